@@ -0,0 +1,237 @@
+package main
+
+import (
+	"time"
+	"errors"
+	"context"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+/******************************
+	BLOCK HANDLERS
+*******************************/
+
+type ReturnBlockedUser struct {
+	UserID uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// blockedBetween reports if a and b can't interact, either having blocked the
+// other.
+func blockedBetween(ctx context.Context, q store.Queries, a, b uuid.UUID) (bool, error) {
+	return q.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{UserID: a, OtherID: b})
+}
+
+// relatedUser checks the user to block or mute is another existing user,
+// writing the error when not.
+func (a *apiConfig) relatedUser(w http.ResponseWriter, r *http.Request, uid, userID uuid.UUID) bool {
+	if userID == uid {
+		respond.Validation(w, r, respond.FieldError{Field: "user_id", Message: "Can't be yourself"})
+		return false
+	}
+	_, err := a.Store.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "User not found")
+		return false
+	} else if somethingError(err, w, r) {
+		return false
+	}
+	return true
+}
+
+// BlockUserHandler blocks the user in the body, ending the follows between
+// the two.
+func (a *apiConfig) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	if !a.relatedUser(w, r, uid, p.UserID) {
+		return
+	}
+
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		_, err := q.BlockUser(r.Context(), database.BlockUserParams{
+			BlockerID: uid,
+			BlockedID: p.UserID,
+		})
+		if err != nil {
+			return err
+		}
+		err = q.UnfollowUser(r.Context(), database.UnfollowUserParams{FollowerID: uid, FolloweeID: p.UserID})
+		if err != nil {
+			return err
+		}
+		return q.UnfollowUser(r.Context(), database.UnfollowUserParams{FollowerID: p.UserID, FolloweeID: uid})
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	blocked, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	err = a.Store.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: uid,
+		BlockedID: blocked,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBlocksHandler lists the users the user blocked, latest first.
+func (a *apiConfig) GetBlocksHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	blocks, err := a.Store.ListBlocks(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	ret := make([]ReturnBlockedUser, 0, len(blocks))
+	for _, b := range blocks {
+		ret = append(ret, ReturnBlockedUser{UserID: b.BlockedID, CreatedAt: b.CreatedAt})
+	}
+	respond.JSON(w, http.StatusOK, ret)
+}
+
+// MuteUserHandler mutes the user in the body, hiding their chirps without
+// stopping them from interacting.
+func (a *apiConfig) MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	if !a.relatedUser(w, r, uid, p.UserID) {
+		return
+	}
+
+	_, err = a.Store.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: uid,
+		MutedID: p.UserID,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) UnmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	muted, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	err = a.Store.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: uid,
+		MutedID: muted,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMutesHandler lists the users the user muted, latest first.
+func (a *apiConfig) GetMutesHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	mutes, err := a.Store.ListMutes(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	ret := make([]ReturnBlockedUser, 0, len(mutes))
+	for _, m := range mutes {
+		ret = append(ret, ReturnBlockedUser{UserID: m.MutedID, CreatedAt: m.CreatedAt})
+	}
+	respond.JSON(w, http.StatusOK, ret)
+}
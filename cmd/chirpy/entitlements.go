@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/entitlements"
+)
+
+// limitsFor returns the entitlements of the user's current plan.
+func (a *apiConfig) limitsFor(ctx context.Context, uid uuid.UUID) (entitlements.Limits, error) {
+	user, err := a.Store.GetUserByID(ctx, uid)
+	if err != nil {
+		return entitlements.Limits{}, err
+	}
+	if !user.IsChirpyRed {
+		return a.Plans.For(false, ""), nil
+	}
+
+	sub, err := a.Store.GetSubscriptionByUser(ctx, uid)
+	if err != nil {
+		return entitlements.Limits{}, err
+	}
+	return a.Plans.For(true, sub.Plan), nil
+}
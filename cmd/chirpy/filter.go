@@ -0,0 +1,437 @@
+package main
+
+import (
+	"io"
+	"time"
+	"errors"
+	"context"
+	"log/slog"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/moderation"
+	"github.com/dubbersthehoser/httpserver/internal/pagination"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
+)
+
+// reloadFilter compiles the rules of the filter file, or the default rules
+// without one, with the rules the admins added and puts them in use. On an
+// error the rules in use are kept.
+func (a *apiConfig) reloadFilter(ctx context.Context) error {
+	a.filterMu.Lock()
+	defer a.filterMu.Unlock()
+
+	rules := moderation.Default
+	if a.FilterFile != "" {
+		loaded, err := moderation.Load(a.FilterFile)
+		if err != nil {
+			return err
+		}
+		rules = loaded
+	}
+
+	added, err := a.Store.ListFilterRules(ctx)
+	if err != nil {
+		return err
+	}
+	all := make([]moderation.Rule, 0, len(rules)+len(added))
+	all = append(all, rules...)
+	for _, r := range added {
+		all = append(all, filterRule(r))
+	}
+
+	f, err := moderation.New(all)
+	if err != nil {
+		return err
+	}
+	a.Filter.Swap(f)
+	return nil
+}
+
+// watchFilter reloads the filter every interval, picking up the changes to
+// the filter file and the rules other instances added.
+func (a *apiConfig) watchFilter(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.reloadFilter(ctx); err != nil {
+			slog.ErrorContext(ctx, "reload content filter", "err", err)
+		}
+	}
+}
+
+func filterRule(r database.FilterRule) moderation.Rule {
+	return moderation.Rule{Kind: r.Kind, Pattern: r.Pattern, Action: r.Action}
+}
+
+// filterChirp runs a chirp body through the content filter. It returns the
+// body with the masked words and if the chirp is held for review, writing the
+// error when the body is rejected.
+func (a *apiConfig) filterChirp(w http.ResponseWriter, r *http.Request, body string) (string, bool, bool) {
+	res := a.Filter.Check(body)
+	if res.Action == moderation.ActionReject {
+		respond.Validation(w, r, respond.FieldError{
+			Field: "body",
+			Message: "Chirp isn't allowed by the content rules",
+		})
+		return "", false, false
+	}
+	return res.Text, res.Action == moderation.ActionHold, true
+}
+
+/******************************
+	HELD CHIRPS HANDLERS
+*******************************/
+
+// pathHeldChirp gets the held chirp of the request path, writing the error
+// when there's none.
+func (a *apiConfig) pathHeldChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	id, err := uuid.Parse(r.PathValue("ChirpID"))
+	if chirpIDError(err, w, r) {
+		return database.Chirp{}, false
+	}
+	chirp, err := a.Store.GetAChirp(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !chirp.Held) {
+		respond.Error(w, r, http.StatusNotFound, "Held chirp not found")
+		return chirp, false
+	} else if somethingError(err, w, r) {
+		return chirp, false
+	}
+	return chirp, true
+}
+
+// logHeldChirp records a moderator's decision on a held chirp in the
+// moderation log.
+func logHeldChirp(r *http.Request, q store.Queries, moderatorID uuid.UUID, action string, chirp database.Chirp, note string) error {
+	_, err := q.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: moderatorID,
+		Action: action,
+		UserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Note: note,
+	})
+	return err
+}
+
+// GetHeldChirpsHandler lists the chirps the content filter held for review,
+// oldest first.
+func (a *apiConfig) GetHeldChirpsHandler(w http.ResponseWriter, r *http.Request) {
+
+	if _, ok := a.moderator(w, r); !ok {
+		return
+	}
+
+	cursor, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	after, afterID := cursor.After()
+	chirps, err := a.Store.ListHeldChirps(r.Context(), database.ListHeldChirpsParams{
+		After: after,
+		AfterID: afterID,
+		MaxRows: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	type response struct {
+		Chirps []ReturnChirp `json:"chirps"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+	// moderators see the images of the chirps too
+	ret, err := a.withMedia(r.Context(), chirps)
+	if somethingError(err, w, r) {
+		return
+	}
+	resp := response{Chirps: ret}
+	// a full page may have more after it
+	if len(chirps) == limit {
+		last := chirps[len(chirps)-1]
+		resp.NextCursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.String()
+	}
+
+	respond.JSON(w, http.StatusOK, resp)
+}
+
+// ApproveChirpHandler publishes a held chirp, as it would have been when it
+// was posted.
+func (a *apiConfig) ApproveChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	uid, ok := a.moderator(w, r)
+	if !ok {
+		return
+	}
+	chirp, ok := a.pathHeldChirp(w, r)
+	if !ok {
+		return
+	}
+
+	var sent []database.Notification
+	err := a.Store.InTx(r.Context(), func(q store.Queries) error {
+		var err error
+		chirp, err = q.ReleaseChirp(r.Context(), chirp.ID)
+		if err != nil {
+			return err
+		}
+		err = webhooks.Enqueue(r.Context(), q, webhooks.EventChirpCreated, chirp)
+		if err != nil {
+			return err
+		}
+		err = notifyMentions(r.Context(), q, &sent, chirp)
+		if err != nil {
+			return err
+		}
+		return logHeldChirp(r, q, uid, actionApproveChirp, chirp, "")
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusConflict, "Chirp is no longer held")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+	a.publishChirpEvent(r, webhooks.EventChirpCreated, chirp.UserID, chirp)
+	a.publishNotifications(r, sent)
+
+	a.respondChirp(w, r, http.StatusOK, chirp)
+}
+
+// RejectChirpHandler deletes a held chirp, the body with the note being
+// optional. The chirp was never published, so nobody is told.
+func (a *apiConfig) RejectChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		Note string `json:"note"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if !errors.Is(err, io.EOF) && decodeError(err, w, r) {
+		return
+	}
+
+	uid, ok := a.moderator(w, r)
+	if !ok {
+		return
+	}
+	chirp, ok := a.pathHeldChirp(w, r)
+	if !ok {
+		return
+	}
+
+	if len(p.Note) > maxModerationNote {
+		respond.Validation(w, r, respond.FieldError{Field: "note", Message: "Note is too long"})
+		return
+	}
+
+	var deleted []database.Media
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		var err error
+		if deleted, err = deleteChirp(r.Context(), q, chirp.ID); err != nil {
+			return err
+		}
+		return logHeldChirp(r, q, uid, actionRejectChirp, chirp, p.Note)
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	a.deleteFiles(r.Context(), deleted)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/******************************
+	FILTER RULES HANDLERS
+*******************************/
+
+// filterRuleParams decodes and checks a filter rule, writing the error when
+// it's invalid.
+func filterRuleParams(w http.ResponseWriter, r *http.Request) (moderation.Rule, bool) {
+	var rule moderation.Rule
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&rule)
+	if decodeError(err, w, r) {
+		return rule, false
+	}
+	switch {
+	case rule.Kind != moderation.KindWord && rule.Kind != moderation.KindRegex:
+		respond.Validation(w, r, respond.FieldError{Field: "kind", Message: "Unknown kind, want word or regex"})
+		return rule, false
+	case rule.Action != moderation.ActionMask && rule.Action != moderation.ActionHold && rule.Action != moderation.ActionReject:
+		respond.Validation(w, r, respond.FieldError{Field: "action", Message: "Unknown action, want mask, hold or reject"})
+		return rule, false
+	}
+	if err := rule.Validate(); err != nil {
+		respond.Validation(w, r, respond.FieldError{Field: "pattern", Message: err.Error()})
+		return rule, false
+	}
+	return rule, true
+}
+
+// pathFilterRuleID parses the filter rule id of the request path, writing the
+// error when it's invalid.
+func pathFilterRuleID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("RuleID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid rule id")
+		return id, false
+	}
+	return id, true
+}
+
+// filterReloadError writes the error of reloading the filter after the rules
+// changed. The change is saved and shows up on the next reload that works.
+func filterReloadError(err error, w http.ResponseWriter, r *http.Request) bool {
+	if err != nil {
+		slog.ErrorContext(r.Context(), "reload content filter", "err", err)
+		respond.Error(w, r, http.StatusInternalServerError, "Rule saved, but the content filter couldn't be reloaded")
+		return true
+	}
+	return false
+}
+
+// AdminGetFilterRulesHandler lists the filter rules the admins added, the
+// ones of the filter file aren't included.
+func (a *apiConfig) AdminGetFilterRulesHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	rules, err := a.Store.ListFilterRules(r.Context())
+	if somethingError(err, w, r) {
+		return
+	}
+	if rules == nil {
+		rules = []database.FilterRule{}
+	}
+	respond.JSON(w, http.StatusOK, rules)
+}
+
+func (a *apiConfig) AdminCreateFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	rule, ok := filterRuleParams(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := a.Store.CreateFilterRule(r.Context(), database.CreateFilterRuleParams{
+		Kind: rule.Kind,
+		Pattern: rule.Pattern,
+		Action: rule.Action,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if filterReloadError(a.reloadFilter(r.Context()), w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, created)
+}
+
+func (a *apiConfig) AdminUpdateFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	id, ok := pathFilterRuleID(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := filterRuleParams(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := a.Store.UpdateFilterRule(r.Context(), database.UpdateFilterRuleParams{
+		ID: id,
+		Kind: rule.Kind,
+		Pattern: rule.Pattern,
+		Action: rule.Action,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "Rule not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+	if filterReloadError(a.reloadFilter(r.Context()), w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, updated)
+}
+
+func (a *apiConfig) AdminRemoveFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	id, ok := pathFilterRuleID(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := a.Store.DeleteFilterRule(r.Context(), id)
+	if somethingError(err, w, r) {
+		return
+	}
+	if n == 0 {
+		respond.Error(w, r, http.StatusNotFound, "Rule not found")
+		return
+	}
+	if filterReloadError(a.reloadFilter(r.Context()), w, r) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminReloadFilterHandler reloads the filter file and the rules, as after
+// editing the file.
+func (a *apiConfig) AdminReloadFilterHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	err := a.reloadFilter(r.Context())
+	if err != nil {
+		respond.Error(w, r, http.StatusUnprocessableEntity, "Content filter not reloaded: " + err.Error())
+		return
+	}
+
+	type response struct {
+		Rules int `json:"rules"`
+	}
+	respond.JSON(w, http.StatusOK, response{Rules: a.Filter.Filter().Len()})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/notifications"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
+)
+
+/******************************
+	FOLLOW HANDLERS
+*******************************/
+
+func (a *apiConfig) FollowUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	followee, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+	if followee == uid {
+		respond.Validation(w, r, respond.FieldError{Field: "user_id", Message: "Can't follow yourself"})
+		return
+	}
+
+	_, err = a.Store.GetUserByID(r.Context(), followee)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+	blocked, err := blockedBetween(r.Context(), a.Store, uid, followee)
+	if somethingError(err, w, r) {
+		return
+	}
+	if blocked {
+		respond.Error(w, r, http.StatusForbidden, "Can't follow a user you blocked or who blocked you")
+		return
+	}
+
+	// a new follow notifies the user and the webhooks, following again
+	// doesn't
+	var sent []database.Notification
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		followed, err := q.FollowUser(r.Context(), database.FollowUserParams{
+			FollowerID: uid,
+			FolloweeID: followee,
+		})
+		if err != nil || followed == 0 {
+			return err
+		}
+		err = webhooks.Enqueue(r.Context(), q, webhooks.EventUserFollowed, map[string]uuid.UUID{
+			"follower_id": uid,
+			"user_id": followee,
+		})
+		if err != nil {
+			return err
+		}
+		return notify(r.Context(), q, &sent, database.CreateNotificationParams{
+			UserID: followee,
+			Type: notifications.TypeFollowed,
+			ActorID: uuid.NullUUID{UUID: uid, Valid: true},
+		})
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	a.publishNotifications(r, sent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	followee, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	err = a.Store.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: uid,
+		FolloweeID: followee,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFollowingHandler lists the ids of the users a user follows, latest
+// follow first.
+func (a *apiConfig) GetFollowingHandler(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	ids, err := a.Store.GetFolloweeIDs(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+	if ids == nil {
+		ids = []uuid.UUID{}
+	}
+
+	respond.JSON(w, http.StatusOK, ids)
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
-	"log"
+	"io"
 	"fmt"
-	"strings"
+	"log/slog"
+	"strconv"
 	"sort"
+	"strings"
 	"time"
 	"errors"
 	"net/http"
@@ -15,103 +17,193 @@ import (
 
 	"github.com/dubbersthehoser/httpserver/internal/database"
 	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/chirptext"
+	"github.com/dubbersthehoser/httpserver/internal/notifications"
+	"github.com/dubbersthehoser/httpserver/internal/pagination"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+	"github.com/dubbersthehoser/httpserver/internal/subscription"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
 )
 
-func somethingError(err error, w http.ResponseWriter) bool {
+func somethingError(err error, w http.ResponseWriter, r *http.Request) bool {
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_, err = w.Write([]byte(`{"error":"Something went wrong"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Println(err)
+		respond.InternalError(w, r, err)
 		return true
 	}
 	return false
 }
 
-func authError(err error, w http.ResponseWriter) bool {
+func authError(err error, w http.ResponseWriter, r *http.Request) bool {
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err := w.Write([]byte(`{"error":"Unauthorized"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+		slog.InfoContext(r.Context(), "unauthorized", "err", err)
+		respond.Error(w, r, http.StatusUnauthorized, "Missing or invalid token")
 		return true
 	}
 	return false
 }
 
-func fatalError(err error, w http.ResponseWriter) bool {
+// viewerID is the user of the request's bearer token, uuid.Nil for a request
+// without one.
+func (a *apiConfig) viewerID(r *http.Request) (uuid.UUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, nil
+	}
+	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_, err = w.Write([]byte(`{"error":"Ouch!! Going down )-:"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Fatal(err)
+		return uuid.Nil, err
+	}
+	return auth.ValidateJWT(token, a.JWTSecret)
+}
+
+func decodeError(err error, w http.ResponseWriter, r *http.Request) bool {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respond.Error(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body over %d bytes", tooLarge.Limit))
+		return true
+	} else if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid request body")
 		return true
 	}
 	return false
 }
 
+// pageQuery reads the cursor and limit of a page from the query, writing a
+// 400 and returning false when they're invalid. The limit is 20 by default.
+func pageQuery(w http.ResponseWriter, r *http.Request) (pagination.Cursor, int, bool) {
+	cursor, err := pagination.ParseCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		respond.Validation(w, r, respond.FieldError{Field: "cursor", Message: "Invalid cursor"})
+		return cursor, 0, false
+	}
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 100 {
+			respond.Validation(w, r, respond.FieldError{Field: "limit", Message: "Must be a number from 1 to 100"})
+			return cursor, 0, false
+		}
+		limit = n
+	}
+	return cursor, limit, true
+}
+
 /****************************
 	MISC HANDLERS
 *****************************/
 
 func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
-	r.Header.Add("Content-Type",  "text/plain; charset=utf-8")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte("OK"))
-	if err != nil {
-		log.Fatal(err)
-	}
+	_, _ = w.Write([]byte("OK"))
 }
 
 func (a *apiConfig) PolkaHandler(w http.ResponseWriter, r *http.Request) {
 
-	apikey, err := auth.GetAPIKey(r.Header)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, polkaMaxBytes))
+	if decodeError(err, w, r) {
 		return
 	}
 
-	if a.PolkaKey != apikey {
-		w.WriteHeader(http.StatusUnauthorized)
+	// Verify Signature
+	err = auth.ValidateWebhookSignature(r.Header, body, a.PolkaKey, polkaTolerance)
+	if err != nil {
+		slog.WarnContext(r.Context(), "polka webhook", "err", err)
+		respond.Error(w, r, http.StatusUnauthorized, "Invalid webhook signature")
 		return
 	}
 
-
 	type params struct {
+		ID string `json:"id"`
 		Event string `json:"event"`
 		Data struct {
 			UserID string `json:"user_id"`
+			Plan string `json:"plan"`
 		} `json:"data"`
 	}
 
 	var p params
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&p)
-	if somethingError(err, w) {
-		log.Printf("Polka: %s", err)
-	}
-
-	if p.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
+	err = json.Unmarshal(body, &p)
+	if err != nil || p.ID == "" {
+		slog.WarnContext(r.Context(), "polka webhook: invalid event", "err", err)
+		respond.Validation(w, r, respond.FieldError{Field: "id", Message: "Event id is required"})
 		return
 	}
 
-	uid, err := uuid.Parse(p.Data.UserID)
-	if somethingError(err, w) {
-		log.Printf("Polka: %s", err)
-		return
+	var uid uuid.UUID
+	if subscription.Known(p.Event) {
+		uid, err = uuid.Parse(p.Data.UserID)
+		if err != nil {
+			respond.Validation(w, r, respond.FieldError{Field: "data.user_id", Message: "Invalid user id"})
+			return
+		}
 	}
 
-	err = a.DBQ.SetUserToRed(r.Context(), uid)
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+	duplicate := false
+	var sent []database.Notification
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		// Record Event, redeliveries are acknowledged and not applied again
+		_, err := q.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+			ID: p.ID,
+			Source: polkaSource,
+			Event: p.Event,
+			Payload: body,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			duplicate = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		status := "ignored"
+		if subscription.Known(p.Event) {
+			// a missing user is sql.ErrNoRows, rolling back the event
+			_, err = q.GetUserByID(r.Context(), uid)
+			if err != nil {
+				return err
+			}
+
+			err = applySubscriptionEvent(r.Context(), q, uid, p.Event, p.Data.Plan)
+			if err == nil {
+				status = "processed"
+			} else if !errors.Is(err, subscription.ErrNoSubscription) {
+				return err
+			}
+
+			if status == "processed" && p.Event == subscription.EventUpgraded {
+				err = webhooks.Enqueue(r.Context(), q, webhooks.EventUserUpgraded, map[string]string{
+					"user_id": uid.String(),
+					"plan": p.Data.Plan,
+				})
+				if err != nil {
+					return err
+				}
+				err = notify(r.Context(), q, &sent, database.CreateNotificationParams{
+					UserID: uid,
+					Type: notifications.TypeRedUpgrade,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return q.MarkWebhookEvent(r.Context(), database.MarkWebhookEventParams{
+			ID: p.ID,
+			Status: status,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "User not found")
 		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+	if duplicate {
+		slog.InfoContext(r.Context(), "polka webhook: event already received", "event_id", p.ID)
 	}
+	a.publishNotifications(r, sent)
 	w.WriteHeader(http.StatusNoContent)
 
 }
@@ -121,14 +213,11 @@ func (a *apiConfig) PolkaHandler(w http.ResponseWriter, r *http.Request) {
 *****************************/
 
 func (a *apiConfig) AdminHandler(w http.ResponseWriter, r *http.Request) {
-	r.Header.Add("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	if a.Platform != "dev" {
 		w.WriteHeader(http.StatusForbidden)
-		_, err := w.Write([]byte("<html><body><h1>Forbidden</h1></body></html>"))
-		if err != nil {
-			log.Fatal(err)
-		}
+		_, _ = w.Write([]byte("<html><body><h1>Forbidden</h1></body></html>"))
 		return
 	}
 
@@ -142,38 +231,64 @@ func (a *apiConfig) AdminHandler(w http.ResponseWriter, r *http.Request) {
   </body>
 </html>
 `
-	_, err := w.Write([]byte(fmt.Sprintf(body, a.fileserverHits.Load())))
-	if err != nil {
-		log.Fatal(err)
-	}
+	_, _ = w.Write([]byte(fmt.Sprintf(body, a.fileserverHits.Load())))
 	return
 }
 
 func (a *apiConfig) AdminResetHandler(w http.ResponseWriter, r *http.Request) {
-	r.Header.Add("Content-Type", "text/plain; charset=utf-8")
 	var err error
 	if a.Platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
-		_, err = w.Write([]byte("Metrics and Database Reset: Unsuccsessful: Forbidden"))
-		if err != nil {
-			log.Fatal(err)
-		}
+		respond.Error(w, r, http.StatusForbidden, "Reset is only allowed on the dev platform")
 		return
 	}
 
 	_ = a.fileserverHits.Swap(0)
 
-	err = a.DBQ.DeleteAllUsers(r.Context())
-	if err != nil {
-		log.Fatal(err)
+	// the files of the media go once their rows are gone
+	deleted, err := a.Store.ListAllMedia(r.Context())
+	if somethingError(err, w, r) {
+		return
+	}
+	err = a.Store.DeleteAllUsers(r.Context())
+	if somethingError(err, w, r) {
+		return
 	}
+	a.deleteFiles(r.Context(), deleted)
 
-	r.Header.Add("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte("Metrics and Database Reset: Succsessful"))
-	if err != nil {
-		log.Fatal(err)
+	_, _ = w.Write([]byte("Metrics and Database Reset: Succsessful"))
+}
+
+
+func (a *apiConfig) AdminWebhookEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if a.Platform != "dev" {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform")
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			respond.Validation(w, r, respond.FieldError{Field: "limit", Message: "Must be a positive number"})
+			return
+		}
+		limit = n
 	}
+
+	events, err := a.Store.ListWebhookEvents(r.Context(), database.ListWebhookEventsParams{
+		Source: polkaSource,
+		Limit: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if events == nil {
+		events = []database.WebhookEvent{}
+	}
+
+	respond.JSON(w, http.StatusOK, events)
 }
 
 
@@ -186,29 +301,68 @@ type ReturnToUser struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Email string `json:"email"`
+	Handle string `json:"handle"`
 	IsChirpyRed bool `json:"is_chirpy_red"`
 }
 
+// validateCredentials returns the field errors of an email and password.
+func validateCredentials(email, password string) []respond.FieldError {
+	var errs []respond.FieldError
+	if email == "" {
+		errs = append(errs, respond.FieldError{Field: "email", Message: "Email is required"})
+	}
+	if password == "" {
+		errs = append(errs, respond.FieldError{Field: "password", Message: "Password is required"})
+	}
+	return errs
+}
+
 
 func (a *apiConfig) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 	// POST /api/users
 	type params struct { 
 		Email string `json:"email"`
 		Password string `json:"password"`
+		Handle string `json:"handle"`
 	}
 	
 	p := params{}
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&p)
-	if somethingError(err, w) {
-		log.Printf("unable to decode: %s", r.Body)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	handle := strings.ToLower(p.Handle)
+	errs := validateCredentials(p.Email, p.Password)
+	if handle != "" {
+		errs = append(errs, validateHandle(handle)...)
+	}
+	if errs != nil {
+		respond.Validation(w, r, errs...)
 		return
 	}
 
+	// a chosen handle must be free, one from the email is made free
+	if handle != "" {
+		taken, err := handleTaken(r.Context(), a.Store, uuid.Nil, handle)
+		if somethingError(err, w, r) {
+			return
+		}
+		if taken {
+			respond.Error(w, r, http.StatusConflict, "Handle is taken")
+			return
+		}
+	} else {
+		handle, err = freeHandle(r.Context(), a.Store, emailHandle(p.Email))
+		if somethingError(err, w, r) {
+			return
+		}
+	}
+
 	// hash password
 	passhash, err := auth.HashPassword(p.Password)
-	if somethingError(err, w) {
-		log.Printf("unable to hash password: %s", p.Password)
+	if somethingError(err, w, r) {
 		return
 	}
 
@@ -216,12 +370,11 @@ func (a *apiConfig) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 	qParams := database.CreateUserParams{
 		Email: p.Email,
 		HashedPassword: passhash,
-
+		Handle: handle,
 	}
 
-	user, err := a.DBQ.CreateUser(r.Context(), qParams)
-	if somethingError(err, w) {
-		log.Printf("unable to create user: %#v", err)
+	user, err := a.Store.CreateUser(r.Context(), qParams)
+	if somethingError(err, w, r) {
 		return
 	}
 
@@ -230,20 +383,11 @@ func (a *apiConfig) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		Handle: user.Handle,
 		IsChirpyRed: user.IsChirpyRed,
 	}
 
-	jdata, err := json.Marshal(&ruser)
-	if somethingError(err, w) {
-		log.Printf("unable to marshal user json: %#v", ruser)
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	_, err = w.Write(jdata)
-	if err != nil {
-		log.Fatal(err)
-	}
+	respond.JSON(w, http.StatusCreated, ruser)
 }
 
 func (a *apiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -252,43 +396,52 @@ func (a *apiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	type params struct{
 		Password string `json:"password"`
 		Email string `json:"email"`
+		Handle string `json:"handle"`
 	}
 
 	p := params{}
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&p)
-	if somethingError(err, w) {
-		log.Printf("unable to decode: %s", r.Body)
+	if decodeError(err, w, r) {
 		return
 	}
 
 	// Get JWT Bearer
 	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Invalid Token in Header: %s", r.Header.Get("Authorization"))
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err := w.Write([]byte(`{"error":"Unauthorized"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+	if authError(err, w, r) {
 		return
 	}
 
 	// Authorize User
 	uid, err := auth.ValidateJWT(token, a.JWTSecret)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err := w.Write([]byte(`{"error":"Unauthorized"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+	if authError(err, w, r) {
 		return
 	}
 
+	// the handle is kept unless one is given
+	handle := strings.ToLower(p.Handle)
+	errs := validateCredentials(p.Email, p.Password)
+	if handle != "" {
+		errs = append(errs, validateHandle(handle)...)
+	}
+	if errs != nil {
+		respond.Validation(w, r, errs...)
+		return
+	}
+	if handle != "" {
+		taken, err := handleTaken(r.Context(), a.Store, uid, handle)
+		if somethingError(err, w, r) {
+			return
+		}
+		if taken {
+			respond.Error(w, r, http.StatusConflict, "Handle is taken")
+			return
+		}
+	}
+
 	// Hash Password
 	passhash, err := auth.HashPassword(p.Password)
-	if somethingError(err, w) {
-		log.Printf("unable to hash password: %s", p.Password)
+	if somethingError(err, w, r) {
 		return
 	}
 
@@ -298,9 +451,20 @@ func (a *apiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		HashedPassword: passhash,
 		Email: p.Email,
 	}
-	user, err := a.DBQ.UpdateUserEmailAndPassword(r.Context(), qParams)
-	if somethingError(err, w) {
-		log.Printf("Faild to update user: %#v", qParams)
+	var user database.UpdateUserEmailAndPasswordRow
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		if handle != "" {
+			err := q.UpdateUserHandle(r.Context(), database.UpdateUserHandleParams{ID: uid, Handle: handle})
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		user, err = q.UpdateUserEmailAndPassword(r.Context(), qParams)
+		return err
+	})
+	if somethingError(err, w, r) {
+		return
 	}
 	
 	// Return Updated User
@@ -309,20 +473,11 @@ func (a *apiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		Handle: user.Handle,
 		IsChirpyRed: user.IsChirpyRed,
 	}
 
-	jdata, err := json.Marshal(&ruser)
-	if somethingError(err, w) {
-		log.Printf("unable to marshal user json: %#v", ruser)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(jdata)
-	if err != nil {
-		log.Fatal(err)
-	}
+	respond.JSON(w, http.StatusOK, ruser)
 }
 
 
@@ -340,56 +495,51 @@ func (a *apiConfig) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 	p := params{}
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&p)
-	if somethingError(err, w) {
-		log.Printf("unable to decode: %s", r.Body)
+	if decodeError(err, w, r) {
 		return
 	}
 
 	// Get user from DB
-	user, err := a.DBQ.GetUserByEmailWithPassword(r.Context(), p.Email)
+	user, err := a.Store.GetUserByEmailWithPassword(r.Context(), p.Email)
 	if errors.Is(err, sql.ErrNoRows) {
-		w.WriteHeader(http.StatusNotFound)
-		_, err = w.Write([]byte(`{"error": "User not found"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+		a.Metrics.FailedLogins.Inc()
+		respond.Error(w, r, http.StatusNotFound, "User not found")
 		return
-	} else if fatalError(err, w) {
+	} else if somethingError(err, w, r) {
 		return
 	}
 
 	// Check Password
 	if err := auth.CheckPasswordHash(user.HashedPassword, p.Password); err != nil {
-		log.Printf("login: %s != %s", user.HashedPassword, p.Password)
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err = w.Write([]byte(`{"error": "Invalid password"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+		slog.InfoContext(r.Context(), "login: invalid password", "user_id", user.ID)
+		a.Metrics.FailedLogins.Inc()
+		respond.Error(w, r, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+	if a.suspendedError(w, r, user.ID) {
 		return
 	}
 
 	// Create JWT
-	jwtExpires := time.Hour
-	token, err := auth.MakeJWT(user.ID, a.JWTSecret, jwtExpires)
-	if somethingError(err, w) {
+	token, err := auth.MakeJWT(user.ID, a.JWTSecret, a.AccessTTL)
+	if somethingError(err, w, r) {
 		return
 	}
 
 	// Create Refresh Token
 	refreshToken, err := auth.MakeRefreshToken()
-	if err != nil {
-		log.Panic(err)
+	if somethingError(err, w, r) {
+		return
 	}
-	refreshExpires := time.Now().Add((time.Hour * 24) * 60)
+	refreshExpires := time.Now().Add(a.RefreshTTL)
 
 	qParams := database.CreateRefreshTokenParams{
 		Token: refreshToken,
 		ExpiresAt: refreshExpires,
 		UserID: user.ID,
 	}
-	_, err = a.DBQ.CreateRefreshToken(r.Context(), qParams)
-	if somethingError(err, w) {
+	_, err = a.Store.CreateRefreshToken(r.Context(), qParams)
+	if somethingError(err, w, r) {
 		return
 	}
 
@@ -398,6 +548,7 @@ func (a *apiConfig) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time `json:"updated_at"`
 		Email string `json:"email"`
+		Handle string `json:"handle"`
 		Token string `json:"token"`
 		RefreshToken string `json:"refresh_token"`
 		IsChirpyRed bool `json:"is_chirpy_red"`
@@ -408,86 +559,61 @@ func (a *apiConfig) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		Handle: user.Handle,
 		Token: token,
 		RefreshToken: refreshToken,
 		IsChirpyRed: user.IsChirpyRed,
 	}
 
-	jData, err := json.Marshal(&ruser)
-	if somethingError(err, w) {
-		log.Printf("unable to json.Marshal(user): %#v", ruser)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(jData)
-	if err != nil {
-		log.Fatal(err)
-	}
+	a.Metrics.Logins.Inc()
+	respond.JSON(w, http.StatusOK, ruser)
 }
 
 func (a *apiConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
-	if somethingError(err, w) {
+	if authError(err, w, r) {
 		return
 	}
 
-	tok, err := a.DBQ.GetRefreshToken(r.Context(), refreshToken)
+	tok, err := a.Store.GetRefreshToken(r.Context(), refreshToken)
 	if errors.Is(err, sql.ErrNoRows) {
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err := w.Write([]byte(`{"error":"Unauthorized"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+		respond.Error(w, r, http.StatusUnauthorized, "Unknown refresh token")
 		return
-	} else if somethingError(err, w) {
+	} else if somethingError(err, w, r) {
 		return
 	}
 
 	currTime := time.Now()
 	if !currTime.Before(tok.ExpiresAt) {
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err := w.Write([]byte(`{"error":"Unauthorized"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+		respond.Error(w, r, http.StatusUnauthorized, "Refresh token expired")
 		return
 	}
 
 	if tok.RevokedAt.Valid {
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err := w.Write([]byte(`{"error":"Unauthorized"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+		respond.Error(w, r, http.StatusUnauthorized, "Refresh token revoked")
+		return
+	}
+	if a.suspendedError(w, r, tok.UserID) {
 		return
 	}
 
 	// Create New JWT
-	jwtExpires := time.Hour
-	token, err := auth.MakeJWT(tok.UserID, a.JWTSecret, jwtExpires)
-	if somethingError(err, w) {
+	token, err := auth.MakeJWT(tok.UserID, a.JWTSecret, a.AccessTTL)
+	if somethingError(err, w, r) {
 		return
 	}
 
-	r.Header.Add("Content-Type", "application/json; charset=utf-8")
-	ret := fmt.Sprintf(`{"token":"%s"}`, token)
-
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte(ret))
-	if err != nil {
-		log.Fatal(err)
-	}
+	respond.JSON(w, http.StatusOK, map[string]string{"token": token})
 }
 
 func (a *apiConfig) RevokeToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
-	if somethingError(err, w) {
+	if authError(err, w, r) {
 		return
 	}
 
-	err = a.DBQ.RevokeToken(r.Context(), refreshToken)
-	if somethingError(err, w) {
+	err = a.Store.RevokeToken(r.Context(), refreshToken)
+	if somethingError(err, w, r) {
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -498,163 +624,228 @@ func (a *apiConfig) RevokeToken(w http.ResponseWriter, r *http.Request) {
 	CHRIPS HANDLERS
 *******************************/
 
+func chirpTooLong(w http.ResponseWriter, r *http.Request, max int) {
+	respond.Validation(w, r, respond.FieldError{
+		Field: "body",
+		Message: fmt.Sprintf("Chirp is too long, at most %d characters", max),
+	})
+}
+
+// chirpBody normalizes the body of a new or edited chirp and checks its
+// length, in characters as drawn with links counting as one weight, writing
+// the error when it's empty or too long.
+func chirpBody(w http.ResponseWriter, r *http.Request, body string, max int) (string, bool) {
+	body = chirptext.Normalize(body)
+	if body == "" {
+		respond.Validation(w, r, respond.FieldError{
+			Field: "body",
+			Message: "Chirp is empty",
+		})
+		return "", false
+	}
+	if chirptext.Length(body) > max {
+		chirpTooLong(w, r, max)
+		return "", false
+	}
+	return body, true
+}
+
+// chirpIDError writes a 400 for an invalid chirp id in the path.
+func chirpIDError(err error, w http.ResponseWriter, r *http.Request) bool {
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid chirp id")
+		return true
+	}
+	return false
+}
+
 func (a *apiConfig) CreateChirpHandler(w http.ResponseWriter, r *http.Request) {
 
 	type params struct {
 		Body string `json:"body"`
 		UserID string `json:"user_id"`
+		MediaIDs []uuid.UUID `json:"media_ids"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	p := params{}
 	err := decoder.Decode(&p)
-	if somethingError(err, w) {
+	if decodeError(err, w, r) {
 		return
 	}
 
 	// Get JWT Token From Header
 	token, err := auth.GetBearerToken(r.Header)
-	if somethingError(err, w) {
+	if authError(err, w, r) {
 		return
 	}
 
 	// Validate JWT
 	uid, err := auth.ValidateJWT(token, a.JWTSecret)
-	if err != nil {
-		log.Printf("%s: token=%s\n\theader=", err, token, r.Header.Get("Authorization"))
-		w.WriteHeader(http.StatusUnauthorized)
-		_, err = w.Write([]byte(`{"error":"Invalid Token"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+	if authError(err, w, r) {
+		return
+	}
+
+	limits, err := a.limitsFor(r.Context(), uid)
+	if somethingError(err, w, r) {
 		return
 	}
 
 	// Check The Size of Chirp
-	if len(p.Body) > ChirpSize {
-		w.WriteHeader(http.StatusBadRequest)
-		_, err = w.Write([]byte(`{"error":"Chirp is too long"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+	body, ok := chirpBody(w, r, p.Body, limits.MaxChirpLength)
+	if !ok {
+		return
+	}
+	if !validMediaIDs(w, r, p.MediaIDs) {
 		return
 	}
 
-	// Senser Chirp
-	words := strings.Split(p.Body, " ")
-	for i, word := range words {
-		switch strings.ToLower(word) {
-			case "kerfuffle", "sharbert", "fornax":
-				words[i] = "****"
-		}
+	// Check Chirps Made In The Last Hour
+	count, err := a.Store.CountChirpsByUserSince(r.Context(), database.CountChirpsByUserSinceParams{
+		UserID: uid,
+		CreatedAt: time.Now().Add(-time.Hour),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if count >= int64(limits.ChirpsPerHour) {
+		respond.WriteProblem(w, r, respond.Problem{
+			Type: respond.TypeRateLimited,
+			Status: http.StatusTooManyRequests,
+			Detail: fmt.Sprintf("At most %d chirps an hour, try again later", limits.ChirpsPerHour),
+		})
+		return
+	}
+
+	body, held, ok := a.filterChirp(w, r, body)
+	if !ok {
+		return
 	}
-	p.Body = strings.Join(words, " ")
 
 	// Create Chirp
-	qParams := database.CreateChirpParams{
-		UserID: uid,
-		Body: p.Body,
+	var chirp database.Chirp
+	var sent []database.Notification
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		qParams := database.CreateChirpParams{
+			UserID: uid,
+			Body: body,
+			Held: held,
+		}
+		chirp, err = q.CreateChirp(r.Context(), qParams)
+		if err != nil {
+			return err
+		}
+		err = attachMedia(r.Context(), q, uid, chirp, p.MediaIDs)
+		if err != nil {
+			return err
+		}
+		// a held chirp is published once a moderator approves it
+		if held {
+			return nil
+		}
+		err = webhooks.Enqueue(r.Context(), q, webhooks.EventChirpCreated, chirp)
+		if err != nil {
+			return err
+		}
+		return notifyMentions(r.Context(), q, &sent, chirp)
+	})
+	if errors.Is(err, errMediaTaken) {
+		respond.Validation(w, r, respond.FieldError{Field: "media_ids", Message: "Media not found or already attached"})
+		return
+	} else if somethingError(err, w, r) {
+		return
 	}
-	chirp, err := a.DBQ.CreateChirp(r.Context(), qParams)
-	if err != nil {
-		log.Fatal(err)
+	a.Metrics.ChirpsCreated.Inc()
+	if !held {
+		a.publishChirpEvent(r, webhooks.EventChirpCreated, uid, chirp)
+		a.publishNotifications(r, sent)
 	}
 
 	// Return to Client
-	data, _ :=  json.Marshal(&chirp)
-	w.WriteHeader(http.StatusCreated)
-	_, err = w.Write(data)
-	if err != nil {
-		log.Fatal(err)
-	}
+	a.respondChirp(w, r, http.StatusCreated, chirp)
 }
 
 func (a *apiConfig) GetAChirpHandler(w http.ResponseWriter, r *http.Request) {
 	
 	chirpID := r.PathValue("ChirpID")
 
-	log.Println(chirpID)
-
 	chirpUUID, err := uuid.Parse(chirpID)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		_, err = w.Write([]byte(`{"error": "Invalid chirp id"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+	if chirpIDError(err, w, r) {
 		return
 	}
 
-
-	chirp, err := a.DBQ.GetAChirp(r.Context(), chirpUUID)
-	if errors.Is(err, sql.ErrNoRows) {
-		w.WriteHeader(http.StatusNotFound)
-		_, err = w.Write([]byte(`{"error": "Chirp id not found"}`))
-		if err != nil {
-			log.Fatal(err)
-		}
+	viewer, err := a.viewerID(r)
+	if authError(err, w, r) {
 		return
-	} else if err != nil {
-		log.Fatal(err)
 	}
 
-	jData, err := json.Marshal(&chirp)
-	if err != nil {
-		log.Fatal(err)
+	// a chirp the viewer wouldn't see in the listings is not found
+	chirp, err := a.Store.GetVisibleChirp(r.Context(), database.GetVisibleChirpParams{
+		ViewerID: viewer,
+		ID: chirpUUID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "Chirp id not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(jData)
-	if err != nil {
-		log.Fatal(err)
-	}
+	a.respondChirp(w, r, http.StatusOK, chirp)
 }
 
 func (a *apiConfig) RemoveChirpHandler(w http.ResponseWriter, r *http.Request) {
 	
 	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		_, _ = w.Write([]byte("What Token?"))
-		log.Printf("remove chirp: %s", err)
+	if authError(err, w, r) {
 		return
 	}
 
 	uid, err := auth.ValidateJWT(token, a.JWTSecret)
-	if err != nil {
-		w.WriteHeader(http.StatusForbidden)
-		log.Printf("remove chirp: %s", err)
+	if authError(err, w, r) {
 		return
 	}
 
 	chirpID := r.PathValue("ChirpID")
 
 	id, err := uuid.Parse(chirpID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("remove chirp: %s", err)
+	if chirpIDError(err, w, r) {
 		return
 	}
 
-	chrip, err := a.DBQ.GetAChirp(r.Context(), id)
+	chrip, err := a.Store.GetAChirp(r.Context(), id)
 	if errors.Is(err, sql.ErrNoRows) {
-		w.WriteHeader(http.StatusNotFound)
-		log.Printf("remove chirp: %s", err)
+		respond.Error(w, r, http.StatusNotFound, "Chirp id not found")
+		return
+	} else if somethingError(err, w, r) {
 		return
 	}
 
 	if chrip.UserID.String() != uid.String() {
-		w.WriteHeader(http.StatusForbidden)
-		log.Printf("remove chirp: %s != %s", chrip.UserID, uid)
+		slog.InfoContext(r.Context(), "remove chirp: not the author", "chirp_id", chrip.ID, "user_id", uid)
+		respond.Error(w, r, http.StatusForbidden, "Only the author can delete a chirp")
 		return
 	}
 
-	err = a.DBQ.DeleteChirp(r.Context(), id)
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		log.Printf("remove chirp: %s", err)
+	var deleted []database.Media
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		var err error
+		if deleted, err = deleteChirp(r.Context(), q, id); err != nil {
+			return err
+		}
+		return webhooks.Enqueue(r.Context(), q, webhooks.EventChirpDeleted, map[string]uuid.UUID{
+			"id": chrip.ID,
+			"user_id": chrip.UserID,
+		})
+	})
+	if somethingError(err, w, r) {
 		return
 	}
+	a.deleteFiles(r.Context(), deleted)
+	a.publishChirpEvent(r, webhooks.EventChirpDeleted, chrip.UserID, map[string]uuid.UUID{
+		"id": chrip.ID,
+		"user_id": chrip.UserID,
+	})
 
 	w.WriteHeader(http.StatusNoContent)
 	return
@@ -663,27 +854,30 @@ func (a *apiConfig) RemoveChirpHandler(w http.ResponseWriter, r *http.Request) {
 
 func (a *apiConfig) GetAllChirpsHandler(w http.ResponseWriter, r *http.Request) {
 
+	// signed in users don't see the users they blocked or muted
+	viewer, err := a.viewerID(r)
+	if authError(err, w, r) {
+		return
+	}
+
 	authorID := r.URL.Query().Get("author_id")
 	var chirps []database.Chirp
-	var err error
 	if authorID == "" {
-		chirps, err = a.DBQ.GetAllChirps(r.Context())
-		if somethingError(err, w) {
-			log.Printf("GetAllChirps: %s", err)
+		chirps, err = a.Store.GetAllChirps(r.Context(), viewer)
+		if somethingError(err, w, r) {
 			return
 		}
 	} else {
 		uid, err := uuid.Parse(authorID)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			_, err = w.Write([]byte(`"error":"invalid author id"`))
-			if err != nil {
-				log.Fatal(err)
-			}
+			respond.Validation(w, r, respond.FieldError{Field: "author_id", Message: "Invalid author id"})
+			return
 		}
-		chirps, err = a.DBQ.GetAllChirpsByUser(r.Context(), uid)
-		if somethingError(err, w) {
-			log.Printf("GetAllChirps: %s", err)
+		chirps, err = a.Store.GetAllChirpsByUser(r.Context(), database.GetAllChirpsByUserParams{
+			UserID: uid,
+			ViewerID: viewer,
+		})
+		if somethingError(err, w, r) {
 			return
 		}
 	}
@@ -699,13 +893,202 @@ func (a *apiConfig) GetAllChirpsHandler(w http.ResponseWriter, r *http.Request)
 		)
 	}
 
-	jData, err := json.Marshal(&chirps)
-	if err != nil {
-		log.Fatal(err)
+	a.respondChirps(w, r, chirps)
+}
+
+func (a *apiConfig) EditChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		Body string `json:"body"`
 	}
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(jData)
+
+	p := params{}
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("ChirpID"))
+	if chirpIDError(err, w, r) {
+		return
+	}
+
+	chirp, err := a.Store.GetAChirp(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "Chirp id not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+
+	if chirp.UserID != uid {
+		respond.Error(w, r, http.StatusForbidden, "Only the author can edit a chirp")
+		return
+	}
+
+	limits, err := a.limitsFor(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	if !limits.CanEdit(chirp.CreatedAt, time.Now()) {
+		respond.Error(w, r, http.StatusForbidden, "Chirp can no longer be edited")
+		return
+	}
+
+	body, ok := chirpBody(w, r, p.Body, limits.MaxChirpLength)
+	if !ok {
+		return
+	}
+
+	body, held, ok := a.filterChirp(w, r, body)
+	if !ok {
+		return
+	}
+
+	// a held chirp stays held until a moderator looks at it
+	chirp, err = a.Store.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID: id,
+		Body: body,
+		Held: held || chirp.Held,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	a.respondChirp(w, r, http.StatusOK, chirp)
+}
+
+func (a *apiConfig) PinChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("ChirpID"))
+	if chirpIDError(err, w, r) {
+		return
+	}
+
+	chirp, err := a.Store.GetAChirp(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "Chirp id not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+
+	if chirp.UserID != uid {
+		respond.Error(w, r, http.StatusForbidden, "Only the author can pin a chirp")
+		return
+	}
+	if chirp.Held {
+		respond.Error(w, r, http.StatusForbidden, "A held chirp can't be pinned")
+		return
+	}
+
+	limits, err := a.limitsFor(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	// the pins are counted and added with the user locked, so that two pins
+	// at once can't both pass the limit
+	var atLimit bool
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		if err := q.LockUser(r.Context(), uid); err != nil {
+			return err
+		}
+		// pinning again changes nothing, even at the limit
+		already, err := q.IsChirpPinned(r.Context(), database.IsChirpPinnedParams{
+			UserID: uid,
+			ChirpID: id,
+		})
+		if err != nil || already {
+			return err
+		}
+		pinned, err := q.CountPinnedChirps(r.Context(), uid)
+		if err != nil {
+			return err
+		}
+		if pinned >= int64(limits.MaxPinnedChirps) {
+			atLimit = true
+			return nil
+		}
+		return q.PinChirp(r.Context(), database.PinChirpParams{
+			UserID: uid,
+			ChirpID: id,
+		})
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if atLimit {
+		respond.Error(w, r, http.StatusForbidden, fmt.Sprintf("At most %d pinned chirps", limits.MaxPinnedChirps))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) UnpinChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("ChirpID"))
+	if chirpIDError(err, w, r) {
+		return
+	}
+
+	err = a.Store.UnpinChirp(r.Context(), database.UnpinChirpParams{
+		UserID: uid,
+		ChirpID: id,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) GetPinnedChirpsHandler(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := uuid.Parse(r.PathValue("UserID"))
 	if err != nil {
-		log.Fatal(err)
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	viewer, err := a.viewerID(r)
+	if authError(err, w, r) {
+		return
+	}
+
+	chirps, err := a.Store.GetPinnedChirpsByUser(r.Context(), database.GetPinnedChirpsByUserParams{
+		UserID: uid,
+		ViewerID: viewer,
+	})
+	if somethingError(err, w, r) {
+		return
 	}
+	a.respondChirps(w, r, chirps)
 }
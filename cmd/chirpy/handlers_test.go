@@ -0,0 +1,1620 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/config"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/entitlements"
+	"github.com/dubbersthehoser/httpserver/internal/logging"
+	"github.com/dubbersthehoser/httpserver/internal/media"
+	"github.com/dubbersthehoser/httpserver/internal/metrics"
+	"github.com/dubbersthehoser/httpserver/internal/moderation"
+	"github.com/dubbersthehoser/httpserver/internal/ratelimit"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+	"github.com/dubbersthehoser/httpserver/internal/stream"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
+)
+
+const (
+	testJWTSecret = "test-jwt-secret"
+	testPolkaKey  = "test-polka-key"
+)
+
+type testServer struct {
+	t     *testing.T
+	srv   *httptest.Server
+	conf  *apiConfig
+	store *store.Memory
+}
+
+// newTestServer serves every route over an in-memory store. The free plan
+// allows 3 chirps an hour so the limit is reachable.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerConfig(t, config.Default())
+}
+
+func newTestServerConfig(t *testing.T, cfg config.Config) *testServer {
+	t.Helper()
+
+	plans := entitlements.Plans{}
+	for name, limits := range entitlements.Default {
+		plans[name] = limits
+	}
+	free := plans[entitlements.FreePlan]
+	free.ChirpsPerHour = 3
+	plans[entitlements.FreePlan] = free
+
+	blobs, err := media.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := store.NewMemory()
+	conf := &apiConfig{
+		Store: mem,
+		Platform: "dev",
+		JWTSecret: testJWTSecret,
+		PolkaKey: testPolkaKey,
+		AccessTTL: time.Hour,
+		RefreshTTL: 24 * time.Hour,
+		Plans: plans,
+		Metrics: metrics.New(nil),
+		Limiter: ratelimit.NewMemory(),
+		Broker: stream.NewBroker(streamReplaySize),
+		Filter: moderation.NewEngine(nil),
+		Blobs: blobs,
+		MediaLinks: media.NewSigner([]byte(testJWTSecret), cfg.Media.URLTTL),
+		MediaMaxBytes: cfg.Media.MaxBytes,
+	}
+	conf.WebhookGuard.Allow, err = webhooks.ParseNetworks(cfg.Webhooks.AllowNetworks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Events = conf.Broker
+	if err := conf.reloadFilter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conf.Broker.Close)
+
+	mux, err := conf.routes(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(serverHandler(cfg, logging.NewWithWriter(io.Discard, slog.LevelInfo), mux))
+	t.Cleanup(srv.Close)
+
+	return &testServer{t: t, srv: srv, conf: conf, store: mem}
+}
+
+// do sends body as JSON, with token as the bearer token when set, and
+// decodes a JSON response into out when given.
+func (s *testServer) do(method, path, token string, body any, out any) *http.Response {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.srv.URL+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.srv.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			s.t.Fatalf("%s %s: body isn't JSON: %s: %s", method, path, err, data)
+		}
+	}
+	return resp
+}
+
+func (s *testServer) expect(resp *http.Response, status int) {
+	s.t.Helper()
+	if resp.StatusCode != status {
+		s.t.Errorf("%s %s: expect status %d, got %d", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode)
+	}
+}
+
+type testUser struct {
+	ID string `json:"id"`
+	Email string `json:"email"`
+	Handle string `json:"handle"`
+	Token string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	IsChirpyRed bool `json:"is_chirpy_red"`
+}
+
+// signup creates and logs in a user.
+func (s *testServer) signup(email string) testUser {
+	s.t.Helper()
+	creds := map[string]string{"email": email, "password": "hunter2"}
+	s.expect(s.do("POST", "/api/users", "", creds, nil), http.StatusCreated)
+
+	var user testUser
+	s.expect(s.do("POST", "/api/login", "", creds, &user), http.StatusOK)
+	return user
+}
+
+type testChirp struct {
+	ID string `json:"id"`
+	UserID string `json:"user_id"`
+	Body string `json:"body"`
+}
+
+func TestHealthAndApp(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect(s.do("GET", "/api/healthz", "", nil, nil), http.StatusOK)
+
+	resp := s.do("GET", "/app/", "", nil, nil)
+	s.expect(resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("expect html, got %s", ct)
+	}
+	if resp.Header.Get("ETag") == "" {
+		t.Error("expect an etag on the app")
+	}
+
+	s.expect(s.do("GET", "/metrics", "", nil, nil), http.StatusOK)
+}
+
+// TestAccessLog sends requests through the handler of the server, checking
+// the access log gets the route the mux matched.
+func TestAccessLog(t *testing.T) {
+	s := newTestServer(t)
+	cfg := config.Default()
+	mux, err := s.conf.routes(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	handler := serverHandler(cfg, logging.NewWithWriter(&buf, slog.LevelInfo), mux)
+
+	for _, c := range []struct{ method, path, route string }{
+		{"GET", "/api/healthz", "GET /api/healthz"},
+		{"POST", "/api/chirps", "POST /api/chirps"},
+	} {
+		buf.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(c.method, c.path, strings.NewReader("{}")))
+
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("access log isn't JSON: %s: %s", err, buf.Bytes())
+		}
+		if record["route"] != c.route {
+			t.Errorf("%s %s: expect route %q, got %v", c.method, c.path, c.route, record["route"])
+		}
+	}
+}
+
+// syncBuffer is a buffer the server goroutines can log to while the test
+// reads it.
+type syncBuffer struct {
+	mu sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records decodes the JSON log records written so far.
+func (b *syncBuffer) records() []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range bytes.Split(b.buf.Bytes(), []byte("\n")) {
+		var record map[string]any
+		if json.Unmarshal(line, &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestRecover(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	mux.HandleFunc("GET /abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	mux.HandleFunc("GET /ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	var logs syncBuffer
+	handler := serverHandler(config.Default(), logging.NewWithWriter(&logs, slog.LevelInfo), mux)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/panic", nil)
+	req.Header.Set(logging.RequestIDHeader, "panic-1")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var problem respond.Problem
+	json.NewDecoder(resp.Body).Decode(&problem)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || problem.Status != http.StatusInternalServerError || problem.RequestID != "panic-1" {
+		t.Errorf("expect a 500 problem, got %d %+v", resp.StatusCode, problem)
+	}
+
+	// the server goes on
+	resp, err = srv.Client().Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expect 200 after the panic, got %d", resp.StatusCode)
+	}
+
+	logged := false
+	for _, record := range logs.records() {
+		if record["msg"] == "panic serving request" {
+			logged = record["request_id"] == "panic-1" && record["panic"] == "boom" && record["stack"] != ""
+		}
+	}
+	if !logged {
+		t.Errorf("expect the panic logged with its request id, got %v", logs.records())
+	}
+
+	// an aborted handler is left to net/http, which drops the connection
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Errorf("expect %v panicking through, got %v", http.ErrAbortHandler, rec)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+	}()
+}
+
+func TestUsersAndAuth(t *testing.T) {
+	s := newTestServer(t)
+
+	var problem respond.Problem
+	resp := s.do("POST", "/api/users", "", map[string]string{"email": ""}, &problem)
+	s.expect(resp, http.StatusBadRequest)
+	if resp.Header.Get("Content-Type") != respond.ProblemContentType || problem.Type != respond.TypeValidation || len(problem.Errors) != 2 {
+		t.Errorf("unexpected problem %#v", problem)
+	}
+
+	user := s.signup("walt@example.com")
+	if user.Token == "" || user.RefreshToken == "" || user.IsChirpyRed {
+		t.Fatalf("unexpected login %#v", user)
+	}
+
+	s.expect(s.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "wrong"}, nil), http.StatusUnauthorized)
+	s.expect(s.do("POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "hunter2"}, nil), http.StatusNotFound)
+
+	// update
+	update := map[string]string{"email": "heisenberg@example.com", "password": "bluesky"}
+	s.expect(s.do("PUT", "/api/users", "", update, nil), http.StatusUnauthorized)
+	var updated testUser
+	s.expect(s.do("PUT", "/api/users", user.Token, update, &updated), http.StatusOK)
+	if updated.Email != "heisenberg@example.com" {
+		t.Errorf("expect updated email, got %s", updated.Email)
+	}
+	s.expect(s.do("POST", "/api/login", "", update, nil), http.StatusOK)
+
+	// refresh and revoke
+	var refreshed struct {
+		Token string `json:"token"`
+	}
+	s.expect(s.do("POST", "/api/refresh", user.RefreshToken, nil, &refreshed), http.StatusOK)
+	if refreshed.Token == "" {
+		t.Error("expect a new access token")
+	}
+	s.expect(s.do("POST", "/api/refresh", "", nil, nil), http.StatusUnauthorized)
+	s.expect(s.do("POST", "/api/revoke", user.RefreshToken, nil, nil), http.StatusNoContent)
+	s.expect(s.do("POST", "/api/refresh", user.RefreshToken, nil, nil), http.StatusUnauthorized)
+}
+
+func TestChirps(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+
+	s.expect(s.do("POST", "/api/chirps", "", map[string]string{"body": "hi"}, nil), http.StatusUnauthorized)
+
+	var first testChirp
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "what a kerfuffle"}, &first), http.StatusCreated)
+	if first.Body != "what a ****" || first.UserID != walt.ID {
+		t.Errorf("unexpected chirp %#v", first)
+	}
+
+	var problem respond.Problem
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": strings.Repeat("a", 141)}, &problem), http.StatusBadRequest)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "body" {
+		t.Errorf("expect a body field error, got %#v", problem)
+	}
+
+	var second testChirp
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo"}, &second), http.StatusCreated)
+
+	// list
+	var chirps []testChirp
+	s.expect(s.do("GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 2 || chirps[0].ID != first.ID {
+		t.Errorf("expect 2 chirps oldest first, got %#v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps?sort=desc&author_id="+jesse.ID, "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 1 || chirps[0].ID != second.ID {
+		t.Errorf("expect jesse's chirp, got %#v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps?author_id=nope", "", nil, nil), http.StatusBadRequest)
+
+	// get
+	var got testChirp
+	s.expect(s.do("GET", "/api/chirps/"+first.ID, "", nil, &got), http.StatusOK)
+	if got.ID != first.ID {
+		t.Errorf("expect chirp %s, got %s", first.ID, got.ID)
+	}
+	s.expect(s.do("GET", "/api/chirps/not-a-uuid", "", nil, nil), http.StatusBadRequest)
+	s.expect(s.do("GET", "/api/chirps/00000000-0000-0000-0000-000000000000", "", nil, nil), http.StatusNotFound)
+
+	// edit, the free plan has no edit window
+	s.expect(s.do("PUT", "/api/chirps/"+first.ID, jesse.Token, map[string]string{"body": "mine"}, nil), http.StatusForbidden)
+	s.expect(s.do("PUT", "/api/chirps/"+first.ID, walt.Token, map[string]string{"body": "edited"}, nil), http.StatusForbidden)
+
+	// delete
+	s.expect(s.do("DELETE", "/api/chirps/"+first.ID, jesse.Token, nil, nil), http.StatusForbidden)
+	s.expect(s.do("DELETE", "/api/chirps/"+first.ID, walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("GET", "/api/chirps/"+first.ID, "", nil, nil), http.StatusNotFound)
+
+	// the free plan here allows 3 chirps an hour, deleted chirps don't count
+	for i := 0; i < 3; i++ {
+		s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "again"}, nil), http.StatusCreated)
+	}
+	resp := s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "too many"}, &problem)
+	s.expect(resp, http.StatusTooManyRequests)
+	if problem.Type != respond.TypeRateLimited {
+		t.Errorf("expect rate limited problem, got %s", problem.Type)
+	}
+}
+
+func TestChirpLength(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+
+	// the free plan allows 140 characters, an emoji is one
+	var chirp testChirp
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": strings.Repeat("\U0001F600", 140)}, &chirp), http.StatusCreated)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": strings.Repeat("\U0001F600", 141)}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": strings.Repeat("e\u0301", 141)}, nil), http.StatusBadRequest)
+
+	// a link counts the same however long
+	link := "https://example.com/" + strings.Repeat("a", 200)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": strings.Repeat("a", 100) + " " + link}, nil), http.StatusCreated)
+
+	var problem respond.Problem
+	for _, body := range []string{"", "   ", "\u200b\n\t\u200b", "\u3164"} {
+		s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": body}, &problem), http.StatusBadRequest)
+		if len(problem.Errors) != 1 || problem.Errors[0].Message != "Chirp is empty" {
+			t.Errorf("expect %q empty, got %#v", body, problem)
+		}
+	}
+
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": " cafe\u0301\u200b\u202e \a"}, &chirp), http.StatusCreated)
+	if chirp.Body != "caf\u00e9" {
+		t.Errorf("expect the body normalized, got %q", chirp.Body)
+	}
+}
+
+func TestPins(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+
+	var one, two, three testChirp
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "one"}, &one), http.StatusCreated)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "two"}, &two), http.StatusCreated)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "three"}, &three), http.StatusCreated)
+
+	s.expect(s.do("POST", "/api/chirps/"+one.ID+"/pin", walt.Token, nil, nil), http.StatusNoContent)
+	// the free plan pins 1 chirp
+	s.expect(s.do("POST", "/api/chirps/"+two.ID+"/pin", walt.Token, nil, nil), http.StatusForbidden)
+	// pinning a pinned chirp again is fine at the limit
+	s.expect(s.do("POST", "/api/chirps/"+one.ID+"/pin", walt.Token, nil, nil), http.StatusNoContent)
+
+	var pinned []testChirp
+	s.expect(s.do("GET", "/api/users/"+walt.ID+"/pinned", "", nil, &pinned), http.StatusOK)
+	if len(pinned) != 1 || pinned[0].ID != one.ID {
+		t.Errorf("expect chirp one pinned, got %#v", pinned)
+	}
+
+	s.expect(s.do("DELETE", "/api/chirps/"+one.ID+"/pin", walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("GET", "/api/users/"+walt.ID+"/pinned", "", nil, &pinned), http.StatusOK)
+	if len(pinned) != 0 {
+		t.Errorf("expect nothing pinned, got %#v", pinned)
+	}
+
+	// pins at once don't pass the limit together
+	var wg sync.WaitGroup
+	for _, chirp := range []testChirp{one, two, three} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.do("POST", "/api/chirps/"+chirp.ID+"/pin", walt.Token, nil, nil)
+		}()
+	}
+	wg.Wait()
+	s.expect(s.do("GET", "/api/users/"+walt.ID+"/pinned", "", nil, &pinned), http.StatusOK)
+	if len(pinned) != 1 {
+		t.Errorf("expect 1 chirp pinned, got %d", len(pinned))
+	}
+}
+
+// polka sends a signed Polka event.
+func (s *testServer) polka(id, event, userID string) *http.Response {
+	s.t.Helper()
+
+	body, _ := json.Marshal(map[string]any{
+		"id": id,
+		"event": event,
+		"data": map[string]string{"user_id": userID},
+	})
+	now := time.Now().Unix()
+	req, _ := http.NewRequest("POST", s.srv.URL+"/api/polka/webhooks", bytes.NewReader(body))
+	req.Header.Set(auth.WebhookTimestampHeader, strconv.FormatInt(now, 10))
+	req.Header.Set(auth.WebhookSignatureHeader, "v1="+auth.SignWebhook(testPolkaKey, now, body))
+
+	resp, err := s.srv.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestPolkaUpgrade(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+
+	s.expect(s.do("POST", "/api/polka/webhooks", "", map[string]string{"event": "user.upgraded"}, nil), http.StatusUnauthorized)
+	s.expect(s.polka("evt_0", "user.upgraded", "00000000-0000-0000-0000-000000000000"), http.StatusNotFound)
+
+	s.expect(s.polka("evt_1", "user.upgraded", walt.ID), http.StatusNoContent)
+	s.expect(s.polka("evt_1", "user.upgraded", walt.ID), http.StatusNoContent)
+
+	var user testUser
+	s.expect(s.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "hunter2"}, &user), http.StatusOK)
+	if !user.IsChirpyRed {
+		t.Error("expect walt to be chirpy red")
+	}
+
+	// red users can edit within 15 minutes
+	var chirp testChirp
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "typo"}, &chirp), http.StatusCreated)
+	s.expect(s.do("PUT", "/api/chirps/"+chirp.ID, walt.Token, map[string]string{"body": "fixed"}, &chirp), http.StatusOK)
+	if chirp.Body != "fixed" {
+		t.Errorf("expect edited body, got %s", chirp.Body)
+	}
+	s.expect(s.do("PUT", "/api/chirps/"+chirp.ID, walt.Token, map[string]string{"body": " \u200b "}, nil), http.StatusBadRequest)
+	s.expect(s.do("PUT", "/api/chirps/"+chirp.ID, walt.Token, map[string]string{"body": strings.Repeat("\U0001F600", 281)}, nil), http.StatusBadRequest)
+
+	var events []struct {
+		ID string `json:"id"`
+		Status string `json:"status"`
+	}
+	s.expect(s.do("GET", "/admin/webhooks/polka", "", nil, &events), http.StatusOK)
+	if len(events) != 1 || events[0].ID != "evt_1" || events[0].Status != "processed" {
+		t.Errorf("expect evt_1 processed once, got %#v", events)
+	}
+
+	// the body is capped well below the global limit
+	now := time.Now().Unix()
+	body := bytes.Repeat([]byte(" "), polkaMaxBytes+1)
+	req, _ := http.NewRequest("POST", s.srv.URL+"/api/polka/webhooks", bytes.NewReader(body))
+	req.Header.Set(auth.WebhookTimestampHeader, strconv.FormatInt(now, 10))
+	req.Header.Set(auth.WebhookSignatureHeader, "v1="+auth.SignWebhook(testPolkaKey, now, body))
+	resp, err := s.srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	s.expect(resp, http.StatusRequestEntityTooLarge)
+
+	// without a key nothing is signed, not even with an empty key
+	s.conf.PolkaKey = ""
+	body = []byte(`{"id":"evt_2","event":"user.upgraded","data":{"user_id":"` + walt.ID + `"}}`)
+	req, _ = http.NewRequest("POST", s.srv.URL+"/api/polka/webhooks", bytes.NewReader(body))
+	req.Header.Set(auth.WebhookTimestampHeader, strconv.FormatInt(now, 10))
+	req.Header.Set(auth.WebhookSignatureHeader, "v1="+auth.SignWebhook("", now, body))
+	resp, err = s.srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	s.expect(resp, http.StatusUnauthorized)
+}
+
+func TestWebhooks(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+
+	s.expect(s.do("POST", "/api/webhooks", walt.Token, map[string]any{"url": "ftp://203.0.113.7", "events": []string{"chirp.created"}}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/webhooks", walt.Token, map[string]any{"url": "https://203.0.113.7/hook", "events": []string{"chirp.exploded"}}, nil), http.StatusBadRequest)
+	// nothing inside the network
+	for _, url := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://[::1]/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest/meta-data"} {
+		s.expect(s.do("POST", "/api/webhooks", walt.Token, map[string]any{"url": url, "events": []string{"chirp.created"}}, nil), http.StatusBadRequest)
+	}
+
+	var hook struct {
+		ID string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	s.expect(s.do("POST", "/api/webhooks", walt.Token, map[string]any{"url": "https://203.0.113.7/hook", "events": []string{"chirp.created"}}, &hook), http.StatusCreated)
+	if hook.Secret == "" {
+		t.Error("expect the secret on creation")
+	}
+
+	var hooks []map[string]any
+	s.expect(s.do("GET", "/api/webhooks", walt.Token, nil, &hooks), http.StatusOK)
+	if len(hooks) != 1 || hooks[0]["secret"] != nil {
+		t.Errorf("expect 1 webhook without its secret, got %#v", hooks)
+	}
+
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "hook me"}, nil), http.StatusCreated)
+
+	var deliveries []struct {
+		ID string `json:"id"`
+		Event string `json:"event"`
+	}
+	s.expect(s.do("GET", "/api/webhooks/"+hook.ID+"/deliveries", walt.Token, nil, &deliveries), http.StatusOK)
+	if len(deliveries) != 1 || deliveries[0].Event != "chirp.created" {
+		t.Fatalf("expect a chirp.created delivery, got %#v", deliveries)
+	}
+	s.expect(s.do("GET", "/api/webhooks/"+hook.ID+"/deliveries", jesse.Token, nil, nil), http.StatusNotFound)
+
+	// a pending delivery may be in flight
+	redeliver := "/api/webhooks/" + hook.ID + "/deliveries/" + deliveries[0].ID + "/redeliver"
+	s.expect(s.do("POST", redeliver, walt.Token, nil, nil), http.StatusConflict)
+	deliveryID, _ := uuid.Parse(deliveries[0].ID)
+	err := s.store.MarkWebhookDelivery(context.Background(), database.MarkWebhookDeliveryParams{
+		ID: deliveryID,
+		Status: webhooks.StatusDelivered,
+		Attempts: 1,
+		NextAttemptAt: time.Now(),
+		LastStatusCode: http.StatusNoContent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do("POST", redeliver, walt.Token, nil, nil), http.StatusAccepted)
+	s.expect(s.do("POST", redeliver, walt.Token, nil, nil), http.StatusConflict)
+
+	s.expect(s.do("DELETE", "/api/webhooks/"+hook.ID, jesse.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("DELETE", "/api/webhooks/"+hook.ID, walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("DELETE", "/api/webhooks/"+hook.ID, walt.Token, nil, nil), http.StatusNotFound)
+
+	// unless allowed
+	cfg := config.Default()
+	cfg.Webhooks.AllowNetworks = "127.0.0.1"
+	s = newTestServerConfig(t, cfg)
+	walt = s.signup("walt@example.com")
+	s.expect(s.do("POST", "/api/webhooks", walt.Token, map[string]any{"url": "http://127.0.0.1:8080/hook", "events": []string{"chirp.created"}}, nil), http.StatusCreated)
+	s.expect(s.do("POST", "/api/webhooks", walt.Token, map[string]any{"url": "http://10.0.0.5/hook", "events": []string{"chirp.created"}}, nil), http.StatusBadRequest)
+}
+
+func TestAdmin(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("walt@example.com")
+
+	s.expect(s.do("GET", "/admin/metrics", "", nil, nil), http.StatusOK)
+	s.expect(s.do("POST", "/admin/reset", "", nil, nil), http.StatusOK)
+	s.expect(s.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "hunter2"}, nil), http.StatusNotFound)
+
+	s.conf.Platform = "prod"
+	s.expect(s.do("POST", "/admin/reset", "", nil, nil), http.StatusForbidden)
+}
+
+func TestRateLimits(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.Auth = 2
+	cfg.RateLimit.Read = 0
+	s := newTestServerConfig(t, cfg)
+
+	creds := map[string]string{"email": "walt@example.com", "password": "hunter2"}
+	resp := s.do("POST", "/api/users", "", creds, nil)
+	s.expect(resp, http.StatusCreated)
+	if resp.Header.Get("RateLimit-Limit") != "2" || resp.Header.Get("RateLimit-Remaining") != "1" {
+		t.Errorf("unexpected rate limit headers %v", resp.Header)
+	}
+	s.expect(s.do("POST", "/api/login", "", creds, nil), http.StatusOK)
+
+	var problem respond.Problem
+	resp = s.do("POST", "/api/login", "", creds, &problem)
+	s.expect(resp, http.StatusTooManyRequests)
+	if resp.Header.Get("Retry-After") == "" || problem.Type != respond.TypeRateLimited {
+		t.Errorf("expect a rate limited problem with Retry-After, got %v %#v", resp.Header, problem)
+	}
+
+	// reads aren't limited here
+	resp = s.do("GET", "/api/chirps", "", nil, nil)
+	s.expect(resp, http.StatusOK)
+	if resp.Header.Get("RateLimit-Limit") != "" {
+		t.Errorf("expect no rate limit headers, got %s", resp.Header.Get("RateLimit-Limit"))
+	}
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openStream connects to the chirp stream, reading events until the test
+// ends.
+func (s *testServer) openStream(query, lastEventID string) <-chan sseEvent {
+	s.t.Helper()
+
+	req, _ := http.NewRequest("GET", s.srv.URL+"/api/stream/chirps"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := s.srv.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		s.t.Fatalf("expect an event stream, got %s", resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		var e sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				e.id = value
+			case "event":
+				e.event = value
+			case "data":
+				e.data = value
+			case "":
+				if e.event != "" {
+					events <- e
+				}
+				e = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event streamed")
+	}
+	return sseEvent{}
+}
+
+func TestStreamChirps(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+
+	s.expect(s.do("GET", "/api/stream/chirps?author_id=nope", "", nil, nil), http.StatusBadRequest)
+
+	all := s.openStream("", "")
+	waltOnly := s.openStream("?author_id="+walt.ID, "")
+
+	var chirp testChirp
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo"}, nil), http.StatusCreated)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "say my name"}, &chirp), http.StatusCreated)
+	s.expect(s.do("DELETE", "/api/chirps/"+chirp.ID, walt.Token, nil, nil), http.StatusNoContent)
+
+	first := nextEvent(t, all)
+	if first.event != "chirp.created" || !strings.Contains(first.data, `"body":"yo"`) {
+		t.Errorf("unexpected first event %#v", first)
+	}
+	nextEvent(t, all)
+	if e := nextEvent(t, all); e.event != "chirp.deleted" || !strings.Contains(e.data, chirp.ID) {
+		t.Errorf("unexpected delete event %#v", e)
+	}
+
+	if e := nextEvent(t, waltOnly); e.event != "chirp.created" || !strings.Contains(e.data, chirp.ID) {
+		t.Errorf("expect only walt's chirps, got %#v", e)
+	}
+
+	// resume after the first event
+	resumed := s.openStream("", first.id)
+	if e := nextEvent(t, resumed); e.event != "chirp.created" || !strings.Contains(e.data, "say my name") {
+		t.Errorf("expect the replayed second event, got %#v", e)
+	}
+	if e := nextEvent(t, resumed); e.event != "chirp.deleted" {
+		t.Errorf("expect the replayed delete, got %#v", e)
+	}
+
+	// an unknown old id can't be resumed
+	if e := nextEvent(t, s.openStream("", "1")); e.event != "reset" {
+		t.Errorf("expect a reset, got %#v", e)
+	}
+}
+
+func TestFollows(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+
+	s.expect(s.do("POST", "/api/users/"+jesse.ID+"/follow", "", nil, nil), http.StatusUnauthorized)
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", walt.Token, nil, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/users/"+uuid.NewString()+"/follow", walt.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("POST", "/api/users/"+jesse.ID+"/follow", walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("POST", "/api/users/"+jesse.ID+"/follow", walt.Token, nil, nil), http.StatusNoContent)
+
+	var following []string
+	s.expect(s.do("GET", "/api/users/"+walt.ID+"/following", "", nil, &following), http.StatusOK)
+	if len(following) != 1 || following[0] != jesse.ID {
+		t.Errorf("expect walt to follow jesse, got %v", following)
+	}
+
+	s.expect(s.do("DELETE", "/api/users/"+jesse.ID+"/follow", walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("GET", "/api/users/"+walt.ID+"/following", "", nil, &following), http.StatusOK)
+	if len(following) != 0 {
+		t.Errorf("expect no follows, got %v", following)
+	}
+}
+
+// dialWebSocket connects to the WebSocket API with token.
+func (s *testServer) dialWebSocket(token string) (*websocket.Conn, *http.Response, error) {
+	s.t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(s.srv.URL, "http")+"/api/ws", &websocket.DialOptions{
+		HTTPClient: s.srv.Client(),
+		HTTPHeader: header,
+	})
+	if conn != nil {
+		s.t.Cleanup(func() { conn.CloseNow() })
+	}
+	return conn, resp, err
+}
+
+func nextMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var msg wsMessage
+	if err := wsjson.Read(ctx, conn, &msg); err != nil {
+		t.Fatalf("no message: %s", err)
+	}
+	return msg
+}
+
+func TestWebSocket(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+	skyler := s.signup("skyler@example.com")
+
+	_, resp, err := s.dialWebSocket("")
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect 401 without a token, got %v", err)
+	}
+
+	s.expect(s.do("POST", "/api/users/"+jesse.ID+"/follow", walt.Token, nil, nil), http.StatusNoContent)
+	conn, _, err := s.dialWebSocket(walt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	wsjson.Write(ctx, conn, map[string]string{"type": "subscribe", "channel": "home"})
+	wsjson.Write(ctx, conn, map[string]string{"type": "subscribe", "channel": "mentions"})
+	wsjson.Write(ctx, conn, map[string]string{"type": "subscribe", "channel": "user", "user_id": skyler.ID})
+	wsjson.Write(ctx, conn, map[string]string{"type": "subscribe", "channel": "everything"})
+	for range 3 {
+		if msg := nextMessage(t, conn); msg.Type != "subscribed" {
+			t.Errorf("expect subscribed, got %#v", msg)
+		}
+	}
+	if msg := nextMessage(t, conn); msg.Type != "error" {
+		t.Errorf("expect an unknown channel error, got %#v", msg)
+	}
+
+	var chirp testChirp
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo"}, &chirp), http.StatusCreated)
+	s.expect(s.do("POST", "/api/chirps", skyler.Token, map[string]string{"body": "we need to talk @Walt."}, nil), http.StatusCreated)
+
+	msg := nextMessage(t, conn)
+	if msg.Type != "chirp.created" || msg.Channel != "home" || !strings.Contains(string(msg.Data), chirp.ID) {
+		t.Errorf("expect jesse's chirp on home, got %#v", msg)
+	}
+	if msg := nextMessage(t, conn); msg.Channel != "user" || msg.UserID == nil || msg.UserID.String() != skyler.ID {
+		t.Errorf("expect skyler's chirp on her channel, got %#v", msg)
+	}
+	if msg := nextMessage(t, conn); msg.Channel != "mentions" {
+		t.Errorf("expect the mention, got %#v", msg)
+	}
+
+	// the connection closes with the token
+	token, _ := auth.MakeJWT(uuid.MustParse(walt.ID), testJWTSecret, time.Second)
+	conn, _, err = s.dialWebSocket(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, _, err = conn.Read(readCtx)
+	if websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("expect a policy violation close, got %v", err)
+	}
+}
+
+func TestMentionedHandles(t *testing.T) {
+	got := mentionedHandles("@Walt. hi @jesse-, mail walt@example.com @@x and @skyler")
+	want := []string{"walt", "jesse", "skyler"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expect %v, got %v", want, got)
+	}
+
+	cases := map[string]string{
+		"Walt.White@example.com": "walt.white",
+		"walt+chirpy@example.com": "waltchirpy",
+		".-walt-.@example.com": "walt",
+		"!!!@example.com": "user",
+		"heisenberg.heisenberg.h.ww@example.com": "heisenberg.heisenberg.h",
+	}
+	for email, want := range cases {
+		if got := emailHandle(email); got != want {
+			t.Errorf("emailHandle(%q): expect %s, got %s", email, want, got)
+		}
+	}
+}
+
+func TestHandles(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	other := s.signup("Walt@example.org")
+	jesse := s.signup("jesse@example.com")
+	if walt.Handle != "walt" || other.Handle != "walt_2" {
+		t.Fatalf("expect handles walt and walt_2, got %s %s", walt.Handle, other.Handle)
+	}
+
+	creds := map[string]string{"email": "skyler@example.com", "password": "hunter2"}
+	creds["handle"] = "Walt"
+	s.expect(s.do("POST", "/api/users", "", creds, nil), http.StatusConflict)
+	creds["handle"] = "-skyler"
+	s.expect(s.do("POST", "/api/users", "", creds, nil), http.StatusBadRequest)
+	creds["handle"] = "Sky"
+	var skyler testUser
+	s.expect(s.do("POST", "/api/users", "", creds, &skyler), http.StatusCreated)
+	if skyler.Handle != "sky" {
+		t.Errorf("expect handle sky, got %s", skyler.Handle)
+	}
+
+	// a mention is of one user, not of every walt@
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo @walt"}, nil), http.StatusCreated)
+	var unread map[string]int
+	s.expect(s.do("GET", "/api/notifications/unread_count", walt.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 1 {
+		t.Errorf("expect walt mentioned, got %v", unread)
+	}
+	s.expect(s.do("GET", "/api/notifications/unread_count", other.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 0 {
+		t.Errorf("expect the other walt not mentioned, got %v", unread)
+	}
+
+	update := map[string]string{"email": other.Email, "password": "hunter2", "handle": "walt"}
+	s.expect(s.do("PUT", "/api/users", other.Token, update, nil), http.StatusConflict)
+	update["handle"] = "walter"
+	var updated testUser
+	s.expect(s.do("PUT", "/api/users", other.Token, update, &updated), http.StatusOK)
+	if updated.Handle != "walter" {
+		t.Errorf("expect handle walter, got %s", updated.Handle)
+	}
+	// keeping a handle isn't taking it
+	s.expect(s.do("PUT", "/api/users", other.Token, update, nil), http.StatusOK)
+	delete(update, "handle")
+	s.expect(s.do("PUT", "/api/users", other.Token, update, &updated), http.StatusOK)
+	if updated.Handle != "walter" {
+		t.Errorf("expect the handle kept, got %s", updated.Handle)
+	}
+
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "and @walter"}, nil), http.StatusCreated)
+	s.expect(s.do("GET", "/api/notifications/unread_count", other.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 1 {
+		t.Errorf("expect walter mentioned, got %v", unread)
+	}
+}
+
+type testNotifications struct {
+	Notifications []struct {
+		ID string `json:"id"`
+		Type string `json:"type"`
+		ActorID *string `json:"actor_id"`
+		ReadAt *time.Time `json:"read_at"`
+	} `json:"notifications"`
+	NextCursor string `json:"next_cursor"`
+	Unread int `json:"unread_count"`
+}
+
+func TestNotifications(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+
+	conn, _, err := s.dialWebSocket(walt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsjson.Write(context.Background(), conn, map[string]string{"type": "subscribe", "channel": "notifications"})
+	nextMessage(t, conn)
+
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", jesse.Token, nil, nil), http.StatusNoContent)
+	// following again doesn't notify again
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", jesse.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo @walt @walt"}, nil), http.StatusCreated)
+	s.expect(s.polka("evt_1", "user.upgraded", walt.ID), http.StatusNoContent)
+
+	if msg := nextMessage(t, conn); msg.Type != "notification.created" || !strings.Contains(string(msg.Data), `"followed"`) {
+		t.Errorf("expect the follow notification live, got %#v", msg)
+	}
+
+	var page testNotifications
+	s.expect(s.do("GET", "/api/notifications?limit=2", walt.Token, nil, &page), http.StatusOK)
+	if len(page.Notifications) != 2 || page.Notifications[0].Type != "red_upgrade" || page.Unread != 3 || page.NextCursor == "" {
+		t.Fatalf("unexpected first page %#v", page)
+	}
+	mention := page.Notifications[1]
+	if mention.Type != "mentioned" || mention.ActorID == nil || *mention.ActorID != jesse.ID {
+		t.Errorf("expect jesse's mention, got %#v", mention)
+	}
+	var last testNotifications
+	s.expect(s.do("GET", "/api/notifications?limit=2&cursor="+page.NextCursor, walt.Token, nil, &last), http.StatusOK)
+	if len(last.Notifications) != 1 || last.Notifications[0].Type != "followed" || last.NextCursor != "" {
+		t.Errorf("unexpected last page %#v", last)
+	}
+	s.expect(s.do("GET", "/api/notifications?cursor=nope", walt.Token, nil, nil), http.StatusBadRequest)
+
+	s.expect(s.do("POST", "/api/notifications/"+mention.ID+"/read", jesse.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("POST", "/api/notifications/"+mention.ID+"/read", walt.Token, nil, nil), http.StatusNoContent)
+	var unread map[string]int
+	s.expect(s.do("GET", "/api/notifications/unread_count", walt.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 2 {
+		t.Errorf("expect 2 unread, got %v", unread)
+	}
+	s.expect(s.do("POST", "/api/notifications/read", walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("GET", "/api/notifications/unread_count", walt.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 0 {
+		t.Errorf("expect all read, got %v", unread)
+	}
+
+	var prefs map[string]bool
+	s.expect(s.do("PUT", "/api/notifications/preferences", walt.Token, map[string]bool{"poked": false}, nil), http.StatusBadRequest)
+	s.expect(s.do("PUT", "/api/notifications/preferences", walt.Token, map[string]bool{"mentioned": false}, &prefs), http.StatusOK)
+	if prefs["mentioned"] || !prefs["followed"] {
+		t.Errorf("expect only mentions off, got %v", prefs)
+	}
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "@walt?"}, nil), http.StatusCreated)
+	s.expect(s.do("GET", "/api/notifications/unread_count", walt.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 0 {
+		t.Errorf("expect no mention notification, got %v", unread)
+	}
+}
+
+type testConversation struct {
+	ID string `json:"id"`
+	Members []string `json:"members"`
+	Unread int `json:"unread_count"`
+}
+
+type testMessages struct {
+	Messages []struct {
+		ID string `json:"id"`
+		SenderID string `json:"sender_id"`
+		Body string `json:"body"`
+	} `json:"messages"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func TestMessages(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+	skyler := s.signup("skyler@example.com")
+
+	conn, _, err := s.dialWebSocket(jesse.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsjson.Write(context.Background(), conn, map[string]string{"type": "subscribe", "channel": "messages"})
+	nextMessage(t, conn)
+
+	start := map[string]any{"user_ids": []string{jesse.ID}, "body": "we need to cook"}
+	var direct testConversation
+	s.expect(s.do("POST", "/api/conversations", walt.Token, start, &direct), http.StatusCreated)
+	if len(direct.Members) != 2 {
+		t.Fatalf("expect walt and jesse, got %#v", direct)
+	}
+	if msg := nextMessage(t, conn); msg.Type != "message.created" || msg.Channel != "messages" || !strings.Contains(string(msg.Data), "cook") {
+		t.Errorf("expect the message live, got %#v", msg)
+	}
+	// either of them starting again gets the same conversation
+	var again testConversation
+	s.expect(s.do("POST", "/api/conversations", jesse.Token, map[string]any{"user_ids": []string{walt.ID}}, &again), http.StatusOK)
+	if again.ID != direct.ID {
+		t.Errorf("expect one conversation between two users, got %s and %s", direct.ID, again.ID)
+	}
+	s.expect(s.do("POST", "/api/conversations", walt.Token, map[string]any{"user_ids": []string{walt.ID}}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/conversations", walt.Token, map[string]any{"user_ids": []string{uuid.NewString()}}, nil), http.StatusNotFound)
+
+	for _, body := range []string{"yo", "yeah mr white"} {
+		s.expect(s.do("POST", "/api/conversations/"+direct.ID+"/messages", jesse.Token, map[string]string{"body": body}, nil), http.StatusCreated)
+	}
+	s.expect(s.do("POST", "/api/conversations/"+direct.ID+"/messages", jesse.Token, map[string]string{"body": " "}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/conversations/"+direct.ID+"/messages", skyler.Token, map[string]string{"body": "hi"}, nil), http.StatusNotFound)
+	s.expect(s.do("GET", "/api/conversations/"+direct.ID+"/messages", skyler.Token, nil, nil), http.StatusNotFound)
+
+	var page testMessages
+	s.expect(s.do("GET", "/api/conversations/"+direct.ID+"/messages?limit=2", walt.Token, nil, &page), http.StatusOK)
+	if len(page.Messages) != 2 || page.Messages[0].Body != "yeah mr white" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page %#v", page)
+	}
+	var last testMessages
+	s.expect(s.do("GET", "/api/conversations/"+direct.ID+"/messages?limit=2&cursor="+page.NextCursor, walt.Token, nil, &last), http.StatusOK)
+	if len(last.Messages) != 1 || last.Messages[0].SenderID != walt.ID || last.NextCursor != "" {
+		t.Errorf("unexpected last page %#v", last)
+	}
+
+	var convs struct {
+		Conversations []testConversation `json:"conversations"`
+	}
+	s.expect(s.do("GET", "/api/conversations", walt.Token, nil, &convs), http.StatusOK)
+	if len(convs.Conversations) != 1 || convs.Conversations[0].Unread != 2 {
+		t.Fatalf("expect 2 unread for walt, got %#v", convs)
+	}
+	s.expect(s.do("POST", "/api/conversations/"+direct.ID+"/read", walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("GET", "/api/conversations", walt.Token, nil, &convs), http.StatusOK)
+	if convs.Conversations[0].Unread != 0 {
+		t.Errorf("expect all read, got %#v", convs)
+	}
+
+	// skyler only takes new conversations from the users she follows
+	var settings map[string]string
+	s.expect(s.do("PUT", "/api/conversations/settings", skyler.Token, map[string]string{"accept_from": "nobody"}, nil), http.StatusBadRequest)
+	s.expect(s.do("PUT", "/api/conversations/settings", skyler.Token, map[string]string{"accept_from": "following"}, &settings), http.StatusOK)
+	group := map[string]any{"user_ids": []string{jesse.ID, skyler.ID}}
+	s.expect(s.do("POST", "/api/conversations", walt.Token, group, nil), http.StatusForbidden)
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", skyler.Token, nil, nil), http.StatusNoContent)
+	var groupConv testConversation
+	s.expect(s.do("POST", "/api/conversations", walt.Token, group, &groupConv), http.StatusCreated)
+	if len(groupConv.Members) != 3 || groupConv.ID == direct.ID {
+		t.Errorf("expect a new group of 3, got %#v", groupConv)
+	}
+	s.expect(s.do("GET", "/api/conversations/settings", skyler.Token, nil, &settings), http.StatusOK)
+	if settings["accept_from"] != "following" {
+		t.Errorf("expect following, got %v", settings)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+	skyler := s.signup("skyler@example.com")
+
+	s.expect(s.do("POST", "/api/users/"+jesse.ID+"/follow", walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", jesse.Token, nil, nil), http.StatusNoContent)
+	var yo, hi testChirp
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo"}, &yo), http.StatusCreated)
+	s.expect(s.do("POST", "/api/chirps", skyler.Token, map[string]string{"body": "hi"}, &hi), http.StatusCreated)
+
+	s.expect(s.do("POST", "/api/users/me/blocks", walt.Token, map[string]string{"user_id": walt.ID}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/users/me/blocks", walt.Token, map[string]string{"user_id": uuid.NewString()}, nil), http.StatusNotFound)
+	s.expect(s.do("POST", "/api/users/me/blocks", walt.Token, map[string]string{"user_id": jesse.ID}, nil), http.StatusNoContent)
+	s.expect(s.do("POST", "/api/users/me/mutes", walt.Token, map[string]string{"user_id": skyler.ID}, nil), http.StatusNoContent)
+
+	// the block ended the follows and stops new ones either way
+	var following []string
+	s.expect(s.do("GET", "/api/users/"+jesse.ID+"/following", "", nil, &following), http.StatusOK)
+	if len(following) != 0 {
+		t.Errorf("expect jesse to follow nobody, got %v", following)
+	}
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", jesse.Token, nil, nil), http.StatusForbidden)
+	s.expect(s.do("POST", "/api/users/"+jesse.ID+"/follow", walt.Token, nil, nil), http.StatusForbidden)
+	// a mute doesn't stop anything
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", skyler.Token, nil, nil), http.StatusNoContent)
+
+	var chirps []testChirp
+	s.expect(s.do("GET", "/api/chirps", walt.Token, nil, &chirps), http.StatusOK)
+	if len(chirps) != 0 {
+		t.Errorf("expect walt to see neither chirp, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps?author_id="+jesse.ID, walt.Token, nil, &chirps), http.StatusOK)
+	if len(chirps) != 0 {
+		t.Errorf("expect none of jesse's chirps for walt, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 2 {
+		t.Errorf("expect both chirps signed out, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps", "nope", nil, nil), http.StatusUnauthorized)
+
+	// a blocked user's chirp isn't found by id either, a muted user's is
+	s.expect(s.do("GET", "/api/chirps/"+yo.ID, walt.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("GET", "/api/chirps/"+yo.ID, "", nil, nil), http.StatusOK)
+	s.expect(s.do("GET", "/api/chirps/"+hi.ID, walt.Token, nil, nil), http.StatusOK)
+
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "@walt yo"}, nil), http.StatusCreated)
+	var unread map[string]int
+	s.expect(s.do("GET", "/api/notifications/unread_count", walt.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 2 {
+		t.Errorf("expect only the follows, no mention, got %v", unread)
+	}
+
+	s.expect(s.do("POST", "/api/conversations", walt.Token, map[string]any{"user_ids": []string{jesse.ID}}, nil), http.StatusForbidden)
+	s.expect(s.do("POST", "/api/conversations", jesse.Token, map[string]any{"user_ids": []string{walt.ID}}, nil), http.StatusForbidden)
+
+	var blocks, mutes []struct {
+		UserID string `json:"user_id"`
+	}
+	s.expect(s.do("GET", "/api/users/me/blocks", walt.Token, nil, &blocks), http.StatusOK)
+	s.expect(s.do("GET", "/api/users/me/mutes", walt.Token, nil, &mutes), http.StatusOK)
+	if len(blocks) != 1 || blocks[0].UserID != jesse.ID || len(mutes) != 1 || mutes[0].UserID != skyler.ID {
+		t.Errorf("expect jesse blocked and skyler muted, got %v %v", blocks, mutes)
+	}
+	s.expect(s.do("DELETE", "/api/users/me/blocks/"+jesse.ID, walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("DELETE", "/api/users/me/mutes/"+skyler.ID, walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("POST", "/api/users/"+walt.ID+"/follow", jesse.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("GET", "/api/chirps", walt.Token, nil, &chirps), http.StatusOK)
+	if len(chirps) != 3 {
+		t.Errorf("expect every chirp again, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps/"+yo.ID, walt.Token, nil, nil), http.StatusOK)
+}
+
+func TestModeration(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+	mod := s.signup("mod@example.com")
+	other := s.signup("other@example.com")
+
+	var chirp testChirp
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo"}, &chirp), http.StatusCreated)
+
+	s.expect(s.do("POST", "/api/reports", walt.Token, map[string]string{"chirp_id": chirp.ID, "reason": "nope"}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/reports", walt.Token, map[string]string{"reason": "spam"}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/reports", walt.Token, map[string]string{"user_id": walt.ID, "reason": "spam"}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/reports", walt.Token, map[string]string{"chirp_id": uuid.NewString(), "reason": "spam"}, nil), http.StatusNotFound)
+
+	type report struct {
+		ID string `json:"id"`
+		UserID string `json:"user_id"`
+		ChirpID *string `json:"chirp_id"`
+		Status string `json:"status"`
+		Resolution *string `json:"resolution"`
+	}
+	var chirpReport, userReport report
+	s.expect(s.do("POST", "/api/reports", walt.Token, map[string]string{"chirp_id": chirp.ID, "reason": "spam"}, &chirpReport), http.StatusCreated)
+	if chirpReport.UserID != jesse.ID || chirpReport.Status != "open" {
+		t.Errorf("expect an open report of jesse, got %+v", chirpReport)
+	}
+	s.expect(s.do("POST", "/api/reports", walt.Token, map[string]string{"user_id": jesse.ID, "reason": "harassment"}, &userReport), http.StatusCreated)
+
+	// only moderators work the queue
+	s.expect(s.do("GET", "/api/moderation/reports", walt.Token, nil, nil), http.StatusForbidden)
+	s.expect(s.do("POST", "/admin/moderators", "", map[string]string{"user_id": uuid.NewString()}, nil), http.StatusNotFound)
+	s.expect(s.do("POST", "/admin/moderators", "", map[string]string{"user_id": mod.ID}, nil), http.StatusNoContent)
+	s.expect(s.do("POST", "/admin/moderators", "", map[string]string{"user_id": other.ID}, nil), http.StatusNoContent)
+
+	var queue struct {
+		Reports []report `json:"reports"`
+		NextCursor string `json:"next_cursor"`
+	}
+	s.expect(s.do("GET", "/api/moderation/reports?limit=1", mod.Token, nil, &queue), http.StatusOK)
+	if len(queue.Reports) != 1 || queue.Reports[0].ID != chirpReport.ID || queue.NextCursor == "" {
+		t.Fatalf("expect the oldest report first, got %+v", queue)
+	}
+	s.expect(s.do("GET", "/api/moderation/reports?cursor="+queue.NextCursor, mod.Token, nil, &queue), http.StatusOK)
+	if len(queue.Reports) != 1 || queue.Reports[0].ID != userReport.ID {
+		t.Errorf("expect the user report next, got %+v", queue)
+	}
+	s.expect(s.do("GET", "/api/moderation/reports?status=nope", mod.Token, nil, nil), http.StatusBadRequest)
+
+	// a claim keeps other moderators off the report
+	s.expect(s.do("POST", "/api/moderation/reports/"+chirpReport.ID+"/claim", mod.Token, nil, nil), http.StatusOK)
+	s.expect(s.do("POST", "/api/moderation/reports/"+chirpReport.ID+"/claim", other.Token, nil, nil), http.StatusConflict)
+	s.expect(s.do("POST", "/api/moderation/reports/"+chirpReport.ID+"/dismiss", other.Token, nil, nil), http.StatusConflict)
+	s.expect(s.do("POST", "/api/moderation/reports/"+uuid.NewString()+"/claim", mod.Token, nil, nil), http.StatusNotFound)
+
+	s.expect(s.do("POST", "/api/moderation/reports/"+chirpReport.ID+"/resolve", mod.Token, map[string]string{"action": "nope"}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/moderation/reports/"+chirpReport.ID+"/resolve", mod.Token, map[string]any{"action": "suspend", "days": 0}, nil), http.StatusBadRequest)
+	var resolved report
+	s.expect(s.do("POST", "/api/moderation/reports/"+chirpReport.ID+"/resolve", mod.Token, map[string]string{"action": "delete_chirp", "note": "spam link"}, &resolved), http.StatusOK)
+	if resolved.Status != "resolved" || resolved.Resolution == nil || *resolved.Resolution != "delete_chirp" {
+		t.Errorf("expect resolved by deleting the chirp, got %+v", resolved)
+	}
+	s.expect(s.do("GET", "/api/chirps/"+chirp.ID, "", nil, nil), http.StatusNotFound)
+	s.expect(s.do("POST", "/api/moderation/reports/"+chirpReport.ID+"/resolve", mod.Token, map[string]string{"action": "warn"}, nil), http.StatusConflict)
+
+	// a warning notifies the user whatever their preferences
+	s.expect(s.do("PUT", "/api/notifications/preferences", jesse.Token, map[string]bool{"followed": false}, nil), http.StatusOK)
+	s.expect(s.do("POST", "/api/moderation/reports/"+userReport.ID+"/resolve", other.Token, map[string]string{"action": "warn"}, nil), http.StatusOK)
+	var notes struct {
+		Notifications []struct {
+			Type string `json:"type"`
+			ActorID *string `json:"actor_id"`
+		} `json:"notifications"`
+	}
+	s.expect(s.do("GET", "/api/notifications", jesse.Token, nil, &notes), http.StatusOK)
+	if len(notes.Notifications) != 1 || notes.Notifications[0].Type != "warning" || notes.Notifications[0].ActorID != nil {
+		t.Errorf("expect an anonymous warning, got %+v", notes.Notifications)
+	}
+
+	var dismissed report
+	s.expect(s.do("POST", "/api/reports", walt.Token, map[string]string{"user_id": jesse.ID, "reason": "other"}, &dismissed), http.StatusCreated)
+	s.expect(s.do("POST", "/api/moderation/reports/"+dismissed.ID+"/dismiss", mod.Token, nil, &dismissed), http.StatusOK)
+	if dismissed.Status != "dismissed" {
+		t.Errorf("expect dismissed, got %+v", dismissed)
+	}
+
+	var log struct {
+		Entries []struct {
+			ModeratorID string `json:"moderator_id"`
+			Action string `json:"action"`
+			Note string `json:"note"`
+		} `json:"entries"`
+	}
+	s.expect(s.do("GET", "/api/moderation/log", mod.Token, nil, &log), http.StatusOK)
+	var actions []string
+	for _, e := range log.Entries {
+		actions = append(actions, e.Action)
+	}
+	if !slices.Equal(actions, []string{"dismiss", "warn", "delete_chirp", "claim"}) {
+		t.Errorf("expect every action latest first, got %v", actions)
+	}
+	if log.Entries[2].Note != "spam link" {
+		t.Errorf("expect the note logged, got %+v", log.Entries[2])
+	}
+
+	// the log outlives a reset, moderators don't
+	s.expect(s.do("POST", "/admin/reset", "", nil, nil), http.StatusOK)
+	if entries, _ := s.store.ListModerationLog(context.Background(), database.ListModerationLogParams{Before: time.Now().Add(time.Hour), BeforeID: uuid.Max, MaxRows: 10}); len(entries) != 4 {
+		t.Errorf("expect the log kept, got %v", entries)
+	}
+	s.expect(s.do("DELETE", "/admin/moderators/"+mod.ID, "", nil, nil), http.StatusNoContent)
+}
+
+func TestSuspensions(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+	var yo testChirp
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "yo"}, &yo), http.StatusCreated)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "hi"}, nil), http.StatusCreated)
+
+	path := "/admin/users/" + jesse.ID + "/suspensions"
+	s.expect(s.do("POST", path, "", map[string]any{"reason": "spam"}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", path, "", map[string]any{"reason": "spam", "ban": true, "expires_at": time.Now().Add(time.Hour)}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", path, "", map[string]any{"reason": "spam", "expires_at": time.Now().Add(-time.Hour)}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/admin/users/"+uuid.NewString()+"/suspensions", "", map[string]any{"reason": "spam", "ban": true}, nil), http.StatusNotFound)
+	s.expect(s.do("POST", path, "", map[string]any{"reason": "spam", "expires_at": time.Now().Add(time.Hour)}, nil), http.StatusCreated)
+
+	// the tokens from before the suspension stop working and no new ones
+	// are handed out
+	s.expect(s.do("GET", "/api/notifications", jesse.Token, nil, nil), http.StatusForbidden)
+	s.expect(s.do("POST", "/api/refresh", jesse.RefreshToken, nil, nil), http.StatusUnauthorized)
+	s.expect(s.do("POST", "/api/login", "", map[string]string{"email": jesse.Email, "password": "hunter2"}, nil), http.StatusForbidden)
+	s.expect(s.do("GET", "/api/notifications", walt.Token, nil, nil), http.StatusOK)
+
+	// jesse's chirps are out of the listings but kept
+	var chirps []testChirp
+	s.expect(s.do("GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 1 || chirps[0].UserID != walt.ID {
+		t.Errorf("expect only walt's chirp, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps/"+yo.ID, "", nil, nil), http.StatusNotFound)
+	s.expect(s.do("GET", "/api/chirps/"+yo.ID, walt.Token, nil, nil), http.StatusNotFound)
+
+	s.expect(s.do("POST", path, "", map[string]any{"reason": "again", "ban": true}, nil), http.StatusCreated)
+	var suspensions []struct {
+		Reason string `json:"reason"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		LiftedAt *time.Time `json:"lifted_at"`
+	}
+	s.expect(s.do("GET", path, "", nil, &suspensions), http.StatusOK)
+	if len(suspensions) != 2 || suspensions[0].ExpiresAt != nil {
+		t.Errorf("expect the ban then the suspension, got %v", suspensions)
+	}
+
+	s.expect(s.do("DELETE", path, "", nil, nil), http.StatusNoContent)
+	s.expect(s.do("DELETE", path, "", nil, nil), http.StatusNotFound)
+	s.expect(s.do("GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 2 {
+		t.Errorf("expect both chirps once lifted, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps/"+yo.ID, "", nil, nil), http.StatusOK)
+	s.expect(s.do("POST", "/api/login", "", map[string]string{"email": jesse.Email, "password": "hunter2"}, nil), http.StatusOK)
+	s.expect(s.do("GET", path, "", nil, &suspensions), http.StatusOK)
+	if len(suspensions) != 2 || suspensions[0].LiftedAt == nil || suspensions[1].LiftedAt == nil {
+		t.Errorf("expect both kept as lifted, got %v", suspensions)
+	}
+}
+
+func TestContentFilter(t *testing.T) {
+	s := newTestServer(t)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+	mod := s.signup("mod@example.com")
+	s.expect(s.do("POST", "/admin/moderators", "", map[string]string{"user_id": mod.ID}, nil), http.StatusNoContent)
+
+	// the default rules mask, look-alike letters included
+	var chirp testChirp
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "what a kеrfuffle, Fornax!"}, &chirp), http.StatusCreated)
+	if chirp.Body != "what a ****, ****!" {
+		t.Errorf("expect masked, got %q", chirp.Body)
+	}
+
+	s.expect(s.do("POST", "/admin/filter/rules", "", map[string]string{"kind": "glob", "pattern": "x", "action": "mask"}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/admin/filter/rules", "", map[string]string{"kind": "regex", "pattern": "(", "action": "mask"}, nil), http.StatusBadRequest)
+	var reject, hold database.FilterRule
+	s.expect(s.do("POST", "/admin/filter/rules", "", map[string]string{"kind": "word", "pattern": "scam", "action": "reject"}, &reject), http.StatusCreated)
+	s.expect(s.do("POST", "/admin/filter/rules", "", map[string]string{"kind": "regex", "pattern": `buy\s+now`, "action": "hold"}, &hold), http.StatusCreated)
+	var rules []database.FilterRule
+	s.expect(s.do("GET", "/admin/filter/rules", "", nil, &rules), http.StatusOK)
+	if len(rules) != 2 {
+		t.Errorf("expect 2 rules, got %v", rules)
+	}
+
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "not a 5C4M"}, nil), http.StatusBadRequest)
+
+	// a held chirp waits for a moderator, seen only by its author
+	var held struct {
+		testChirp
+		Held bool `json:"held"`
+	}
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "BUY  NOW @walt"}, &held), http.StatusCreated)
+	if !held.Held {
+		t.Fatalf("expect held, got %+v", held)
+	}
+	var chirps []testChirp
+	s.expect(s.do("GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 1 {
+		t.Errorf("expect the held chirp out of the listing, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/chirps/"+held.ID, walt.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("GET", "/api/chirps/"+held.ID, jesse.Token, nil, nil), http.StatusOK)
+	s.expect(s.do("POST", "/api/chirps/"+held.ID+"/pin", jesse.Token, nil, nil), http.StatusForbidden)
+	var unread map[string]int
+	s.expect(s.do("GET", "/api/notifications/unread_count", walt.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 0 {
+		t.Errorf("expect no mention while held, got %v", unread)
+	}
+
+	var queue struct {
+		Chirps []testChirp `json:"chirps"`
+	}
+	s.expect(s.do("GET", "/api/moderation/chirps", walt.Token, nil, nil), http.StatusForbidden)
+	s.expect(s.do("GET", "/api/moderation/chirps", mod.Token, nil, &queue), http.StatusOK)
+	if len(queue.Chirps) != 1 || queue.Chirps[0].ID != held.ID {
+		t.Fatalf("expect the held chirp queued, got %+v", queue)
+	}
+	s.expect(s.do("POST", "/api/moderation/chirps/"+chirp.ID+"/approve", mod.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("POST", "/api/moderation/chirps/"+held.ID+"/approve", mod.Token, nil, nil), http.StatusOK)
+	s.expect(s.do("GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 2 {
+		t.Errorf("expect the approved chirp listed, got %v", chirps)
+	}
+	s.expect(s.do("GET", "/api/notifications/unread_count", walt.Token, nil, &unread), http.StatusOK)
+	if unread["unread_count"] != 1 {
+		t.Errorf("expect the mention once approved, got %v", unread)
+	}
+
+	s.expect(s.do("POST", "/api/chirps", jesse.Token, map[string]string{"body": "buy now"}, &held), http.StatusCreated)
+	s.expect(s.do("POST", "/api/moderation/chirps/"+held.ID+"/reject", mod.Token, map[string]string{"note": "ad"}, nil), http.StatusNoContent)
+	s.expect(s.do("GET", "/api/chirps/"+held.ID, jesse.Token, nil, nil), http.StatusNotFound)
+
+	var log struct {
+		Entries []struct {
+			Action string `json:"action"`
+		} `json:"entries"`
+	}
+	s.expect(s.do("GET", "/api/moderation/log", mod.Token, nil, &log), http.StatusOK)
+	if len(log.Entries) != 2 || log.Entries[0].Action != "reject_chirp" || log.Entries[1].Action != "approve_chirp" {
+		t.Errorf("expect the reject then the approve logged, got %+v", log.Entries)
+	}
+
+	// changes to the rules take effect at once
+	s.expect(s.do("PUT", "/admin/filter/rules/"+reject.ID.String(), "", map[string]string{"kind": "word", "pattern": "scam", "action": "mask"}, nil), http.StatusOK)
+	s.expect(s.do("POST", "/api/chirps", walt.Token, map[string]string{"body": "scam"}, &chirp), http.StatusCreated)
+	if chirp.Body != "****" {
+		t.Errorf("expect masked, got %q", chirp.Body)
+	}
+	s.expect(s.do("DELETE", "/admin/filter/rules/"+hold.ID.String(), "", nil, nil), http.StatusNoContent)
+	s.expect(s.do("DELETE", "/admin/filter/rules/"+hold.ID.String(), "", nil, nil), http.StatusNotFound)
+	var reloaded struct {
+		Rules int `json:"rules"`
+	}
+	s.expect(s.do("POST", "/admin/filter/reload", "", nil, &reloaded), http.StatusOK)
+	if reloaded.Rules != len(moderation.Default)+1 {
+		t.Errorf("expect the default rules and one added, got %d", reloaded.Rules)
+	}
+}
+
+// upload posts data as the file of a multipart form, decoding a JSON
+// response into out when given.
+func (s *testServer) upload(token, field string, data []byte, out any) *http.Response {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile(field, "image.png")
+	part.Write(data)
+	form.Close()
+
+	req, _ := http.NewRequest("POST", s.srv.URL+"/api/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.srv.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp
+}
+
+func TestMedia(t *testing.T) {
+	cfg := config.Default()
+	cfg.Media.MaxBytes = 1 << 10
+	s := newTestServerConfig(t, cfg)
+	walt := s.signup("walt@example.com")
+	jesse := s.signup("jesse@example.com")
+
+	type testMedia struct {
+		ID string `json:"id"`
+		ContentType string `json:"content_type"`
+		Size int64 `json:"size"`
+		URL string `json:"url"`
+	}
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	var uploads []testMedia
+	for range 5 {
+		var md testMedia
+		s.expect(s.upload(walt.Token, "file", png, &md), http.StatusCreated)
+		uploads = append(uploads, md)
+	}
+	if uploads[0].ContentType != "image/png" || uploads[0].Size != int64(len(png)) || uploads[0].URL == "" {
+		t.Fatalf("unexpected upload %#v", uploads[0])
+	}
+
+	s.expect(s.upload("", "file", png, nil), http.StatusUnauthorized)
+	s.expect(s.upload(walt.Token, "file", []byte("<html><script>alert(1)</script></html>"), nil), http.StatusUnsupportedMediaType)
+	s.expect(s.upload(walt.Token, "file", append(png, make([]byte, 1<<10)...), nil), http.StatusRequestEntityTooLarge)
+	s.expect(s.upload(walt.Token, "image", png, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/api/media", walt.Token, map[string]string{"file": "x"}, nil), http.StatusBadRequest)
+
+	// the signed link serves the file to anyone holding it
+	resp := s.do("GET", uploads[0].URL, "", nil, nil)
+	s.expect(resp, http.StatusOK)
+	if resp.Header.Get("Content-Type") != "image/png" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("unexpected headers %v", resp.Header)
+	}
+	s.expect(s.do("GET", strings.Replace(uploads[0].URL, uploads[0].ID, uploads[1].ID, 1), "", nil, nil), http.StatusForbidden)
+	s.expect(s.do("GET", "/api/media/"+uploads[0].ID, "", nil, nil), http.StatusForbidden)
+
+	// at most 4 images, owned by the author and in no other chirp
+	ids := func(mds ...testMedia) []string {
+		var ret []string
+		for _, md := range mds {
+			ret = append(ret, md.ID)
+		}
+		return ret
+	}
+	chirpWith := func(token string, mediaIDs []string, out any) *http.Response {
+		return s.do("POST", "/api/chirps", token, map[string]any{"body": "look", "media_ids": mediaIDs}, out)
+	}
+	s.expect(chirpWith(walt.Token, ids(uploads...), nil), http.StatusBadRequest)
+	s.expect(chirpWith(walt.Token, ids(uploads[0], uploads[0]), nil), http.StatusBadRequest)
+	s.expect(chirpWith(jesse.Token, ids(uploads[0]), nil), http.StatusBadRequest)
+
+	type chirpWithMedia struct {
+		ID string `json:"id"`
+		Media []testMedia `json:"media"`
+	}
+	var chirp chirpWithMedia
+	s.expect(chirpWith(walt.Token, ids(uploads[1], uploads[0]), &chirp), http.StatusCreated)
+	if len(chirp.Media) != 2 || chirp.Media[0].ID != uploads[1].ID || chirp.Media[1].ID != uploads[0].ID {
+		t.Errorf("expect the images in order, got %#v", chirp.Media)
+	}
+	s.expect(chirpWith(walt.Token, ids(uploads[2], uploads[0]), nil), http.StatusBadRequest)
+
+	// the failed chirps weren't created, and the images show in the listings
+	var chirps []chirpWithMedia
+	s.expect(s.do("GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+	if len(chirps) != 1 || len(chirps[0].Media) != 2 {
+		t.Fatalf("expect one chirp with 2 images, got %#v", chirps)
+	}
+	s.expect(s.do("GET", chirps[0].Media[0].URL, "", nil, nil), http.StatusOK)
+
+	// links expire
+	s.conf.MediaLinks.Now = func() time.Time { return time.Now().Add(2 * cfg.Media.URLTTL) }
+	s.expect(s.do("GET", uploads[0].URL, "", nil, nil), http.StatusForbidden)
+	s.conf.MediaLinks.Now = time.Now
+
+	// and stop working with the chirp deleted, its files gone from the store
+	s.expect(s.do("DELETE", "/api/chirps/"+chirp.ID, walt.Token, nil, nil), http.StatusNoContent)
+	s.expect(s.do("GET", uploads[0].URL, "", nil, nil), http.StatusNotFound)
+	for _, md := range uploads[:2] {
+		id, _ := uuid.Parse(md.ID)
+		if _, err := s.conf.Blobs.Get(context.Background(), media.Key(id)); !errors.Is(err, media.ErrNotFound) {
+			t.Errorf("expect the file of %s deleted, got %v", md.ID, err)
+		}
+	}
+
+	// uploads never attached are swept once too old
+	if n, err := s.conf.deleteUploads(context.Background(), time.Now().Add(-time.Hour)); n != 0 || err != nil {
+		t.Errorf("expect the recent uploads kept, got %d %v", n, err)
+	}
+	if n, err := s.conf.deleteUploads(context.Background(), time.Now().Add(time.Minute)); n != 3 || err != nil {
+		t.Errorf("expect 3 uploads swept, got %d %v", n, err)
+	}
+	s.expect(s.do("GET", uploads[4].URL, "", nil, nil), http.StatusNotFound)
+	id, _ := uuid.Parse(uploads[4].ID)
+	if _, err := s.conf.Blobs.Get(context.Background(), media.Key(id)); !errors.Is(err, media.ErrNotFound) {
+		t.Errorf("expect the swept file deleted, got %v", err)
+	}
+}
@@ -3,111 +3,292 @@ package main
 import (
 	"os"
 	"log"
+	"log/slog"
+	"context"
+	"errors"
+	"time"
 	"net/http"
+	"crypto/tls"
+	"sync"
 	"sync/atomic"
-	"database/sql"
-	_ "github.com/lib/pq"
+	"syscall"
+	"os/signal"
 
 	"github.com/joho/godotenv"
 
-	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/certs"
+	"github.com/dubbersthehoser/httpserver/internal/config"
+	"github.com/dubbersthehoser/httpserver/internal/entitlements"
+	"github.com/dubbersthehoser/httpserver/internal/logging"
+	"github.com/dubbersthehoser/httpserver/internal/media"
+	"github.com/dubbersthehoser/httpserver/internal/metrics"
+	"github.com/dubbersthehoser/httpserver/internal/moderation"
+	"github.com/dubbersthehoser/httpserver/internal/ratelimit"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+	"github.com/dubbersthehoser/httpserver/internal/stream"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
 	
 )
 
-const ChirpSize int = 140
-const servFiles string = "./servfiles"
+// Polka webhook deliveries older or newer than this are rejected.
+const polkaTolerance = 5 * time.Minute
+// polkaMaxBytes caps the body of a Polka webhook, which is a small event.
+const polkaMaxBytes = 64 << 10
+const polkaSource string = "polka"
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
-	DBQ *database.Queries
+	Store store.Store
 	Platform string
 	JWTSecret string
 	PolkaKey string
+	AccessTTL time.Duration
+	RefreshTTL time.Duration
+	Plans entitlements.Plans
+	Metrics *metrics.Metrics
+	Limiter ratelimit.Limiter
+	Proxies ratelimit.Proxies
+	// Broker feeds the chirp streams, Events publishes to every instance's
+	// broker through Postgres LISTEN/NOTIFY, or only to the local broker
+	// without Postgres.
+	Broker *stream.Broker
+	Events stream.Publisher
+	// Filter checks the chirps, its rules are from FilterFile and the store.
+	Filter *moderation.Engine
+	FilterFile string
+	filterMu sync.Mutex
+	// Blobs keeps the uploaded images, handed out with links signed by
+	// MediaLinks.
+	Blobs media.BlobStore
+	MediaLinks *media.Signer
+	MediaMaxBytes int64
+	// WebhookGuard refuses the webhooks to internal addresses.
+	WebhookGuard webhooks.Guard
 }
 
 func main() {
 	
-	file, err := os.OpenFile("chirpy.log", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0o664)
+	godotenv.Load()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.SetOutput(file)
-	
-	godotenv.Load()
 
-	dbURL := os.Getenv("DB_URL")
-	jwtSecret := os.Getenv("JWT_SECRET_KEY")
-	polkaKey := os.Getenv("POLKA_KEY")
-	platform := os.Getenv("PLATFORM")
+	logger := logging.New(logging.Options{
+		File: cfg.Log.File,
+		MaxSizeMB: 100,
+		MaxBackups: 5,
+		MaxAgeDays: 28,
+		Level: logging.ParseLevel(cfg.Log.Level),
+	})
+	slog.SetDefault(logger)
+
+	plans := entitlements.Default
+	if cfg.Limits.PlansFile != "" {
+		loaded, err := entitlements.Load(cfg.Limits.PlansFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		plans = loaded
+	}
 
-	db, err := sql.Open("postgres", dbURL)
+	db, driver, err := store.Open(cfg.DB.URL)
 	if err != nil {
 		log.Fatal(err)
 	}
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DB.ConnMaxLifetime)
+
+	if err := checkSchema(context.Background(), db, driver, cfg.DB.AutoMigrate); err != nil {
+		log.Fatal(err)
+	}
 
-	dbQueries := database.New(db)
+	st, err := store.New(driver, db)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	conf := apiConfig{
-		DBQ: dbQueries,
-		Platform: platform,
-		JWTSecret: jwtSecret,
-		PolkaKey: polkaKey,
+		Store: st,
+		Platform: cfg.Platform,
+		JWTSecret: cfg.JWTSecret,
+		PolkaKey: cfg.PolkaKey,
+		AccessTTL: cfg.Tokens.AccessTTL,
+		RefreshTTL: cfg.Tokens.RefreshTTL,
+		Plans: plans,
+		Metrics: metrics.New(db),
+		Filter: moderation.NewEngine(nil),
+		FilterFile: cfg.Filter.RulesFile,
+		MediaLinks: media.NewSigner([]byte(cfg.JWTSecret), cfg.Media.URLTTL),
+		MediaMaxBytes: cfg.Media.MaxBytes,
+	}
+	if err := conf.reloadFilter(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	conf.Blobs, err = openBlobStore(cfg.Media)
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	conf.Proxies, err = ratelimit.ParseProxies(cfg.RateLimit.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf.WebhookGuard.Allow, err = webhooks.ParseNetworks(cfg.Webhooks.AllowNetworks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch cfg.RateLimit.Store {
+	case "postgres":
+		if driver != "postgres" {
+			log.Fatal("RATE_LIMIT_STORE=postgres needs a Postgres DB_URL")
+		}
+		conf.Limiter = ratelimit.NewPostgres(db)
+	default:
+		conf.Limiter = ratelimit.NewMemory()
+	}
 
-	sMux := http.NewServeMux()
 
-	// Main Page
-	appHandler := http.StripPrefix("/app/", http.FileServer(http.Dir(servFiles + "/app")))
-	sMux.Handle("/app/", conf.middlewareMetricsInc(appHandler))
+	// stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// assets
-	appAssetsHandler := http.StripPrefix("/app/assets/", http.FileServer(http.Dir(servFiles + "/app/assets")))
-	sMux.Handle("/app/assets/", conf.middlewareMetricsInc(appAssetsHandler))
+	var workers sync.WaitGroup
+	workers.Add(5)
+	go func() {
+		defer workers.Done()
+		conf.sweepSubscriptions(ctx, subscriptionSweepInterval)
+	}()
+	go func() {
+		defer workers.Done()
+		conf.sweepRateLimits(ctx, rateLimitSweepInterval)
+	}()
+	go func() {
+		defer workers.Done()
+		conf.watchFilter(ctx, cfg.Filter.ReloadInterval)
+	}()
+	go func() {
+		defer workers.Done()
+		conf.sweepUploads(ctx, uploadSweepInterval, cfg.Media.UploadTTL)
+	}()
 
-	// server status
-	readinessHandler := http.HandlerFunc(ReadinessHandler)
-	sMux.Handle("GET /api/healthz", conf.middlewareMetricsInc(readinessHandler))
+	conf.Broker = stream.NewBroker(streamReplaySize)
+	conf.Events = conf.Broker
+	if driver == "postgres" {
+		// fan out through Postgres so every instance streams every chirp
+		events := stream.NewPostgres(db, cfg.DB.URL, conf.Broker)
+		conf.Events = events
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if err := events.Run(ctx); err != nil {
+				slog.Error("chirp events listener stopped", "err", err)
+			}
+		}()
+	}
 
-	// users
-	addUserHandler := http.HandlerFunc(conf.AddUserHandler)
-	updateUserHandler := http.HandlerFunc(conf.UpdateUserHandler)
+	dispatcher := webhooks.NewDispatcher(webhooks.QueryStore{Q: st}, conf.WebhookGuard)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(ctx)
+	}()
 
-	sMux.Handle("POST /api/users", conf.middlewareMetricsInc(addUserHandler))
-	sMux.Handle("PUT /api/users", conf.middlewareMetricsInc(updateUserHandler))
+	var tlsConf *tls.Config
+	if cfg.TLS.Enabled() {
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tlsConf, err = certs.ServerConfig(reloader, certs.Options{
+			MinVersion: cfg.TLS.MinVersion,
+			CipherSuites: cfg.TLS.CipherSuites,
+			ClientCAFile: cfg.TLS.ClientCAFile,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	// auth
-	refreshToken := http.HandlerFunc(conf.RefreshToken)
-	revokeToken := http.HandlerFunc(conf.RevokeToken)
-	loginUserHandler := http.HandlerFunc(conf.LoginUserHandler)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			watchCertificate(ctx, reloader, cfg.TLS.ReloadInterval)
+		}()
+	}
 
-	sMux.Handle("POST /api/refresh", conf.middlewareMetricsInc(refreshToken))
-	sMux.Handle("POST /api/revoke", conf.middlewareMetricsInc(revokeToken))
-	sMux.Handle("POST /api/login", conf.middlewareMetricsInc(loginUserHandler))
+	routes, err := conf.routes(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// chirps / users posts
-	createChirpHandler := http.HandlerFunc(conf.CreateChirpHandler)
-	getAllChirpHandler := http.HandlerFunc(conf.GetAllChirpsHandler)
-	getAChirpHandler := http.HandlerFunc(conf.GetAChirpHandler)
-	removeAChirpHandler := http.HandlerFunc(conf.RemoveChirpHandler)
+	s := &http.Server{
+		Addr: cfg.Addr,
+		TLSConfig: tlsConf,
+		Handler: serverHandler(cfg, logger, routes),
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		ReadTimeout: cfg.Timeouts.Read,
+		WriteTimeout: cfg.Timeouts.Write,
+		IdleTimeout: cfg.Timeouts.Idle,
+	}
+	// streams never go idle, end them so the shutdown doesn't wait on them
+	s.RegisterOnShutdown(conf.Broker.Close)
 
-	sMux.Handle("POST /api/chirps", conf.middlewareMetricsInc(createChirpHandler))
-	sMux.Handle("GET /api/chirps", conf.middlewareMetricsInc(getAllChirpHandler))
-	sMux.Handle("GET /api/chirps/{ChirpID}", conf.middlewareMetricsInc(getAChirpHandler))
-	sMux.Handle("DELETE /api/chirps/{ChirpID}", conf.middlewareMetricsInc(removeAChirpHandler))
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("chirpy listening", "addr", s.Addr, "tls", cfg.TLS.Enabled())
+		if cfg.TLS.Enabled() {
+			// the certificate comes from TLSConfig so it can be reloaded
+			serveErr <- s.ListenAndServeTLS("", "")
+			return
+		}
+		serveErr <- s.ListenAndServe()
+	}()
 
-	// admin
-	sMux.HandleFunc("GET /admin/metrics", conf.AdminHandler)
-	sMux.HandleFunc("POST /admin/reset", conf.AdminResetHandler)
+	var redirect *http.Server
+	if cfg.TLS.RedirectAddr != "" {
+		redirect = &http.Server{
+			Addr: cfg.TLS.RedirectAddr,
+			Handler: redirectHTTPS(cfg.Addr),
+			ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		}
+		go func() {
+			slog.Info("redirecting to https", "addr", redirect.Addr)
+			serveErr <- redirect.ListenAndServe()
+		}()
+	}
 
-	// chirpy red
-	polkaHandler := http.HandlerFunc(conf.PolkaHandler)
-	sMux.Handle("POST /api/polka/webhooks", conf.middlewareMetricsInc(polkaHandler))
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped", "err", err)
+		}
+		stop()
+	case <-ctx.Done():
+		slog.Info("shutting down", "drain_timeout", cfg.Timeouts.Shutdown.String())
+	}
 
-	s := &http.Server{
-		Addr: ":8080",
-		Handler: sMux,
+	// drain in flight requests
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown", "err", err)
+	}
+	if redirect != nil {
+		if err := redirect.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutdown redirect", "err", err)
+		}
 	}
 
-	log.Fatal(s.ListenAndServe())
+	workers.Wait()
+	if err := db.Close(); err != nil {
+		slog.Error("closing database", "err", err)
+	}
+	slog.Info("chirpy stopped")
 }
+
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"io"
+	"fmt"
+	"errors"
+	"context"
+	"time"
+	"strconv"
+	"log/slog"
+	"net/http"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/config"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/media"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+// maxChirpMedia is how many images a chirp can have.
+const maxChirpMedia = 4
+
+// uploadOverhead is the room left in the body of an upload for the
+// multipart boundaries and headers around the file.
+const uploadOverhead = 64 << 10
+
+// uploadSweepInterval is how often the uploads in no chirp are looked for.
+const uploadSweepInterval = 5 * time.Minute
+
+// errMediaTaken is returned from a transaction attaching media that is
+// missing, of another user or already in a chirp.
+var errMediaTaken = errors.New("media not found or already attached")
+
+// openBlobStore opens the store of the uploaded images.
+func openBlobStore(cfg config.Media) (media.BlobStore, error) {
+	if cfg.Store == "s3" {
+		return media.NewS3(media.S3Config{
+			Endpoint: cfg.S3.Endpoint,
+			Region: cfg.S3.Region,
+			Bucket: cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PathStyle: cfg.S3.PathStyle,
+		})
+	}
+	return media.NewFS(cfg.Dir)
+}
+
+/******************************
+	MEDIA HANDLERS
+*******************************/
+
+type ReturnMedia struct {
+	ID uuid.UUID `json:"id"`
+	ContentType string `json:"content_type"`
+	Size int64 `json:"size"`
+	// URL is a link to the file signed for a limited time.
+	URL string `json:"url"`
+}
+
+// ReturnChirp is a chirp with its images.
+type ReturnChirp struct {
+	database.Chirp
+	Media []ReturnMedia `json:"media"`
+}
+
+func (a *apiConfig) returnMedia(md database.Media) ReturnMedia {
+	return ReturnMedia{
+		ID: md.ID,
+		ContentType: md.ContentType,
+		Size: md.Size,
+		URL: "/api/media/" + md.ID.String() + "?" + a.MediaLinks.Query(md.ID),
+	}
+}
+
+// withMedia adds their images to chirps, in one query.
+func (a *apiConfig) withMedia(ctx context.Context, chirps []database.Chirp) ([]ReturnChirp, error) {
+	ret := make([]ReturnChirp, len(chirps))
+	if len(chirps) == 0 {
+		return ret, nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	}
+	all, err := a.Store.ListMediaByChirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byChirp := map[uuid.UUID][]ReturnMedia{}
+	for _, md := range all {
+		byChirp[md.ChirpID.UUID] = append(byChirp[md.ChirpID.UUID], a.returnMedia(md))
+	}
+
+	for i, c := range chirps {
+		ret[i] = ReturnChirp{Chirp: c, Media: byChirp[c.ID]}
+		if ret[i].Media == nil {
+			ret[i].Media = []ReturnMedia{}
+		}
+	}
+	return ret, nil
+}
+
+// respondChirp writes chirp with its images.
+func (a *apiConfig) respondChirp(w http.ResponseWriter, r *http.Request, status int, chirp database.Chirp) {
+	ret, err := a.withMedia(r.Context(), []database.Chirp{chirp})
+	if somethingError(err, w, r) {
+		return
+	}
+	respond.JSON(w, status, ret[0])
+}
+
+// respondChirps writes chirps with their images.
+func (a *apiConfig) respondChirps(w http.ResponseWriter, r *http.Request, chirps []database.Chirp) {
+	ret, err := a.withMedia(r.Context(), chirps)
+	if somethingError(err, w, r) {
+		return
+	}
+	respond.JSON(w, http.StatusOK, ret)
+}
+
+// attachMedia attaches the uploads of uid to chirp, in the order given.
+func attachMedia(ctx context.Context, q store.Queries, uid uuid.UUID, chirp database.Chirp, ids []uuid.UUID) error {
+	for i, id := range ids {
+		n, err := q.AttachMedia(ctx, database.AttachMediaParams{
+			ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			Position: int32(i),
+			ID: id,
+			UserID: uid,
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errMediaTaken
+		}
+	}
+	return nil
+}
+
+// deleteChirp deletes the chirp in q, returning its images, whose files are
+// deleted with deleteFiles once the transaction commits.
+func deleteChirp(ctx context.Context, q store.Queries, id uuid.UUID) ([]database.Media, error) {
+	media, err := q.ListMediaByChirps(ctx, []uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+	return media, q.DeleteChirp(ctx, id)
+}
+
+// deleteFiles deletes the files of deleted media from the blob store. A file
+// left behind harms nobody, so the failures are only logged.
+func (a *apiConfig) deleteFiles(ctx context.Context, deleted []database.Media) {
+	// the request may be gone, the files are deleted anyway
+	ctx = context.WithoutCancel(ctx)
+	for _, md := range deleted {
+		if err := a.Blobs.Delete(ctx, media.Key(md.ID)); err != nil {
+			slog.ErrorContext(ctx, "delete media file", "media_id", md.ID, "err", err)
+		}
+	}
+}
+
+// deleteUploads deletes the uploads created before the time that are in no
+// chirp, returning how many.
+func (a *apiConfig) deleteUploads(ctx context.Context, before time.Time) (int, error) {
+	uploads, err := a.Store.ListUnattachedMedia(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, md := range uploads {
+		// the row goes first, an upload attached in the meantime is kept
+		n, err := a.Store.DeleteUnattachedMedia(ctx, md.ID)
+		if err != nil {
+			return deleted, err
+		}
+		if n == 0 {
+			continue
+		}
+		a.deleteFiles(ctx, []database.Media{md})
+		deleted++
+	}
+	return deleted, nil
+}
+
+// sweepUploads deletes the uploads never attached to a chirp once they are
+// older than ttl.
+func (a *apiConfig) sweepUploads(ctx context.Context, interval, ttl time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := a.deleteUploads(ctx, time.Now().Add(-ttl))
+		if err != nil {
+			slog.ErrorContext(ctx, "upload sweep", "err", err)
+		} else if n > 0 {
+			slog.InfoContext(ctx, "upload sweep: deleted uploads", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validMediaIDs checks the images to attach to a chirp, writing a 400 and
+// returning false when they're invalid.
+func validMediaIDs(w http.ResponseWriter, r *http.Request, ids []uuid.UUID) bool {
+	if len(ids) > maxChirpMedia {
+		respond.Validation(w, r, respond.FieldError{Field: "media_ids", Message: fmt.Sprintf("At most %d images", maxChirpMedia)})
+		return false
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			respond.Validation(w, r, respond.FieldError{Field: "media_ids", Message: "Duplicate media id"})
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+// uploadError writes the error of reading or storing an upload.
+func uploadError(err error, w http.ResponseWriter, r *http.Request) bool {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, media.ErrTooLarge), errors.As(err, &tooLarge):
+		respond.Error(w, r, http.StatusRequestEntityTooLarge, "Image is too large")
+	case errors.Is(err, media.ErrUnsupported):
+		respond.Error(w, r, http.StatusUnsupportedMediaType, "Only GIF, JPEG, PNG and WebP images are accepted")
+	default:
+		respond.InternalError(w, r, err)
+	}
+	return true
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// UploadMediaHandler stores the image in the "file" part of a multipart
+// form, streamed to the blob store. The type is sniffed from the file
+// itself, whatever the client says it is.
+func (a *apiConfig) UploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Expected a multipart/form-data body")
+		return
+	}
+	var part io.Reader
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			respond.Validation(w, r, respond.FieldError{Field: "file", Message: "Is required"})
+			return
+		} else if decodeError(err, w, r) {
+			return
+		}
+		if p.FormName() == "file" {
+			part = p
+			break
+		}
+	}
+
+	contentType, file, err := media.Sniff(media.LimitReader(part, a.MediaMaxBytes))
+	if uploadError(err, w, r) {
+		return
+	}
+
+	id := uuid.New()
+	counted := &countingReader{r: file}
+	err = a.Blobs.Put(r.Context(), media.Key(id), counted, -1, contentType)
+	if uploadError(err, w, r) {
+		return
+	}
+
+	md, err := a.Store.CreateMedia(r.Context(), database.CreateMediaParams{
+		ID: id,
+		UserID: uid,
+		ContentType: contentType,
+		Size: counted.n,
+	})
+	if err != nil {
+		// the request may be gone, the file is deleted anyway
+		if err := a.Blobs.Delete(context.WithoutCancel(r.Context()), media.Key(id)); err != nil {
+			slog.ErrorContext(r.Context(), "delete orphaned upload", "media_id", id, "err", err)
+		}
+	}
+	if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, a.returnMedia(md))
+}
+
+// GetMediaHandler serves the file of a signed link.
+func (a *apiConfig) GetMediaHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := uuid.Parse(r.PathValue("MediaID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusNotFound, "Media not found")
+		return
+	}
+
+	expires, err := a.MediaLinks.Verify(id, r.URL.Query())
+	if errors.Is(err, media.ErrLinkExpired) {
+		respond.Error(w, r, http.StatusForbidden, "Link expired")
+		return
+	} else if err != nil {
+		respond.Error(w, r, http.StatusForbidden, "Invalid link signature")
+		return
+	}
+
+	md, err := a.Store.GetMedia(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "Media not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+
+	file, err := a.Blobs.Get(r.Context(), media.Key(id))
+	if errors.Is(err, media.ErrNotFound) {
+		respond.Error(w, r, http.StatusNotFound, "Media not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+	defer file.Close()
+
+	// the file is cacheable as long as the link works, and never run as
+	// anything but the image it was sniffed as
+	maxAge := int(expires.Sub(a.MediaLinks.Now()).Seconds())
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+	w.Header().Set("Content-Type", md.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(md.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		slog.InfoContext(r.Context(), "serve media", "media_id", id, "err", err)
+	}
+}
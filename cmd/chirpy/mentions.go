@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+// mentionPattern finds @handles that don't sit inside a word or an email.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.+-]+)`)
+
+// handlePattern is what a chosen handle may be: up to 30 lower case letters,
+// digits, _, . and -, neither starting nor ending with . or - so that a
+// mention at the end of a sentence finds it.
+var handlePattern = regexp.MustCompile(`^[a-z0-9_](?:[a-z0-9_.-]{0,28}[a-z0-9_])?$`)
+
+// maxEmailHandle leaves room in a handle from an email for the number
+// freeHandle puts after it.
+const maxEmailHandle = 24
+
+// mentionedHandles are the handles mentioned in body, lower cased, with
+// trailing punctuation like "@walt." dropped.
+func mentionedHandles(body string) []string {
+	var handles []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.TrimRight(m[1], ".-+")
+		if handle != "" {
+			handles = append(handles, strings.ToLower(handle))
+		}
+	}
+	return handles
+}
+
+// emailHandle is the handle of a user who didn't choose one: the part of
+// their email before the @, without what a handle can't have.
+func emailHandle(email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	handle := strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') || strings.ContainsRune("_.-", r) {
+			return r
+		}
+		return -1
+	}, local)
+	handle = strings.Trim(handle, ".-")
+	if len(handle) > maxEmailHandle {
+		handle = strings.TrimRight(handle[:maxEmailHandle], ".-")
+	}
+	if handle == "" {
+		return "user"
+	}
+	return handle
+}
+
+// freeHandle returns handle, or else handle with the first number after it
+// that makes it a handle no user has.
+func freeHandle(ctx context.Context, q store.Queries, handle string) (string, error) {
+	candidate := handle
+	for n := 2; ; n++ {
+		ids, err := q.GetUserIDsByHandles(ctx, []string{candidate})
+		if err != nil {
+			return "", err
+		}
+		if len(ids) == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s_%d", handle, n)
+	}
+}
+
+// validateHandle returns the field error of a chosen handle, lower cased.
+func validateHandle(handle string) []respond.FieldError {
+	if !handlePattern.MatchString(handle) {
+		return []respond.FieldError{{Field: "handle", Message: "Handle must be up to 30 letters, digits, _, . or -, starting and ending with a letter, digit or _"}}
+	}
+	return nil
+}
+
+// handleTaken reports if a user other than uid has handle.
+func handleTaken(ctx context.Context, q store.Queries, uid uuid.UUID, handle string) (bool, error) {
+	ids, err := q.GetUserIDsByHandles(ctx, []string{handle})
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		if id != uid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
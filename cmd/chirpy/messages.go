@@ -0,0 +1,564 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"slices"
+	"errors"
+	"context"
+	"strings"
+	"log/slog"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/pagination"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+const (
+	// maxConversationMembers is how many users a conversation can have, its
+	// creator included.
+	maxConversationMembers = 10
+	// maxMessageLength is how long a message can be.
+	maxMessageLength = 1000
+)
+
+// Who a user accepts new conversations from.
+const (
+	acceptEveryone = "everyone"
+	acceptFollowing = "following"
+)
+
+// eventMessageCreated is the stream event of a new message, published once
+// for each member of its conversation.
+const eventMessageCreated = "message.created"
+
+/******************************
+	MESSAGE HANDLERS
+*******************************/
+
+type ReturnConversation struct {
+	ID uuid.UUID `json:"id"`
+	Members []uuid.UUID `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ReturnMessage struct {
+	ID uuid.UUID `json:"id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID uuid.UUID `json:"sender_id"`
+	Body string `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func returnMessage(m database.Message) ReturnMessage {
+	return ReturnMessage{
+		ID: m.ID,
+		ConversationID: m.ConversationID,
+		SenderID: m.SenderID,
+		Body: m.Body,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// directKey is the key of the one-to-one conversation of two users, the same
+// whichever of them starts it.
+func directKey(a, b uuid.UUID) sql.NullString {
+	ids := []string{a.String(), b.String()}
+	slices.Sort(ids)
+	return sql.NullString{String: strings.Join(ids, ":"), Valid: true}
+}
+
+// acceptsMessages reports if to accepts a new conversation from from.
+func acceptsMessages(ctx context.Context, q store.Queries, from, to uuid.UUID) (bool, error) {
+	settings, err := q.GetMessageSettings(ctx, to)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if settings.AcceptFrom != acceptFollowing {
+		return true, nil
+	}
+	return q.IsFollowing(ctx, database.IsFollowingParams{FollowerID: to, FolloweeID: from})
+}
+
+// validateMessage checks the body of a message, which a new conversation can
+// leave empty.
+func validateMessage(body string, required bool) []respond.FieldError {
+	if required && strings.TrimSpace(body) == "" {
+		return []respond.FieldError{{Field: "body", Message: "Message can't be empty"}}
+	}
+	if len(body) > maxMessageLength {
+		return []respond.FieldError{{Field: "body", Message: fmt.Sprintf("Message is too long, at most %d characters", maxMessageLength)}}
+	}
+	return nil
+}
+
+// sendMessage adds a message to a conversation, moving the conversation to
+// the top of its members' lists.
+func sendMessage(ctx context.Context, q store.Queries, arg database.CreateMessageParams) (database.Message, error) {
+	msg, err := q.CreateMessage(ctx, arg)
+	if err != nil {
+		return msg, err
+	}
+	return msg, q.TouchConversation(ctx, arg.ConversationID)
+}
+
+// publishMessage sends a committed message to the live connections of the
+// members of its conversation.
+func (a *apiConfig) publishMessage(r *http.Request, msg database.Message, members []uuid.UUID) {
+	if a.Events == nil {
+		return
+	}
+	for _, id := range members {
+		err := a.Events.Publish(r.Context(), eventMessageCreated, id, returnMessage(msg))
+		if err != nil {
+			slog.WarnContext(r.Context(), "publish message", "err", err)
+		}
+	}
+}
+
+// conversationMember reads the conversation id of the path, writing a 404
+// unless uid is a member of it.
+func (a *apiConfig) conversationMember(w http.ResponseWriter, r *http.Request, uid uuid.UUID) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("ConversationID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid conversation id")
+		return id, false
+	}
+	_, err = a.Store.GetConversationMember(r.Context(), database.GetConversationMemberParams{
+		ConversationID: id,
+		UserID: uid,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "Conversation not found")
+		return id, false
+	} else if somethingError(err, w, r) {
+		return id, false
+	}
+	return id, true
+}
+
+// CreateConversationHandler starts a conversation with the users in the body,
+// sending its first message when there's a body. Two users have one
+// conversation between them, which is returned with 200 when it exists.
+func (a *apiConfig) CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+		Body string `json:"body"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	members := []uuid.UUID{uid}
+	for _, id := range p.UserIDs {
+		if !slices.Contains(members, id) {
+			members = append(members, id)
+		}
+	}
+	fields := validateMessage(p.Body, false)
+	if len(members) == 1 {
+		fields = append(fields, respond.FieldError{Field: "user_ids", Message: "Needs another user"})
+	} else if len(members) > maxConversationMembers {
+		fields = append(fields, respond.FieldError{Field: "user_ids", Message: fmt.Sprintf("At most %d users", maxConversationMembers-1)})
+	}
+	if len(fields) > 0 {
+		respond.Validation(w, r, fields...)
+		return
+	}
+
+	var conv database.Conversation
+	var key sql.NullString
+	found := false
+	if len(members) == 2 {
+		key = directKey(members[0], members[1])
+		conv, err = a.Store.GetConversationByDirectKey(r.Context(), key)
+		if err == nil {
+			found = true
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			somethingError(err, w, r)
+			return
+		}
+	}
+
+	for _, id := range members[1:] {
+		blocked, err := blockedBetween(r.Context(), a.Store, uid, id)
+		if somethingError(err, w, r) {
+			return
+		}
+		if blocked {
+			respond.Error(w, r, http.StatusForbidden, fmt.Sprintf("Can't message user %s", id))
+			return
+		}
+	}
+
+	// the accept_from of the others only decides who starts a conversation
+	if !found {
+		for _, id := range members[1:] {
+			_, err := a.Store.GetUserByID(r.Context(), id)
+			if errors.Is(err, sql.ErrNoRows) {
+				respond.Error(w, r, http.StatusNotFound, fmt.Sprintf("User %s not found", id))
+				return
+			} else if somethingError(err, w, r) {
+				return
+			}
+			accepts, err := acceptsMessages(r.Context(), a.Store, uid, id)
+			if somethingError(err, w, r) {
+				return
+			}
+			if !accepts {
+				respond.Error(w, r, http.StatusForbidden, fmt.Sprintf("User %s only accepts messages from users they follow", id))
+				return
+			}
+		}
+	}
+
+	var msg database.Message
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		if !found {
+			conv, err = q.CreateConversation(r.Context(), database.CreateConversationParams{
+				DirectKey: key,
+				CreatedBy: uid,
+			})
+			if err != nil {
+				return err
+			}
+			for _, id := range members {
+				err := q.AddConversationMember(r.Context(), database.AddConversationMemberParams{
+					ConversationID: conv.ID,
+					UserID: id,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if p.Body == "" {
+			return nil
+		}
+		msg, err = sendMessage(r.Context(), q, database.CreateMessageParams{
+			ConversationID: conv.ID,
+			SenderID: uid,
+			Body: p.Body,
+		})
+		if err != nil {
+			return err
+		}
+		conv, err = q.GetConversation(r.Context(), conv.ID)
+		return err
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if p.Body != "" {
+		a.publishMessage(r, msg, members)
+	}
+
+	status := http.StatusCreated
+	if found {
+		status = http.StatusOK
+	}
+	respond.JSON(w, status, ReturnConversation{
+		ID: conv.ID,
+		Members: members,
+		CreatedAt: conv.CreatedAt,
+		UpdatedAt: conv.UpdatedAt,
+	})
+}
+
+// GetConversationsHandler lists the conversations of the user, latest message
+// first.
+func (a *apiConfig) GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	cursor, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	before, beforeID := cursor.Before()
+	convs, err := a.Store.ListConversationsByUser(r.Context(), database.ListConversationsByUserParams{
+		UserID: uid,
+		Before: before,
+		BeforeID: beforeID,
+		MaxRows: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	rows, err := a.Store.ListConversationMembersByUser(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+	members := map[uuid.UUID][]uuid.UUID{}
+	for _, row := range rows {
+		members[row.ConversationID] = append(members[row.ConversationID], row.UserID)
+	}
+
+	type conversation struct {
+		ReturnConversation
+		LastReadAt *time.Time `json:"last_read_at"`
+		Unread int64 `json:"unread_count"`
+	}
+	type response struct {
+		Conversations []conversation `json:"conversations"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+	resp := response{Conversations: make([]conversation, 0, len(convs))}
+	for _, c := range convs {
+		ret := conversation{
+			ReturnConversation: ReturnConversation{
+				ID: c.ID,
+				Members: members[c.ID],
+				CreatedAt: c.CreatedAt,
+				UpdatedAt: c.UpdatedAt,
+			},
+			Unread: c.UnreadCount,
+		}
+		if c.LastReadAt.Valid {
+			ret.LastReadAt = &c.LastReadAt.Time
+		}
+		resp.Conversations = append(resp.Conversations, ret)
+	}
+	// a full page may have more after it
+	if len(convs) == limit {
+		last := convs[len(convs)-1]
+		resp.NextCursor = pagination.Cursor{Time: last.UpdatedAt, ID: last.ID}.String()
+	}
+
+	respond.JSON(w, http.StatusOK, resp)
+}
+
+func (a *apiConfig) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		Body string `json:"body"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	if fields := validateMessage(p.Body, true); len(fields) > 0 {
+		respond.Validation(w, r, fields...)
+		return
+	}
+	id, ok := a.conversationMember(w, r, uid)
+	if !ok {
+		return
+	}
+
+	members, err := a.Store.ListConversationMembers(r.Context(), id)
+	if somethingError(err, w, r) {
+		return
+	}
+	for _, member := range members {
+		if member == uid {
+			continue
+		}
+		blocked, err := blockedBetween(r.Context(), a.Store, uid, member)
+		if somethingError(err, w, r) {
+			return
+		}
+		if blocked {
+			respond.Error(w, r, http.StatusForbidden, fmt.Sprintf("Can't message user %s", member))
+			return
+		}
+	}
+
+	var msg database.Message
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		msg, err = sendMessage(r.Context(), q, database.CreateMessageParams{
+			ConversationID: id,
+			SenderID: uid,
+			Body: p.Body,
+		})
+		return err
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	a.publishMessage(r, msg, members)
+
+	respond.JSON(w, http.StatusCreated, returnMessage(msg))
+}
+
+// GetMessagesHandler lists the messages of a conversation, newest first.
+func (a *apiConfig) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	cursor, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+	id, ok := a.conversationMember(w, r, uid)
+	if !ok {
+		return
+	}
+
+	before, beforeID := cursor.Before()
+	messages, err := a.Store.ListMessages(r.Context(), database.ListMessagesParams{
+		ConversationID: id,
+		Before: before,
+		BeforeID: beforeID,
+		MaxRows: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	type response struct {
+		Messages []ReturnMessage `json:"messages"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+	resp := response{Messages: make([]ReturnMessage, 0, len(messages))}
+	for _, m := range messages {
+		resp.Messages = append(resp.Messages, returnMessage(m))
+	}
+	if len(messages) == limit {
+		last := messages[len(messages)-1]
+		resp.NextCursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.String()
+	}
+
+	respond.JSON(w, http.StatusOK, resp)
+}
+
+// MarkConversationReadHandler marks every message of a conversation read by
+// the user.
+func (a *apiConfig) MarkConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	id, ok := a.conversationMember(w, r, uid)
+	if !ok {
+		return
+	}
+
+	err = a.Store.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: id,
+		UserID: uid,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) GetMessageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	acceptFrom := acceptEveryone
+	settings, err := a.Store.GetMessageSettings(r.Context(), uid)
+	if err == nil {
+		acceptFrom = settings.AcceptFrom
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		somethingError(err, w, r)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]string{"accept_from": acceptFrom})
+}
+
+func (a *apiConfig) UpdateMessageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		AcceptFrom string `json:"accept_from"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	if p.AcceptFrom != acceptEveryone && p.AcceptFrom != acceptFollowing {
+		respond.Validation(w, r, respond.FieldError{Field: "accept_from", Message: "Must be everyone or following"})
+		return
+	}
+
+	settings, err := a.Store.SetMessageSettings(r.Context(), database.SetMessageSettingsParams{
+		UserID: uid,
+		AcceptFrom: p.AcceptFrom,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]string{"accept_from": settings.AcceptFrom})
+}
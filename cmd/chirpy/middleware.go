@@ -1,13 +1,111 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"net/http"
+	"time"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/dubbersthehoser/httpserver/internal/config"
+	"github.com/dubbersthehoser/httpserver/internal/logging"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
 )
 
+// serverHandler wraps routes in the middlewares every request goes through.
+func serverHandler(cfg config.Config, logger *slog.Logger, routes http.Handler) http.Handler {
+	handler := middlewareMaxBytes(cfg.Limits.MaxBodyBytes, cfg.Media.MaxBytes+uploadOverhead, routes)
+	if cfg.TLS.Enabled() && cfg.TLS.HSTSMaxAge > 0 {
+		handler = middlewareHSTS(cfg.TLS.HSTSMaxAge, handler)
+	}
+	return logging.RequestID(logging.AccessLog(logger, middlewareRecover(logger, handler)))
+}
+
 func (a *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
-		r.Header.Add("Cache-Control", "no-cache")
+		// handlers with cacheable responses override this
+		w.Header().Set("Cache-Control", "no-cache")
 		a.fileserverHits.Add(1)
+		a.Metrics.Instrument(next).ServeHTTP(w, r)
+	})
+}
+
+// middlewareRecover turns a panic in a handler into a 500 response so one
+// bad request can't take the server down, logging it to logger.
+func middlewareRecover(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+			logger.ErrorContext(r.Context(), "panic serving request",
+				"panic", rec,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+			respond.Error(w, r, http.StatusInternalServerError, "Something went wrong")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middlewareMaxBytes caps the size of request bodies at limit, and of media
+// uploads at uploadLimit.
+func middlewareMaxBytes(limit, uploadLimit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		n := limit
+		if r.Method == http.MethodPost && r.URL.Path == "/api/media" {
+			n = uploadLimit
+		}
+		// the request is changed in place, the mux sets its Pattern for the
+		// access log
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middlewareHSTS tells browsers to only use HTTPS for maxAge.
+func middlewareHSTS(maxAge time.Duration, next http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d; includeSubDomains", int64(maxAge.Seconds()))
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
 		next.ServeHTTP(w, r)
 	})
 }
+
+// middlewareClientCert only lets through requests with a client certificate
+// verified by the TLS config's client CAs.
+func middlewareClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			respond.Error(w, r, http.StatusForbidden, "A client certificate is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectHTTPS sends plain HTTP requests to the same url on the HTTPS
+// listener at httpsAddr.
+func redirectHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"log"
+	"context"
+	"log/slog"
+	"database/sql"
+	"text/tabwriter"
+
+	"github.com/dubbersthehoser/httpserver/internal/config"
+	"github.com/dubbersthehoser/httpserver/internal/migrate"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+const migrateUsage string = "usage: chirpy migrate up|down|status [flags]"
+
+// runMigrate is the `chirpy migrate` subcommand, args are the ones after
+// "migrate".
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+	cmd := args[0]
+
+	// only the database settings are needed here
+	cfg, err := config.Load(args[1:], os.Getenv)
+	if cfg.DB.URL == "" {
+		log.Fatal(err)
+	}
+
+	db, driver, err := store.Open(cfg.DB.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	switch cmd {
+	case "up":
+		results, err := m.Up(ctx)
+		for _, res := range results {
+			fmt.Printf("OK   %s (%s)\n", res.Source.Path, res.Duration)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(results) == 0 {
+			fmt.Println("no migrations to run")
+		}
+
+	case "down":
+		res, err := m.Down(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("OK   %s (%s)\n", res.Source.Path, res.Duration)
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Applied At\tMigration")
+		for _, s := range statuses {
+			applied := "Pending"
+			if !s.AppliedAt.IsZero() {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", applied, s.Source.Path)
+		}
+		tw.Flush()
+
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
+
+// checkSchema applies pending migrations when autoMigrate is set, then
+// refuses to go on if the database is still behind the binary.
+func checkSchema(ctx context.Context, db *sql.DB, driver string, autoMigrate bool) error {
+	m, err := migrate.New(db, driver)
+	if err != nil {
+		return err
+	}
+
+	if autoMigrate {
+		results, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, res := range results {
+			slog.InfoContext(ctx, "applied migration", "migration", res.Source.Path)
+		}
+	}
+
+	return m.Check(ctx)
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"io"
+	"time"
+	"errors"
+	"slices"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/notifications"
+	"github.com/dubbersthehoser/httpserver/internal/pagination"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
+)
+
+const (
+	// maxReportDetails is how long the details of a report can be.
+	maxReportDetails = 500
+	// maxModerationNote is how long a moderator's note can be.
+	maxModerationNote = 500
+	// maxSuspensionDays is the longest suspension, past it users are banned.
+	maxSuspensionDays = 365
+)
+
+// reportReasons are the categories a report is made for.
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "sexual", "self_harm", "impersonation", "other"}
+
+// Statuses of a report.
+const (
+	reportOpen = "open"
+	reportClaimed = "claimed"
+	reportResolved = "resolved"
+	reportDismissed = "dismissed"
+)
+
+// Actions of the moderation log, the resolve ones being what a report can be
+// resolved with.
+const (
+	actionClaim = "claim"
+	actionDismiss = "dismiss"
+	actionDeleteChirp = "delete_chirp"
+	actionWarn = "warn"
+	actionSuspend = "suspend"
+	actionBan = "ban"
+	actionApproveChirp = "approve_chirp"
+	actionRejectChirp = "reject_chirp"
+)
+
+var resolveActions = []string{actionDeleteChirp, actionWarn, actionSuspend, actionBan}
+
+/******************************
+	MODERATION HANDLERS
+*******************************/
+
+type ReturnReport struct {
+	ID uuid.UUID `json:"id"`
+	ReporterID uuid.UUID `json:"reporter_id"`
+	UserID uuid.UUID `json:"user_id"`
+	ChirpID *uuid.UUID `json:"chirp_id"`
+	Reason string `json:"reason"`
+	Details string `json:"details"`
+	Status string `json:"status"`
+	ModeratorID *uuid.UUID `json:"moderator_id"`
+	Resolution *string `json:"resolution"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func returnReport(rep database.Report) ReturnReport {
+	ret := ReturnReport{
+		ID: rep.ID,
+		ReporterID: rep.ReporterID,
+		UserID: rep.UserID,
+		Reason: rep.Reason,
+		Details: rep.Details,
+		Status: rep.Status,
+		CreatedAt: rep.CreatedAt,
+		UpdatedAt: rep.UpdatedAt,
+	}
+	if rep.ChirpID.Valid {
+		ret.ChirpID = &rep.ChirpID.UUID
+	}
+	if rep.ModeratorID.Valid {
+		ret.ModeratorID = &rep.ModeratorID.UUID
+	}
+	if rep.Resolution.Valid {
+		ret.Resolution = &rep.Resolution.String
+	}
+	return ret
+}
+
+type ReturnModerationAction struct {
+	ID uuid.UUID `json:"id"`
+	ModeratorID uuid.UUID `json:"moderator_id"`
+	Action string `json:"action"`
+	ReportID *uuid.UUID `json:"report_id"`
+	UserID *uuid.UUID `json:"user_id"`
+	ChirpID *uuid.UUID `json:"chirp_id"`
+	Note string `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func returnModerationAction(e database.ModerationLog) ReturnModerationAction {
+	ret := ReturnModerationAction{
+		ID: e.ID,
+		ModeratorID: e.ModeratorID,
+		Action: e.Action,
+		Note: e.Note,
+		CreatedAt: e.CreatedAt,
+	}
+	if e.ReportID.Valid {
+		ret.ReportID = &e.ReportID.UUID
+	}
+	if e.UserID.Valid {
+		ret.UserID = &e.UserID.UUID
+	}
+	if e.ChirpID.Valid {
+		ret.ChirpID = &e.ChirpID.UUID
+	}
+	return ret
+}
+
+// moderator authenticates the request as a moderator, writing the error when
+// it isn't from one.
+func (a *apiConfig) moderator(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return uuid.Nil, false
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return uuid.Nil, false
+	}
+
+	ok, err := a.Store.IsModerator(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return uuid.Nil, false
+	}
+	if !ok {
+		respond.Error(w, r, http.StatusForbidden, "Only moderators can do this")
+		return uuid.Nil, false
+	}
+	return uid, true
+}
+
+// pathReport gets the report of the request path, writing the error when
+// there's none.
+func (a *apiConfig) pathReport(w http.ResponseWriter, r *http.Request) (database.Report, bool) {
+	id, err := uuid.Parse(r.PathValue("ReportID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid report id")
+		return database.Report{}, false
+	}
+	rep, err := a.Store.GetReport(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "Report not found")
+		return rep, false
+	} else if somethingError(err, w, r) {
+		return rep, false
+	}
+	return rep, true
+}
+
+// reportTakenError writes the conflict of working a report another moderator
+// claimed or that's closed, the queries returning sql.ErrNoRows for it.
+func reportTakenError(err error, w http.ResponseWriter, r *http.Request) bool {
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusConflict, "Report is claimed by another moderator or closed")
+		return true
+	}
+	return somethingError(err, w, r)
+}
+
+// logModeration records a moderator's action on a report in the moderation
+// log.
+func logModeration(r *http.Request, q store.Queries, moderatorID uuid.UUID, action string, rep database.Report, note string) error {
+	_, err := q.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: moderatorID,
+		Action: action,
+		ReportID: uuid.NullUUID{UUID: rep.ID, Valid: true},
+		UserID: uuid.NullUUID{UUID: rep.UserID, Valid: true},
+		ChirpID: rep.ChirpID,
+		Note: note,
+	})
+	return err
+}
+
+// CreateReportHandler reports a chirp, or a user when there's no chirp id, to
+// the moderators.
+func (a *apiConfig) CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		ChirpID uuid.NullUUID `json:"chirp_id"`
+		UserID uuid.NullUUID `json:"user_id"`
+		Reason string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	var fields []respond.FieldError
+	if p.ChirpID.Valid == p.UserID.Valid {
+		fields = append(fields, respond.FieldError{Field: "chirp_id", Message: "Report either a chirp or a user"})
+	}
+	if !slices.Contains(reportReasons, p.Reason) {
+		fields = append(fields, respond.FieldError{Field: "reason", Message: "Unknown reason"})
+	}
+	if len(p.Details) > maxReportDetails {
+		fields = append(fields, respond.FieldError{Field: "details", Message: "Details are too long"})
+	}
+	if len(fields) > 0 {
+		respond.Validation(w, r, fields...)
+		return
+	}
+
+	// a chirp report is of its author too
+	reported := p.UserID.UUID
+	if p.ChirpID.Valid {
+		chirp, err := a.Store.GetAChirp(r.Context(), p.ChirpID.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respond.Error(w, r, http.StatusNotFound, "Chirp id not found")
+			return
+		} else if somethingError(err, w, r) {
+			return
+		}
+		reported = chirp.UserID
+	} else {
+		_, err := a.Store.GetUserByID(r.Context(), reported)
+		if errors.Is(err, sql.ErrNoRows) {
+			respond.Error(w, r, http.StatusNotFound, "User not found")
+			return
+		} else if somethingError(err, w, r) {
+			return
+		}
+	}
+	if reported == uid {
+		respond.Validation(w, r, respond.FieldError{Field: "user_id", Message: "Can't report yourself"})
+		return
+	}
+
+	rep, err := a.Store.CreateReport(r.Context(), database.CreateReportParams{
+		ReporterID: uid,
+		UserID: reported,
+		ChirpID: p.ChirpID,
+		Reason: p.Reason,
+		Details: p.Details,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, returnReport(rep))
+}
+
+// GetReportsHandler is the moderation queue, the reports of a ?status= (open
+// by default) oldest first.
+func (a *apiConfig) GetReportsHandler(w http.ResponseWriter, r *http.Request) {
+
+	if _, ok := a.moderator(w, r); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reportOpen
+	}
+	if !slices.Contains([]string{reportOpen, reportClaimed, reportResolved, reportDismissed}, status) {
+		respond.Validation(w, r, respond.FieldError{Field: "status", Message: "Unknown report status"})
+		return
+	}
+	cursor, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	after, afterID := cursor.After()
+	reports, err := a.Store.ListReports(r.Context(), database.ListReportsParams{
+		Status: status,
+		After: after,
+		AfterID: afterID,
+		MaxRows: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	type response struct {
+		Reports []ReturnReport `json:"reports"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+	resp := response{Reports: make([]ReturnReport, 0, len(reports))}
+	for _, rep := range reports {
+		resp.Reports = append(resp.Reports, returnReport(rep))
+	}
+	// a full page may have more after it
+	if len(reports) == limit {
+		last := reports[len(reports)-1]
+		resp.NextCursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.String()
+	}
+
+	respond.JSON(w, http.StatusOK, resp)
+}
+
+// ClaimReportHandler assigns an open report to the moderator, so no other
+// moderator works it too.
+func (a *apiConfig) ClaimReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	uid, ok := a.moderator(w, r)
+	if !ok {
+		return
+	}
+	rep, ok := a.pathReport(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Store.InTx(r.Context(), func(q store.Queries) error {
+		var err error
+		rep, err = q.ClaimReport(r.Context(), database.ClaimReportParams{
+			ID: rep.ID,
+			ModeratorID: uuid.NullUUID{UUID: uid, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return logModeration(r, q, uid, actionClaim, rep, "")
+	})
+	if reportTakenError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, returnReport(rep))
+}
+
+// ResolveReportHandler closes a report with an action on the reported chirp
+// or user.
+func (a *apiConfig) ResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		Action string `json:"action"`
+		Note string `json:"note"`
+		// Days is how long a suspension lasts.
+		Days int `json:"days"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	uid, ok := a.moderator(w, r)
+	if !ok {
+		return
+	}
+	rep, ok := a.pathReport(w, r)
+	if !ok {
+		return
+	}
+
+	var fields []respond.FieldError
+	if !slices.Contains(resolveActions, p.Action) {
+		fields = append(fields, respond.FieldError{Field: "action", Message: "Unknown action"})
+	}
+	if p.Action == actionDeleteChirp && !rep.ChirpID.Valid {
+		fields = append(fields, respond.FieldError{Field: "action", Message: "Report has no chirp to delete"})
+	}
+	if p.Action == actionSuspend && (p.Days < 1 || p.Days > maxSuspensionDays) {
+		fields = append(fields, respond.FieldError{Field: "days", Message: "Must be a number from 1 to 365"})
+	}
+	if len(p.Note) > maxModerationNote {
+		fields = append(fields, respond.FieldError{Field: "note", Message: "Note is too long"})
+	}
+	if len(fields) > 0 {
+		respond.Validation(w, r, fields...)
+		return
+	}
+
+	var sent []database.Notification
+	var deleted []database.Media
+	closed := rep
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		var err error
+		closed, err = q.CloseReport(r.Context(), database.CloseReportParams{
+			ID: rep.ID,
+			Status: reportResolved,
+			Resolution: sql.NullString{String: p.Action, Valid: true},
+			ModeratorID: uuid.NullUUID{UUID: uid, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		switch p.Action {
+		case actionDeleteChirp:
+			if deleted, err = deleteChirp(r.Context(), q, rep.ChirpID.UUID); err != nil {
+				return err
+			}
+			err = webhooks.Enqueue(r.Context(), q, webhooks.EventChirpDeleted, map[string]uuid.UUID{
+				"id": rep.ChirpID.UUID,
+				"user_id": rep.UserID,
+			})
+		case actionWarn:
+			// the warning is from the moderators, not one of them
+			var n database.Notification
+			n, err = q.CreateNotification(r.Context(), database.CreateNotificationParams{
+				UserID: rep.UserID,
+				Type: notifications.TypeWarning,
+				ChirpID: rep.ChirpID,
+			})
+			sent = append(sent, n)
+		case actionSuspend, actionBan:
+			var expires sql.NullTime
+			if p.Action == actionSuspend {
+				expires = sql.NullTime{Time: time.Now().AddDate(0, 0, p.Days), Valid: true}
+			}
+			_, err = suspendUser(r.Context(), q, database.CreateSuspensionParams{
+				UserID: rep.UserID,
+				Reason: rep.Reason,
+				ExpiresAt: expires,
+				CreatedBy: uuid.NullUUID{UUID: uid, Valid: true},
+			})
+		}
+		if err != nil {
+			return err
+		}
+		return logModeration(r, q, uid, p.Action, rep, p.Note)
+	})
+	if reportTakenError(err, w, r) {
+		return
+	}
+	if p.Action == actionDeleteChirp {
+		a.deleteFiles(r.Context(), deleted)
+		a.publishChirpEvent(r, webhooks.EventChirpDeleted, rep.UserID, map[string]uuid.UUID{
+			"id": rep.ChirpID.UUID,
+			"user_id": rep.UserID,
+		})
+	}
+	a.publishNotifications(r, sent)
+
+	respond.JSON(w, http.StatusOK, returnReport(closed))
+}
+
+// DismissReportHandler closes a report without acting on it, the body with
+// the note being optional.
+func (a *apiConfig) DismissReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		Note string `json:"note"`
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if !errors.Is(err, io.EOF) && decodeError(err, w, r) {
+		return
+	}
+
+	uid, ok := a.moderator(w, r)
+	if !ok {
+		return
+	}
+	rep, ok := a.pathReport(w, r)
+	if !ok {
+		return
+	}
+
+	if len(p.Note) > maxModerationNote {
+		respond.Validation(w, r, respond.FieldError{Field: "note", Message: "Note is too long"})
+		return
+	}
+
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		var err error
+		rep, err = q.CloseReport(r.Context(), database.CloseReportParams{
+			ID: rep.ID,
+			Status: reportDismissed,
+			ModeratorID: uuid.NullUUID{UUID: uid, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return logModeration(r, q, uid, actionDismiss, rep, p.Note)
+	})
+	if reportTakenError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, returnReport(rep))
+}
+
+// GetModerationLogHandler lists every action of the moderators, latest first.
+func (a *apiConfig) GetModerationLogHandler(w http.ResponseWriter, r *http.Request) {
+
+	if _, ok := a.moderator(w, r); !ok {
+		return
+	}
+
+	cursor, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	before, beforeID := cursor.Before()
+	entries, err := a.Store.ListModerationLog(r.Context(), database.ListModerationLogParams{
+		Before: before,
+		BeforeID: beforeID,
+		MaxRows: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	type response struct {
+		Entries []ReturnModerationAction `json:"entries"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+	resp := response{Entries: make([]ReturnModerationAction, 0, len(entries))}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, returnModerationAction(e))
+	}
+	// a full page may have more after it
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		resp.NextCursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.String()
+	}
+
+	respond.JSON(w, http.StatusOK, resp)
+}
+
+// adminAllowed reports if r may manage the moderators, on the dev platform or
+// with a verified client certificate.
+func (a *apiConfig) adminAllowed(r *http.Request) bool {
+	return a.Platform == "dev" || (r.TLS != nil && len(r.TLS.VerifiedChains) > 0)
+}
+
+func (a *apiConfig) AdminAddModeratorHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	_, err = a.Store.GetUserByID(r.Context(), p.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+
+	err = a.Store.AddModerator(r.Context(), p.UserID)
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) AdminRemoveModeratorHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	uid, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	err = a.Store.RemoveModerator(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
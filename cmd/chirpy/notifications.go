@@ -0,0 +1,311 @@
+package main
+
+import (
+	"maps"
+	"time"
+	"slices"
+	"context"
+	"log/slog"
+	"net/http"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/notifications"
+	"github.com/dubbersthehoser/httpserver/internal/pagination"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+// maxMentions is how many users a chirp can notify by mentioning them.
+const maxMentions = 10
+
+/******************************
+	NOTIFICATION HANDLERS
+*******************************/
+
+type ReturnNotification struct {
+	ID uuid.UUID `json:"id"`
+	Type string `json:"type"`
+	ActorID *uuid.UUID `json:"actor_id"`
+	ChirpID *uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ReadAt *time.Time `json:"read_at"`
+}
+
+func returnNotification(n database.Notification) ReturnNotification {
+	ret := ReturnNotification{
+		ID: n.ID,
+		Type: n.Type,
+		CreatedAt: n.CreatedAt,
+	}
+	if n.ActorID.Valid {
+		ret.ActorID = &n.ActorID.UUID
+	}
+	if n.ChirpID.Valid {
+		ret.ChirpID = &n.ChirpID.UUID
+	}
+	if n.ReadAt.Valid {
+		ret.ReadAt = &n.ReadAt.Time
+	}
+	return ret
+}
+
+// notify records a notification along with a change, adding it to sent to
+// be published once the change commits.
+func notify(ctx context.Context, q store.Queries, sent *[]database.Notification, arg database.CreateNotificationParams) error {
+	n, ok, err := notifications.Notify(ctx, q, arg)
+	if err != nil {
+		return err
+	}
+	if ok {
+		*sent = append(*sent, n)
+	}
+	return nil
+}
+
+// notifyMentions notifies the users mentioned in chirp, except the ones
+// blocked from or blocking its author.
+func notifyMentions(ctx context.Context, q store.Queries, sent *[]database.Notification, chirp database.Chirp) error {
+	var handles []string
+	for _, handle := range mentionedHandles(chirp.Body) {
+		if len(handles) < maxMentions && !slices.Contains(handles, handle) {
+			handles = append(handles, handle)
+		}
+	}
+	if len(handles) == 0 {
+		return nil
+	}
+
+	ids, err := q.GetUserIDsByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		blocked, err := blockedBetween(ctx, q, chirp.UserID, id)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			continue
+		}
+		err = notify(ctx, q, sent, database.CreateNotificationParams{
+			UserID: id,
+			Type: notifications.TypeMentioned,
+			ActorID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+			ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishNotifications sends committed notifications to their users' live
+// connections.
+func (a *apiConfig) publishNotifications(r *http.Request, sent []database.Notification) {
+	if a.Events == nil {
+		return
+	}
+	for _, n := range sent {
+		err := a.Events.Publish(r.Context(), notifications.EventCreated, n.UserID, returnNotification(n))
+		if err != nil {
+			slog.WarnContext(r.Context(), "publish notification", "err", err)
+		}
+	}
+}
+
+func (a *apiConfig) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	cursor, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	before, beforeID := cursor.Before()
+	notes, err := a.Store.ListNotifications(r.Context(), database.ListNotificationsParams{
+		UserID: uid,
+		Before: before,
+		BeforeID: beforeID,
+		MaxRows: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	unread, err := a.Store.CountUnreadNotifications(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	type response struct {
+		Notifications []ReturnNotification `json:"notifications"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		Unread int64 `json:"unread_count"`
+	}
+	resp := response{
+		Notifications: make([]ReturnNotification, 0, len(notes)),
+		Unread: unread,
+	}
+	for _, n := range notes {
+		resp.Notifications = append(resp.Notifications, returnNotification(n))
+	}
+	// a full page may have more after it
+	if len(notes) == limit {
+		last := notes[len(notes)-1]
+		resp.NextCursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.String()
+	}
+
+	respond.JSON(w, http.StatusOK, resp)
+}
+
+func (a *apiConfig) GetUnreadNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	unread, err := a.Store.CountUnreadNotifications(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]int64{"unread_count": unread})
+}
+
+func (a *apiConfig) MarkNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("NotificationID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid notification id")
+		return
+	}
+
+	marked, err := a.Store.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{
+		ID: id,
+		UserID: uid,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if marked == 0 {
+		respond.Error(w, r, http.StatusNotFound, "Notification id not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) MarkAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	_, err = a.Store.MarkAllNotificationsRead(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) GetNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	prefs, err := a.Store.GetNotificationPreferences(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, notifications.Preferences(prefs))
+}
+
+// UpdateNotificationPreferencesHandler turns the types in the body on or
+// off, leaving the others as they are.
+func (a *apiConfig) UpdateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	var p map[string]bool
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	var fields []respond.FieldError
+	for _, typ := range slices.Sorted(maps.Keys(p)) {
+		if !notifications.Known(typ) {
+			fields = append(fields, respond.FieldError{Field: typ, Message: "Unknown notification type"})
+		}
+	}
+	if len(fields) > 0 {
+		respond.Validation(w, r, fields...)
+		return
+	}
+
+	var prefs []database.NotificationPreference
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		for typ, enabled := range p {
+			err := q.SetNotificationPreference(r.Context(), database.SetNotificationPreferenceParams{
+				UserID: uid,
+				Type: typ,
+				Enabled: enabled,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		prefs, err = q.GetNotificationPreferences(r.Context(), uid)
+		return err
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, notifications.Preferences(prefs))
+}
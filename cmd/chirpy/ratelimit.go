@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+)
+
+const rateLimitSweepInterval = time.Minute
+
+// rateLimitKey buckets requests by the user of a valid access token, and by
+// client IP for anonymous requests.
+func (a *apiConfig) rateLimitKey(r *http.Request) string {
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if uid, err := auth.ValidateJWT(token, a.JWTSecret); err == nil {
+			return "user:" + uid.String()
+		}
+	}
+	return "ip:" + a.Proxies.ClientIP(r)
+}
+
+// sweepRateLimits forgets the buckets that are full again. Every policy has a
+// period of a minute.
+func (a *apiConfig) sweepRateLimits(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.Limiter.Sweep(ctx, time.Minute); err != nil {
+			slog.ErrorContext(ctx, "rate limit sweep", "err", err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"os"
+	"time"
+	"io/fs"
+	"net/http"
+
+	"github.com/dubbersthehoser/httpserver/internal/config"
+	"github.com/dubbersthehoser/httpserver/internal/ratelimit"
+	"github.com/dubbersthehoser/httpserver/internal/static"
+	"github.com/dubbersthehoser/httpserver/servfiles"
+)
+
+// routes registers every endpoint of the server, behind the check of
+// suspended users.
+func (a *apiConfig) routes(cfg config.Config) (http.Handler, error) {
+	sMux := http.NewServeMux()
+
+	// Main Page and assets, embedded unless served from disk for development
+	appFiles, err := appHandler(cfg.StaticDir)
+	if err != nil {
+		return nil, err
+	}
+	appHandler := http.StripPrefix("/app/", appFiles)
+	sMux.Handle("/app/", a.middlewareMetricsInc(appHandler))
+
+	// rate limits by route group, per user when signed in and per client
+	// IP otherwise
+	limits := ratelimit.Middleware{Limiter: a.Limiter, Key: a.rateLimitKey}
+	authLimit := ratelimit.Policy{Name: "auth", Limit: cfg.RateLimit.Auth, Period: time.Minute}
+	writeLimit := ratelimit.Policy{Name: "write", Limit: cfg.RateLimit.Write, Period: time.Minute}
+	readLimit := ratelimit.Policy{Name: "read", Limit: cfg.RateLimit.Read, Period: time.Minute}
+
+	// server status
+	readinessHandler := http.HandlerFunc(ReadinessHandler)
+	sMux.Handle("GET /api/healthz", a.middlewareMetricsInc(readinessHandler))
+
+	// users
+	addUserHandler := http.HandlerFunc(a.AddUserHandler)
+	updateUserHandler := http.HandlerFunc(a.UpdateUserHandler)
+
+	sMux.Handle("POST /api/users", a.middlewareMetricsInc(limits.Limit(authLimit, addUserHandler)))
+	sMux.Handle("PUT /api/users", a.middlewareMetricsInc(limits.Limit(writeLimit, updateUserHandler)))
+
+	// auth
+	refreshToken := http.HandlerFunc(a.RefreshToken)
+	revokeToken := http.HandlerFunc(a.RevokeToken)
+	loginUserHandler := http.HandlerFunc(a.LoginUserHandler)
+
+	sMux.Handle("POST /api/refresh", a.middlewareMetricsInc(limits.Limit(authLimit, refreshToken)))
+	sMux.Handle("POST /api/revoke", a.middlewareMetricsInc(limits.Limit(authLimit, revokeToken)))
+	sMux.Handle("POST /api/login", a.middlewareMetricsInc(limits.Limit(authLimit, loginUserHandler)))
+
+	// chirps / users posts
+	createChirpHandler := http.HandlerFunc(a.CreateChirpHandler)
+	getAllChirpHandler := http.HandlerFunc(a.GetAllChirpsHandler)
+	getAChirpHandler := http.HandlerFunc(a.GetAChirpHandler)
+	removeAChirpHandler := http.HandlerFunc(a.RemoveChirpHandler)
+
+	sMux.Handle("POST /api/chirps", a.middlewareMetricsInc(limits.Limit(writeLimit, createChirpHandler)))
+	sMux.Handle("GET /api/chirps", a.middlewareMetricsInc(limits.Limit(readLimit, getAllChirpHandler)))
+	sMux.Handle("GET /api/chirps/{ChirpID}", a.middlewareMetricsInc(limits.Limit(readLimit, getAChirpHandler)))
+	sMux.Handle("DELETE /api/chirps/{ChirpID}", a.middlewareMetricsInc(limits.Limit(writeLimit, removeAChirpHandler)))
+
+	// the stream and the WebSocket are long lived, they stay out of the request metrics
+	streamChirpsHandler := http.HandlerFunc(a.StreamChirpsHandler)
+	sMux.Handle("GET /api/stream/chirps", limits.Limit(readLimit, streamChirpsHandler))
+
+	webSocketHandler := http.HandlerFunc(a.WebSocketHandler)
+	sMux.Handle("GET /api/ws", limits.Limit(readLimit, webSocketHandler))
+
+	editChirpHandler := http.HandlerFunc(a.EditChirpHandler)
+	pinChirpHandler := http.HandlerFunc(a.PinChirpHandler)
+	unpinChirpHandler := http.HandlerFunc(a.UnpinChirpHandler)
+	getPinnedChirpsHandler := http.HandlerFunc(a.GetPinnedChirpsHandler)
+
+	sMux.Handle("PUT /api/chirps/{ChirpID}", a.middlewareMetricsInc(limits.Limit(writeLimit, editChirpHandler)))
+	sMux.Handle("POST /api/chirps/{ChirpID}/pin", a.middlewareMetricsInc(limits.Limit(writeLimit, pinChirpHandler)))
+	sMux.Handle("DELETE /api/chirps/{ChirpID}/pin", a.middlewareMetricsInc(limits.Limit(writeLimit, unpinChirpHandler)))
+	sMux.Handle("GET /api/users/{UserID}/pinned", a.middlewareMetricsInc(limits.Limit(readLimit, getPinnedChirpsHandler)))
+
+	// media, served through signed links
+	uploadMediaHandler := http.HandlerFunc(a.UploadMediaHandler)
+	getMediaHandler := http.HandlerFunc(a.GetMediaHandler)
+
+	sMux.Handle("POST /api/media", a.middlewareMetricsInc(limits.Limit(writeLimit, uploadMediaHandler)))
+	sMux.Handle("GET /api/media/{MediaID}", a.middlewareMetricsInc(limits.Limit(readLimit, getMediaHandler)))
+
+	// follows
+	followUserHandler := http.HandlerFunc(a.FollowUserHandler)
+	unfollowUserHandler := http.HandlerFunc(a.UnfollowUserHandler)
+	getFollowingHandler := http.HandlerFunc(a.GetFollowingHandler)
+
+	sMux.Handle("POST /api/users/{UserID}/follow", a.middlewareMetricsInc(limits.Limit(writeLimit, followUserHandler)))
+	sMux.Handle("DELETE /api/users/{UserID}/follow", a.middlewareMetricsInc(limits.Limit(writeLimit, unfollowUserHandler)))
+	sMux.Handle("GET /api/users/{UserID}/following", a.middlewareMetricsInc(limits.Limit(readLimit, getFollowingHandler)))
+
+	// blocks and mutes
+	blockUserHandler := http.HandlerFunc(a.BlockUserHandler)
+	unblockUserHandler := http.HandlerFunc(a.UnblockUserHandler)
+	getBlocksHandler := http.HandlerFunc(a.GetBlocksHandler)
+	muteUserHandler := http.HandlerFunc(a.MuteUserHandler)
+	unmuteUserHandler := http.HandlerFunc(a.UnmuteUserHandler)
+	getMutesHandler := http.HandlerFunc(a.GetMutesHandler)
+
+	sMux.Handle("POST /api/users/me/blocks", a.middlewareMetricsInc(limits.Limit(writeLimit, blockUserHandler)))
+	sMux.Handle("DELETE /api/users/me/blocks/{UserID}", a.middlewareMetricsInc(limits.Limit(writeLimit, unblockUserHandler)))
+	sMux.Handle("GET /api/users/me/blocks", a.middlewareMetricsInc(limits.Limit(readLimit, getBlocksHandler)))
+	sMux.Handle("POST /api/users/me/mutes", a.middlewareMetricsInc(limits.Limit(writeLimit, muteUserHandler)))
+	sMux.Handle("DELETE /api/users/me/mutes/{UserID}", a.middlewareMetricsInc(limits.Limit(writeLimit, unmuteUserHandler)))
+	sMux.Handle("GET /api/users/me/mutes", a.middlewareMetricsInc(limits.Limit(readLimit, getMutesHandler)))
+
+	// notifications
+	getNotificationsHandler := http.HandlerFunc(a.GetNotificationsHandler)
+	getUnreadNotificationsHandler := http.HandlerFunc(a.GetUnreadNotificationsHandler)
+	markNotificationReadHandler := http.HandlerFunc(a.MarkNotificationReadHandler)
+	markAllNotificationsReadHandler := http.HandlerFunc(a.MarkAllNotificationsReadHandler)
+	getNotificationPreferencesHandler := http.HandlerFunc(a.GetNotificationPreferencesHandler)
+	updateNotificationPreferencesHandler := http.HandlerFunc(a.UpdateNotificationPreferencesHandler)
+
+	sMux.Handle("GET /api/notifications", a.middlewareMetricsInc(limits.Limit(readLimit, getNotificationsHandler)))
+	sMux.Handle("GET /api/notifications/unread_count", a.middlewareMetricsInc(limits.Limit(readLimit, getUnreadNotificationsHandler)))
+	sMux.Handle("POST /api/notifications/{NotificationID}/read", a.middlewareMetricsInc(limits.Limit(writeLimit, markNotificationReadHandler)))
+	sMux.Handle("POST /api/notifications/read", a.middlewareMetricsInc(limits.Limit(writeLimit, markAllNotificationsReadHandler)))
+	sMux.Handle("GET /api/notifications/preferences", a.middlewareMetricsInc(limits.Limit(readLimit, getNotificationPreferencesHandler)))
+	sMux.Handle("PUT /api/notifications/preferences", a.middlewareMetricsInc(limits.Limit(writeLimit, updateNotificationPreferencesHandler)))
+
+	// direct messages
+	createConversationHandler := http.HandlerFunc(a.CreateConversationHandler)
+	getConversationsHandler := http.HandlerFunc(a.GetConversationsHandler)
+	sendMessageHandler := http.HandlerFunc(a.SendMessageHandler)
+	getMessagesHandler := http.HandlerFunc(a.GetMessagesHandler)
+	markConversationReadHandler := http.HandlerFunc(a.MarkConversationReadHandler)
+	getMessageSettingsHandler := http.HandlerFunc(a.GetMessageSettingsHandler)
+	updateMessageSettingsHandler := http.HandlerFunc(a.UpdateMessageSettingsHandler)
+
+	sMux.Handle("POST /api/conversations", a.middlewareMetricsInc(limits.Limit(writeLimit, createConversationHandler)))
+	sMux.Handle("GET /api/conversations", a.middlewareMetricsInc(limits.Limit(readLimit, getConversationsHandler)))
+	sMux.Handle("POST /api/conversations/{ConversationID}/messages", a.middlewareMetricsInc(limits.Limit(writeLimit, sendMessageHandler)))
+	sMux.Handle("GET /api/conversations/{ConversationID}/messages", a.middlewareMetricsInc(limits.Limit(readLimit, getMessagesHandler)))
+	sMux.Handle("POST /api/conversations/{ConversationID}/read", a.middlewareMetricsInc(limits.Limit(writeLimit, markConversationReadHandler)))
+	sMux.Handle("GET /api/conversations/settings", a.middlewareMetricsInc(limits.Limit(readLimit, getMessageSettingsHandler)))
+	sMux.Handle("PUT /api/conversations/settings", a.middlewareMetricsInc(limits.Limit(writeLimit, updateMessageSettingsHandler)))
+
+	// reports and moderation
+	createReportHandler := http.HandlerFunc(a.CreateReportHandler)
+	getReportsHandler := http.HandlerFunc(a.GetReportsHandler)
+	claimReportHandler := http.HandlerFunc(a.ClaimReportHandler)
+	resolveReportHandler := http.HandlerFunc(a.ResolveReportHandler)
+	dismissReportHandler := http.HandlerFunc(a.DismissReportHandler)
+	getModerationLogHandler := http.HandlerFunc(a.GetModerationLogHandler)
+	getHeldChirpsHandler := http.HandlerFunc(a.GetHeldChirpsHandler)
+	approveChirpHandler := http.HandlerFunc(a.ApproveChirpHandler)
+	rejectChirpHandler := http.HandlerFunc(a.RejectChirpHandler)
+
+	sMux.Handle("POST /api/reports", a.middlewareMetricsInc(limits.Limit(writeLimit, createReportHandler)))
+	sMux.Handle("GET /api/moderation/reports", a.middlewareMetricsInc(limits.Limit(readLimit, getReportsHandler)))
+	sMux.Handle("POST /api/moderation/reports/{ReportID}/claim", a.middlewareMetricsInc(limits.Limit(writeLimit, claimReportHandler)))
+	sMux.Handle("POST /api/moderation/reports/{ReportID}/resolve", a.middlewareMetricsInc(limits.Limit(writeLimit, resolveReportHandler)))
+	sMux.Handle("POST /api/moderation/reports/{ReportID}/dismiss", a.middlewareMetricsInc(limits.Limit(writeLimit, dismissReportHandler)))
+	sMux.Handle("GET /api/moderation/log", a.middlewareMetricsInc(limits.Limit(readLimit, getModerationLogHandler)))
+	sMux.Handle("GET /api/moderation/chirps", a.middlewareMetricsInc(limits.Limit(readLimit, getHeldChirpsHandler)))
+	sMux.Handle("POST /api/moderation/chirps/{ChirpID}/approve", a.middlewareMetricsInc(limits.Limit(writeLimit, approveChirpHandler)))
+	sMux.Handle("POST /api/moderation/chirps/{ChirpID}/reject", a.middlewareMetricsInc(limits.Limit(writeLimit, rejectChirpHandler)))
+
+	// developer webhooks
+	createWebhookHandler := http.HandlerFunc(a.CreateWebhookHandler)
+	getWebhooksHandler := http.HandlerFunc(a.GetWebhooksHandler)
+	removeWebhookHandler := http.HandlerFunc(a.RemoveWebhookHandler)
+	getWebhookDeliveriesHandler := http.HandlerFunc(a.GetWebhookDeliveriesHandler)
+	redeliverWebhookHandler := http.HandlerFunc(a.RedeliverWebhookHandler)
+
+	sMux.Handle("POST /api/webhooks", a.middlewareMetricsInc(limits.Limit(writeLimit, createWebhookHandler)))
+	sMux.Handle("GET /api/webhooks", a.middlewareMetricsInc(limits.Limit(readLimit, getWebhooksHandler)))
+	sMux.Handle("DELETE /api/webhooks/{WebhookID}", a.middlewareMetricsInc(limits.Limit(writeLimit, removeWebhookHandler)))
+	sMux.Handle("GET /api/webhooks/{WebhookID}/deliveries", a.middlewareMetricsInc(limits.Limit(readLimit, getWebhookDeliveriesHandler)))
+	sMux.Handle("POST /api/webhooks/{WebhookID}/deliveries/{DeliveryID}/redeliver", a.middlewareMetricsInc(limits.Limit(writeLimit, redeliverWebhookHandler)))
+
+	// prometheus
+	sMux.Handle("GET /metrics", a.Metrics.Handler())
+
+	// admin, behind client certificates when configured
+	admin := func(h http.HandlerFunc) http.Handler {
+		if cfg.TLS.ClientCAFile != "" {
+			return middlewareClientCert(h)
+		}
+		return h
+	}
+	sMux.Handle("GET /admin/metrics", admin(a.AdminHandler))
+	sMux.Handle("POST /admin/reset", admin(a.AdminResetHandler))
+	sMux.Handle("GET /admin/webhooks/polka", admin(a.AdminWebhookEventsHandler))
+	sMux.Handle("POST /admin/moderators", admin(a.AdminAddModeratorHandler))
+	sMux.Handle("DELETE /admin/moderators/{UserID}", admin(a.AdminRemoveModeratorHandler))
+	sMux.Handle("POST /admin/users/{UserID}/suspensions", admin(a.AdminSuspendUserHandler))
+	sMux.Handle("GET /admin/users/{UserID}/suspensions", admin(a.AdminGetSuspensionsHandler))
+	sMux.Handle("DELETE /admin/users/{UserID}/suspensions", admin(a.AdminLiftSuspensionHandler))
+	sMux.Handle("GET /admin/filter/rules", admin(a.AdminGetFilterRulesHandler))
+	sMux.Handle("POST /admin/filter/rules", admin(a.AdminCreateFilterRuleHandler))
+	sMux.Handle("PUT /admin/filter/rules/{RuleID}", admin(a.AdminUpdateFilterRuleHandler))
+	sMux.Handle("DELETE /admin/filter/rules/{RuleID}", admin(a.AdminRemoveFilterRuleHandler))
+	sMux.Handle("POST /admin/filter/reload", admin(a.AdminReloadFilterHandler))
+
+	// chirpy red
+	polkaHandler := http.HandlerFunc(a.PolkaHandler)
+	sMux.Handle("POST /api/polka/webhooks", a.middlewareMetricsInc(polkaHandler))
+
+	return a.middlewareSuspended(sMux), nil
+}
+
+// appHandler serves the embedded web site, or when dir is set, the files
+// under dir/app straight from disk so edits show up without a rebuild.
+func appHandler(dir string) (http.Handler, error) {
+	if dir != "" {
+		return http.FileServerFS(os.DirFS(dir + "/app")), nil
+	}
+
+	app, err := fs.Sub(servfiles.FS, "app")
+	if err != nil {
+		return nil, err
+	}
+	return static.New(app)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"strconv"
+	"log/slog"
+	"net/http"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/stream"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
+)
+
+const (
+	// streamReplaySize is how many events a reconnecting client can resume.
+	streamReplaySize = 1024
+	streamHeartbeat = 15 * time.Second
+	// streamRetry is how long clients wait before reconnecting.
+	streamRetry = 3 * time.Second
+)
+
+// publishChirpEvent tells the stream clients about a chirp change. The change
+// is already committed, so a failure is only logged.
+func (a *apiConfig) publishChirpEvent(r *http.Request, typ string, userID uuid.UUID, data any) {
+	if a.Events == nil {
+		return
+	}
+	if err := a.Events.Publish(r.Context(), typ, userID, data); err != nil {
+		slog.WarnContext(r.Context(), "publish chirp event", "type", typ, "err", err)
+	}
+}
+
+func isChirpEvent(e stream.Event) bool {
+	return e.Type == webhooks.EventChirpCreated || e.Type == webhooks.EventChirpDeleted
+}
+
+// StreamChirpsHandler is a Server-Sent Events stream of created and deleted
+// chirps, of one author with ?author_id=. A client reconnecting with
+// Last-Event-ID gets the events it missed, or a reset event when they're no
+// longer buffered and it should refetch the chirps.
+func (a *apiConfig) StreamChirpsHandler(w http.ResponseWriter, r *http.Request) {
+
+	var authorID uuid.UUID
+	if id := r.URL.Query().Get("author_id"); id != "" {
+		var err error
+		authorID, err = uuid.Parse(id)
+		if err != nil {
+			respond.Validation(w, r, respond.FieldError{Field: "author_id", Message: "Invalid author id"})
+			return
+		}
+	}
+
+	// a bad id is treated as no id, the client starts over
+	lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	// the stream outlives the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	sub, replay, complete := a.Broker.Subscribe(lastID)
+	defer a.Broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// don't let nginx buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range replay {
+		writeChirpEvent(w, e, authorID)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case e, ok := <-sub.C:
+			if !ok {
+				// fell behind or shutting down, the client will reconnect
+				return
+			}
+			if !writeChirpEvent(w, e, authorID) {
+				continue
+			}
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeChirpEvent writes e if it's a chirp event by authorID, or any author
+// when authorID is zero, and reports if it did. Other events, like the
+// notifications of the WebSocket, aren't public.
+func writeChirpEvent(w http.ResponseWriter, e stream.Event, authorID uuid.UUID) bool {
+	if !isChirpEvent(e) || (authorID != uuid.Nil && e.UserID != authorID) {
+		return false
+	}
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return false
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return true
+}
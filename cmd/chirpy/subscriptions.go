@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+	"errors"
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+	"github.com/dubbersthehoser/httpserver/internal/subscription"
+)
+
+// How often lapsed subscriptions are expired.
+const subscriptionSweepInterval = time.Minute
+
+// applySubscriptionEvent moves the user's subscription through event.
+func applySubscriptionEvent(ctx context.Context, q store.Subscriptions, uid uuid.UUID, event, plan string) error {
+	var current *subscription.State
+	sub, err := q.GetSubscriptionByUser(ctx, uid)
+	if err == nil {
+		state := subscriptionState(sub)
+		current = &state
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	next, err := subscription.DefaultConfig.Apply(current, event, plan, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	grace := sql.NullTime{}
+	if next.GraceUntil != nil {
+		grace = sql.NullTime{Time: *next.GraceUntil, Valid: true}
+	}
+	_, err = q.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID: uid,
+		Plan: next.Plan,
+		Status: next.Status,
+		CurrentPeriodStart: next.PeriodStart,
+		CurrentPeriodEnd: next.PeriodEnd,
+		GraceUntil: grace,
+	})
+	return err
+}
+
+func subscriptionState(sub database.Subscription) subscription.State {
+	state := subscription.State{
+		Plan: sub.Plan,
+		Status: sub.Status,
+		PeriodStart: sub.CurrentPeriodStart,
+		PeriodEnd: sub.CurrentPeriodEnd,
+	}
+	if sub.GraceUntil.Valid {
+		grace := sub.GraceUntil.Time
+		state.GraceUntil = &grace
+	}
+	return state
+}
+
+// sweepSubscriptions expires subscriptions whose period and grace have passed.
+func (a *apiConfig) sweepSubscriptions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := a.Store.ExpireLapsedSubscriptions(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "subscription sweep", "err", err)
+		} else if n > 0 {
+			slog.InfoContext(ctx, "subscription sweep: expired subscriptions", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
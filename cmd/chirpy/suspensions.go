@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"context"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+// maxSuspensionReason is how long the reason of a suspension can be.
+const maxSuspensionReason = 500
+
+/******************************
+	SUSPENSION HANDLERS
+*******************************/
+
+type ReturnSuspension struct {
+	ID uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Reason string `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy *uuid.UUID `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	LiftedAt *time.Time `json:"lifted_at"`
+}
+
+func returnSuspension(s database.Suspension) ReturnSuspension {
+	ret := ReturnSuspension{
+		ID: s.ID,
+		UserID: s.UserID,
+		Reason: s.Reason,
+		CreatedAt: s.CreatedAt,
+	}
+	if s.ExpiresAt.Valid {
+		ret.ExpiresAt = &s.ExpiresAt.Time
+	}
+	if s.CreatedBy.Valid {
+		ret.CreatedBy = &s.CreatedBy.UUID
+	}
+	if s.LiftedAt.Valid {
+		ret.LiftedAt = &s.LiftedAt.Time
+	}
+	return ret
+}
+
+// suspendUser suspends a user, revoking their refresh tokens so they can't
+// get new access tokens.
+func suspendUser(ctx context.Context, q store.Queries, arg database.CreateSuspensionParams) (database.Suspension, error) {
+	s, err := q.CreateSuspension(ctx, arg)
+	if err != nil {
+		return s, err
+	}
+	return s, q.RevokeUserTokens(ctx, arg.UserID)
+}
+
+// suspendedError writes a 403 when the user is suspended, reporting if it
+// did.
+func (a *apiConfig) suspendedError(w http.ResponseWriter, r *http.Request, uid uuid.UUID) bool {
+	s, err := a.Store.GetActiveSuspension(r.Context(), uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	} else if somethingError(err, w, r) {
+		return true
+	}
+
+	msg := "Account banned: " + s.Reason
+	if s.ExpiresAt.Valid {
+		msg = fmt.Sprintf("Account suspended until %s: %s", s.ExpiresAt.Time.UTC().Format(time.RFC3339), s.Reason)
+	}
+	respond.Error(w, r, http.StatusForbidden, msg)
+	return true
+}
+
+// middlewareSuspended turns away the access tokens of suspended users, the
+// ones issued before the suspension included. Requests without a valid access
+// token go through for the handlers to deal with.
+func (a *apiConfig) middlewareSuspended(next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		if token, err := auth.GetBearerToken(r.Header); err == nil {
+			if uid, err := auth.ValidateJWT(token, a.JWTSecret); err == nil && a.suspendedError(w, r, uid) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminSuspendUserHandler suspends a user until expires_at, or bans them for
+// good with ban set.
+func (a *apiConfig) AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	type params struct {
+		Reason string `json:"reason"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		Ban bool `json:"ban"`
+	}
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	var p params
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	uid, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	var fields []respond.FieldError
+	if p.Reason == "" {
+		fields = append(fields, respond.FieldError{Field: "reason", Message: "Reason is required"})
+	} else if len(p.Reason) > maxSuspensionReason {
+		fields = append(fields, respond.FieldError{Field: "reason", Message: "Reason is too long"})
+	}
+	if p.Ban == (p.ExpiresAt != nil) {
+		fields = append(fields, respond.FieldError{Field: "expires_at", Message: "Set either expires_at or ban"})
+	} else if p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now()) {
+		fields = append(fields, respond.FieldError{Field: "expires_at", Message: "Must be in the future"})
+	}
+	if len(fields) > 0 {
+		respond.Validation(w, r, fields...)
+		return
+	}
+
+	_, err = a.Store.GetUserByID(r.Context(), uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+
+	arg := database.CreateSuspensionParams{UserID: uid, Reason: p.Reason}
+	if p.ExpiresAt != nil {
+		arg.ExpiresAt = sql.NullTime{Time: *p.ExpiresAt, Valid: true}
+	}
+	var s database.Suspension
+	err = a.Store.InTx(r.Context(), func(q store.Queries) error {
+		var err error
+		s, err = suspendUser(r.Context(), q, arg)
+		return err
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, returnSuspension(s))
+}
+
+// AdminGetSuspensionsHandler lists every suspension of a user, lifted and
+// expired ones included, latest first.
+func (a *apiConfig) AdminGetSuspensionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	uid, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	suspensions, err := a.Store.ListSuspensionsByUser(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	ret := make([]ReturnSuspension, 0, len(suspensions))
+	for _, s := range suspensions {
+		ret = append(ret, returnSuspension(s))
+	}
+	respond.JSON(w, http.StatusOK, ret)
+}
+
+// AdminLiftSuspensionHandler ends a user's suspensions and ban, as for an
+// appeal. Their chirps show again, their tokens stay revoked.
+func (a *apiConfig) AdminLiftSuspensionHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !a.adminAllowed(r) {
+		respond.Error(w, r, http.StatusForbidden, "Only allowed on the dev platform or with a client certificate")
+		return
+	}
+
+	uid, err := uuid.Parse(r.PathValue("UserID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	lifted, err := a.Store.LiftSuspensions(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+	if lifted == 0 {
+		respond.Error(w, r, http.StatusNotFound, "User isn't suspended")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
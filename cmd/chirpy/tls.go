@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"context"
+	"log/slog"
+	"syscall"
+	"os/signal"
+	"time"
+
+	"github.com/dubbersthehoser/httpserver/internal/certs"
+)
+
+// watchCertificate reloads the certificate on SIGHUP, and when interval isn't
+// zero, whenever its files change. It returns when ctx is done.
+func watchCertificate(ctx context.Context, reloader *certs.Reloader, interval time.Duration) {
+	if interval > 0 {
+		go reloader.Watch(ctx, interval)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := reloader.Reload(); err != nil {
+				slog.Error("reload certificate", "err", err)
+				continue
+			}
+			slog.Info("certificate reloaded", "cert_file", reloader.CertFile)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"time"
+	"errors"
+	"strconv"
+	"net/url"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
+)
+
+/******************************
+	WEBHOOK HANDLERS
+*******************************/
+
+type ReturnWebhook struct {
+	ID uuid.UUID `json:"id"`
+	URL string `json:"url"`
+	Events []string `json:"events"`
+	Active bool `json:"active"`
+	Secret string `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func returnWebhook(e database.WebhookEndpoint) ReturnWebhook {
+	return ReturnWebhook{
+		ID: e.ID,
+		URL: e.Url,
+		Events: e.Events,
+		Active: e.Active,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+func (a *apiConfig) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	type params struct {
+		URL string `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	p := params{}
+	err = json.NewDecoder(r.Body).Decode(&p)
+	if decodeError(err, w, r) {
+		return
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respond.Validation(w, r, respond.FieldError{Field: "url", Message: "Must be an absolute http or https url"})
+		return
+	}
+	// the dispatcher checks again on every delivery, the host can move
+	err = a.WebhookGuard.CheckHost(r.Context(), u.Hostname())
+	if errors.Is(err, webhooks.ErrForbiddenAddress) {
+		respond.Validation(w, r, respond.FieldError{Field: "url", Message: "Must not be an internal address"})
+		return
+	} else if err != nil {
+		respond.Validation(w, r, respond.FieldError{Field: "url", Message: "Host doesn't resolve"})
+		return
+	}
+
+	if len(p.Events) == 0 {
+		respond.Validation(w, r, respond.FieldError{Field: "events", Message: "Must not be empty"})
+		return
+	}
+	for _, event := range p.Events {
+		if !webhooks.Known(event) {
+			respond.Validation(w, r, respond.FieldError{Field: "events", Message: "Unknown event " + event})
+			return
+		}
+	}
+
+	secret, err := auth.MakeRefreshToken()
+	if somethingError(err, w, r) {
+		return
+	}
+
+	endpoint, err := a.Store.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID: uid,
+		Url: u.String(),
+		Secret: secret,
+		Events: p.Events,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+
+	// the secret is only ever shown on creation
+	ret := returnWebhook(endpoint)
+	ret.Secret = endpoint.Secret
+
+	respond.JSON(w, http.StatusCreated, ret)
+}
+
+func (a *apiConfig) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	endpoints, err := a.Store.ListWebhookEndpointsByUser(r.Context(), uid)
+	if somethingError(err, w, r) {
+		return
+	}
+
+	ret := make([]ReturnWebhook, 0, len(endpoints))
+	for _, e := range endpoints {
+		ret = append(ret, returnWebhook(e))
+	}
+
+	respond.JSON(w, http.StatusOK, ret)
+}
+
+func (a *apiConfig) RemoveWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("WebhookID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid webhook id")
+		return
+	}
+
+	n, err := a.Store.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID: id,
+		UserID: uid,
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if n == 0 {
+		respond.Error(w, r, http.StatusNotFound, "Webhook id not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownedWebhook returns the endpoint in the path if it belongs to the requesting user.
+// On false the response has been written.
+func (a *apiConfig) ownedWebhook(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return database.WebhookEndpoint{}, false
+	}
+	uid, err := auth.ValidateJWT(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return database.WebhookEndpoint{}, false
+	}
+
+	id, err := uuid.Parse(r.PathValue("WebhookID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid webhook id")
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := a.Store.GetWebhookEndpoint(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && endpoint.UserID != uid) {
+		respond.Error(w, r, http.StatusNotFound, "Webhook id not found")
+		return database.WebhookEndpoint{}, false
+	} else if somethingError(err, w, r) {
+		return database.WebhookEndpoint{}, false
+	}
+	return endpoint, true
+}
+
+func (a *apiConfig) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+
+	endpoint, ok := a.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			respond.Validation(w, r, respond.FieldError{Field: "limit", Message: "Must be a positive number"})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := a.Store.ListWebhookDeliveriesByEndpoint(r.Context(), database.ListWebhookDeliveriesByEndpointParams{
+		EndpointID: endpoint.ID,
+		Limit: int32(limit),
+	})
+	if somethingError(err, w, r) {
+		return
+	}
+	if deliveries == nil {
+		deliveries = []database.WebhookDelivery{}
+	}
+
+	respond.JSON(w, http.StatusOK, deliveries)
+}
+
+func (a *apiConfig) RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	endpoint, ok := a.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("DeliveryID"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "Invalid delivery id")
+		return
+	}
+
+	delivery, err := a.Store.GetWebhookDelivery(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && delivery.EndpointID != endpoint.ID) {
+		respond.Error(w, r, http.StatusNotFound, "Delivery id not found")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+
+	// a pending delivery may be in flight, resetting it would send it twice
+	delivery, err = a.Store.RedeliverWebhookDelivery(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respond.Error(w, r, http.StatusConflict, "Delivery is still pending")
+		return
+	} else if somethingError(err, w, r) {
+		return
+	}
+
+	respond.JSON(w, http.StatusAccepted, delivery)
+}
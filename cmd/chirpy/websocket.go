@@ -0,0 +1,341 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"context"
+	"log/slog"
+	"net/http"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+	"github.com/dubbersthehoser/httpserver/internal/notifications"
+	"github.com/dubbersthehoser/httpserver/internal/stream"
+	"github.com/dubbersthehoser/httpserver/internal/webhooks"
+)
+
+const (
+	// wsPing is how often the connection is pinged, and how often the
+	// channels pick up new follows, blocks and mutes.
+	wsPing = 30 * time.Second
+	// wsWriteTimeout is how long a client has to take a message before it's
+	// dropped as too slow.
+	wsWriteTimeout = 10 * time.Second
+	wsMaxMessage = 4096
+	// wsMaxChannels is how many user channels a connection can subscribe.
+	wsMaxChannels = 100
+)
+
+// The channels of a WebSocket connection.
+const (
+	// channelHome is the chirps of the user and the users they follow.
+	channelHome = "home"
+	// channelUser is the chirps of one user.
+	channelUser = "user"
+	// channelMentions is the chirps mentioning the user.
+	channelMentions = "mentions"
+	// channelNotifications is the new notifications of the user.
+	channelNotifications = "notifications"
+	// channelMessages is the new messages of the user's conversations.
+	channelMessages = "messages"
+)
+
+// wsChannel names a channel, UserID is the user of a user channel.
+type wsChannel struct {
+	Channel string `json:"channel"`
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+}
+
+// wsRequest is a message from the client, subscribing or unsubscribing a
+// channel.
+type wsRequest struct {
+	Type string `json:"type"`
+	wsChannel
+}
+
+// wsMessage is a message to the client. Events are sent once for each
+// channel they're in, with the id of the stream event.
+type wsMessage struct {
+	Type string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+	ID int64 `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// wsSession is the state of a connection.
+type wsSession struct {
+	a *apiConfig
+	conn *websocket.Conn
+	uid uuid.UUID
+
+	mu sync.Mutex
+	handle string
+	home bool
+	mentions bool
+	notifications bool
+	messages bool
+	users map[uuid.UUID]bool
+	// following is who the home channel shows, the user included.
+	following map[uuid.UUID]bool
+	// hidden is the users the user blocked or muted, left out of every
+	// chirp channel.
+	hidden map[uuid.UUID]bool
+}
+
+// WebSocketHandler is the realtime API over one WebSocket connection. The
+// client authenticates with the bearer JWT of the upgrade request, then
+// subscribes to the home, user or mentions channels and gets their chirp
+// events as JSON, and to the notifications and messages channels for its
+// notifications and direct messages. The connection is closed when the JWT
+// expires, when the user is suspended, checked on each ping, and when the
+// client can't keep up with its events.
+func (a *apiConfig) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+
+	token, err := auth.GetBearerToken(r.Header)
+	if authError(err, w, r) {
+		return
+	}
+	uid, expires, err := auth.ValidateJWTExpiry(token, a.JWTSecret)
+	if authError(err, w, r) {
+		return
+	}
+	user, err := a.Store.GetUserByID(r.Context(), uid)
+	if authError(err, w, r) {
+		return
+	}
+
+	// the connection outlives the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		// Accept has responded
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(wsMaxMessage)
+
+	ws := &wsSession{
+		a: a,
+		conn: conn,
+		uid: uid,
+		handle: user.Handle,
+		users: map[uuid.UUID]bool{},
+	}
+	if err := ws.refresh(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "websocket follows", "err", err)
+		conn.Close(websocket.StatusInternalError, "something went wrong")
+		return
+	}
+
+	sub, _, _ := a.Broker.Subscribe(0)
+	defer a.Broker.Unsubscribe(sub)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		ws.readRequests(ctx)
+	}()
+
+	expired := time.NewTimer(time.Until(expires))
+	defer expired.Stop()
+	ping := time.NewTicker(wsPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// the client left, or a read failed and closed the connection
+			return
+
+		case <-expired.C:
+			conn.Close(websocket.StatusPolicyViolation, "token expired")
+			return
+
+		case e, ok := <-sub.C:
+			if !ok && a.Broker.Closed() {
+				conn.Close(websocket.StatusGoingAway, "server shutting down")
+				return
+			} else if !ok {
+				conn.Close(websocket.StatusTryAgainLater, "too slow")
+				return
+			}
+			if err := ws.send(ctx, e); err != nil {
+				conn.Close(websocket.StatusTryAgainLater, "too slow")
+				return
+			}
+
+		case <-ping.C:
+			pingCtx, cancelPing := context.WithTimeout(ctx, wsWriteTimeout)
+			err := conn.Ping(pingCtx)
+			cancelPing()
+			if err != nil {
+				return
+			}
+			_, err = a.Store.GetActiveSuspension(ctx, uid)
+			if err == nil {
+				conn.Close(websocket.StatusPolicyViolation, "account suspended")
+				return
+			}
+			if err := ws.refresh(ctx); err != nil {
+				slog.WarnContext(ctx, "websocket refresh", "err", err)
+			}
+		}
+	}
+}
+
+// readRequests handles the client messages until the connection fails.
+func (ws *wsSession) readRequests(ctx context.Context) {
+	for {
+		_, data, err := ws.conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			ws.write(ctx, wsMessage{Type: "error", Message: "Invalid message"})
+			continue
+		}
+		typ, msg := ws.apply(req)
+		ws.write(ctx, wsMessage{Type: typ, Channel: req.Channel, UserID: req.UserID, Message: msg})
+	}
+}
+
+// apply applies req, returning the type and message of the reply.
+func (ws *wsSession) apply(req wsRequest) (string, string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	on := req.Type == "subscribe"
+	if !on && req.Type != "unsubscribe" {
+		return "error", "Type must be subscribe or unsubscribe"
+	}
+
+	switch req.Channel {
+	case channelHome:
+		ws.home = on
+	case channelMentions:
+		ws.mentions = on
+	case channelNotifications:
+		ws.notifications = on
+	case channelMessages:
+		ws.messages = on
+	case channelUser:
+		if req.UserID == nil {
+			return "error", "A user channel needs a user_id"
+		}
+		if on && !ws.users[*req.UserID] && len(ws.users) >= wsMaxChannels {
+			return "error", "Too many user channels"
+		}
+		if on {
+			ws.users[*req.UserID] = true
+		} else {
+			delete(ws.users, *req.UserID)
+		}
+	default:
+		return "error", "Channel must be home, user, mentions, notifications or messages"
+	}
+	return req.Type + "d", ""
+}
+
+// refresh reloads who the user follows and hides.
+func (ws *wsSession) refresh(ctx context.Context) error {
+	user, err := ws.a.Store.GetUserByID(ctx, ws.uid)
+	if err != nil {
+		return err
+	}
+	ids, err := ws.a.Store.GetFolloweeIDs(ctx, ws.uid)
+	if err != nil {
+		return err
+	}
+	following := map[uuid.UUID]bool{ws.uid: true}
+	for _, id := range ids {
+		following[id] = true
+	}
+	ids, err = ws.a.Store.GetHiddenUserIDs(ctx, ws.uid)
+	if err != nil {
+		return err
+	}
+	hidden := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		hidden[id] = true
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.handle = user.Handle
+	ws.following = following
+	ws.hidden = hidden
+	return nil
+}
+
+// channels are the subscribed channels e is in.
+func (ws *wsSession) channels(e stream.Event) []wsChannel {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if e.Type == notifications.EventCreated {
+		if ws.notifications && e.UserID == ws.uid {
+			return []wsChannel{{Channel: channelNotifications}}
+		}
+		return nil
+	}
+	if e.Type == eventMessageCreated {
+		if ws.messages && e.UserID == ws.uid {
+			return []wsChannel{{Channel: channelMessages}}
+		}
+		return nil
+	}
+	if !isChirpEvent(e) || ws.hidden[e.UserID] {
+		return nil
+	}
+
+	var channels []wsChannel
+	if ws.home && ws.following[e.UserID] {
+		channels = append(channels, wsChannel{Channel: channelHome})
+	}
+	if ws.users[e.UserID] {
+		id := e.UserID
+		channels = append(channels, wsChannel{Channel: channelUser, UserID: &id})
+	}
+	if ws.mentions && e.Type == webhooks.EventChirpCreated && e.UserID != ws.uid {
+		var chirp struct {
+			Body string `json:"body"`
+		}
+		json.Unmarshal(e.Data, &chirp)
+		for _, handle := range mentionedHandles(chirp.Body) {
+			if handle == ws.handle {
+				channels = append(channels, wsChannel{Channel: channelMentions})
+				break
+			}
+		}
+	}
+	return channels
+}
+
+// send writes e to each of its channels.
+func (ws *wsSession) send(ctx context.Context, e stream.Event) error {
+	for _, channel := range ws.channels(e) {
+		err := ws.write(ctx, wsMessage{Type: e.Type, Channel: channel.Channel, UserID: channel.UserID, ID: e.ID, Data: e.Data})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write sends msg, failing when the client doesn't take it in time.
+func (ws *wsSession) write(ctx context.Context, msg wsMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, ws.conn, msg)
+}
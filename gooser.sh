@@ -3,4 +3,4 @@ source .env
 
 cmd="$1"
 
-goose -dir sql/schema/ 'postgres' "$DB_URL" "$cmd"
+go run ./cmd/chirpy migrate "$cmd"
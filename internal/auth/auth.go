@@ -3,9 +3,13 @@ package auth
 import (
 	"time"
 	"fmt"
+	"errors"
+	"strconv"
 	"strings"
 	"net/http"
 	"crypto/rand"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/hex"
 
 	"golang.org/x/crypto/bcrypt"
@@ -51,6 +55,62 @@ func GetAPIKey(header http.Header) (string, error) {
 
 }
 
+const (
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+var (
+	ErrWebhookSignatureMissing = errors.New("webhook signature headers not found")
+	ErrWebhookSignatureInvalid = errors.New("webhook signature does not match")
+	ErrWebhookTimestampExpired = errors.New("webhook timestamp outside of tolerance")
+	ErrWebhookSecretMissing    = errors.New("webhook secret is not set")
+)
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of "timestamp.body" using secret.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateWebhookSignature checks the timestamp and signature headers against
+// the raw request body. The timestamp must be within tolerance of now. No
+// signature is valid without a secret, as anyone can sign with an empty one.
+func ValidateWebhookSignature(header http.Header, body []byte, secret string, tolerance time.Duration) error {
+	if secret == "" {
+		return ErrWebhookSecretMissing
+	}
+	stamp := header.Get(WebhookTimestampHeader)
+	signature := header.Get(WebhookSignatureHeader)
+	if stamp == "" || signature == "" {
+		return ErrWebhookSignatureMissing
+	}
+
+	timestamp, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp: %w", err)
+	}
+
+	sent := time.Unix(timestamp, 0)
+	if diff := time.Since(sent); diff > tolerance || diff < -tolerance {
+		return ErrWebhookTimestampExpired
+	}
+
+	signature, _ = strings.CutPrefix(signature, "v1=")
+	given, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrWebhookSignatureInvalid
+	}
+	expect, _ := hex.DecodeString(SignWebhook(secret, timestamp, body))
+	if !hmac.Equal(given, expect) {
+		return ErrWebhookSignatureInvalid
+	}
+	return nil
+}
+
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
@@ -82,6 +142,12 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	uid, _, err := ValidateJWTExpiry(tokenString, tokenSecret)
+	return uid, err
+}
+
+// ValidateJWTExpiry is ValidateJWT also returning when the token expires.
+func ValidateJWTExpiry(tokenString, tokenSecret string) (uuid.UUID, time.Time, error) {
 
 	claims := jwt.RegisteredClaims{}
 
@@ -95,15 +161,19 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		},
 	)
 	if err != nil {
-		return uuid.UUID{}, err
+		return uuid.UUID{}, time.Time{}, err
 	}
 
 	if token.Valid {
 		strUID := token.Claims.(*jwt.RegisteredClaims).Subject
 		UUID := uuid.MustParse(strUID)
-		return UUID, nil
+		var expires time.Time
+		if claims.ExpiresAt != nil {
+			expires = claims.ExpiresAt.Time
+		}
+		return UUID, expires, nil
 	} else {
-		return uuid.UUID{}, fmt.Errorf("invalid token")
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("invalid token")
 	}
 
 }
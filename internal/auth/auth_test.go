@@ -3,6 +3,8 @@ package auth
 import (
 	"testing"
 	"time"
+	"errors"
+	"strconv"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -34,6 +36,11 @@ func TestJWT(t *testing.T) {
 		t.Errorf("UserID is %s, got %s", userID, datedUID)
 	}
 
+	_, expires, err := ValidateJWTExpiry(stringToken, secretToken)
+	if err != nil || expires.Before(time.Now()) || expires.After(time.Now().Add(expiresIn)) {
+		t.Errorf("expect an expiry within %s, got %s %v", expiresIn, expires, err)
+	}
+
 	time.Sleep(expiresIn)
 
 	_, err = ValidateJWT(stringToken, secretToken)
@@ -69,3 +76,49 @@ func TestBearerToken(t *testing.T) {
 	}
 
 }
+
+func TestWebhookSignature(t *testing.T) {
+	secret := "polka secret"
+	body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"x"}}`)
+
+	now := time.Now().Unix()
+	header := http.Header{}
+	header.Set(WebhookTimestampHeader, strconv.FormatInt(now, 10))
+	header.Set(WebhookSignatureHeader, "v1=" + SignWebhook(secret, now, body))
+
+	err := ValidateWebhookSignature(header, body, secret, time.Minute)
+	if err != nil {
+		t.Errorf("Unexpected Error: %s", err)
+	}
+
+	err = ValidateWebhookSignature(header, body, "wrong secret", time.Minute)
+	if !errors.Is(err, ErrWebhookSignatureInvalid) {
+		t.Errorf("wrong secret, expect %s, got %v", ErrWebhookSignatureInvalid, err)
+	}
+
+	err = ValidateWebhookSignature(header, append(body, ' '), secret, time.Minute)
+	if !errors.Is(err, ErrWebhookSignatureInvalid) {
+		t.Errorf("changed body, expect %s, got %v", ErrWebhookSignatureInvalid, err)
+	}
+
+	old := now - 600
+	header.Set(WebhookTimestampHeader, strconv.FormatInt(old, 10))
+	header.Set(WebhookSignatureHeader, SignWebhook(secret, old, body))
+	err = ValidateWebhookSignature(header, body, secret, time.Minute)
+	if !errors.Is(err, ErrWebhookTimestampExpired) {
+		t.Errorf("old timestamp, expect %s, got %v", ErrWebhookTimestampExpired, err)
+	}
+
+	err = ValidateWebhookSignature(http.Header{}, body, secret, time.Minute)
+	if !errors.Is(err, ErrWebhookSignatureMissing) {
+		t.Errorf("empty header, expect %s, got %v", ErrWebhookSignatureMissing, err)
+	}
+
+	// signed with an empty key, which anyone can do
+	header.Set(WebhookTimestampHeader, strconv.FormatInt(now, 10))
+	header.Set(WebhookSignatureHeader, "v1="+SignWebhook("", now, body))
+	err = ValidateWebhookSignature(header, body, "", time.Minute)
+	if !errors.Is(err, ErrWebhookSecretMissing) {
+		t.Errorf("empty secret, expect %s, got %v", ErrWebhookSecretMissing, err)
+	}
+}
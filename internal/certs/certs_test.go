@@ -0,0 +1,123 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self signed certificate for name to dir.
+func writeCert(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "old.example.com")
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cn := commonName(t, r); cn != "old.example.com" {
+		t.Errorf("expect old.example.com, got %s", cn)
+	}
+
+	writeCert(t, dir, "new.example.com")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cn := commonName(t, r); cn != "new.example.com" {
+		t.Errorf("expect new.example.com, got %s", cn)
+	}
+
+	// a broken file keeps the current certificate
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("expect error reloading a broken certificate")
+	}
+	if cn := commonName(t, r); cn != "new.example.com" {
+		t.Errorf("expect new.example.com kept, got %s", cn)
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "localhost")
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := ServerConfig(r, Options{
+		MinVersion:   "1.3",
+		CipherSuites: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+		ClientCAFile: certFile,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if conf.MinVersion != tls.VersionTLS13 {
+		t.Errorf("expect TLS 1.3, got %x", conf.MinVersion)
+	}
+	if len(conf.CipherSuites) != 1 || conf.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("unexpected config %#v", conf)
+	}
+
+	_, err = ServerConfig(r, Options{CipherSuites: "TLS_RSA_WITH_RC4_128_SHA"})
+	if err == nil {
+		t.Error("expect error for an insecure cipher suite")
+	}
+}
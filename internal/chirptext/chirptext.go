@@ -0,0 +1,112 @@
+// Package chirptext normalizes chirp bodies and measures their length the way
+// users see it: in characters as drawn on screen, with links counting the same
+// whatever their length.
+package chirptext
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// URLWeight is how many characters a link counts for.
+const URLWeight = 23
+
+// maxMarks is how many combining marks can follow one another, enough for
+// every script and too few to stack marks over the lines around them.
+const maxMarks = 8
+
+// urlPattern finds http and https links, without the punctuation that ends
+// the sentence around them.
+var urlPattern = regexp.MustCompile(`(?i)https?://[^\s]*[^\s.,;:!?'"()\[\]<>]`)
+
+// invisible are the format characters with no use in a chirp: the zero-width
+// spaces, the invisible operators, the blank fillers and the bidi marks,
+// embeddings, overrides and isolates, which reorder the text around them.
+var invisible = map[rune]bool{
+	'\u00ad': true, // soft hyphen
+	'\u180e': true, // mongolian vowel separator
+	'\u200b': true, // zero width space
+	'\u2060': true, // word joiner
+	'\u2061': true, // invisible operators
+	'\u2062': true,
+	'\u2063': true,
+	'\u2064': true,
+	'\ufeff': true, // zero width no-break space
+	'\u115f': true, // hangul fillers
+	'\u1160': true,
+	'\u3164': true,
+	'\uffa0': true,
+	'\u200e': true, // bidi marks: left-to-right, right-to-left and arabic letter
+	'\u200f': true,
+	'\u061c': true,
+	'\u202a': true, // bidi embeddings and overrides
+	'\u202b': true,
+	'\u202c': true,
+	'\u202d': true,
+	'\u202e': true,
+	'\u2066': true, // bidi isolates
+	'\u2067': true,
+	'\u2068': true,
+	'\u2069': true,
+}
+
+// isJoiner reports if r is a zero width joiner or non-joiner, which emoji
+// sequences and some scripts need.
+func isJoiner(r rune) bool {
+	return r == '\u200c' || r == '\u200d'
+}
+
+// Normalize returns body in NFC without control characters other than new
+// lines, without invisible characters and with the spaces around it trimmed.
+// Tabs become spaces, joiners are only kept between two characters and runs
+// of combining marks are cut to maxMarks.
+func Normalize(body string) string {
+	var runes []rune
+	marks := 0
+	for _, r := range body {
+		switch {
+		case r == '\t':
+			r = ' '
+		case r == '\n':
+		case unicode.IsControl(r), invisible[r], r == utf8.RuneError:
+			continue
+		}
+
+		if unicode.Is(unicode.Mn, r) {
+			if marks++; marks > maxMarks {
+				continue
+			}
+		} else {
+			marks = 0
+		}
+		runes = append(runes, r)
+	}
+
+	joins := func(r rune) bool { return !isJoiner(r) && !unicode.IsSpace(r) }
+	kept := runes[:0]
+	for i, r := range runes {
+		if isJoiner(r) && (len(kept) == 0 || !joins(kept[len(kept)-1]) || i+1 == len(runes) || !joins(runes[i+1])) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	return strings.TrimSpace(norm.NFC.String(string(kept)))
+}
+
+// Length is how many characters body counts for: its grapheme clusters, with
+// every link counting for URLWeight.
+func Length(body string) int {
+	n := 0
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		n += uniseg.GraphemeClusterCount(body[last:loc[0]]) + URLWeight
+		last = loc[1]
+	}
+	return n + uniseg.GraphemeClusterCount(body[last:])
+}
@@ -0,0 +1,63 @@
+package chirptext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		body   string
+		expect string
+	}{
+		{"hello", "hello"},
+		{"  hello\t world \n", "hello  world"},
+		{"line\r\nbreak", "line\nbreak"},
+		{"e\u0301", "\u00e9"},
+		{"ze\u200bro\ufeff", "zero"},
+		{"\u202eevil", "evil"},
+		{"\u200fevil\u200e\u061c", "evil"},
+		{"bell\a", "bell"},
+		{"\u3164", ""},
+		{"\u200b \u200b", ""},
+		{"\U0001F468\u200d\U0001F469\u200d\U0001F467", "\U0001F468\u200d\U0001F469\u200d\U0001F467"},
+		{"\u200da\u200d\u200db\u200d", "a\u200db"},
+		{"a\u200d b", "a b"},
+		{"می\u200cخوام", "می\u200cخوام"},
+		{"bad\xffutf8", "badutf8"},
+		{"x" + strings.Repeat("\u0301", 20), "x" + strings.Repeat("\u0301", maxMarks)},
+	}
+	for _, c := range cases {
+		got := Normalize(c.body)
+		if got != c.expect {
+			t.Errorf("Normalize(%q): expect %q, got %q", c.body, c.expect, got)
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	cases := []struct {
+		body   string
+		expect int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"caf\u00e9", 4},
+		{"cafe\u0301", 4},
+		{strings.Repeat("\U0001F600", 50), 50},
+		{"\U0001F468\u200d\U0001F469\u200d\U0001F467", 1},
+		{"\U0001F1FA\U0001F1F8", 1},
+		{"\U0001F44D\U0001F3FD", 1},
+		{"おはよう", 4},
+		{"https://example.com/" + strings.Repeat("a", 100), URLWeight},
+		{"see https://example.com.", 4 + URLWeight + 1},
+		{"(http://a.io) and HTTPS://b.io/x?y=1", 1 + URLWeight + 6 + URLWeight},
+		{"http://", 7},
+	}
+	for _, c := range cases {
+		got := Length(c.body)
+		if got != c.expect {
+			t.Errorf("Length(%q): expect %d, got %d", c.body, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+// Package config loads the server configuration. Values are layered, each
+// overriding the last: defaults, a YAML or TOML file, environment variables
+// and command line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Addr string `yaml:"addr" toml:"addr"`
+	// StaticDir serves the web site from disk instead of the embedded copy.
+	StaticDir string `yaml:"static_dir" toml:"static_dir"`
+	Platform  string `yaml:"platform" toml:"platform"`
+	JWTSecret string `yaml:"jwt_secret_key" toml:"jwt_secret_key"`
+	PolkaKey  string `yaml:"polka_key" toml:"polka_key"`
+
+	TLS       TLS       `yaml:"tls" toml:"tls"`
+	Timeouts  Timeouts  `yaml:"timeouts" toml:"timeouts"`
+	Tokens    Tokens    `yaml:"tokens" toml:"tokens"`
+	Limits    Limits    `yaml:"limits" toml:"limits"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+	Filter    Filter    `yaml:"filter" toml:"filter"`
+	Media     Media     `yaml:"media" toml:"media"`
+	Webhooks  Webhooks  `yaml:"webhooks" toml:"webhooks"`
+	DB        DB        `yaml:"db" toml:"db"`
+	Log       Log       `yaml:"log" toml:"log"`
+}
+
+type TLS struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+	// ReloadInterval is how often the files are checked for changes, 0 only
+	// reloads on SIGHUP.
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval"`
+	MinVersion     string        `yaml:"min_version" toml:"min_version"`
+	// CipherSuites is a comma separated list of TLS 1.2 suite names.
+	CipherSuites string `yaml:"cipher_suites" toml:"cipher_suites"`
+	// ClientCAFile requires client certificates signed by these CAs on the
+	// admin routes.
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+	// RedirectAddr listens for plain HTTP and redirects it to HTTPS.
+	RedirectAddr string        `yaml:"redirect_addr" toml:"redirect_addr"`
+	HSTSMaxAge   time.Duration `yaml:"hsts_max_age" toml:"hsts_max_age"`
+}
+
+// Enabled reports if the server should serve HTTPS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+type Timeouts struct {
+	ReadHeader time.Duration `yaml:"read_header" toml:"read_header"`
+	Read       time.Duration `yaml:"read" toml:"read"`
+	Write      time.Duration `yaml:"write" toml:"write"`
+	Idle       time.Duration `yaml:"idle" toml:"idle"`
+	Shutdown   time.Duration `yaml:"shutdown" toml:"shutdown"`
+}
+
+type Tokens struct {
+	AccessTTL  time.Duration `yaml:"access_ttl" toml:"access_ttl"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" toml:"refresh_ttl"`
+}
+
+type Limits struct {
+	// MaxBodyBytes caps the size of request bodies.
+	MaxBodyBytes int64 `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	// PlansFile overrides the per plan limits, see the entitlements package.
+	PlansFile string `yaml:"plans_file" toml:"plans_file"`
+}
+
+// RateLimit is how many requests a minute a client may make to each group
+// of routes, 0 doesn't limit the group.
+type RateLimit struct {
+	// Store is "memory", or "postgres" to share the limits between instances.
+	Store string `yaml:"store" toml:"store"`
+	// TrustedProxies is a comma separated list of the IPs and CIDRs of the
+	// reverse proxies whose X-Forwarded-For is believed.
+	TrustedProxies string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	// Auth is signing up, logging in and refreshing tokens.
+	Auth int `yaml:"auth" toml:"auth"`
+	// Write is every other change, like posting chirps.
+	Write int `yaml:"write" toml:"write"`
+	Read  int `yaml:"read" toml:"read"`
+}
+
+// Filter is the content filter of the chirps, see the moderation package.
+type Filter struct {
+	// RulesFile replaces the default rules. The rules added by the admins
+	// apply as well.
+	RulesFile string `yaml:"rules_file" toml:"rules_file"`
+	// ReloadInterval is how often the rules are reloaded, 0 only reloads
+	// when the admins change them.
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval"`
+}
+
+// Media is where the images attached to chirps are kept, see the media
+// package.
+type Media struct {
+	// Store is "fs" to keep the files under Dir, or "s3" for an S3
+	// compatible object store.
+	Store string `yaml:"store" toml:"store"`
+	Dir   string `yaml:"dir" toml:"dir"`
+	S3    S3     `yaml:"s3" toml:"s3"`
+	// MaxBytes caps the size of an uploaded file.
+	MaxBytes int64 `yaml:"max_bytes" toml:"max_bytes"`
+	// URLTTL is how long the signed links to the files work.
+	URLTTL time.Duration `yaml:"url_ttl" toml:"url_ttl"`
+	// UploadTTL is how long an upload can wait for a chirp before it is
+	// deleted.
+	UploadTTL time.Duration `yaml:"upload_ttl" toml:"upload_ttl"`
+}
+
+// Webhooks are the HTTP callbacks users register, see the webhooks package.
+type Webhooks struct {
+	// AllowNetworks is a comma separated list of the IPs and CIDRs webhooks
+	// may be sent to although they are loopback, private or link-local
+	// addresses, which are refused otherwise.
+	AllowNetworks string `yaml:"allow_networks" toml:"allow_networks"`
+}
+
+type S3 struct {
+	Endpoint  string `yaml:"endpoint" toml:"endpoint"`
+	Region    string `yaml:"region" toml:"region"`
+	Bucket    string `yaml:"bucket" toml:"bucket"`
+	AccessKey string `yaml:"access_key" toml:"access_key"`
+	SecretKey string `yaml:"secret_key" toml:"secret_key"`
+	// PathStyle puts the bucket in the path, as MinIO needs.
+	PathStyle bool `yaml:"path_style" toml:"path_style"`
+}
+
+type DB struct {
+	URL             string        `yaml:"url" toml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	// AutoMigrate applies pending migrations on startup.
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+}
+
+type Log struct {
+	File  string `yaml:"file" toml:"file"`
+	Level string `yaml:"level" toml:"level"`
+}
+
+// Default returns the configuration used for anything left unset.
+func Default() Config {
+	return Config{
+		Addr: ":8080",
+		TLS: TLS{
+			ReloadInterval: time.Minute,
+			MinVersion:     "1.2",
+			HSTSMaxAge:     365 * 24 * time.Hour,
+		},
+		Timeouts: Timeouts{
+			ReadHeader: 5 * time.Second,
+			Read:       15 * time.Second,
+			Write:      30 * time.Second,
+			Idle:       2 * time.Minute,
+			Shutdown:   30 * time.Second,
+		},
+		Tokens: Tokens{
+			AccessTTL:  time.Hour,
+			RefreshTTL: 60 * 24 * time.Hour,
+		},
+		Limits: Limits{
+			MaxBodyBytes: 1 << 20,
+		},
+		RateLimit: RateLimit{
+			Store: "memory",
+			Auth:  20,
+			Write: 120,
+			Read:  600,
+		},
+		Filter: Filter{
+			ReloadInterval: time.Minute,
+		},
+		Media: Media{
+			Store:     "fs",
+			Dir:       "media",
+			MaxBytes:  5 << 20,
+			URLTTL:    time.Hour,
+			UploadTTL: 24 * time.Hour,
+		},
+		DB: DB{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Log: Log{
+			Level: "info",
+		},
+	}
+}
+
+// option is one setting reachable from the environment and the command line.
+type option struct {
+	flag  string
+	env   string
+	value any // *string, *bool, *int, *int64 or *time.Duration
+	usage string
+}
+
+func (c *Config) options() []option {
+	return []option{
+		{"addr", "ADDR", &c.Addr, "address to listen on"},
+		{"static-dir", "STATIC_DIR", &c.StaticDir, "serve the web site from this directory instead of the binary"},
+		{"platform", "PLATFORM", &c.Platform, `"dev" enables the admin reset`},
+		{"jwt-secret-key", "JWT_SECRET_KEY", &c.JWTSecret, "HMAC secret for signing JWTs"},
+		{"polka-key", "POLKA_KEY", &c.PolkaKey, "secret of the Polka webhooks"},
+		{"tls-cert-file", "TLS_CERT_FILE", &c.TLS.CertFile, "TLS certificate, enables HTTPS"},
+		{"tls-key-file", "TLS_KEY_FILE", &c.TLS.KeyFile, "TLS private key"},
+		{"tls-reload-interval", "TLS_RELOAD_INTERVAL", &c.TLS.ReloadInterval, "how often to check the TLS files for changes, 0 only on SIGHUP"},
+		{"tls-min-version", "TLS_MIN_VERSION", &c.TLS.MinVersion, "1.2 or 1.3"},
+		{"tls-cipher-suites", "TLS_CIPHER_SUITES", &c.TLS.CipherSuites, "comma separated TLS 1.2 cipher suites"},
+		{"tls-client-ca-file", "TLS_CLIENT_CA_FILE", &c.TLS.ClientCAFile, "CAs of the client certificates required on admin routes"},
+		{"tls-redirect-addr", "TLS_REDIRECT_ADDR", &c.TLS.RedirectAddr, "plain HTTP address redirecting to HTTPS"},
+		{"hsts-max-age", "HSTS_MAX_AGE", &c.TLS.HSTSMaxAge, "Strict-Transport-Security max age, 0 disables"},
+		{"read-header-timeout", "READ_HEADER_TIMEOUT", &c.Timeouts.ReadHeader, "time to read request headers"},
+		{"read-timeout", "READ_TIMEOUT", &c.Timeouts.Read, "time to read a request"},
+		{"write-timeout", "WRITE_TIMEOUT", &c.Timeouts.Write, "time to write a response"},
+		{"idle-timeout", "IDLE_TIMEOUT", &c.Timeouts.Idle, "time to keep idle connections"},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", &c.Timeouts.Shutdown, "time in flight requests get on shutdown"},
+		{"access-token-ttl", "ACCESS_TOKEN_TTL", &c.Tokens.AccessTTL, "lifetime of JWTs"},
+		{"refresh-token-ttl", "REFRESH_TOKEN_TTL", &c.Tokens.RefreshTTL, "lifetime of refresh tokens"},
+		{"max-body-bytes", "MAX_BODY_BYTES", &c.Limits.MaxBodyBytes, "largest request body accepted"},
+		{"plans-file", "PLANS_FILE", &c.Limits.PlansFile, "JSON file of the per plan limits"},
+		{"rate-limit-store", "RATE_LIMIT_STORE", &c.RateLimit.Store, `"memory", or "postgres" to share limits between instances`},
+		{"trusted-proxies", "TRUSTED_PROXIES", &c.RateLimit.TrustedProxies, "comma separated IPs and CIDRs of reverse proxies setting X-Forwarded-For"},
+		{"rate-limit-auth", "RATE_LIMIT_AUTH", &c.RateLimit.Auth, "signups, logins and refreshes a minute per client, 0 is no limit"},
+		{"rate-limit-write", "RATE_LIMIT_WRITE", &c.RateLimit.Write, "writes a minute per user, 0 is no limit"},
+		{"rate-limit-read", "RATE_LIMIT_READ", &c.RateLimit.Read, "reads a minute per client, 0 is no limit"},
+		{"filter-rules-file", "FILTER_RULES_FILE", &c.Filter.RulesFile, "JSON file of the content filter rules, replacing the defaults"},
+		{"filter-reload-interval", "FILTER_RELOAD_INTERVAL", &c.Filter.ReloadInterval, "how often to reload the content filter rules, 0 only when changed"},
+		{"media-store", "MEDIA_STORE", &c.Media.Store, `"fs", or "s3" for an S3 compatible object store`},
+		{"media-dir", "MEDIA_DIR", &c.Media.Dir, "directory of the uploaded images with the fs store"},
+		{"media-max-bytes", "MEDIA_MAX_BYTES", &c.Media.MaxBytes, "largest image accepted"},
+		{"media-url-ttl", "MEDIA_URL_TTL", &c.Media.URLTTL, "lifetime of the signed links to images"},
+		{"media-upload-ttl", "MEDIA_UPLOAD_TTL", &c.Media.UploadTTL, "age at which the uploads in no chirp are deleted"},
+		{"s3-endpoint", "S3_ENDPOINT", &c.Media.S3.Endpoint, "URL of the S3 compatible object store"},
+		{"s3-region", "S3_REGION", &c.Media.S3.Region, "region of the bucket, us-east-1 if unset"},
+		{"s3-bucket", "S3_BUCKET", &c.Media.S3.Bucket, "bucket of the uploaded images"},
+		{"s3-access-key", "S3_ACCESS_KEY", &c.Media.S3.AccessKey, "access key of the object store"},
+		{"s3-secret-key", "S3_SECRET_KEY", &c.Media.S3.SecretKey, "secret key of the object store"},
+		{"s3-path-style", "S3_PATH_STYLE", &c.Media.S3.PathStyle, "put the bucket in the path, for MinIO"},
+		{"webhook-allow-networks", "WEBHOOK_ALLOW_NETWORKS", &c.Webhooks.AllowNetworks, "comma separated internal IPs and CIDRs webhooks may be sent to"},
+		{"db-url", "DB_URL", &c.DB.URL, "database url, postgres:// or sqlite:"},
+		{"db-max-open-conns", "DB_MAX_OPEN_CONNS", &c.DB.MaxOpenConns, "most open database connections"},
+		{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", &c.DB.MaxIdleConns, "most idle database connections"},
+		{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", &c.DB.ConnMaxLifetime, "longest a database connection is reused"},
+		{"auto-migrate", "AUTO_MIGRATE", &c.DB.AutoMigrate, "apply pending migrations on startup"},
+		{"log-file", "LOG_FILE", &c.Log.File, "write logs to this file instead of stdout"},
+		{"log-level", "LOG_LEVEL", &c.Log.Level, "debug, info, warn or error"},
+	}
+}
+
+// Load builds the configuration from args (without the program name) and
+// getenv. The file is taken from the -config flag or CONFIG_FILE. On a
+// validation error the configuration is still returned, for commands that
+// only need part of it.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	// first pass only to find the config file
+	var path string
+	scratch := Default()
+	fs := scratch.flagSet(&path)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if path == "" {
+		path = getenv("CONFIG_FILE")
+	}
+
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := cfg.loadEnv(getenv); err != nil {
+		return Config{}, err
+	}
+
+	// flags default to the values so far, so only the ones given override
+	fs = cfg.flagSet(&path)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) flagSet(path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.StringVar(path, "config", "", "YAML or TOML config file")
+	for _, o := range c.options() {
+		switch v := o.value.(type) {
+		case *string:
+			fs.StringVar(v, o.flag, *v, o.usage)
+		case *bool:
+			fs.BoolVar(v, o.flag, *v, o.usage)
+		case *int:
+			fs.IntVar(v, o.flag, *v, o.usage)
+		case *int64:
+			fs.Int64Var(v, o.flag, *v, o.usage)
+		case *time.Duration:
+			fs.DurationVar(v, o.flag, *v, o.usage)
+		}
+	}
+	return fs
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("config: %s: unknown format, want .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(getenv func(string) string) error {
+	for _, o := range c.options() {
+		s := getenv(o.env)
+		if s == "" {
+			continue
+		}
+
+		var err error
+		switch v := o.value.(type) {
+		case *string:
+			*v = s
+		case *bool:
+			*v, err = strconv.ParseBool(s)
+		case *int:
+			*v, err = strconv.Atoi(s)
+		case *int64:
+			*v, err = strconv.ParseInt(s, 10, 64)
+		case *time.Duration:
+			*v, err = time.ParseDuration(s)
+		}
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", o.env, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports every invalid or missing setting.
+func (c Config) Validate() error {
+	var errs []error
+	if c.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_SECRET_KEY is required"))
+	}
+	if c.PolkaKey == "" {
+		errs = append(errs, errors.New("POLKA_KEY is required"))
+	}
+	if c.DB.URL == "" {
+		errs = append(errs, errors.New("DB_URL is required"))
+	}
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr is required"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls needs both a cert file and a key file"))
+	}
+	if !c.TLS.Enabled() && (c.TLS.ClientCAFile != "" || c.TLS.RedirectAddr != "") {
+		errs = append(errs, errors.New("tls client ca file and redirect addr need a cert and key file"))
+	}
+	switch c.TLS.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		errs = append(errs, fmt.Errorf("unknown tls min version %q, want 1.2 or 1.3", c.TLS.MinVersion))
+	}
+	if c.TLS.ReloadInterval < 0 || c.TLS.HSTSMaxAge < 0 {
+		errs = append(errs, errors.New("tls reload interval and hsts max age must not be negative"))
+	}
+	if c.Tokens.AccessTTL <= 0 || c.Tokens.RefreshTTL <= 0 {
+		errs = append(errs, errors.New("token ttls must be positive"))
+	}
+	if c.Timeouts.ReadHeader < 0 || c.Timeouts.Read < 0 || c.Timeouts.Write < 0 || c.Timeouts.Idle < 0 || c.Timeouts.Shutdown < 0 {
+		errs = append(errs, errors.New("timeouts must not be negative"))
+	}
+	if c.Limits.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("max body bytes must be positive"))
+	}
+	switch c.RateLimit.Store {
+	case "memory", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("unknown rate limit store %q, want memory or postgres", c.RateLimit.Store))
+	}
+	if c.RateLimit.Auth < 0 || c.RateLimit.Write < 0 || c.RateLimit.Read < 0 {
+		errs = append(errs, errors.New("rate limits must not be negative"))
+	}
+	if c.Filter.ReloadInterval < 0 {
+		errs = append(errs, errors.New("filter reload interval must not be negative"))
+	}
+	switch c.Media.Store {
+	case "fs":
+		if c.Media.Dir == "" {
+			errs = append(errs, errors.New("media dir is required with the fs store"))
+		}
+	case "s3":
+		if c.Media.S3.Endpoint == "" || c.Media.S3.Bucket == "" {
+			errs = append(errs, errors.New("s3 endpoint and bucket are required with the s3 store"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown media store %q, want fs or s3", c.Media.Store))
+	}
+	if c.Media.MaxBytes <= 0 || c.Media.URLTTL <= 0 || c.Media.UploadTTL <= 0 {
+		errs = append(errs, errors.New("media max bytes, url ttl and upload ttl must be positive"))
+	}
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 || c.DB.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("db pool settings must not be negative"))
+	}
+	switch c.Log.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log level %q", c.Log.Level))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chirpy.yaml")
+	file := "addr: \":9000\"\ntokens:\n  access_ttl: 15m\ndb:\n  url: postgres://file\n  max_open_conns: 10\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(
+		[]string{"-config", path, "-addr", ":9999"},
+		env(map[string]string{
+			"JWT_SECRET_KEY":    "secret",
+			"POLKA_KEY":         "polka",
+			"DB_MAX_OPEN_CONNS": "50",
+			"ADDR":              ":7000",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if cfg.Addr != ":9999" {
+		t.Errorf("expect flag addr :9999, got %s", cfg.Addr)
+	}
+	if cfg.DB.MaxOpenConns != 50 {
+		t.Errorf("expect env max open conns 50, got %d", cfg.DB.MaxOpenConns)
+	}
+	if cfg.DB.URL != "postgres://file" {
+		t.Errorf("expect file db url, got %s", cfg.DB.URL)
+	}
+	if cfg.Tokens.AccessTTL != 15*time.Minute {
+		t.Errorf("expect file access ttl 15m, got %s", cfg.Tokens.AccessTTL)
+	}
+	if cfg.Tokens.RefreshTTL != Default().Tokens.RefreshTTL {
+		t.Errorf("expect default refresh ttl, got %s", cfg.Tokens.RefreshTTL)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.toml")
+	file := "jwt_secret_key = \"secret\"\n[db]\nurl = \"postgres://toml\"\n[timeouts]\nshutdown = \"5s\"\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(nil, env(map[string]string{"CONFIG_FILE": path, "POLKA_KEY": "polka"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.DB.URL != "postgres://toml" || cfg.Timeouts.Shutdown != 5*time.Second {
+		t.Errorf("unexpected config %#v", cfg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, err := Load(nil, env(nil))
+	if err == nil {
+		t.Fatal("expect error for missing secrets")
+	}
+	for _, want := range []string{"JWT_SECRET_KEY", "POLKA_KEY", "DB_URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expect %s in %q", want, err)
+		}
+	}
+
+	_, err = Load([]string{"-tls-cert-file", "cert.pem"}, env(map[string]string{
+		"JWT_SECRET_KEY": "secret",
+		"DB_URL":         "postgres://env",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "tls") {
+		t.Errorf("expect tls error, got %v", err)
+	}
+
+	_, err = Load(nil, env(map[string]string{
+		"JWT_SECRET_KEY":   "secret",
+		"DB_URL":           "postgres://env",
+		"ACCESS_TOKEN_TTL": "soon",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "ACCESS_TOKEN_TTL") {
+		t.Errorf("expect ttl parse error, got %v", err)
+	}
+
+	_, err = Load([]string{"-rate-limit-store", "redis"}, env(map[string]string{
+		"JWT_SECRET_KEY": "secret",
+		"DB_URL":         "postgres://env",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "rate limit store") {
+		t.Errorf("expect rate limit store error, got %v", err)
+	}
+
+	_, err = Load([]string{"-filter-reload-interval", "-1m"}, env(map[string]string{
+		"JWT_SECRET_KEY": "secret",
+		"DB_URL":         "postgres://env",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "filter reload interval") {
+		t.Errorf("expect filter reload interval error, got %v", err)
+	}
+
+	_, err = Load([]string{"-media-store", "s3"}, env(map[string]string{
+		"JWT_SECRET_KEY": "secret",
+		"DB_URL":         "postgres://env",
+		"S3_BUCKET":      "chirpy",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "s3 endpoint") {
+		t.Errorf("expect s3 endpoint error, got %v", err)
+	}
+
+	_, err = Load([]string{"-media-upload-ttl", "0s"}, env(map[string]string{
+		"JWT_SECRET_KEY": "secret",
+		"DB_URL":         "postgres://env",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "upload ttl") {
+		t.Errorf("expect upload ttl error, got %v", err)
+	}
+}
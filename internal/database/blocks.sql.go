@@ -0,0 +1,193 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: blocks.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const blockUser = `-- name: BlockUser :execrows
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES (
+	$1,
+	$2,
+	now()
+)
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING
+`
+
+type BlockUserParams struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+}
+
+func (q *Queries) BlockUser(ctx context.Context, arg BlockUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, blockUser, arg.BlockerID, arg.BlockedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getHiddenUserIDs = `-- name: GetHiddenUserIDs :many
+SELECT blocked_id AS user_id FROM blocks WHERE blocker_id = $1
+UNION
+SELECT muted_id AS user_id FROM mutes WHERE muter_id = $1
+`
+
+func (q *Queries) GetHiddenUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getHiddenUserIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isBlockedBetween = `-- name: IsBlockedBetween :one
+SELECT EXISTS (
+	SELECT 1 FROM blocks
+	WHERE (blocker_id = $1 AND blocked_id = $2)
+	OR (blocker_id = $2 AND blocked_id = $1)
+) AS is_blocked
+`
+
+type IsBlockedBetweenParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	OtherID uuid.UUID `json:"other_id"`
+}
+
+func (q *Queries) IsBlockedBetween(ctx context.Context, arg IsBlockedBetweenParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isBlockedBetween, arg.UserID, arg.OtherID)
+	var is_blocked bool
+	err := row.Scan(&is_blocked)
+	return is_blocked, err
+}
+
+const listBlocks = `-- name: ListBlocks :many
+SELECT blocker_id, blocked_id, created_at FROM blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListBlocks(ctx context.Context, blockerID uuid.UUID) ([]Block, error) {
+	rows, err := q.db.QueryContext(ctx, listBlocks, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Block
+	for rows.Next() {
+		var i Block
+		if err := rows.Scan(&i.BlockerID, &i.BlockedID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMutes = `-- name: ListMutes :many
+SELECT muter_id, muted_id, created_at FROM mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListMutes(ctx context.Context, muterID uuid.UUID) ([]Mute, error) {
+	rows, err := q.db.QueryContext(ctx, listMutes, muterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Mute
+	for rows.Next() {
+		var i Mute
+		if err := rows.Scan(&i.MuterID, &i.MutedID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const muteUser = `-- name: MuteUser :execrows
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES (
+	$1,
+	$2,
+	now()
+)
+ON CONFLICT (muter_id, muted_id) DO NOTHING
+`
+
+type MuteUserParams struct {
+	MuterID uuid.UUID `json:"muter_id"`
+	MutedID uuid.UUID `json:"muted_id"`
+}
+
+func (q *Queries) MuteUser(ctx context.Context, arg MuteUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, muteUser, arg.MuterID, arg.MutedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unblockUser = `-- name: UnblockUser :exec
+DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2
+`
+
+type UnblockUserParams struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+}
+
+func (q *Queries) UnblockUser(ctx context.Context, arg UnblockUserParams) error {
+	_, err := q.db.ExecContext(ctx, unblockUser, arg.BlockerID, arg.BlockedID)
+	return err
+}
+
+const unmuteUser = `-- name: UnmuteUser :exec
+DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2
+`
+
+type UnmuteUserParams struct {
+	MuterID uuid.UUID `json:"muter_id"`
+	MutedID uuid.UUID `json:"muted_id"`
+}
+
+func (q *Queries) UnmuteUser(ctx context.Context, arg UnmuteUserParams) error {
+	_, err := q.db.ExecContext(ctx, unmuteUser, arg.MuterID, arg.MutedID)
+	return err
+}
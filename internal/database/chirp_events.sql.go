@@ -0,0 +1,33 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: chirp_events.sql
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+const notifyChirpEvent = `-- name: NotifyChirpEvent :exec
+SELECT pg_notify('chirp_events', json_build_object(
+	'id', nextval('chirp_event_ids'),
+	'type', $1::text,
+	'user_id', $2::uuid,
+	'data', $3::json
+)::text)
+`
+
+type NotifyChirpEventParams struct {
+	Type   string          `json:"type"`
+	UserID uuid.UUID       `json:"user_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func (q *Queries) NotifyChirpEvent(ctx context.Context, arg NotifyChirpEventParams) error {
+	_, err := q.db.ExecContext(ctx, notifyChirpEvent, arg.Type, arg.UserID, arg.Data)
+	return err
+}
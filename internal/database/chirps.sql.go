@@ -7,29 +7,59 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByUserSince = `-- name: CountChirpsByUserSince :one
+SELECT count(*) FROM chirps WHERE user_id = $1 AND created_at >= $2
+`
+
+type CountChirpsByUserSinceParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) CountChirpsByUserSince(ctx context.Context, arg CountChirpsByUserSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserSince, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPinnedChirps = `-- name: CountPinnedChirps :one
+SELECT count(*) FROM pinned_chirps WHERE user_id = $1
+`
+
+func (q *Queries) CountPinnedChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPinnedChirps, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id,  created_at, updated_at, user_id, body) 
+INSERT INTO chirps (id,  created_at, updated_at, user_id, body, held) 
 VALUES (
 	gen_random_uuid(),
 	now(),
 	now(),
 	$1,
-	$2
+	$2,
+	$3
 )
-RETURNING id, user_id, created_at, updated_at, body
+RETURNING id, user_id, created_at, updated_at, body, held
 `
 
 type CreateChirpParams struct {
 	UserID uuid.UUID `json:"user_id"`
 	Body   string    `json:"body"`
+	Held   bool      `json:"held"`
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.UserID, arg.Body)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.UserID, arg.Body, arg.Held)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +67,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
+		&i.Held,
 	)
 	return i, err
 }
@@ -51,7 +82,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getAChirp = `-- name: GetAChirp :one
-SELECT id, user_id, created_at, updated_at, body FROM chirps WHERE id = $1
+SELECT id, user_id, created_at, updated_at, body, held FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetAChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -63,16 +94,26 @@ func (q *Queries) GetAChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
+		&i.Held,
 	)
 	return i, err
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, user_id, created_at, updated_at, body FROM chirps ORDER BY created_at ASC
+SELECT chirps.id, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.body, chirps.held FROM chirps
+LEFT JOIN blocks ON blocks.blocker_id = $1 AND blocks.blocked_id = chirps.user_id
+LEFT JOIN mutes ON mutes.muter_id = $1 AND mutes.muted_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE NOT chirps.held AND blocks.blocker_id IS NULL AND mutes.muter_id IS NULL AND suspensions.id IS NULL
+ORDER BY chirps.created_at ASC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+// The chirp listings leave out the chirps of the users the viewer blocked or
+// muted, of the suspended users and the held chirps. The nil UUID is an
+// anonymous viewer, who blocked and muted nobody.
+func (q *Queries) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +127,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
+			&i.Held,
 		); err != nil {
 			return nil, err
 		}
@@ -101,11 +143,164 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getAllChirpsByUser = `-- name: GetAllChirpsByUser :many
-SELECT id, user_id, created_at, updated_at, body FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
+SELECT chirps.id, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.body, chirps.held FROM chirps
+LEFT JOIN blocks ON blocks.blocker_id = $1 AND blocks.blocked_id = chirps.user_id
+LEFT JOIN mutes ON mutes.muter_id = $1 AND mutes.muted_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE chirps.user_id = $2
+AND NOT chirps.held AND blocks.blocker_id IS NULL AND mutes.muter_id IS NULL AND suspensions.id IS NULL
+ORDER BY chirps.created_at ASC
+`
+
+type GetAllChirpsByUserParams struct {
+	ViewerID uuid.UUID `json:"viewer_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetAllChirpsByUser(ctx context.Context, arg GetAllChirpsByUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsByUser, arg.ViewerID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.Held,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPinnedChirpsByUser = `-- name: GetPinnedChirpsByUser :many
+SELECT chirps.id, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.body, chirps.held FROM chirps
+JOIN pinned_chirps ON pinned_chirps.chirp_id = chirps.id
+LEFT JOIN blocks ON blocks.blocker_id = $1 AND blocks.blocked_id = chirps.user_id
+LEFT JOIN mutes ON mutes.muter_id = $1 AND mutes.muted_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE pinned_chirps.user_id = $2
+AND NOT chirps.held AND blocks.blocker_id IS NULL AND mutes.muter_id IS NULL AND suspensions.id IS NULL
+ORDER BY pinned_chirps.pinned_at DESC
+`
+
+type GetPinnedChirpsByUserParams struct {
+	ViewerID uuid.UUID `json:"viewer_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetPinnedChirpsByUser(ctx context.Context, arg GetPinnedChirpsByUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getPinnedChirpsByUser, arg.ViewerID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.Held,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisibleChirp = `-- name: GetVisibleChirp :one
+SELECT chirps.id, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.body, chirps.held FROM chirps
+LEFT JOIN blocks ON blocks.blocker_id = $1 AND blocks.blocked_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE chirps.id = $2
+AND (chirps.user_id = $1 OR (NOT chirps.held AND blocks.blocker_id IS NULL AND suspensions.id IS NULL))
+`
+
+type GetVisibleChirpParams struct {
+	ViewerID uuid.UUID `json:"viewer_id"`
+	ID       uuid.UUID `json:"id"`
+}
+
+// GetAChirp as the viewer sees it: like the listings, without the chirps of the
+// users the viewer blocked or of the suspended users, and with a held chirp
+// only seen by its author. A muted user's chirp is still there to be opened.
+func (q *Queries) GetVisibleChirp(ctx context.Context, arg GetVisibleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirp, arg.ViewerID, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.Held,
+	)
+	return i, err
+}
+
+const isChirpPinned = `-- name: IsChirpPinned :one
+SELECT EXISTS (
+	SELECT 1 FROM pinned_chirps WHERE user_id = $1 AND chirp_id = $2
+) AS is_pinned
 `
 
-func (q *Queries) GetAllChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirpsByUser, userID)
+type IsChirpPinnedParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	ChirpID uuid.UUID `json:"chirp_id"`
+}
+
+func (q *Queries) IsChirpPinned(ctx context.Context, arg IsChirpPinnedParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isChirpPinned, arg.UserID, arg.ChirpID)
+	var is_pinned bool
+	err := row.Scan(&is_pinned)
+	return is_pinned, err
+}
+
+const listHeldChirps = `-- name: ListHeldChirps :many
+SELECT id, user_id, created_at, updated_at, body, held FROM chirps
+WHERE held
+AND (created_at > $1 OR (created_at = $1 AND id > $2))
+ORDER BY created_at, id
+LIMIT $3
+`
+
+type ListHeldChirpsParams struct {
+	After   time.Time `json:"after"`
+	AfterID uuid.UUID `json:"after_id"`
+	MaxRows int32     `json:"max_rows"`
+}
+
+// oldest first, like the reports
+func (q *Queries) ListHeldChirps(ctx context.Context, arg ListHeldChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listHeldChirps, arg.After, arg.AfterID, arg.MaxRows)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +314,7 @@ func (q *Queries) GetAllChirpsByUser(ctx context.Context, userID uuid.UUID) ([]C
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
+			&i.Held,
 		); err != nil {
 			return nil, err
 		}
@@ -132,3 +328,84 @@ func (q *Queries) GetAllChirpsByUser(ctx context.Context, userID uuid.UUID) ([]C
 	}
 	return items, nil
 }
+
+const pinChirp = `-- name: PinChirp :exec
+INSERT INTO pinned_chirps (user_id, chirp_id, pinned_at)
+VALUES (
+	$1,
+	$2,
+	now()
+)
+ON CONFLICT (user_id, chirp_id) DO NOTHING
+`
+
+type PinChirpParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	ChirpID uuid.UUID `json:"chirp_id"`
+}
+
+func (q *Queries) PinChirp(ctx context.Context, arg PinChirpParams) error {
+	_, err := q.db.ExecContext(ctx, pinChirp, arg.UserID, arg.ChirpID)
+	return err
+}
+
+const releaseChirp = `-- name: ReleaseChirp :one
+UPDATE chirps SET held = false
+WHERE id = $1 AND held
+RETURNING id, user_id, created_at, updated_at, body, held
+`
+
+func (q *Queries) ReleaseChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, releaseChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.Held,
+	)
+	return i, err
+}
+
+const unpinChirp = `-- name: UnpinChirp :exec
+DELETE FROM pinned_chirps WHERE user_id = $1 AND chirp_id = $2
+`
+
+type UnpinChirpParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	ChirpID uuid.UUID `json:"chirp_id"`
+}
+
+func (q *Queries) UnpinChirp(ctx context.Context, arg UnpinChirpParams) error {
+	_, err := q.db.ExecContext(ctx, unpinChirp, arg.UserID, arg.ChirpID)
+	return err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, held = $3, updated_at = now()
+WHERE id = $1
+RETURNING id, user_id, created_at, updated_at, body, held
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID `json:"id"`
+	Body string    `json:"body"`
+	Held bool      `json:"held"`
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body, arg.Held)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.Held,
+	)
+	return i, err
+}
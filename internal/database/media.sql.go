@@ -0,0 +1,219 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: media.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const attachMedia = `-- name: AttachMedia :execrows
+UPDATE media
+SET chirp_id = $1, position = $2
+WHERE id = $3 AND user_id = $4 AND chirp_id IS NULL
+`
+
+type AttachMediaParams struct {
+	ChirpID  uuid.NullUUID `json:"chirp_id"`
+	Position int32         `json:"position"`
+	ID       uuid.UUID     `json:"id"`
+	UserID   uuid.UUID     `json:"user_id"`
+}
+
+func (q *Queries) AttachMedia(ctx context.Context, arg AttachMediaParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, attachMedia,
+		arg.ChirpID,
+		arg.Position,
+		arg.ID,
+		arg.UserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createMedia = `-- name: CreateMedia :one
+INSERT INTO media (id, user_id, content_type, size, created_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	now()
+)
+RETURNING id, user_id, chirp_id, position, content_type, size, created_at
+`
+
+type CreateMediaParams struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+}
+
+func (q *Queries) CreateMedia(ctx context.Context, arg CreateMediaParams) (Media, error) {
+	row := q.db.QueryRowContext(ctx, createMedia,
+		arg.ID,
+		arg.UserID,
+		arg.ContentType,
+		arg.Size,
+	)
+	var i Media
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ChirpID,
+		&i.Position,
+		&i.ContentType,
+		&i.Size,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteUnattachedMedia = `-- name: DeleteUnattachedMedia :execrows
+DELETE FROM media WHERE id = $1 AND chirp_id IS NULL
+`
+
+func (q *Queries) DeleteUnattachedMedia(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUnattachedMedia, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getMedia = `-- name: GetMedia :one
+SELECT id, user_id, chirp_id, position, content_type, size, created_at FROM media WHERE id = $1
+`
+
+func (q *Queries) GetMedia(ctx context.Context, id uuid.UUID) (Media, error) {
+	row := q.db.QueryRowContext(ctx, getMedia, id)
+	var i Media
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ChirpID,
+		&i.Position,
+		&i.ContentType,
+		&i.Size,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAllMedia = `-- name: ListAllMedia :many
+SELECT id, user_id, chirp_id, position, content_type, size, created_at FROM media
+`
+
+func (q *Queries) ListAllMedia(ctx context.Context) ([]Media, error) {
+	rows, err := q.db.QueryContext(ctx, listAllMedia)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Media
+	for rows.Next() {
+		var i Media
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ChirpID,
+			&i.Position,
+			&i.ContentType,
+			&i.Size,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMediaByChirps = `-- name: ListMediaByChirps :many
+SELECT id, user_id, chirp_id, position, content_type, size, created_at FROM media
+WHERE chirp_id = ANY($1::uuid[])
+ORDER BY chirp_id, position
+`
+
+func (q *Queries) ListMediaByChirps(ctx context.Context, chirpIds []uuid.UUID) ([]Media, error) {
+	rows, err := q.db.QueryContext(ctx, listMediaByChirps, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Media
+	for rows.Next() {
+		var i Media
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ChirpID,
+			&i.Position,
+			&i.ContentType,
+			&i.Size,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnattachedMedia = `-- name: ListUnattachedMedia :many
+SELECT id, user_id, chirp_id, position, content_type, size, created_at FROM media
+WHERE chirp_id IS NULL AND created_at < $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUnattachedMedia(ctx context.Context, createdAt time.Time) ([]Media, error) {
+	rows, err := q.db.QueryContext(ctx, listUnattachedMedia, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Media
+	for rows.Next() {
+		var i Media
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ChirpID,
+			&i.Position,
+			&i.ContentType,
+			&i.Size,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
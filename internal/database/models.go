@@ -6,17 +6,129 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Block struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Chirp struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    uuid.UUID `json:"user_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
+	Held      bool      `json:"held"`
+}
+
+type Conversation struct {
+	ID        uuid.UUID      `json:"id"`
+	DirectKey sql.NullString `json:"direct_key"`
+	CreatedBy uuid.UUID      `json:"created_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID    `json:"conversation_id"`
+	UserID         uuid.UUID    `json:"user_id"`
+	JoinedAt       time.Time    `json:"joined_at"`
+	LastReadAt     sql.NullTime `json:"last_read_at"`
+}
+
+type FilterRule struct {
+	ID        uuid.UUID `json:"id"`
+	Kind      string    `json:"kind"`
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Media struct {
+	ID          uuid.UUID     `json:"id"`
+	UserID      uuid.UUID     `json:"user_id"`
+	ChirpID     uuid.NullUUID `json:"chirp_id"`
+	Position    int32         `json:"position"`
+	ContentType string        `json:"content_type"`
+	Size        int64         `json:"size"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+type Message struct {
+	ID             uuid.UUID `json:"id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type MessageSetting struct {
+	UserID     uuid.UUID `json:"user_id"`
+	AcceptFrom string    `json:"accept_from"`
+}
+
+type ModerationLog struct {
+	ID          uuid.UUID     `json:"id"`
+	ModeratorID uuid.UUID     `json:"moderator_id"`
+	Action      string        `json:"action"`
+	ReportID    uuid.NullUUID `json:"report_id"`
+	UserID      uuid.NullUUID `json:"user_id"`
+	ChirpID     uuid.NullUUID `json:"chirp_id"`
+	Note        string        `json:"note"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+type Moderator struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Mute struct {
+	MuterID   uuid.UUID `json:"muter_id"`
+	MutedID   uuid.UUID `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Notification struct {
+	ID        uuid.UUID     `json:"id"`
+	UserID    uuid.UUID     `json:"user_id"`
+	Type      string        `json:"type"`
+	ActorID   uuid.NullUUID `json:"actor_id"`
+	ChirpID   uuid.NullUUID `json:"chirp_id"`
+	CreatedAt time.Time     `json:"created_at"`
+	ReadAt    sql.NullTime  `json:"read_at"`
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Type    string    `json:"type"`
+	Enabled bool      `json:"enabled"`
+}
+
+type PinnedChirp struct {
+	UserID   uuid.UUID `json:"user_id"`
+	ChirpID  uuid.UUID `json:"chirp_id"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+type RateLimit struct {
+	Key       string    `json:"key"`
+	Tokens    float64   `json:"tokens"`
+	Allowed   bool      `json:"allowed"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type RefreshToken struct {
@@ -28,11 +140,82 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime `json:"revoked_at"`
 }
 
+type Report struct {
+	ID          uuid.UUID      `json:"id"`
+	ReporterID  uuid.UUID      `json:"reporter_id"`
+	UserID      uuid.UUID      `json:"user_id"`
+	ChirpID     uuid.NullUUID  `json:"chirp_id"`
+	Reason      string         `json:"reason"`
+	Details     string         `json:"details"`
+	Status      string         `json:"status"`
+	ModeratorID uuid.NullUUID  `json:"moderator_id"`
+	Resolution  sql.NullString `json:"resolution"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+type Subscription struct {
+	ID                 uuid.UUID    `json:"id"`
+	UserID             uuid.UUID    `json:"user_id"`
+	Plan               string       `json:"plan"`
+	Status             string       `json:"status"`
+	CurrentPeriodStart time.Time    `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time    `json:"current_period_end"`
+	GraceUntil         sql.NullTime `json:"grace_until"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at"`
+}
+
+type Suspension struct {
+	ID        uuid.UUID     `json:"id"`
+	UserID    uuid.UUID     `json:"user_id"`
+	Reason    string        `json:"reason"`
+	ExpiresAt sql.NullTime  `json:"expires_at"`
+	CreatedBy uuid.NullUUID `json:"created_by"`
+	CreatedAt time.Time     `json:"created_at"`
+	LiftedAt  sql.NullTime  `json:"lifted_at"`
+}
+
 type User struct {
 	ID             uuid.UUID `json:"id"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 	Email          string    `json:"email"`
 	HashedPassword string    `json:"hashed_password"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	Handle         string    `json:"handle"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	EndpointID     uuid.UUID       `json:"endpoint_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode int32           `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookEvent struct {
+	ID          string          `json:"id"`
+	Source      string          `json:"source"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt sql.NullTime    `json:"processed_at"`
 }
@@ -0,0 +1,62 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: rate_limits.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const deleteIdleRateLimits = `-- name: DeleteIdleRateLimits :execrows
+DELETE FROM rate_limits WHERE updated_at < $1
+`
+
+func (q *Queries) DeleteIdleRateLimits(ctx context.Context, updatedAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteIdleRateLimits, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limits AS rl (key, tokens, allowed, updated_at)
+VALUES (
+	$1,
+	$2::float8 - 1,
+	true,
+	now()
+)
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+		WHEN LEAST($2::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * $3::float8) >= 1
+		THEN LEAST($2::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * $3::float8) - 1
+		ELSE LEAST($2::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * $3::float8)
+	END,
+	allowed = LEAST($2::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * $3::float8) >= 1,
+	updated_at = now()
+RETURNING tokens, allowed
+`
+
+type TakeRateLimitTokenParams struct {
+	Key   string  `json:"key"`
+	Burst float64 `json:"burst"`
+	Rate  float64 `json:"rate"`
+}
+
+type TakeRateLimitTokenRow struct {
+	Tokens  float64 `json:"tokens"`
+	Allowed bool    `json:"allowed"`
+}
+
+// Refills the token bucket of key for the time since it was last used, then
+// takes a token if there's one. allowed is if a token was taken.
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken, arg.Key, arg.Burst, arg.Rate)
+	var i TakeRateLimitTokenRow
+	err := row.Scan(&i.Tokens, &i.Allowed)
+	return i, err
+}
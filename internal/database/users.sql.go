@@ -7,36 +7,51 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     now(),
     now(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, handle, false AS is_chirpy_red
 `
 
 type CreateUserParams struct {
 	Email          string `json:"email"`
 	HashedPassword string `json:"hashed_password"`
+	Handle         string `json:"handle"`
 }
 
-func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
-	var i User
+type CreateUserRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
+	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.Handle,
 		&i.IsChirpyRed,
 	)
 	return i, err
@@ -52,39 +67,124 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 }
 
 const getUserByEmailWithPassword = `-- name: GetUserByEmailWithPassword :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.handle, EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS is_chirpy_red
+FROM users WHERE users.email = $1
 `
 
-func (q *Queries) GetUserByEmailWithPassword(ctx context.Context, email string) (User, error) {
+type GetUserByEmailWithPasswordRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+}
+
+func (q *Queries) GetUserByEmailWithPassword(ctx context.Context, email string) (GetUserByEmailWithPasswordRow, error) {
 	row := q.db.QueryRowContext(ctx, getUserByEmailWithPassword, email)
-	var i User
+	var i GetUserByEmailWithPasswordRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.Handle,
 		&i.IsChirpyRed,
 	)
 	return i, err
 }
 
-const setUserToRed = `-- name: SetUserToRed :exec
-UPDATE users
-SET updated_at = now(), is_chirpy_red = true
-WHERE id = $1
+const getUserByID = `-- name: GetUserByID :one
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.handle, EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS is_chirpy_red
+FROM users WHERE users.id = $1
 `
 
-func (q *Queries) SetUserToRed(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, setUserToRed, id)
+type GetUserByIDRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+}
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (GetUserByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i GetUserByIDRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
+
+const getUserIDsByHandles = `-- name: GetUserIDsByHandles :many
+SELECT id FROM users
+WHERE handle = ANY($1::text[])
+`
+
+func (q *Queries) GetUserIDsByHandles(ctx context.Context, handles []string) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUserIDsByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUser = `-- name: LockUser :exec
+SELECT id FROM users WHERE id = $1 FOR UPDATE
+`
+
+// holds the user's row until the end of the transaction, so that what's
+// counted for the user's limits doesn't change before it's written.
+func (q *Queries) LockUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, lockUser, id)
 	return err
 }
 
 const updateUserEmailAndPassword = `-- name: UpdateUserEmailAndPassword :one
 UPDATE users
 SET updated_at = now(), email = $2, hashed_password = $3
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE users.id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, handle, EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS is_chirpy_red
 `
 
 type UpdateUserEmailAndPasswordParams struct {
@@ -93,16 +193,41 @@ type UpdateUserEmailAndPasswordParams struct {
 	HashedPassword string    `json:"hashed_password"`
 }
 
-func (q *Queries) UpdateUserEmailAndPassword(ctx context.Context, arg UpdateUserEmailAndPasswordParams) (User, error) {
+type UpdateUserEmailAndPasswordRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+}
+
+func (q *Queries) UpdateUserEmailAndPassword(ctx context.Context, arg UpdateUserEmailAndPasswordParams) (UpdateUserEmailAndPasswordRow, error) {
 	row := q.db.QueryRowContext(ctx, updateUserEmailAndPassword, arg.ID, arg.Email, arg.HashedPassword)
-	var i User
+	var i UpdateUserEmailAndPasswordRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.Handle,
 		&i.IsChirpyRed,
 	)
 	return i, err
 }
+
+const updateUserHandle = `-- name: UpdateUserHandle :exec
+UPDATE users SET updated_at = now(), handle = $2 WHERE id = $1
+`
+
+type UpdateUserHandleParams struct {
+	ID     uuid.UUID `json:"id"`
+	Handle string    `json:"handle"`
+}
+
+func (q *Queries) UpdateUserHandle(ctx context.Context, arg UpdateUserHandleParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserHandle, arg.ID, arg.Handle)
+	return err
+}
@@ -0,0 +1,129 @@
+package entitlements
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FreePlan is the plan of every user without Chirpy Red.
+const FreePlan string = "free"
+
+// RedPlan is used for Chirpy Red users whose plan has no limits of its own.
+const RedPlan string = "chirpy_red"
+
+// Limits are what a plan allows a user to do.
+type Limits struct {
+	MaxChirpLength  int           `json:"max_chirp_length"`
+	EditWindow      time.Duration `json:"edit_window"`
+	ChirpsPerHour   int           `json:"chirps_per_hour"`
+	MaxPinnedChirps int           `json:"max_pinned_chirps"`
+}
+
+// CanEdit reports if a chirp created at createdAt can still be edited at now.
+func (l Limits) CanEdit(createdAt, now time.Time) bool {
+	return l.EditWindow > 0 && now.Before(createdAt.Add(l.EditWindow))
+}
+
+// UnmarshalJSON reads edit_window as a duration string like "15m".
+func (l *Limits) UnmarshalJSON(data []byte) error {
+	type limits Limits
+	aux := struct {
+		*limits
+		EditWindow string `json:"edit_window"`
+	}{limits: (*limits)(l)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.EditWindow == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(aux.EditWindow)
+	if err != nil {
+		return fmt.Errorf("edit_window: %w", err)
+	}
+	l.EditWindow = d
+	return nil
+}
+
+// Plans maps a plan name to its limits.
+type Plans map[string]Limits
+
+var Default = Plans{
+	FreePlan: {
+		MaxChirpLength:  140,
+		EditWindow:      0,
+		ChirpsPerHour:   30,
+		MaxPinnedChirps: 1,
+	},
+	RedPlan: {
+		MaxChirpLength:  280,
+		EditWindow:      15 * time.Minute,
+		ChirpsPerHour:   300,
+		MaxPinnedChirps: 5,
+	},
+}
+
+// For returns the limits of a user. plan is the user's subscription
+// plan and is only looked at when isRed is true.
+func (p Plans) For(isRed bool, plan string) Limits {
+	if !isRed {
+		return p[FreePlan]
+	}
+	if l, ok := p[plan]; ok && plan != FreePlan {
+		return l
+	}
+	return p[RedPlan]
+}
+
+// Load reads plans from a JSON file. Plans missing from the file keep
+// their default limits, and so do the limits missing from a plan. A plan
+// that isn't a default one starts from the limits of RedPlan.
+func Load(path string) (Plans, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	plans := Plans{}
+	for name, l := range Default {
+		plans[name] = l
+	}
+	for name, raw := range loaded {
+		l, ok := Default[name]
+		if !ok {
+			l = Default[RedPlan]
+		}
+		if err := json.Unmarshal(raw, &l); err != nil {
+			return nil, fmt.Errorf("%s: plan %q: %w", path, name, err)
+		}
+		if err := l.validate(); err != nil {
+			return nil, fmt.Errorf("%s: plan %q: %w", path, name, err)
+		}
+		plans[name] = l
+	}
+	return plans, nil
+}
+
+// validate checks the limits allow something: a plan without an edit
+// window is the only one of them that can be zero.
+func (l Limits) validate() error {
+	switch {
+	case l.MaxChirpLength <= 0:
+		return fmt.Errorf("max_chirp_length must be positive")
+	case l.EditWindow < 0:
+		return fmt.Errorf("edit_window must not be negative")
+	case l.ChirpsPerHour <= 0:
+		return fmt.Errorf("chirps_per_hour must be positive")
+	case l.MaxPinnedChirps <= 0:
+		return fmt.Errorf("max_pinned_chirps must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package entitlements
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFor(t *testing.T) {
+	plans := Plans{
+		FreePlan: {MaxChirpLength: 140},
+		RedPlan:  {MaxChirpLength: 280},
+		"gold":   {MaxChirpLength: 1000},
+	}
+
+	cases := []struct {
+		isRed  bool
+		plan   string
+		expect int
+	}{
+		{false, "", 140},
+		{false, "gold", 140},
+		{true, "", 280},
+		{true, "gold", 1000},
+		{true, "unknown", 280},
+		{true, FreePlan, 280},
+	}
+	for _, c := range cases {
+		got := plans.For(c.isRed, c.plan).MaxChirpLength
+		if got != c.expect {
+			t.Errorf("For(%v, %q): expect %d, got %d", c.isRed, c.plan, c.expect, got)
+		}
+	}
+}
+
+func TestCanEdit(t *testing.T) {
+	created := time.Now()
+	l := Limits{EditWindow: time.Minute}
+	if !l.CanEdit(created, created.Add(30*time.Second)) {
+		t.Errorf("can't edit within window")
+	}
+	if l.CanEdit(created, created.Add(time.Minute)) {
+		t.Errorf("can edit after window")
+	}
+	if (Limits{}).CanEdit(created, created) {
+		t.Errorf("can edit without a window")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plans.json")
+	data := `{"chirpy_red": {"max_chirp_length": 500, "edit_window": "1h", "chirps_per_hour": 10, "max_pinned_chirps": 2}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	plans, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+
+	red := plans.For(true, "")
+	expect := Limits{MaxChirpLength: 500, EditWindow: time.Hour, ChirpsPerHour: 10, MaxPinnedChirps: 2}
+	if red != expect {
+		t.Errorf("expect %#v, got %#v", expect, red)
+	}
+	if plans.For(false, "") != Default[FreePlan] {
+		t.Errorf("free plan not kept from defaults")
+	}
+}
+
+func TestLoadPartial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plans.json")
+	data := `{"free": {"chirps_per_hour": 10}, "gold": {"max_chirp_length": 1000}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	plans, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+
+	free := Default[FreePlan]
+	free.ChirpsPerHour = 10
+	if got := plans.For(false, ""); got != free {
+		t.Errorf("expect %#v, got %#v", free, got)
+	}
+	gold := Default[RedPlan]
+	gold.MaxChirpLength = 1000
+	if got := plans.For(true, "gold"); got != gold {
+		t.Errorf("expect %#v, got %#v", gold, got)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	cases := []string{
+		`{"free": {"max_chirp_length": 0}}`,
+		`{"free": {"chirps_per_hour": -1}}`,
+		`{"chirpy_red": {"max_pinned_chirps": 0}}`,
+		`{"chirpy_red": {"edit_window": "-1m"}}`,
+		`{"gold": {"max_chirp_length": -280}}`,
+	}
+	for _, data := range cases {
+		path := filepath.Join(t.TempDir(), "plans.json")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("expect an error loading %s", data)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted string = "[REDACTED]"
+
+// sensitive attribute keys, matched case-insensitively.
+var sensitive = map[string]bool{
+	"password":        true,
+	"hashed_password": true,
+	"token":           true,
+	"refresh_token":   true,
+	"secret":          true,
+	"authorization":   true,
+	"api_key":         true,
+	"cookie":          true,
+}
+
+// Options configure where and how much is logged.
+type Options struct {
+	// File is rotated when set, otherwise logs go to stdout.
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Level      slog.Level
+}
+
+// New returns a JSON logger for opts. Sensitive attributes are redacted
+// and the request id of the context is added to every record.
+func New(opts Options) *slog.Logger {
+	var w io.Writer = os.Stdout
+	if opts.File != "" {
+		w = &lumberjack.Logger{
+			Filename:   opts.File,
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+			Compress:   true,
+		}
+	}
+	return NewWithWriter(w, opts.Level)
+}
+
+// NewWithWriter returns the same logger as New writing to w.
+func NewWithWriter(w io.Writer, level slog.Level) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+	return slog.New(contextHandler{h})
+}
+
+// ParseLevel reads a level name like "debug" or "warn", defaulting to info.
+func ParseLevel(s string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitive[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// contextHandler adds the request id of the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWithWriter(&buf, slog.LevelInfo)
+
+	logger.Info("login", "email", "user@example.com", "password", "hunter2", "Token", "abc")
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "abc") {
+		t.Errorf("sensitive values logged: %s", out)
+	}
+	if !strings.Contains(out, "user@example.com") {
+		t.Errorf("email not logged: %s", out)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWithWriter(&buf, slog.LevelInfo)
+
+	var seen string
+	handler := RequestID(AccessLog(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	})))
+
+	// propagated
+	req := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen != "abc-123" {
+		t.Errorf("expect request id abc-123 in context, got %q", seen)
+	}
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("expect response header abc-123, got %q", got)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("access log isn't JSON: %s", err)
+	}
+	if record["request_id"] != "abc-123" || record["status"] != float64(http.StatusTeapot) {
+		t.Errorf("unexpected access log %v", record)
+	}
+
+	// generated for a missing or invalid id
+	req = httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen == "" || seen == "bad id\n" {
+		t.Errorf("expect generated request id, got %q", seen)
+	}
+	if rec.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("response header %q doesn't match context %q", rec.Header().Get(RequestIDHeader), seen)
+	}
+}
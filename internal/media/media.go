@@ -0,0 +1,105 @@
+// Package media keeps the images attached to chirps. The files live in a
+// BlobStore, on the local filesystem or in an S3 compatible object store, and
+// are handed out through links signed for a limited time.
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound    = errors.New("media: blob not found")
+	ErrTooLarge    = errors.New("media: file too large")
+	ErrUnsupported = errors.New("media: unsupported file type")
+)
+
+// BlobStore keeps files by key. Keys are slash separated paths, like
+// "media/<id>".
+type BlobStore interface {
+	// Put writes the size bytes of r under key, replacing what was there.
+	// A size of -1 reads r to its end. Nothing is written if r fails.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns ErrNotFound if nothing is under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete does nothing if nothing is under key.
+	Delete(ctx context.Context, key string) error
+}
+
+// Key is where the file of the media id is kept.
+func Key(id uuid.UUID) string {
+	return "media/" + id.String()
+}
+
+// validKey reports if key is a relative path without empty, "." or ".."
+// parts, so it can't reach outside of a directory or a bucket.
+func validKey(key string) error {
+	if key == "" || strings.ContainsRune(key, '\\') {
+		return fmt.Errorf("media: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("media: invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// Types are the content types accepted, images browsers can show.
+var Types = []string{"image/gif", "image/jpeg", "image/png", "image/webp"}
+
+// sniffLen is how many bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// Sniff finds the content type of r from its first bytes, ignoring what the
+// client claims, and returns ErrUnsupported unless it is one of Types. The
+// returned reader still reads from the first byte.
+func Sniff(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if !slices.Contains(Types, contentType) {
+		return "", nil, ErrUnsupported
+	}
+	return contentType, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// LimitReader reads from r until more than n bytes were read, and fails with
+// ErrTooLarge from then on.
+func LimitReader(r io.Reader, n int64) io.Reader {
+	return &limitReader{r: r, left: n}
+}
+
+type limitReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, ErrTooLarge
+	}
+	// one byte more than allowed tells a full file from a larger one
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,67 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrLinkInvalid = errors.New("media: link signature does not match")
+	ErrLinkExpired = errors.New("media: link expired")
+)
+
+// Signer signs the links to media, so a link only opens the file it was
+// made for and stops working once it expires.
+type Signer struct {
+	Secret []byte
+	// TTL is how long links work.
+	TTL time.Duration
+	// Now is the clock of the expiry, time.Now unless replaced.
+	Now func() time.Time
+}
+
+func NewSigner(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{Secret: secret, TTL: ttl, Now: time.Now}
+}
+
+func (s *Signer) sign(id uuid.UUID, expires int64) []byte {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte("media:" + id.String() + "." + strconv.FormatInt(expires, 10)))
+	return mac.Sum(nil)
+}
+
+// Query is the query string of a link to the media id, valid for TTL.
+func (s *Signer) Query(id uuid.UUID) string {
+	// rounding the expiry up to the minute keeps a link the same for a
+	// minute, so clients can cache it
+	expires := s.Now().Add(s.TTL).Truncate(time.Minute).Add(time.Minute).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", hex.EncodeToString(s.sign(id, expires)))
+	return q.Encode()
+}
+
+// Verify checks the query of a link to the media id, returning when it
+// expires.
+func (s *Signer) Verify(id uuid.UUID, query url.Values) (time.Time, error) {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return time.Time{}, ErrLinkInvalid
+	}
+	given, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(given, s.sign(id, expires)) {
+		return time.Time{}, ErrLinkInvalid
+	}
+	at := time.Unix(expires, 0)
+	if !s.Now().Before(at) {
+		return time.Time{}, ErrLinkExpired
+	}
+	return at, nil
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrument(t *testing.T) {
+	m := New(nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/chirps/{ChirpID}", m.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})))
+	mux.Handle("GET /metrics", m.Handler())
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps/abc", nil))
+	}
+	m.ChirpsCreated.Inc()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	expect := []string{
+		`chirpy_http_requests_total{method="GET",route="/api/chirps/{ChirpID}",status="404"} 2`,
+		`chirpy_http_request_duration_seconds_count{method="GET",route="/api/chirps/{ChirpID}",status="404"} 2`,
+		`chirpy_http_requests_in_flight 0`,
+		`chirpy_chirps_created_total 1`,
+	}
+	for _, e := range expect {
+		if !strings.Contains(string(body), e) {
+			t.Errorf("metrics missing %q", e)
+		}
+	}
+}
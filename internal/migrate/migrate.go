@@ -0,0 +1,92 @@
+// Package migrate applies the embedded schema migrations with goose.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/dubbersthehoser/httpserver/sql/schema"
+	sqliteschema "github.com/dubbersthehoser/httpserver/sql/sqlite/schema"
+)
+
+// ErrBehind is returned by Check when migrations are pending.
+var ErrBehind = errors.New("migrate: database schema is behind")
+
+// Migrator runs the migrations of an fs.FS against a database.
+type Migrator struct {
+	provider *goose.Provider
+}
+
+// New returns a Migrator of the embedded schema of the database/sql driver,
+// "postgres" or "sqlite".
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	switch driver {
+	case "postgres":
+		return NewFS(db, goose.DialectPostgres, schema.FS)
+	case "sqlite":
+		return NewFS(db, goose.DialectSQLite3, sqliteschema.FS)
+	}
+	return nil, fmt.Errorf("migrate: no migrations for driver %q", driver)
+}
+
+// NewFS returns a Migrator of the migrations in fsys.
+func NewFS(db *sql.DB, dialect goose.Dialect, fsys fs.FS) (*Migrator, error) {
+	provider, err := goose.NewProvider(dialect, db, fsys)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return &Migrator{provider: provider}, nil
+}
+
+// Expected is the version the binary's migrations end at.
+func (m *Migrator) Expected() int64 {
+	sources := m.provider.ListSources()
+	if len(sources) == 0 {
+		return 0
+	}
+	return sources[len(sources)-1].Version
+}
+
+// Version is the version the database is at.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	return m.provider.GetDBVersion(ctx)
+}
+
+// Up applies every pending migration and returns what it applied.
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	return m.provider.Up(ctx)
+}
+
+// Down rolls back the latest migration.
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	return m.provider.Down(ctx)
+}
+
+// Status lists every migration and if it's applied.
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	return m.provider.Status(ctx)
+}
+
+// Check returns ErrBehind if the database is missing migrations of the binary.
+// A database ahead of the binary is fine, an older binary can still serve it
+// during a rollout.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.provider.HasPending(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	if !pending {
+		return nil
+	}
+
+	version, err := m.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return fmt.Errorf("%w: at version %d, want %d, run `chirpy migrate up` or start with -auto-migrate", ErrBehind, version, m.Expected())
+}
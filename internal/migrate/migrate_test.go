@@ -0,0 +1,40 @@
+package migrate
+
+import (
+	"database/sql"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"github.com/dubbersthehoser/httpserver/sql/schema"
+)
+
+func TestExpected(t *testing.T) {
+	// the connection is lazy, nothing here talks to the database
+	db, err := sql.Open("postgres", "postgres://localhost:1/chirpy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m, err := New(db, "postgres")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	files, err := fs.Glob(schema.FS, "*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no embedded migrations: %v", err)
+	}
+	latest, err := strconv.ParseInt(strings.SplitN(files[len(files)-1], "_", 2)[0], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Expected() != latest {
+		t.Errorf("expect version %d, got %d", latest, m.Expected())
+	}
+}
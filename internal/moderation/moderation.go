@@ -0,0 +1,255 @@
+// Package moderation checks the text users post against a set of content
+// rules. Rules match the normalized text, so case, accents, zero-width
+// characters, look-alike letters from other scripts and leetspeak don't get
+// around them.
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule kinds.
+const (
+	KindWord  string = "word"
+	KindRegex string = "regex"
+)
+
+// Rule actions, from the weakest to the strongest.
+const (
+	ActionMask   string = "mask"
+	ActionHold   string = "hold"
+	ActionReject string = "reject"
+)
+
+// Mask replaces the text matched by a mask rule.
+const Mask string = "****"
+
+var strength = map[string]int{
+	ActionMask:   1,
+	ActionHold:   2,
+	ActionReject: 3,
+}
+
+// Rule is a word or a regular expression and what to do with text it matches.
+// A word matches whole words only. A regular expression is matched against
+// the normalized text, which is lowercase.
+type Rule struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+// Validate reports why r can't be used in a Filter.
+func (r Rule) Validate() error {
+	if _, ok := strength[r.Action]; !ok {
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	switch r.Kind {
+	case KindWord:
+		if Normalize(r.Pattern) == "" {
+			return fmt.Errorf("word %q is empty once normalized", r.Pattern)
+		}
+	case KindRegex:
+		if r.Pattern == "" {
+			return fmt.Errorf("regex is empty")
+		}
+		if _, err := regexp.Compile("(?i)" + r.Pattern); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	return nil
+}
+
+// Default are the rules used when none are configured.
+var Default = []Rule{
+	{Kind: KindWord, Pattern: "kerfuffle", Action: ActionMask},
+	{Kind: KindWord, Pattern: "sharbert", Action: ActionMask},
+	{Kind: KindWord, Pattern: "fornax", Action: ActionMask},
+}
+
+// Load reads rules from a JSON file holding a list of rules.
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+type compiled struct {
+	Rule
+	word string
+	re   *regexp.Regexp
+}
+
+// Filter is a compiled set of rules.
+type Filter struct {
+	rules []compiled
+}
+
+// New compiles rules into a Filter.
+func New(rules []Rule) (*Filter, error) {
+	f := &Filter{}
+	for i, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		c := compiled{Rule: r}
+		if r.Kind == KindWord {
+			c.word = Normalize(r.Pattern)
+		} else {
+			c.re = regexp.MustCompile("(?i)" + r.Pattern)
+		}
+		f.rules = append(f.rules, c)
+	}
+	return f, nil
+}
+
+// Len is the number of rules in f.
+func (f *Filter) Len() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.rules)
+}
+
+// Result is what a Filter made of a text.
+type Result struct {
+	// Text is the text with what the mask rules matched replaced by Mask.
+	Text string
+
+	// Action is the strongest action of the rules that matched, or empty
+	// when none did.
+	Action string
+
+	// Matched are the rules that matched.
+	Matched []Rule
+}
+
+// Check runs text through every rule of f.
+func (f *Filter) Check(text string) Result {
+	res := Result{Text: text}
+	if f.Len() == 0 {
+		return res
+	}
+
+	sk := skeletonOf(text)
+	var masks [][2]int
+	for _, c := range f.rules {
+		var found [][2]int
+		if c.re != nil {
+			for _, m := range c.re.FindAllStringIndex(sk.text, -1) {
+				if m[1] > m[0] {
+					found = append(found, [2]int{m[0], m[1]})
+				}
+			}
+		} else {
+			found = findWord(sk.text, c.word)
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		res.Matched = append(res.Matched, c.Rule)
+		if strength[c.Action] > strength[res.Action] {
+			res.Action = c.Action
+		}
+		if c.Action == ActionMask {
+			for _, m := range found {
+				masks = append(masks, [2]int{sk.start[m[0]], sk.end[m[1]-1]})
+			}
+		}
+	}
+	res.Text = mask(text, masks)
+	return res
+}
+
+// findWord finds word in s where it isn't part of a longer word.
+func findWord(s, word string) [][2]int {
+	var found [][2]int
+	for from := 0; from < len(s); {
+		i := strings.Index(s[from:], word)
+		if i < 0 {
+			break
+		}
+		i += from
+		j := i + len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[j:])
+		if !isWordRune(before) && !isWordRune(after) {
+			found = append(found, [2]int{i, j})
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		from = i + size
+	}
+	return found
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// mask replaces the byte ranges of text with Mask, merging the ranges that
+// overlap.
+func mask(text string, ranges [][2]int) string {
+	if len(ranges) == 0 {
+		return text
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(ranges); {
+		start, end := ranges[i][0], ranges[i][1]
+		for i++; i < len(ranges) && ranges[i][0] < end; i++ {
+			end = max(end, ranges[i][1])
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(Mask)
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Engine holds the Filter in use. It's safe to Check while the filter is
+// swapped for another.
+type Engine struct {
+	filter atomic.Pointer[Filter]
+}
+
+// NewEngine returns an Engine using f.
+func NewEngine(f *Filter) *Engine {
+	e := &Engine{}
+	e.filter.Store(f)
+	return e
+}
+
+// Check runs text through the filter in use.
+func (e *Engine) Check(text string) Result {
+	return e.filter.Load().Check(text)
+}
+
+// Filter is the filter in use.
+func (e *Engine) Filter() *Filter {
+	return e.filter.Load()
+}
+
+// Swap makes f the filter in use.
+func (e *Engine) Swap(f *Filter) {
+	e.filter.Store(f)
+}
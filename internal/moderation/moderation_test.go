@@ -0,0 +1,170 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		text   string
+		expect string
+	}{
+		{"Fornax", "fornax"},
+		{"FÓRNÁX", "fornax"},
+		{"for\u200bnax", "fornax"},
+		{"f\u00adornax", "fornax"},
+		{"fоrnах", "fornax"}, // Cyrillic о, а and х
+		{"ｆｏｒｎａｘ", "fornax"},
+		{"f0rn4x", "fornax"},
+		{"k3rfuff1e", "kerfuffie"},
+		{"ﬁne", "fine"},
+	}
+	for _, c := range cases {
+		got := Normalize(c.text)
+		if got != c.expect {
+			t.Errorf("Normalize(%q): expect %q, got %q", c.text, c.expect, got)
+		}
+	}
+}
+
+func TestCheckDefault(t *testing.T) {
+	f, err := New(Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		text   string
+		expect string
+	}{
+		{"I had something interesting for breakfast", "I had something interesting for breakfast"},
+		{"I hear Mastodon is better than Chirpy. sharbert I need to migrate", "I hear Mastodon is better than Chirpy. **** I need to migrate"},
+		{"I really need a kerfuffle to go to bed sooner, Fornax !", "I really need a **** to go to bed sooner, **** !"},
+		{"Sharbert!", "****!"},
+		{"fоrnах fornax", "**** ****"},
+		{"for\u200bnax", "****"},
+		{"FÓRNÁX", "****"},
+		{"fornaxes", "fornaxes"},
+		{"kerfuffle-sharbert", "****-****"},
+	}
+	for _, c := range cases {
+		res := f.Check(c.text)
+		if res.Text != c.expect {
+			t.Errorf("Check(%q): expect %q, got %q", c.text, c.expect, res.Text)
+		}
+	}
+
+	res := f.Check("nothing here")
+	if res.Action != "" || len(res.Matched) != 0 {
+		t.Errorf("expect no match, got %q %v", res.Action, res.Matched)
+	}
+	res = f.Check("fornax")
+	if res.Action != ActionMask || len(res.Matched) != 1 {
+		t.Errorf("expect a mask match, got %q %v", res.Action, res.Matched)
+	}
+}
+
+func TestCheckActions(t *testing.T) {
+	f, err := New([]Rule{
+		{Kind: KindWord, Pattern: "fornax", Action: ActionMask},
+		{Kind: KindRegex, Pattern: `buy\s+now`, Action: ActionHold},
+		{Kind: KindWord, Pattern: "scam", Action: ActionReject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		text   string
+		action string
+		masked string
+	}{
+		{"hello", "", "hello"},
+		{"fornax", ActionMask, "****"},
+		{"BUY   NOW fornax", ActionHold, "BUY   NOW ****"},
+		{"buy now, it's a 5c4m", ActionReject, "buy now, it's a 5c4m"},
+	}
+	for _, c := range cases {
+		res := f.Check(c.text)
+		if res.Action != c.action {
+			t.Errorf("Check(%q): expect action %q, got %q", c.text, c.action, res.Action)
+		}
+		if res.Text != c.masked {
+			t.Errorf("Check(%q): expect %q, got %q", c.text, c.masked, res.Text)
+		}
+	}
+}
+
+func TestMaskOverlap(t *testing.T) {
+	f, err := New([]Rule{
+		{Kind: KindRegex, Pattern: "ab+", Action: ActionMask},
+		{Kind: KindRegex, Pattern: "bc", Action: ActionMask},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Check("xabbcx").Text; got != "x****x" {
+		t.Errorf("expect %q, got %q", "x****x", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []Rule{
+		{Kind: "glob", Pattern: "x", Action: ActionMask},
+		{Kind: KindWord, Pattern: "x", Action: "ban"},
+		{Kind: KindWord, Pattern: "\u200b", Action: ActionMask},
+		{Kind: KindRegex, Pattern: "", Action: ActionMask},
+		{Kind: KindRegex, Pattern: "(", Action: ActionMask},
+	}
+	for _, r := range bad {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expect an error for %+v", r)
+		}
+	}
+	if _, err := New(bad[:1]); err == nil {
+		t.Errorf("expect New to fail")
+	}
+}
+
+func TestEngine(t *testing.T) {
+	e := NewEngine(nil)
+	if got := e.Check("fornax").Text; got != "fornax" {
+		t.Errorf("expect no filtering, got %q", got)
+	}
+
+	f, err := New(Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Swap(f)
+	if got := e.Check("fornax").Text; got != Mask {
+		t.Errorf("expect %q, got %q", Mask, got)
+	}
+	if e.Filter().Len() != len(Default) {
+		t.Errorf("expect %d rules, got %d", len(Default), e.Filter().Len())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `[{"kind": "word", "pattern": "spam", "action": "reject"}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0] != (Rule{Kind: KindWord, Pattern: "spam", Action: ActionReject}) {
+		t.Errorf("expect the spam rule, got %v", rules)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Errorf("expect an error for bad JSON")
+	}
+}
@@ -0,0 +1,88 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps lowercase letters that look like a latin letter, and
+// the digits and symbols of leetspeak, to that letter.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'г': 'r', 'е': 'e', 'к': 'k', 'м': 'm',
+	'н': 'h', 'о': 'o', 'п': 'n', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y',
+	'х': 'x', 'ь': 'b', 'і': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q',
+	'ԝ': 'w', 'ӏ': 'l',
+
+	// Greek
+	'α': 'a', 'β': 'b', 'γ': 'y', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k',
+	'μ': 'u', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	'ω': 'w',
+
+	// Latin look-alikes
+	'ı': 'i', 'ȷ': 'j', 'ɡ': 'g', 'ɑ': 'a', 'ø': 'o', 'ł': 'l', 'đ': 'd',
+	'ß': 's',
+
+	// Leetspeak
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a',
+	'$': 's',
+}
+
+// skeleton is a normalized text and, for each of its bytes, the byte range
+// of the original text it came from.
+type skeleton struct {
+	text       string
+	start, end []int
+}
+
+func skeletonOf(text string) skeleton {
+	var sk skeleton
+	var b strings.Builder
+	var buf [utf8.UTFMax]byte
+	for i, r := range text {
+		size := utf8.RuneLen(r)
+		if size < 0 {
+			size = 1
+		}
+		for _, d := range fold(r) {
+			n := utf8.EncodeRune(buf[:], d)
+			b.Write(buf[:n])
+			for range n {
+				sk.start = append(sk.start, i)
+				sk.end = append(sk.end, i+size)
+			}
+		}
+	}
+	sk.text = b.String()
+	return sk
+}
+
+// fold is what r becomes in the normalized text: its compatibility
+// decomposition without the combining marks, in lowercase and with the
+// confusables replaced. Format characters, like the zero-width ones, are
+// dropped.
+func fold(r rune) []rune {
+	if unicode.Is(unicode.Cf, r) {
+		return nil
+	}
+	var out []rune
+	for _, d := range norm.NFKD.String(string(r)) {
+		if unicode.Is(unicode.Mn, d) {
+			continue
+		}
+		d = unicode.ToLower(d)
+		if c, ok := confusables[d]; ok {
+			d = c
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// Normalize returns text the way rules see it.
+func Normalize(text string) string {
+	return skeletonOf(text).text
+}
@@ -0,0 +1,85 @@
+// Package notifications records what happens to users for them to read
+// later, skipping the types of notification a user turned off.
+package notifications
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+// Types of notification.
+const (
+	TypeFollowed   = "followed"
+	TypeLiked      = "liked"
+	TypeReplied    = "replied"
+	TypeMentioned  = "mentioned"
+	TypeRechirped  = "rechirped"
+	TypeRedUpgrade = "red_upgrade"
+)
+
+// TypeWarning is a moderator's warning. It isn't in Types as users can't
+// turn it off, it's recorded with CreateNotification rather than Notify.
+const TypeWarning = "warning"
+
+// EventCreated is the stream event of a new notification, for its user.
+const EventCreated = "notification.created"
+
+// Types is every type of notification.
+var Types = []string{TypeFollowed, TypeLiked, TypeReplied, TypeMentioned, TypeRechirped, TypeRedUpgrade}
+
+// Known reports if typ is a type of notification.
+func Known(typ string) bool {
+	for _, t := range Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Queries are the database queries of recording a notification.
+type Queries interface {
+	GetNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error)
+	CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error)
+}
+
+// Notify records a notification, unless its user turned its type off or is
+// the actor. ok reports if it was recorded. Pass queries bound to a
+// transaction to record it along with the change.
+func Notify(ctx context.Context, q Queries, arg database.CreateNotificationParams) (n database.Notification, ok bool, err error) {
+	if arg.ActorID.Valid && arg.ActorID.UUID == arg.UserID {
+		return n, false, nil
+	}
+
+	prefs, err := q.GetNotificationPreferences(ctx, arg.UserID)
+	if err != nil {
+		return n, false, err
+	}
+	if !Preferences(prefs)[arg.Type] {
+		return n, false, nil
+	}
+
+	n, err = q.CreateNotification(ctx, arg)
+	if err != nil {
+		return n, false, err
+	}
+	return n, true, nil
+}
+
+// Preferences is whether each type is on, every type being on unless the
+// stored preferences turn it off.
+func Preferences(prefs []database.NotificationPreference) map[string]bool {
+	on := make(map[string]bool, len(Types))
+	for _, t := range Types {
+		on[t] = true
+	}
+	for _, p := range prefs {
+		if Known(p.Type) {
+			on[p.Type] = p.Enabled
+		}
+	}
+	return on
+}
@@ -0,0 +1,96 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/pagination"
+	"github.com/dubbersthehoser/httpserver/internal/store"
+)
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	walt, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "walt@example.com", Handle: "walt"})
+	jesse, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "jesse@example.com", Handle: "jesse"})
+
+	arg := database.CreateNotificationParams{
+		UserID:  walt.ID,
+		Type:    TypeFollowed,
+		ActorID: uuid.NullUUID{UUID: jesse.ID, Valid: true},
+	}
+	if _, ok, err := Notify(ctx, s, arg); !ok || err != nil {
+		t.Errorf("expect a notification, got %v %v", ok, err)
+	}
+
+	self := arg
+	self.ActorID.UUID = walt.ID
+	if _, ok, _ := Notify(ctx, s, self); ok {
+		t.Error("expect no notification of your own doing")
+	}
+
+	s.SetNotificationPreference(ctx, database.SetNotificationPreferenceParams{UserID: walt.ID, Type: TypeFollowed, Enabled: false})
+	if _, ok, _ := Notify(ctx, s, arg); ok {
+		t.Error("expect no notification of a type turned off")
+	}
+
+	prefs, _ := s.GetNotificationPreferences(ctx, walt.ID)
+	on := Preferences(prefs)
+	if on[TypeFollowed] || !on[TypeMentioned] || len(on) != len(Types) {
+		t.Errorf("expect only followed off, got %v", on)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	walt, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "walt@example.com", Handle: "walt"})
+
+	// two notifications share a time, the id breaks the tie
+	for i := range 5 {
+		if i != 2 {
+			now = now.Add(time.Second)
+		}
+		s.CreateNotification(ctx, database.CreateNotificationParams{UserID: walt.ID, Type: TypeRedUpgrade})
+	}
+
+	var cursor pagination.Cursor
+	seen := map[uuid.UUID]bool{}
+	for page := 0; ; page++ {
+		before, beforeID := cursor.Before()
+		notes, err := s.ListNotifications(ctx, database.ListNotificationsParams{
+			UserID:   walt.ID,
+			Before:   before,
+			BeforeID: beforeID,
+			MaxRows:  2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(notes) == 0 {
+			break
+		}
+		for _, n := range notes {
+			if seen[n.ID] {
+				t.Errorf("page %d: %s listed twice", page, n.ID)
+			}
+			seen[n.ID] = true
+		}
+
+		last := notes[len(notes)-1]
+		cursor, err = pagination.ParseCursor(pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("expect 5 notifications over the pages, got %d", len(seen))
+	}
+
+}
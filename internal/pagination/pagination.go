@@ -0,0 +1,71 @@
+// Package pagination is the cursors of the lists clients page through.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("pagination: invalid cursor")
+
+// Cursor is a position in a list ordered by a time and an id, newest first
+// with Before or oldest first with After. The zero Cursor is the start of the
+// list.
+type Cursor struct {
+	Time time.Time
+	ID   uuid.UUID
+}
+
+// Before is the position to list the rows before, for queries comparing the
+// time and id of the rows with it.
+func (c Cursor) Before() (time.Time, uuid.UUID) {
+	if c.Time.IsZero() {
+		return time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), uuid.Max
+	}
+	return c.Time, c.ID
+}
+
+// After is the position to list the rows after, for lists oldest first.
+func (c Cursor) After() (time.Time, uuid.UUID) {
+	if c.Time.IsZero() {
+		return time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), uuid.Nil
+	}
+	return c.Time, c.ID
+}
+
+// String encodes c for clients, who pass it back as is.
+func (c Cursor) String() string {
+	if c.Time.IsZero() {
+		return ""
+	}
+	raw := c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a Cursor from String, the empty string being the zero
+// Cursor.
+func ParseCursor(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if c.Time, err = time.Parse(time.RFC3339Nano, at); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if c.ID, err = uuid.Parse(id); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
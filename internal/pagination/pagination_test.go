@@ -0,0 +1,38 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{Time: time.Date(2025, 1, 1, 0, 0, 0, 5, time.UTC), ID: uuid.New()}
+	got, err := ParseCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(c.Time) || got.ID != c.ID {
+		t.Errorf("expect %v, got %v", c, got)
+	}
+
+	start, err := ParseCursor("")
+	if err != nil || start != (Cursor{}) {
+		t.Errorf("expect the zero cursor for none, got %v %v", start, err)
+	}
+	before, beforeID := start.Before()
+	if before.Year() != 9999 || beforeID != uuid.Max {
+		t.Errorf("expect the zero cursor before everything, got %v %v", before, beforeID)
+	}
+	after, afterID := start.After()
+	if !after.Before(c.Time) || afterID != uuid.Nil {
+		t.Errorf("expect the zero cursor after nothing, got %v %v", after, afterID)
+	}
+
+	for _, bad := range []string{"!", "bm9wZQ", "eHx5"} {
+		if _, err := ParseCursor(bad); err != ErrInvalidCursor {
+			t.Errorf("%s: expect an invalid cursor, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dubbersthehoser/httpserver/internal/respond"
+)
+
+// Middleware limits requests with a Limiter.
+type Middleware struct {
+	Limiter Limiter
+	// Key is the bucket of a request within a Policy.
+	Key func(r *http.Request) string
+}
+
+// Limit limits next by p, with a policy of no limit passing requests
+// through. Every limited response gets the RateLimit-* headers, a refused
+// one a 429 with Retry-After. If the Limiter fails the request is let
+// through, an outage of the limits shouldn't be an outage of the API.
+func (m Middleware) Limit(p Policy, next http.Handler) http.Handler {
+	if p.Limit <= 0 || m.Limiter == nil {
+		return next
+	}
+	policy := fmt.Sprintf("%d;w=%d", p.Limit, int(p.Period.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := m.Limiter.Take(r.Context(), p, m.Key(r))
+		if err != nil {
+			slog.WarnContext(r.Context(), "rate limit", "policy", p.Name, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", policy)
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", seconds(res.Reset))
+		if !res.Allowed {
+			h.Set("Retry-After", seconds(res.RetryAfter))
+			respond.WriteProblem(w, r, respond.Problem{
+				Type:   respond.TypeRateLimited,
+				Status: http.StatusTooManyRequests,
+				Detail: fmt.Sprintf("Too many requests, try again in %s seconds", seconds(res.RetryAfter)),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Proxies are the reverse proxies trusted to tell the client address in
+// X-Forwarded-For.
+type Proxies []netip.Prefix
+
+// ParseProxies parses a comma separated list of IPs and CIDRs.
+func ParseProxies(s string) (Proxies, error) {
+	var proxies Proxies
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("ratelimit: trusted proxy %q: %w", field, err)
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: trusted proxy %q: %w", field, err)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return proxies, nil
+}
+
+func (p Proxies) trusted(addr netip.Addr) bool {
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address of the client of r. When the peer is a trusted
+// proxy, X-Forwarded-For is read right to left and the first address that
+// isn't a trusted proxy is the client.
+func (p Proxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if !p.trusted(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// whatever is left of a garbled hop can't be believed
+			break
+		}
+		addr = hop.Unmap()
+		if !p.trusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
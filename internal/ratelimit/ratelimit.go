@@ -0,0 +1,155 @@
+// Package ratelimit limits requests with token buckets. Each Policy is a
+// bucket per key holding Limit tokens, refilled at Limit tokens a Period, and
+// every request takes a token.
+//
+// Buckets live in memory, or in Postgres so several instances share them.
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+// Policy is the limit of a group of routes.
+type Policy struct {
+	Name string
+	// Limit is the requests allowed a Period, and the most allowed in a burst.
+	Limit  int
+	Period time.Duration
+}
+
+// rate is the tokens refilled a second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// refill is the tokens of a bucket elapsed after it had tokens.
+func (p Policy) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(p.Limit), tokens+elapsed.Seconds()*p.rate())
+}
+
+// result is the Result of a bucket left with tokens.
+func (p Policy) result(allowed bool, tokens float64) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     p.until(tokens, float64(p.Limit)),
+	}
+	if !allowed {
+		res.RetryAfter = p.until(tokens, 1)
+	}
+	return res
+}
+
+// until is the time a bucket with tokens takes to refill to want.
+func (p Policy) until(tokens, want float64) time.Duration {
+	if tokens >= want {
+		return 0
+	}
+	return time.Duration((want - tokens) / p.rate() * float64(time.Second))
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until a request is allowed, when it wasn't.
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from the buckets of keys.
+type Limiter interface {
+	Take(ctx context.Context, p Policy, key string) (Result, error)
+	// Sweep forgets the buckets unused for idle, which are full again when
+	// idle is at least the longest Period.
+	Sweep(ctx context.Context, idle time.Duration) error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Memory is a Limiter of the buckets of one instance.
+type Memory struct {
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemory() *Memory {
+	return &Memory{Now: time.Now, buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(ctx context.Context, p Policy, key string) (Result, error) {
+	now := m.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[p.Name+":"+key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Limit), updated: now}
+		m.buckets[p.Name+":"+key] = b
+	}
+
+	b.tokens = p.refill(b.tokens, now.Sub(b.updated))
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return p.result(allowed, b.tokens), nil
+}
+
+func (m *Memory) Sweep(ctx context.Context, idle time.Duration) error {
+	before := m.Now().Add(-idle)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, b := range m.buckets {
+		if b.updated.Before(before) {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
+
+// Postgres is a Limiter of buckets in the rate_limits table, shared by every
+// instance using the database.
+type Postgres struct {
+	Q *database.Queries
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{Q: database.New(db)}
+}
+
+func (p *Postgres) Take(ctx context.Context, policy Policy, key string) (Result, error) {
+	row, err := p.Q.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   policy.Name + ":" + key,
+		Burst: float64(policy.Limit),
+		Rate:  policy.rate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return policy.result(row.Allowed, row.Tokens), nil
+}
+
+func (p *Postgres) Sweep(ctx context.Context, idle time.Duration) error {
+	_, err := p.Q.DeleteIdleRateLimits(ctx, time.Now().Add(-idle))
+	return err
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryTake(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	m := NewMemory()
+	m.Now = func() time.Time { return now }
+	p := Policy{Name: "test", Limit: 2, Period: time.Minute}
+
+	for i, remaining := range []int{1, 0} {
+		res, _ := m.Take(ctx, p, "a")
+		if !res.Allowed || res.Remaining != remaining {
+			t.Errorf("take %d: expect allowed with %d remaining, got %#v", i, remaining, res)
+		}
+	}
+	res, _ := m.Take(ctx, p, "a")
+	if res.Allowed || res.RetryAfter != 30*time.Second || res.Reset != time.Minute {
+		t.Errorf("expect refused for 30s, got %#v", res)
+	}
+	if res, _ := m.Take(ctx, p, "b"); !res.Allowed {
+		t.Error("expect another key to have its own bucket")
+	}
+
+	// a token refills every 30 seconds
+	now = now.Add(30 * time.Second)
+	if res, _ := m.Take(ctx, p, "a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("expect a refilled token, got %#v", res)
+	}
+
+	now = now.Add(2 * time.Minute)
+	m.Sweep(ctx, time.Minute)
+	if len(m.buckets) != 0 {
+		t.Errorf("expect idle buckets swept, got %d", len(m.buckets))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseProxies("10.0.0.0/40"); err == nil {
+		t.Error("expect an error for a bad CIDR")
+	}
+
+	tests := []struct {
+		remote string
+		xff    string
+		want   string
+	}{
+		{"203.0.113.9:1234", "", "203.0.113.9"},
+		// only trusted proxies are believed
+		{"203.0.113.9:1234", "198.51.100.1", "203.0.113.9"},
+		{"10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.1.2.3:1234", "6.6.6.6, 198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"10.1.2.3:1234", "garbage, 10.9.9.9", "10.9.9.9"},
+		{"10.1.2.3:1234", "", "10.1.2.3"},
+		{"[::ffff:203.0.113.9]:1234", "", "203.0.113.9"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remote
+		if test.xff != "" {
+			r.Header.Set("X-Forwarded-For", test.xff)
+		}
+		if got := proxies.ClientIP(r); got != test.want {
+			t.Errorf("%s %q: expect %s, got %s", test.remote, test.xff, test.want, got)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := Middleware{
+		Limiter: NewMemory(),
+		Key:     func(r *http.Request) string { return "key" },
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := m.Limit(Policy{Name: "test", Limit: 1, Period: time.Minute}, ok)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Policy") != "1;w=60" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("unexpected response %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("expect 429 retrying after 60s, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,92 @@
+// Package respond writes JSON responses and RFC 7807 problem details.
+package respond
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/dubbersthehoser/httpserver/internal/logging"
+)
+
+const ProblemContentType string = "application/problem+json"
+
+// Problem types beyond the plain HTTP status ("about:blank").
+const (
+	TypeValidation  = "urn:chirpy:problem:validation"
+	TypeRateLimited = "urn:chirpy:problem:rate-limited"
+)
+
+// FieldError is a validation error of one request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// JSON writes v as a JSON body with status.
+func JSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("marshal response", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// WriteProblem fills in the title, instance and request id of p when
+// missing and writes it.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = logging.RequestIDFromContext(r.Context())
+	}
+
+	data, _ := json.Marshal(&p)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_, _ = w.Write(data)
+}
+
+// Error writes a problem with status and detail.
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	WriteProblem(w, r, Problem{Status: status, Detail: detail})
+}
+
+// Validation writes a 400 problem listing the invalid fields.
+func Validation(w http.ResponseWriter, r *http.Request, errs ...FieldError) {
+	WriteProblem(w, r, Problem{
+		Type:   TypeValidation,
+		Title:  "Invalid request",
+		Status: http.StatusBadRequest,
+		Detail: "One or more fields are invalid.",
+		Errors: errs,
+	})
+}
+
+// InternalError logs err and writes a 500 problem without its details.
+func InternalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+	Error(w, r, http.StatusInternalServerError, "Something went wrong")
+}
@@ -0,0 +1,70 @@
+package respond
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dubbersthehoser/httpserver/internal/logging"
+)
+
+func TestValidation(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-1"))
+	rec := httptest.NewRecorder()
+
+	Validation(rec, req, FieldError{Field: "body", Message: "Chirp is too long"})
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expect status 400, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Errorf("expect content type %s, got %s", ProblemContentType, ct)
+	}
+
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("body isn't JSON: %s", err)
+	}
+	if p.Type != TypeValidation || p.Status != http.StatusBadRequest || p.Instance != "/api/chirps" || p.RequestID != "req-1" {
+		t.Errorf("unexpected problem %#v", p)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "body" {
+		t.Errorf("unexpected field errors %#v", p.Errors)
+	}
+}
+
+func TestInternalError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	rec := httptest.NewRecorder()
+
+	InternalError(rec, req, errors.New("pq: connection refused"))
+
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("body isn't JSON: %s", err)
+	}
+	if p.Type != "about:blank" || p.Title != "Internal Server Error" || p.Status != http.StatusInternalServerError {
+		t.Errorf("unexpected problem %#v", p)
+	}
+	if p.Detail == "pq: connection refused" {
+		t.Errorf("internal error leaked to client")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	JSON(rec, http.StatusCreated, map[string]string{"id": "1"})
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("expect status 201, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expect content type application/json, got %s", ct)
+	}
+	if rec.Body.String() != `{"id":"1"}` {
+		t.Errorf("unexpected body %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,143 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: filter_rules.sql
+
+package sqlitedb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createFilterRule = `-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, kind, pattern, action, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	now(),
+	now()
+)
+RETURNING id, kind, pattern, "action", created_at, updated_at
+`
+
+type CreateFilterRuleParams struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+func (q *Queries) CreateFilterRule(ctx context.Context, arg CreateFilterRuleParams) (FilterRule, error) {
+	row := q.db.QueryRowContext(ctx, createFilterRule, arg.Kind, arg.Pattern, arg.Action)
+	var i FilterRule
+	err := row.Scan(
+		&i.ID,
+		&i.Kind,
+		&i.Pattern,
+		&i.Action,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteFilterRule = `-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE id = ?
+`
+
+func (q *Queries) DeleteFilterRule(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFilterRule, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFilterRule = `-- name: GetFilterRule :one
+SELECT id, kind, pattern, "action", created_at, updated_at FROM filter_rules WHERE id = ?
+`
+
+func (q *Queries) GetFilterRule(ctx context.Context, id uuid.UUID) (FilterRule, error) {
+	row := q.db.QueryRowContext(ctx, getFilterRule, id)
+	var i FilterRule
+	err := row.Scan(
+		&i.ID,
+		&i.Kind,
+		&i.Pattern,
+		&i.Action,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listFilterRules = `-- name: ListFilterRules :many
+SELECT id, kind, pattern, "action", created_at, updated_at FROM filter_rules
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListFilterRules(ctx context.Context) ([]FilterRule, error) {
+	rows, err := q.db.QueryContext(ctx, listFilterRules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FilterRule
+	for rows.Next() {
+		var i FilterRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kind,
+			&i.Pattern,
+			&i.Action,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateFilterRule = `-- name: UpdateFilterRule :one
+UPDATE filter_rules
+SET kind = ?1, pattern = ?2, action = ?3, updated_at = now()
+WHERE id = ?4
+RETURNING id, kind, pattern, "action", created_at, updated_at
+`
+
+type UpdateFilterRuleParams struct {
+	Kind    string    `json:"kind"`
+	Pattern string    `json:"pattern"`
+	Action  string    `json:"action"`
+	ID      uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateFilterRule(ctx context.Context, arg UpdateFilterRuleParams) (FilterRule, error) {
+	row := q.db.QueryRowContext(ctx, updateFilterRule,
+		arg.Kind,
+		arg.Pattern,
+		arg.Action,
+		arg.ID,
+	)
+	var i FilterRule
+	err := row.Scan(
+		&i.ID,
+		&i.Kind,
+		&i.Pattern,
+		&i.Action,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,386 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: messages.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const addConversationMember = `-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at)
+VALUES (
+	?,
+	?,
+	now()
+)
+`
+
+type AddConversationMemberParams struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) AddConversationMember(ctx context.Context, arg AddConversationMemberParams) error {
+	_, err := q.db.ExecContext(ctx, addConversationMember, arg.ConversationID, arg.UserID)
+	return err
+}
+
+const createConversation = `-- name: CreateConversation :one
+INSERT INTO conversations (id, direct_key, created_by, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	now(),
+	now()
+)
+RETURNING id, direct_key, created_by, created_at, updated_at
+`
+
+type CreateConversationParams struct {
+	DirectKey sql.NullString `json:"direct_key"`
+	CreatedBy uuid.UUID      `json:"created_by"`
+}
+
+func (q *Queries) CreateConversation(ctx context.Context, arg CreateConversationParams) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, createConversation, arg.DirectKey, arg.CreatedBy)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createMessage = `-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	now()
+)
+RETURNING id, conversation_id, sender_id, body, created_at
+`
+
+type CreateMessageParams struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
+	row := q.db.QueryRowContext(ctx, createMessage, arg.ConversationID, arg.SenderID, arg.Body)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.SenderID,
+		&i.Body,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getConversation = `-- name: GetConversation :one
+SELECT id, direct_key, created_by, created_at, updated_at FROM conversations WHERE id = ?
+`
+
+func (q *Queries) GetConversation(ctx context.Context, id uuid.UUID) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, getConversation, id)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getConversationByDirectKey = `-- name: GetConversationByDirectKey :one
+SELECT id, direct_key, created_by, created_at, updated_at FROM conversations WHERE direct_key = ?
+`
+
+func (q *Queries) GetConversationByDirectKey(ctx context.Context, directKey sql.NullString) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, getConversationByDirectKey, directKey)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getConversationMember = `-- name: GetConversationMember :one
+SELECT conversation_id, user_id, joined_at, last_read_at FROM conversation_members WHERE conversation_id = ? AND user_id = ?
+`
+
+type GetConversationMemberParams struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetConversationMember(ctx context.Context, arg GetConversationMemberParams) (ConversationMember, error) {
+	row := q.db.QueryRowContext(ctx, getConversationMember, arg.ConversationID, arg.UserID)
+	var i ConversationMember
+	err := row.Scan(
+		&i.ConversationID,
+		&i.UserID,
+		&i.JoinedAt,
+		&i.LastReadAt,
+	)
+	return i, err
+}
+
+const getMessageSettings = `-- name: GetMessageSettings :one
+SELECT user_id, accept_from FROM message_settings WHERE user_id = ?
+`
+
+func (q *Queries) GetMessageSettings(ctx context.Context, userID uuid.UUID) (MessageSetting, error) {
+	row := q.db.QueryRowContext(ctx, getMessageSettings, userID)
+	var i MessageSetting
+	err := row.Scan(&i.UserID, &i.AcceptFrom)
+	return i, err
+}
+
+const listConversationMembers = `-- name: ListConversationMembers :many
+SELECT user_id FROM conversation_members WHERE conversation_id = ? ORDER BY joined_at
+`
+
+func (q *Queries) ListConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationMembers, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationMembersByUser = `-- name: ListConversationMembersByUser :many
+SELECT conversation_id, user_id FROM conversation_members
+WHERE conversation_id IN (
+	SELECT mine.conversation_id FROM conversation_members AS mine WHERE mine.user_id = ?
+)
+ORDER BY joined_at
+`
+
+type ListConversationMembersByUserRow struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) ListConversationMembersByUser(ctx context.Context, userID uuid.UUID) ([]ListConversationMembersByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationMembersByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListConversationMembersByUserRow
+	for rows.Next() {
+		var i ListConversationMembersByUserRow
+		if err := rows.Scan(&i.ConversationID, &i.UserID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationsByUser = `-- name: ListConversationsByUser :many
+SELECT conversations.id, conversations.direct_key, conversations.created_by, conversations.created_at, conversations.updated_at, conversation_members.last_read_at, (
+	SELECT count(*) FROM messages
+	WHERE messages.conversation_id = conversations.id
+	AND messages.sender_id <> conversation_members.user_id
+	AND (conversation_members.last_read_at IS NULL OR messages.created_at > conversation_members.last_read_at)
+) AS unread_count
+FROM conversations
+JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversation_members.user_id = ?1
+AND (conversations.updated_at < ?2 OR (conversations.updated_at = ?2 AND conversations.id < ?3))
+ORDER BY conversations.updated_at DESC, conversations.id DESC
+LIMIT ?4
+`
+
+type ListConversationsByUserParams struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Before   time.Time `json:"before"`
+	BeforeID uuid.UUID `json:"before_id"`
+	MaxRows  int64     `json:"max_rows"`
+}
+
+type ListConversationsByUserRow struct {
+	ID          uuid.UUID      `json:"id"`
+	DirectKey   sql.NullString `json:"direct_key"`
+	CreatedBy   uuid.UUID      `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	LastReadAt  sql.NullTime   `json:"last_read_at"`
+	UnreadCount int64          `json:"unread_count"`
+}
+
+func (q *Queries) ListConversationsByUser(ctx context.Context, arg ListConversationsByUserParams) ([]ListConversationsByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationsByUser,
+		arg.UserID,
+		arg.Before,
+		arg.BeforeID,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListConversationsByUserRow
+	for rows.Next() {
+		var i ListConversationsByUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DirectKey,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastReadAt,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessages = `-- name: ListMessages :many
+SELECT id, conversation_id, sender_id, body, created_at FROM messages
+WHERE conversation_id = ?1
+AND (created_at < ?2 OR (created_at = ?2 AND id < ?3))
+ORDER BY created_at DESC, id DESC
+LIMIT ?4
+`
+
+type ListMessagesParams struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Before         time.Time `json:"before"`
+	BeforeID       uuid.UUID `json:"before_id"`
+	MaxRows        int64     `json:"max_rows"`
+}
+
+func (q *Queries) ListMessages(ctx context.Context, arg ListMessagesParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessages,
+		arg.ConversationID,
+		arg.Before,
+		arg.BeforeID,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Body,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markConversationRead = `-- name: MarkConversationRead :exec
+UPDATE conversation_members SET last_read_at = now()
+WHERE conversation_id = ? AND user_id = ?
+`
+
+type MarkConversationReadParams struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) MarkConversationRead(ctx context.Context, arg MarkConversationReadParams) error {
+	_, err := q.db.ExecContext(ctx, markConversationRead, arg.ConversationID, arg.UserID)
+	return err
+}
+
+const setMessageSettings = `-- name: SetMessageSettings :one
+INSERT INTO message_settings (user_id, accept_from)
+VALUES (
+	?,
+	?
+)
+ON CONFLICT (user_id) DO UPDATE SET accept_from = excluded.accept_from
+RETURNING user_id, accept_from
+`
+
+type SetMessageSettingsParams struct {
+	UserID     uuid.UUID `json:"user_id"`
+	AcceptFrom string    `json:"accept_from"`
+}
+
+func (q *Queries) SetMessageSettings(ctx context.Context, arg SetMessageSettingsParams) (MessageSetting, error) {
+	row := q.db.QueryRowContext(ctx, setMessageSettings, arg.UserID, arg.AcceptFrom)
+	var i MessageSetting
+	err := row.Scan(&i.UserID, &i.AcceptFrom)
+	return i, err
+}
+
+const touchConversation = `-- name: TouchConversation :exec
+UPDATE conversations SET updated_at = now() WHERE id = ?
+`
+
+func (q *Queries) TouchConversation(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchConversation, id)
+	return err
+}
@@ -0,0 +1,339 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: moderation.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const addModerator = `-- name: AddModerator :exec
+INSERT INTO moderators (user_id, created_at)
+VALUES (
+	?,
+	now()
+)
+ON CONFLICT (user_id) DO NOTHING
+`
+
+func (q *Queries) AddModerator(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, addModerator, userID)
+	return err
+}
+
+const claimReport = `-- name: ClaimReport :one
+UPDATE reports SET status = 'claimed', moderator_id = ?1, updated_at = now()
+WHERE id = ?2
+AND (status = 'open' OR (status = 'claimed' AND moderator_id = ?1))
+RETURNING id, reporter_id, user_id, chirp_id, reason, details, status, moderator_id, resolution, created_at, updated_at
+`
+
+type ClaimReportParams struct {
+	ModeratorID uuid.NullUUID `json:"moderator_id"`
+	ID          uuid.UUID     `json:"id"`
+}
+
+// an open report, or one the moderator already claimed
+func (q *Queries) ClaimReport(ctx context.Context, arg ClaimReportParams) (Report, error) {
+	row := q.db.QueryRowContext(ctx, claimReport, arg.ModeratorID, arg.ID)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.ReporterID,
+		&i.UserID,
+		&i.ChirpID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		&i.ModeratorID,
+		&i.Resolution,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const closeReport = `-- name: CloseReport :one
+UPDATE reports SET status = ?1, resolution = ?2, moderator_id = ?3, updated_at = now()
+WHERE id = ?4
+AND (status = 'open' OR (status = 'claimed' AND moderator_id = ?3))
+RETURNING id, reporter_id, user_id, chirp_id, reason, details, status, moderator_id, resolution, created_at, updated_at
+`
+
+type CloseReportParams struct {
+	Status      string         `json:"status"`
+	Resolution  sql.NullString `json:"resolution"`
+	ModeratorID uuid.NullUUID  `json:"moderator_id"`
+	ID          uuid.UUID      `json:"id"`
+}
+
+// resolves or dismisses a report open or claimed by the moderator
+func (q *Queries) CloseReport(ctx context.Context, arg CloseReportParams) (Report, error) {
+	row := q.db.QueryRowContext(ctx, closeReport,
+		arg.Status,
+		arg.Resolution,
+		arg.ModeratorID,
+		arg.ID,
+	)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.ReporterID,
+		&i.UserID,
+		&i.ChirpID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		&i.ModeratorID,
+		&i.Resolution,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createModerationAction = `-- name: CreateModerationAction :one
+INSERT INTO moderation_log (id, moderator_id, action, report_id, user_id, chirp_id, note, created_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	?,
+	?,
+	?,
+	now()
+)
+RETURNING id, moderator_id, "action", report_id, user_id, chirp_id, note, created_at
+`
+
+type CreateModerationActionParams struct {
+	ModeratorID uuid.UUID     `json:"moderator_id"`
+	Action      string        `json:"action"`
+	ReportID    uuid.NullUUID `json:"report_id"`
+	UserID      uuid.NullUUID `json:"user_id"`
+	ChirpID     uuid.NullUUID `json:"chirp_id"`
+	Note        string        `json:"note"`
+}
+
+func (q *Queries) CreateModerationAction(ctx context.Context, arg CreateModerationActionParams) (ModerationLog, error) {
+	row := q.db.QueryRowContext(ctx, createModerationAction,
+		arg.ModeratorID,
+		arg.Action,
+		arg.ReportID,
+		arg.UserID,
+		arg.ChirpID,
+		arg.Note,
+	)
+	var i ModerationLog
+	err := row.Scan(
+		&i.ID,
+		&i.ModeratorID,
+		&i.Action,
+		&i.ReportID,
+		&i.UserID,
+		&i.ChirpID,
+		&i.Note,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createReport = `-- name: CreateReport :one
+INSERT INTO reports (id, reporter_id, user_id, chirp_id, reason, details, status, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	?,
+	?,
+	'open',
+	now(),
+	now()
+)
+RETURNING id, reporter_id, user_id, chirp_id, reason, details, status, moderator_id, resolution, created_at, updated_at
+`
+
+type CreateReportParams struct {
+	ReporterID uuid.UUID     `json:"reporter_id"`
+	UserID     uuid.UUID     `json:"user_id"`
+	ChirpID    uuid.NullUUID `json:"chirp_id"`
+	Reason     string        `json:"reason"`
+	Details    string        `json:"details"`
+}
+
+func (q *Queries) CreateReport(ctx context.Context, arg CreateReportParams) (Report, error) {
+	row := q.db.QueryRowContext(ctx, createReport,
+		arg.ReporterID,
+		arg.UserID,
+		arg.ChirpID,
+		arg.Reason,
+		arg.Details,
+	)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.ReporterID,
+		&i.UserID,
+		&i.ChirpID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		&i.ModeratorID,
+		&i.Resolution,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getReport = `-- name: GetReport :one
+SELECT id, reporter_id, user_id, chirp_id, reason, details, status, moderator_id, resolution, created_at, updated_at FROM reports WHERE id = ?
+`
+
+func (q *Queries) GetReport(ctx context.Context, id uuid.UUID) (Report, error) {
+	row := q.db.QueryRowContext(ctx, getReport, id)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.ReporterID,
+		&i.UserID,
+		&i.ChirpID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		&i.ModeratorID,
+		&i.Resolution,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const isModerator = `-- name: IsModerator :one
+SELECT EXISTS (SELECT 1 FROM moderators WHERE user_id = ?) AS is_moderator
+`
+
+func (q *Queries) IsModerator(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isModerator, userID)
+	var is_moderator int64
+	err := row.Scan(&is_moderator)
+	return is_moderator, err
+}
+
+const listModerationLog = `-- name: ListModerationLog :many
+SELECT id, moderator_id, "action", report_id, user_id, chirp_id, note, created_at FROM moderation_log
+WHERE created_at < ?1 OR (created_at = ?1 AND id < ?2)
+ORDER BY created_at DESC, id DESC
+LIMIT ?3
+`
+
+type ListModerationLogParams struct {
+	Before   time.Time `json:"before"`
+	BeforeID uuid.UUID `json:"before_id"`
+	MaxRows  int64     `json:"max_rows"`
+}
+
+func (q *Queries) ListModerationLog(ctx context.Context, arg ListModerationLogParams) ([]ModerationLog, error) {
+	rows, err := q.db.QueryContext(ctx, listModerationLog, arg.Before, arg.BeforeID, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ModerationLog
+	for rows.Next() {
+		var i ModerationLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ModeratorID,
+			&i.Action,
+			&i.ReportID,
+			&i.UserID,
+			&i.ChirpID,
+			&i.Note,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReports = `-- name: ListReports :many
+SELECT id, reporter_id, user_id, chirp_id, reason, details, status, moderator_id, resolution, created_at, updated_at FROM reports
+WHERE status = ?1
+AND (created_at > ?2 OR (created_at = ?2 AND id > ?3))
+ORDER BY created_at, id
+LIMIT ?4
+`
+
+type ListReportsParams struct {
+	Status  string    `json:"status"`
+	After   time.Time `json:"after"`
+	AfterID uuid.UUID `json:"after_id"`
+	MaxRows int64     `json:"max_rows"`
+}
+
+// oldest first, the queue is worked from the front
+func (q *Queries) ListReports(ctx context.Context, arg ListReportsParams) ([]Report, error) {
+	rows, err := q.db.QueryContext(ctx, listReports,
+		arg.Status,
+		arg.After,
+		arg.AfterID,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Report
+	for rows.Next() {
+		var i Report
+		if err := rows.Scan(
+			&i.ID,
+			&i.ReporterID,
+			&i.UserID,
+			&i.ChirpID,
+			&i.Reason,
+			&i.Details,
+			&i.Status,
+			&i.ModeratorID,
+			&i.Resolution,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeModerator = `-- name: RemoveModerator :exec
+DELETE FROM moderators WHERE user_id = ?
+`
+
+func (q *Queries) RemoveModerator(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, removeModerator, userID)
+	return err
+}
@@ -0,0 +1,106 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: subscriptions.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const expireLapsedSubscriptions = `-- name: ExpireLapsedSubscriptions :execrows
+UPDATE subscriptions
+SET status = 'expired', updated_at = now()
+WHERE status IN ('active', 'past_due')
+AND now() >= COALESCE(grace_until, current_period_end)
+`
+
+func (q *Queries) ExpireLapsedSubscriptions(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, expireLapsedSubscriptions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getSubscriptionByUser = `-- name: GetSubscriptionByUser :one
+SELECT id, user_id, "plan", status, current_period_start, current_period_end, grace_until, created_at, updated_at FROM subscriptions WHERE user_id = ?
+`
+
+func (q *Queries) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getSubscriptionByUser, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.GraceUntil,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertSubscription = `-- name: UpsertSubscription :one
+INSERT INTO subscriptions (id, user_id, plan, status, current_period_start, current_period_end, grace_until, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	?,
+	?,
+	?,
+	now(),
+	now()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET plan = excluded.plan,
+	status = excluded.status,
+	current_period_start = excluded.current_period_start,
+	current_period_end = excluded.current_period_end,
+	grace_until = excluded.grace_until,
+	updated_at = now()
+RETURNING id, user_id, "plan", status, current_period_start, current_period_end, grace_until, created_at, updated_at
+`
+
+type UpsertSubscriptionParams struct {
+	UserID             uuid.UUID    `json:"user_id"`
+	Plan               string       `json:"plan"`
+	Status             string       `json:"status"`
+	CurrentPeriodStart time.Time    `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time    `json:"current_period_end"`
+	GraceUntil         sql.NullTime `json:"grace_until"`
+}
+
+func (q *Queries) UpsertSubscription(ctx context.Context, arg UpsertSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, upsertSubscription,
+		arg.UserID,
+		arg.Plan,
+		arg.Status,
+		arg.CurrentPeriodStart,
+		arg.CurrentPeriodEnd,
+		arg.GraceUntil,
+	)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.GraceUntil,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
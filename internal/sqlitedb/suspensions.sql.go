@@ -0,0 +1,126 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: suspensions.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const createSuspension = `-- name: CreateSuspension :one
+INSERT INTO suspensions (id, user_id, reason, expires_at, created_by, created_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	?,
+	now()
+)
+RETURNING id, user_id, reason, expires_at, created_by, created_at, lifted_at
+`
+
+type CreateSuspensionParams struct {
+	UserID    uuid.UUID     `json:"user_id"`
+	Reason    string        `json:"reason"`
+	ExpiresAt sql.NullTime  `json:"expires_at"`
+	CreatedBy uuid.NullUUID `json:"created_by"`
+}
+
+func (q *Queries) CreateSuspension(ctx context.Context, arg CreateSuspensionParams) (Suspension, error) {
+	row := q.db.QueryRowContext(ctx, createSuspension,
+		arg.UserID,
+		arg.Reason,
+		arg.ExpiresAt,
+		arg.CreatedBy,
+	)
+	var i Suspension
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Reason,
+		&i.ExpiresAt,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.LiftedAt,
+	)
+	return i, err
+}
+
+const getActiveSuspension = `-- name: GetActiveSuspension :one
+SELECT id, user_id, reason, expires_at, created_by, created_at, lifted_at FROM suspensions
+WHERE user_id = ? AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+ORDER BY expires_at IS NULL DESC, expires_at DESC
+LIMIT 1
+`
+
+// a ban first, then the suspension ending last
+func (q *Queries) GetActiveSuspension(ctx context.Context, userID uuid.UUID) (Suspension, error) {
+	row := q.db.QueryRowContext(ctx, getActiveSuspension, userID)
+	var i Suspension
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Reason,
+		&i.ExpiresAt,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.LiftedAt,
+	)
+	return i, err
+}
+
+const liftSuspensions = `-- name: LiftSuspensions :execrows
+UPDATE suspensions SET lifted_at = now()
+WHERE user_id = ? AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+`
+
+func (q *Queries) LiftSuspensions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, liftSuspensions, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listSuspensionsByUser = `-- name: ListSuspensionsByUser :many
+SELECT id, user_id, reason, expires_at, created_by, created_at, lifted_at FROM suspensions
+WHERE user_id = ?
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListSuspensionsByUser(ctx context.Context, userID uuid.UUID) ([]Suspension, error) {
+	rows, err := q.db.QueryContext(ctx, listSuspensionsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Suspension
+	for rows.Next() {
+		var i Suspension
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Reason,
+			&i.ExpiresAt,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.LiftedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
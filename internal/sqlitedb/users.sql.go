@@ -0,0 +1,233 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: users.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
+VALUES (
+	gen_random_uuid(),
+	now(),
+	now(),
+	?,
+	?,
+	?
+)
+RETURNING id, created_at, updated_at, email, hashed_password, handle, CAST(false AS BOOLEAN) AS is_chirpy_red
+`
+
+type CreateUserParams struct {
+	Email          string `json:"email"`
+	HashedPassword string `json:"hashed_password"`
+	Handle         string `json:"handle"`
+}
+
+type CreateUserRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	Column7        bool      `json:"column_7"`
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
+	var i CreateUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.Column7,
+	)
+	return i, err
+}
+
+const deleteAllUsers = `-- name: DeleteAllUsers :exec
+DELETE FROM users
+`
+
+func (q *Queries) DeleteAllUsers(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteAllUsers)
+	return err
+}
+
+const getUserByEmailWithPassword = `-- name: GetUserByEmailWithPassword :one
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.handle, CAST(EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS BOOLEAN) AS is_chirpy_red
+FROM users WHERE users.email = ?
+`
+
+type GetUserByEmailWithPasswordRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+}
+
+func (q *Queries) GetUserByEmailWithPassword(ctx context.Context, email string) (GetUserByEmailWithPasswordRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmailWithPassword, email)
+	var i GetUserByEmailWithPasswordRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.handle, CAST(EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS BOOLEAN) AS is_chirpy_red
+FROM users WHERE users.id = ?
+`
+
+type GetUserByIDRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+}
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (GetUserByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i GetUserByIDRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
+
+const getUserIDsByHandles = `-- name: GetUserIDsByHandles :many
+SELECT id FROM users
+WHERE instr(CAST(?1 AS TEXT), ',' || handle || ',') > 0
+`
+
+// handles is the handles comma separated and wrapped in commas, ",walt,jesse,".
+func (q *Queries) GetUserIDsByHandles(ctx context.Context, handles string) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUserIDsByHandles, handles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUser = `-- name: LockUser :exec
+SELECT id FROM users WHERE id = ?
+`
+
+// SQLite has no row locks, but the transactions are begun immediate and so
+// run one at a time already.
+func (q *Queries) LockUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, lockUser, id)
+	return err
+}
+
+const updateUserEmailAndPassword = `-- name: UpdateUserEmailAndPassword :one
+UPDATE users
+SET updated_at = now(), email = ?1, hashed_password = ?2
+WHERE users.id = ?3
+RETURNING id, created_at, updated_at, email, hashed_password, handle, CAST(EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS BOOLEAN) AS is_chirpy_red
+`
+
+type UpdateUserEmailAndPasswordParams struct {
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	ID             uuid.UUID `json:"id"`
+}
+
+type UpdateUserEmailAndPasswordRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	Column7        bool      `json:"column_7"`
+}
+
+func (q *Queries) UpdateUserEmailAndPassword(ctx context.Context, arg UpdateUserEmailAndPasswordParams) (UpdateUserEmailAndPasswordRow, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmailAndPassword, arg.Email, arg.HashedPassword, arg.ID)
+	var i UpdateUserEmailAndPasswordRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.Column7,
+	)
+	return i, err
+}
+
+const updateUserHandle = `-- name: UpdateUserHandle :exec
+UPDATE users SET updated_at = now(), handle = ? WHERE id = ?
+`
+
+type UpdateUserHandleParams struct {
+	Handle string    `json:"handle"`
+	ID     uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateUserHandle(ctx context.Context, arg UpdateUserHandleParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserHandle, arg.Handle, arg.ID)
+	return err
+}
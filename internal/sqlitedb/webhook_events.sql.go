@@ -0,0 +1,129 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: webhook_events.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const createWebhookEvent = `-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, source, event, payload, received_at)
+VALUES (
+	?,
+	?,
+	?,
+	?,
+	now()
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING id, source, event, payload, status, received_at, processed_at
+`
+
+type CreateWebhookEventParams struct {
+	ID      string          `json:"id"`
+	Source  string          `json:"source"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (q *Queries) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookEvent,
+		arg.ID,
+		arg.Source,
+		arg.Event,
+		arg.Payload,
+	)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Source,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const getWebhookEvent = `-- name: GetWebhookEvent :one
+SELECT id, source, event, payload, status, received_at, processed_at FROM webhook_events WHERE id = ?
+`
+
+func (q *Queries) GetWebhookEvent(ctx context.Context, id string) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEvent, id)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Source,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const listWebhookEvents = `-- name: ListWebhookEvents :many
+SELECT id, source, event, payload, status, received_at, processed_at FROM webhook_events
+WHERE source = ?
+ORDER BY received_at DESC
+LIMIT ?
+`
+
+type ListWebhookEventsParams struct {
+	Source string `json:"source"`
+	Limit  int64  `json:"limit"`
+}
+
+func (q *Queries) ListWebhookEvents(ctx context.Context, arg ListWebhookEventsParams) ([]WebhookEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookEvents, arg.Source, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEvent
+	for rows.Next() {
+		var i WebhookEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.Source,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.ReceivedAt,
+			&i.ProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markWebhookEvent = `-- name: MarkWebhookEvent :exec
+UPDATE webhook_events
+SET status = ?1, processed_at = now()
+WHERE id = ?2
+`
+
+type MarkWebhookEventParams struct {
+	Status string `json:"status"`
+	ID     string `json:"id"`
+}
+
+func (q *Queries) MarkWebhookEvent(ctx context.Context, arg MarkWebhookEventParams) error {
+	_, err := q.db.ExecContext(ctx, markWebhookEvent, arg.Status, arg.ID)
+	return err
+}
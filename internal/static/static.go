@@ -0,0 +1,180 @@
+// Package static serves the embedded web site with strong ETags,
+// precompressed variants and long lived caching of fingerprinted assets.
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// CacheImmutable is sent for fingerprinted files, their content never
+	// changes under the same name.
+	CacheImmutable = "public, max-age=31536000, immutable"
+	// CacheRevalidate is sent for everything else, clients check the ETag.
+	CacheRevalidate = "no-cache"
+)
+
+// fingerprint matches names like app.3f2a9c1d.js.
+var fingerprint = regexp.MustCompile(`\.[0-9a-f]{8,}\.[A-Za-z0-9]+$`)
+
+// encodings in order of preference, with the suffix of their files.
+var encodings = []struct {
+	name   string
+	suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+type file struct {
+	data        []byte
+	etag        string
+	contentType string
+	cache       string
+	// encoded holds precompressed variants by encoding name.
+	encoded map[string][]byte
+}
+
+// Server serves the files of an fs.FS loaded into memory.
+type Server struct {
+	files map[string]*file
+}
+
+// New loads every file of fsys. Files with a ".br" or ".gz" sibling are
+// served precompressed to clients accepting it, text files without a ".gz"
+// sibling are gzipped here.
+func New(fsys fs.FS) (*Server, error) {
+	s := &Server{files: map[string]*file{}}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		for _, enc := range encodings {
+			if strings.HasSuffix(name, enc.suffix) {
+				return nil
+			}
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+
+		f := &file{
+			data:        data,
+			etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+			contentType: contentType(name, data),
+			cache:       CacheRevalidate,
+			encoded:     map[string][]byte{},
+		}
+		if fingerprint.MatchString(name) {
+			f.cache = CacheImmutable
+		}
+
+		for _, enc := range encodings {
+			if variant, err := fs.ReadFile(fsys, name+enc.suffix); err == nil {
+				f.encoded[enc.name] = variant
+			}
+		}
+		if _, ok := f.encoded["gzip"]; !ok && compressible(f.contentType) {
+			if gz, err := gzipped(data); err == nil && len(gz) < len(data) {
+				f.encoded["gzip"] = gz
+			}
+		}
+
+		s.files[name] = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+
+	f, ok := s.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", f.contentType)
+	h.Set("Cache-Control", f.cache)
+	h.Add("Vary", "Accept-Encoding")
+
+	// each encoding is its own representation, so gets its own strong etag
+	data, etag := f.data, f.etag
+	for _, enc := range encodings {
+		variant, ok := f.encoded[enc.name]
+		if ok && accepts(r, enc.name) {
+			h.Set("Content-Encoding", enc.name)
+			data = variant
+			etag = strings.TrimSuffix(f.etag, `"`) + "-" + enc.name + `"`
+			break
+		}
+	}
+	h.Set("ETag", etag)
+
+	// ServeContent answers If-None-Match with 304 and handles ranges
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func contentType(name string, data []byte) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
+
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "svg")
+}
+
+func gzipped(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// accepts reports if the request's Accept-Encoding allows encoding.
+func accepts(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
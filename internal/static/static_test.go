@@ -0,0 +1,103 @@
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func newServer(t *testing.T) *Server {
+	t.Helper()
+	page := strings.Repeat("<p>Welcome to Chirpy</p>\n", 20)
+	s, err := New(fstest.MapFS{
+		"index.html":                {Data: []byte(page)},
+		"assets/app.3f2a9c1d.js":    {Data: []byte("console.log('chirp')")},
+		"assets/app.3f2a9c1d.js.br": {Data: []byte("brotli bytes")},
+		"assets/logo.png":           {Data: []byte("\x89PNG\r\n\x1a\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func get(s *Server, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServe(t *testing.T) {
+	s := newServer(t)
+
+	rec := get(s, "/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("expect html content type, got %s", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != CacheRevalidate {
+		t.Errorf("expect %s, got %s", CacheRevalidate, cc)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Errorf("expect a strong etag, got %s", etag)
+	}
+	rec = get(s, "/index.html", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("expect 304 for a matching etag, got %d", rec.Code)
+	}
+
+	rec = get(s, "/assets/app.3f2a9c1d.js", nil)
+	if cc := rec.Header().Get("Cache-Control"); cc != CacheImmutable {
+		t.Errorf("expect %s for a fingerprinted file, got %s", CacheImmutable, cc)
+	}
+
+	rec = get(s, "/assets/missing.js", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expect 404, got %d", rec.Code)
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	s := newServer(t)
+
+	rec := get(s, "/assets/app.3f2a9c1d.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	if rec.Header().Get("Content-Encoding") != "br" || rec.Body.String() != "brotli bytes" {
+		t.Errorf("expect the brotli variant, got %q %q", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+
+	rec = get(s, "/", map[string]string{"Accept-Encoding": "gzip"})
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expect gzip, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !strings.Contains(string(body), "Welcome to Chirpy") {
+		t.Errorf("unexpected gzip body %q", body)
+	}
+
+	rec = get(s, "/", map[string]string{"Accept-Encoding": "gzip;q=0"})
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expect no encoding for q=0, got %q", rec.Header().Get("Content-Encoding"))
+	}
+
+	rec = get(s, "/assets/logo.png", map[string]string{"Accept-Encoding": "gzip"})
+	if rec.Header().Get("Content-Encoding") != "" || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expect a plain png, got %v", rec.Header())
+	}
+}
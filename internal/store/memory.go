@@ -0,0 +1,1800 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+// ErrForeignKey is returned by Memory for rows referencing missing ones,
+// where Postgres would fail a foreign key constraint.
+var ErrForeignKey = errors.New("store: foreign key violation")
+
+// ErrCheck is returned by Memory for rows Postgres would fail a check
+// constraint on.
+var ErrCheck = errors.New("store: check violation")
+
+// ErrUnique is returned by Memory for rows Postgres would fail a unique
+// constraint on.
+var ErrUnique = errors.New("store: unique violation")
+
+// memData is the state of a Memory. Rows are kept in insertion order, which
+// is also created_at order.
+type memData struct {
+	users      []database.User
+	chirps     []database.Chirp
+	pins       []database.PinnedChirp
+	follows    []database.Follow
+	blocks     []database.Block
+	mutes      []database.Mute
+	convs      []database.Conversation
+	members    []database.ConversationMember
+	messages   []database.Message
+	msgPrefs   []database.MessageSetting
+	reports    []database.Report
+	mods       []database.Moderator
+	modLog     []database.ModerationLog
+	suspends   []database.Suspension
+	rules      []database.FilterRule
+	media      []database.Media
+	notes      []database.Notification
+	prefs      []database.NotificationPreference
+	tokens     []database.RefreshToken
+	subs       []database.Subscription
+	events     []database.WebhookEvent
+	endpoints  []database.WebhookEndpoint
+	deliveries []database.WebhookDelivery
+}
+
+func (d *memData) clone() memData {
+	return memData{
+		users:      slices.Clone(d.users),
+		chirps:     slices.Clone(d.chirps),
+		pins:       slices.Clone(d.pins),
+		follows:    slices.Clone(d.follows),
+		blocks:     slices.Clone(d.blocks),
+		mutes:      slices.Clone(d.mutes),
+		convs:      slices.Clone(d.convs),
+		members:    slices.Clone(d.members),
+		messages:   slices.Clone(d.messages),
+		msgPrefs:   slices.Clone(d.msgPrefs),
+		reports:    slices.Clone(d.reports),
+		mods:       slices.Clone(d.mods),
+		modLog:     slices.Clone(d.modLog),
+		suspends:   slices.Clone(d.suspends),
+		rules:      slices.Clone(d.rules),
+		media:      slices.Clone(d.media),
+		notes:      slices.Clone(d.notes),
+		prefs:      slices.Clone(d.prefs),
+		tokens:     slices.Clone(d.tokens),
+		subs:       slices.Clone(d.subs),
+		events:     slices.Clone(d.events),
+		endpoints:  slices.Clone(d.endpoints),
+		deliveries: slices.Clone(d.deliveries),
+	}
+}
+
+// Memory is a thread-safe Store kept in memory, behaving like the Postgres
+// queries including cascading deletes.
+type Memory struct {
+	// Now is the clock of the store, time.Now unless replaced.
+	Now func() time.Time
+
+	mu *sync.Mutex // nil inside InTx, which holds the lock
+	d  *memData
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{Now: time.Now, mu: &sync.Mutex{}, d: &memData{}}
+}
+
+func (m *Memory) lock() func() {
+	if m.mu == nil {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// InTx runs fn holding the lock of the store, restoring the state from before
+// fn if it fails.
+func (m *Memory) InTx(ctx context.Context, fn func(q Queries) error) error {
+	defer m.lock()()
+
+	snapshot := m.d.clone()
+	if err := fn(&Memory{Now: m.Now, d: m.d}); err != nil {
+		*m.d = snapshot
+		return err
+	}
+	return nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+/*
+	USERS
+*/
+
+func (m *Memory) isRed(userID uuid.UUID, now time.Time) bool {
+	for _, s := range m.d.subs {
+		if s.UserID != userID || (s.Status != "active" && s.Status != "past_due") {
+			continue
+		}
+		until := s.CurrentPeriodEnd
+		if s.GraceUntil.Valid {
+			until = s.GraceUntil.Time
+		}
+		if now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) userRow(u database.User) database.GetUserByIDRow {
+	return database.GetUserByIDRow{
+		ID:             u.ID,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+		Email:          u.Email,
+		HashedPassword: u.HashedPassword,
+		Handle:         u.Handle,
+		IsChirpyRed:    m.isRed(u.ID, m.Now()),
+	}
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	defer m.lock()()
+
+	if m.handleTaken(arg.Handle, uuid.Nil) {
+		return database.CreateUserRow{}, ErrUnique
+	}
+	now := m.Now()
+	u := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Handle:         arg.Handle,
+	}
+	m.d.users = append(m.d.users, u)
+	return database.CreateUserRow(m.userRow(u)), nil
+}
+
+// LockUser does nothing: InTx holds the lock of the whole store.
+func (m *Memory) LockUser(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.GetUserByIDRow, error) {
+	defer m.lock()()
+
+	for _, u := range m.d.users {
+		if u.ID == id {
+			return m.userRow(u), nil
+		}
+	}
+	return database.GetUserByIDRow{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserByEmailWithPassword(ctx context.Context, email string) (database.GetUserByEmailWithPasswordRow, error) {
+	defer m.lock()()
+
+	for _, u := range m.d.users {
+		if u.Email == email {
+			return database.GetUserByEmailWithPasswordRow(m.userRow(u)), nil
+		}
+	}
+	return database.GetUserByEmailWithPasswordRow{}, sql.ErrNoRows
+}
+
+func (m *Memory) UpdateUserEmailAndPassword(ctx context.Context, arg database.UpdateUserEmailAndPasswordParams) (database.UpdateUserEmailAndPasswordRow, error) {
+	defer m.lock()()
+
+	for i, u := range m.d.users {
+		if u.ID == arg.ID {
+			u.Email = arg.Email
+			u.HashedPassword = arg.HashedPassword
+			u.UpdatedAt = m.Now()
+			m.d.users[i] = u
+			return database.UpdateUserEmailAndPasswordRow(m.userRow(u)), nil
+		}
+	}
+	return database.UpdateUserEmailAndPasswordRow{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteAllUsers(ctx context.Context) error {
+	defer m.lock()()
+
+	// the webhook events, the moderation log and the filter rules don't
+	// reference users
+	events, modLog, rules := m.d.events, m.d.modLog, m.d.rules
+	*m.d = memData{events: events, modLog: modLog, rules: rules}
+	return nil
+}
+
+func (m *Memory) GetUserIDsByHandles(ctx context.Context, handles []string) ([]uuid.UUID, error) {
+	defer m.lock()()
+
+	var ids []uuid.UUID
+	for _, u := range m.d.users {
+		if slices.Contains(handles, u.Handle) {
+			ids = append(ids, u.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) UpdateUserHandle(ctx context.Context, arg database.UpdateUserHandleParams) error {
+	defer m.lock()()
+
+	if m.handleTaken(arg.Handle, arg.ID) {
+		return ErrUnique
+	}
+	for i, u := range m.d.users {
+		if u.ID == arg.ID {
+			m.d.users[i].Handle = arg.Handle
+			m.d.users[i].UpdatedAt = m.Now()
+		}
+	}
+	return nil
+}
+
+// handleTaken reports if a user other than id has handle.
+func (m *Memory) handleTaken(handle string, id uuid.UUID) bool {
+	return slices.ContainsFunc(m.d.users, func(u database.User) bool {
+		return u.Handle == handle && u.ID != id
+	})
+}
+
+func (m *Memory) userExists(id uuid.UUID) bool {
+	return slices.ContainsFunc(m.d.users, func(u database.User) bool { return u.ID == id })
+}
+
+/*
+	CHIRPS
+*/
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) {
+		return database.Chirp{}, ErrForeignKey
+	}
+	now := m.Now()
+	c := database.Chirp{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Body:      arg.Body,
+		Held:      arg.Held,
+	}
+	m.d.chirps = append(m.d.chirps, c)
+	return c, nil
+}
+
+func (m *Memory) GetAChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	defer m.lock()()
+
+	for _, c := range m.d.chirps {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetVisibleChirp(ctx context.Context, arg database.GetVisibleChirpParams) (database.Chirp, error) {
+	defer m.lock()()
+
+	for _, c := range m.d.chirps {
+		if c.ID != arg.ID {
+			continue
+		}
+		if c.UserID == arg.ViewerID || (!c.Held && !m.blockedOrSuspended(arg.ViewerID, c.UserID)) {
+			return c, nil
+		}
+		break
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+// hidden reports if the chirps of userID are left out of the listings for
+// viewerID, who blocked or muted them, or for them being suspended.
+func (m *Memory) hidden(viewerID, userID uuid.UUID) bool {
+	muted := slices.ContainsFunc(m.d.mutes, func(mu database.Mute) bool {
+		return mu.MuterID == viewerID && mu.MutedID == userID
+	})
+	return muted || m.blockedOrSuspended(viewerID, userID)
+}
+
+func (m *Memory) blockedOrSuspended(viewerID, userID uuid.UUID) bool {
+	blocked := slices.ContainsFunc(m.d.blocks, func(b database.Block) bool {
+		return b.BlockerID == viewerID && b.BlockedID == userID
+	})
+	suspended := slices.ContainsFunc(m.d.suspends, func(s database.Suspension) bool {
+		return s.UserID == userID && m.suspended(s)
+	})
+	return blocked || suspended
+}
+
+func (m *Memory) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	var chirps []database.Chirp
+	for _, c := range m.d.chirps {
+		if !c.Held && !m.hidden(viewerID, c.UserID) {
+			chirps = append(chirps, c)
+		}
+	}
+	return chirps, nil
+}
+
+func (m *Memory) GetAllChirpsByUser(ctx context.Context, arg database.GetAllChirpsByUserParams) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	var chirps []database.Chirp
+	for _, c := range m.d.chirps {
+		if c.UserID == arg.UserID && !c.Held && !m.hidden(arg.ViewerID, c.UserID) {
+			chirps = append(chirps, c)
+		}
+	}
+	return chirps, nil
+}
+
+func (m *Memory) UpdateChirpBody(ctx context.Context, arg database.UpdateChirpBodyParams) (database.Chirp, error) {
+	defer m.lock()()
+
+	for i, c := range m.d.chirps {
+		if c.ID == arg.ID {
+			c.Body = arg.Body
+			c.Held = arg.Held
+			c.UpdatedAt = m.Now()
+			m.d.chirps[i] = c
+			return c, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+
+	m.d.chirps = slices.DeleteFunc(m.d.chirps, func(c database.Chirp) bool { return c.ID == id })
+	m.d.pins = slices.DeleteFunc(m.d.pins, func(p database.PinnedChirp) bool { return p.ChirpID == id })
+	m.d.media = slices.DeleteFunc(m.d.media, func(md database.Media) bool {
+		return md.ChirpID.Valid && md.ChirpID.UUID == id
+	})
+	m.d.notes = slices.DeleteFunc(m.d.notes, func(n database.Notification) bool {
+		return n.ChirpID.Valid && n.ChirpID.UUID == id
+	})
+	for i, rep := range m.d.reports {
+		if rep.ChirpID.Valid && rep.ChirpID.UUID == id {
+			m.d.reports[i].ChirpID = uuid.NullUUID{}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CountChirpsByUserSince(ctx context.Context, arg database.CountChirpsByUserSinceParams) (int64, error) {
+	defer m.lock()()
+
+	var n int64
+	for _, c := range m.d.chirps {
+		if c.UserID == arg.UserID && !c.CreatedAt.Before(arg.CreatedAt) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) PinChirp(ctx context.Context, arg database.PinChirpParams) error {
+	defer m.lock()()
+
+	exists := slices.ContainsFunc(m.d.chirps, func(c database.Chirp) bool { return c.ID == arg.ChirpID })
+	if !exists || !m.userExists(arg.UserID) {
+		return ErrForeignKey
+	}
+	pinned := slices.ContainsFunc(m.d.pins, func(p database.PinnedChirp) bool {
+		return p.UserID == arg.UserID && p.ChirpID == arg.ChirpID
+	})
+	if !pinned {
+		m.d.pins = append(m.d.pins, database.PinnedChirp{UserID: arg.UserID, ChirpID: arg.ChirpID, PinnedAt: m.Now()})
+	}
+	return nil
+}
+
+func (m *Memory) UnpinChirp(ctx context.Context, arg database.UnpinChirpParams) error {
+	defer m.lock()()
+
+	m.d.pins = slices.DeleteFunc(m.d.pins, func(p database.PinnedChirp) bool {
+		return p.UserID == arg.UserID && p.ChirpID == arg.ChirpID
+	})
+	return nil
+}
+
+func (m *Memory) IsChirpPinned(ctx context.Context, arg database.IsChirpPinnedParams) (bool, error) {
+	defer m.lock()()
+
+	return slices.ContainsFunc(m.d.pins, func(p database.PinnedChirp) bool {
+		return p.UserID == arg.UserID && p.ChirpID == arg.ChirpID
+	}), nil
+}
+
+func (m *Memory) CountPinnedChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	var n int64
+	for _, p := range m.d.pins {
+		if p.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) GetPinnedChirpsByUser(ctx context.Context, arg database.GetPinnedChirpsByUserParams) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	var chirps []database.Chirp
+	for i := len(m.d.pins) - 1; i >= 0; i-- {
+		p := m.d.pins[i]
+		if p.UserID != arg.UserID {
+			continue
+		}
+		for _, c := range m.d.chirps {
+			if c.ID == p.ChirpID && !c.Held && !m.hidden(arg.ViewerID, c.UserID) {
+				chirps = append(chirps, c)
+			}
+		}
+	}
+	return chirps, nil
+}
+
+func (m *Memory) ListHeldChirps(ctx context.Context, arg database.ListHeldChirpsParams) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	var chirps []database.Chirp
+	for _, c := range m.d.chirps {
+		if !c.Held {
+			continue
+		}
+		if c.CreatedAt.After(arg.After) || (c.CreatedAt.Equal(arg.After) && bytes.Compare(c.ID[:], arg.AfterID[:]) > 0) {
+			chirps = append(chirps, c)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		if !chirps[i].CreatedAt.Equal(chirps[j].CreatedAt) {
+			return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
+		}
+		return bytes.Compare(chirps[i].ID[:], chirps[j].ID[:]) < 0
+	})
+	if len(chirps) > int(arg.MaxRows) {
+		chirps = chirps[:arg.MaxRows]
+	}
+	return chirps, nil
+}
+
+func (m *Memory) ReleaseChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	defer m.lock()()
+
+	for i, c := range m.d.chirps {
+		if c.ID == id && c.Held {
+			c.Held = false
+			m.d.chirps[i] = c
+			return c, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+/*
+	FOLLOWS
+*/
+
+func (m *Memory) FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.FollowerID) || !m.userExists(arg.FolloweeID) {
+		return 0, ErrForeignKey
+	}
+	if arg.FollowerID == arg.FolloweeID {
+		return 0, ErrCheck
+	}
+	following := slices.ContainsFunc(m.d.follows, func(f database.Follow) bool {
+		return f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID
+	})
+	if following {
+		return 0, nil
+	}
+	m.d.follows = append(m.d.follows, database.Follow{FollowerID: arg.FollowerID, FolloweeID: arg.FolloweeID, CreatedAt: m.Now()})
+	return 1, nil
+}
+
+func (m *Memory) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	defer m.lock()()
+
+	m.d.follows = slices.DeleteFunc(m.d.follows, func(f database.Follow) bool {
+		return f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID
+	})
+	return nil
+}
+
+func (m *Memory) GetFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error) {
+	defer m.lock()()
+
+	var ids []uuid.UUID
+	for i := len(m.d.follows) - 1; i >= 0; i-- {
+		if f := m.d.follows[i]; f.FollowerID == followerID {
+			ids = append(ids, f.FolloweeID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) IsFollowing(ctx context.Context, arg database.IsFollowingParams) (bool, error) {
+	defer m.lock()()
+
+	return slices.ContainsFunc(m.d.follows, func(f database.Follow) bool {
+		return f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID
+	}), nil
+}
+
+/*
+	BLOCKS
+*/
+
+func (m *Memory) BlockUser(ctx context.Context, arg database.BlockUserParams) (int64, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.BlockerID) || !m.userExists(arg.BlockedID) {
+		return 0, ErrForeignKey
+	}
+	if arg.BlockerID == arg.BlockedID {
+		return 0, ErrCheck
+	}
+	blocking := slices.ContainsFunc(m.d.blocks, func(b database.Block) bool {
+		return b.BlockerID == arg.BlockerID && b.BlockedID == arg.BlockedID
+	})
+	if blocking {
+		return 0, nil
+	}
+	m.d.blocks = append(m.d.blocks, database.Block{BlockerID: arg.BlockerID, BlockedID: arg.BlockedID, CreatedAt: m.Now()})
+	return 1, nil
+}
+
+func (m *Memory) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	defer m.lock()()
+
+	m.d.blocks = slices.DeleteFunc(m.d.blocks, func(b database.Block) bool {
+		return b.BlockerID == arg.BlockerID && b.BlockedID == arg.BlockedID
+	})
+	return nil
+}
+
+func (m *Memory) ListBlocks(ctx context.Context, blockerID uuid.UUID) ([]database.Block, error) {
+	defer m.lock()()
+
+	var blocks []database.Block
+	for i := len(m.d.blocks) - 1; i >= 0; i-- {
+		if b := m.d.blocks[i]; b.BlockerID == blockerID {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+func (m *Memory) IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error) {
+	defer m.lock()()
+
+	return slices.ContainsFunc(m.d.blocks, func(b database.Block) bool {
+		return (b.BlockerID == arg.UserID && b.BlockedID == arg.OtherID) || (b.BlockerID == arg.OtherID && b.BlockedID == arg.UserID)
+	}), nil
+}
+
+func (m *Memory) MuteUser(ctx context.Context, arg database.MuteUserParams) (int64, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.MuterID) || !m.userExists(arg.MutedID) {
+		return 0, ErrForeignKey
+	}
+	if arg.MuterID == arg.MutedID {
+		return 0, ErrCheck
+	}
+	muting := slices.ContainsFunc(m.d.mutes, func(mu database.Mute) bool {
+		return mu.MuterID == arg.MuterID && mu.MutedID == arg.MutedID
+	})
+	if muting {
+		return 0, nil
+	}
+	m.d.mutes = append(m.d.mutes, database.Mute{MuterID: arg.MuterID, MutedID: arg.MutedID, CreatedAt: m.Now()})
+	return 1, nil
+}
+
+func (m *Memory) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	defer m.lock()()
+
+	m.d.mutes = slices.DeleteFunc(m.d.mutes, func(mu database.Mute) bool {
+		return mu.MuterID == arg.MuterID && mu.MutedID == arg.MutedID
+	})
+	return nil
+}
+
+func (m *Memory) ListMutes(ctx context.Context, muterID uuid.UUID) ([]database.Mute, error) {
+	defer m.lock()()
+
+	var mutes []database.Mute
+	for i := len(m.d.mutes) - 1; i >= 0; i-- {
+		if mu := m.d.mutes[i]; mu.MuterID == muterID {
+			mutes = append(mutes, mu)
+		}
+	}
+	return mutes, nil
+}
+
+func (m *Memory) GetHiddenUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	defer m.lock()()
+
+	var ids []uuid.UUID
+	for _, b := range m.d.blocks {
+		if b.BlockerID == userID {
+			ids = append(ids, b.BlockedID)
+		}
+	}
+	for _, mu := range m.d.mutes {
+		if mu.MuterID == userID && !slices.Contains(ids, mu.MutedID) {
+			ids = append(ids, mu.MutedID)
+		}
+	}
+	return ids, nil
+}
+
+/*
+	MESSAGES
+*/
+
+func (m *Memory) CreateConversation(ctx context.Context, arg database.CreateConversationParams) (database.Conversation, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.CreatedBy) {
+		return database.Conversation{}, ErrForeignKey
+	}
+	if arg.DirectKey.Valid && slices.ContainsFunc(m.d.convs, func(c database.Conversation) bool { return c.DirectKey == arg.DirectKey }) {
+		return database.Conversation{}, ErrUnique
+	}
+	now := m.Now()
+	c := database.Conversation{
+		ID:        uuid.New(),
+		DirectKey: arg.DirectKey,
+		CreatedBy: arg.CreatedBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.d.convs = append(m.d.convs, c)
+	return c, nil
+}
+
+func (m *Memory) GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error) {
+	defer m.lock()()
+
+	for _, c := range m.d.convs {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return database.Conversation{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetConversationByDirectKey(ctx context.Context, directKey sql.NullString) (database.Conversation, error) {
+	defer m.lock()()
+
+	for _, c := range m.d.convs {
+		if directKey.Valid && c.DirectKey == directKey {
+			return c, nil
+		}
+	}
+	return database.Conversation{}, sql.ErrNoRows
+}
+
+func (m *Memory) conversationExists(id uuid.UUID) bool {
+	return slices.ContainsFunc(m.d.convs, func(c database.Conversation) bool { return c.ID == id })
+}
+
+func (m *Memory) AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error {
+	defer m.lock()()
+
+	if !m.conversationExists(arg.ConversationID) || !m.userExists(arg.UserID) {
+		return ErrForeignKey
+	}
+	member := slices.ContainsFunc(m.d.members, func(cm database.ConversationMember) bool {
+		return cm.ConversationID == arg.ConversationID && cm.UserID == arg.UserID
+	})
+	if member {
+		return ErrUnique
+	}
+	m.d.members = append(m.d.members, database.ConversationMember{
+		ConversationID: arg.ConversationID,
+		UserID:         arg.UserID,
+		JoinedAt:       m.Now(),
+	})
+	return nil
+}
+
+func (m *Memory) GetConversationMember(ctx context.Context, arg database.GetConversationMemberParams) (database.ConversationMember, error) {
+	defer m.lock()()
+
+	for _, cm := range m.d.members {
+		if cm.ConversationID == arg.ConversationID && cm.UserID == arg.UserID {
+			return cm, nil
+		}
+	}
+	return database.ConversationMember{}, sql.ErrNoRows
+}
+
+// ListConversationsByUser orders by updated_at and id like ListMessages.
+func (m *Memory) ListConversationsByUser(ctx context.Context, arg database.ListConversationsByUserParams) ([]database.ListConversationsByUserRow, error) {
+	defer m.lock()()
+
+	var rows []database.ListConversationsByUserRow
+	for _, cm := range m.d.members {
+		if cm.UserID != arg.UserID {
+			continue
+		}
+		i := slices.IndexFunc(m.d.convs, func(c database.Conversation) bool { return c.ID == cm.ConversationID })
+		c := m.d.convs[i]
+		if !c.UpdatedAt.Before(arg.Before) && !(c.UpdatedAt.Equal(arg.Before) && bytes.Compare(c.ID[:], arg.BeforeID[:]) < 0) {
+			continue
+		}
+		row := database.ListConversationsByUserRow{
+			ID:         c.ID,
+			DirectKey:  c.DirectKey,
+			CreatedBy:  c.CreatedBy,
+			CreatedAt:  c.CreatedAt,
+			UpdatedAt:  c.UpdatedAt,
+			LastReadAt: cm.LastReadAt,
+		}
+		for _, msg := range m.d.messages {
+			if msg.ConversationID == c.ID && msg.SenderID != cm.UserID && (!cm.LastReadAt.Valid || msg.CreatedAt.After(cm.LastReadAt.Time)) {
+				row.UnreadCount++
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].UpdatedAt.Equal(rows[j].UpdatedAt) {
+			return rows[i].UpdatedAt.After(rows[j].UpdatedAt)
+		}
+		return bytes.Compare(rows[i].ID[:], rows[j].ID[:]) > 0
+	})
+	if len(rows) > int(arg.MaxRows) {
+		rows = rows[:arg.MaxRows]
+	}
+	return rows, nil
+}
+
+func (m *Memory) ListConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]uuid.UUID, error) {
+	defer m.lock()()
+
+	var ids []uuid.UUID
+	for _, cm := range m.d.members {
+		if cm.ConversationID == conversationID {
+			ids = append(ids, cm.UserID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) ListConversationMembersByUser(ctx context.Context, userID uuid.UUID) ([]database.ListConversationMembersByUserRow, error) {
+	defer m.lock()()
+
+	var rows []database.ListConversationMembersByUserRow
+	for _, cm := range m.d.members {
+		mine := slices.ContainsFunc(m.d.members, func(other database.ConversationMember) bool {
+			return other.ConversationID == cm.ConversationID && other.UserID == userID
+		})
+		if mine {
+			rows = append(rows, database.ListConversationMembersByUserRow{ConversationID: cm.ConversationID, UserID: cm.UserID})
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error) {
+	defer m.lock()()
+
+	if !m.conversationExists(arg.ConversationID) || !m.userExists(arg.SenderID) {
+		return database.Message{}, ErrForeignKey
+	}
+	msg := database.Message{
+		ID:             uuid.New(),
+		ConversationID: arg.ConversationID,
+		SenderID:       arg.SenderID,
+		Body:           arg.Body,
+		CreatedAt:      m.Now(),
+	}
+	m.d.messages = append(m.d.messages, msg)
+	return msg, nil
+}
+
+func (m *Memory) TouchConversation(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+
+	for i, c := range m.d.convs {
+		if c.ID == id {
+			m.d.convs[i].UpdatedAt = m.Now()
+		}
+	}
+	return nil
+}
+
+// ListMessages orders like ListNotifications.
+func (m *Memory) ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error) {
+	defer m.lock()()
+
+	var messages []database.Message
+	for _, msg := range m.d.messages {
+		if msg.ConversationID != arg.ConversationID {
+			continue
+		}
+		if msg.CreatedAt.Before(arg.Before) || (msg.CreatedAt.Equal(arg.Before) && bytes.Compare(msg.ID[:], arg.BeforeID[:]) < 0) {
+			messages = append(messages, msg)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].CreatedAt.After(messages[j].CreatedAt)
+		}
+		return bytes.Compare(messages[i].ID[:], messages[j].ID[:]) > 0
+	})
+	if len(messages) > int(arg.MaxRows) {
+		messages = messages[:arg.MaxRows]
+	}
+	return messages, nil
+}
+
+func (m *Memory) MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error {
+	defer m.lock()()
+
+	for i, cm := range m.d.members {
+		if cm.ConversationID == arg.ConversationID && cm.UserID == arg.UserID {
+			m.d.members[i].LastReadAt = sql.NullTime{Time: m.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetMessageSettings(ctx context.Context, userID uuid.UUID) (database.MessageSetting, error) {
+	defer m.lock()()
+
+	for _, s := range m.d.msgPrefs {
+		if s.UserID == userID {
+			return s, nil
+		}
+	}
+	return database.MessageSetting{}, sql.ErrNoRows
+}
+
+func (m *Memory) SetMessageSettings(ctx context.Context, arg database.SetMessageSettingsParams) (database.MessageSetting, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) {
+		return database.MessageSetting{}, ErrForeignKey
+	}
+	for i, s := range m.d.msgPrefs {
+		if s.UserID == arg.UserID {
+			m.d.msgPrefs[i].AcceptFrom = arg.AcceptFrom
+			return m.d.msgPrefs[i], nil
+		}
+	}
+	s := database.MessageSetting(arg)
+	m.d.msgPrefs = append(m.d.msgPrefs, s)
+	return s, nil
+}
+
+/*
+	MODERATION
+*/
+
+func (m *Memory) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.ReporterID) || !m.userExists(arg.UserID) {
+		return database.Report{}, ErrForeignKey
+	}
+	if arg.ChirpID.Valid && !slices.ContainsFunc(m.d.chirps, func(c database.Chirp) bool { return c.ID == arg.ChirpID.UUID }) {
+		return database.Report{}, ErrForeignKey
+	}
+	now := m.Now()
+	rep := database.Report{
+		ID:         uuid.New(),
+		ReporterID: arg.ReporterID,
+		UserID:     arg.UserID,
+		ChirpID:    arg.ChirpID,
+		Reason:     arg.Reason,
+		Details:    arg.Details,
+		Status:     "open",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	m.d.reports = append(m.d.reports, rep)
+	return rep, nil
+}
+
+func (m *Memory) GetReport(ctx context.Context, id uuid.UUID) (database.Report, error) {
+	defer m.lock()()
+
+	for _, rep := range m.d.reports {
+		if rep.ID == id {
+			return rep, nil
+		}
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListReports(ctx context.Context, arg database.ListReportsParams) ([]database.Report, error) {
+	defer m.lock()()
+
+	var reports []database.Report
+	for _, rep := range m.d.reports {
+		if rep.Status != arg.Status {
+			continue
+		}
+		if rep.CreatedAt.After(arg.After) || (rep.CreatedAt.Equal(arg.After) && bytes.Compare(rep.ID[:], arg.AfterID[:]) > 0) {
+			reports = append(reports, rep)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].CreatedAt.Equal(reports[j].CreatedAt) {
+			return reports[i].CreatedAt.Before(reports[j].CreatedAt)
+		}
+		return bytes.Compare(reports[i].ID[:], reports[j].ID[:]) < 0
+	})
+	if len(reports) > int(arg.MaxRows) {
+		reports = reports[:arg.MaxRows]
+	}
+	return reports, nil
+}
+
+// workable reports if rep is open or claimed by the moderator.
+func workable(rep database.Report, moderatorID uuid.NullUUID) bool {
+	return rep.Status == "open" || (rep.Status == "claimed" && rep.ModeratorID == moderatorID)
+}
+
+func (m *Memory) ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error) {
+	defer m.lock()()
+
+	for i, rep := range m.d.reports {
+		if rep.ID == arg.ID && workable(rep, arg.ModeratorID) {
+			m.d.reports[i].Status = "claimed"
+			m.d.reports[i].ModeratorID = arg.ModeratorID
+			m.d.reports[i].UpdatedAt = m.Now()
+			return m.d.reports[i], nil
+		}
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (m *Memory) CloseReport(ctx context.Context, arg database.CloseReportParams) (database.Report, error) {
+	defer m.lock()()
+
+	if arg.Status != "resolved" && arg.Status != "dismissed" && arg.Status != "open" && arg.Status != "claimed" {
+		return database.Report{}, ErrCheck
+	}
+	for i, rep := range m.d.reports {
+		if rep.ID == arg.ID && workable(rep, arg.ModeratorID) {
+			m.d.reports[i].Status = arg.Status
+			m.d.reports[i].Resolution = arg.Resolution
+			m.d.reports[i].ModeratorID = arg.ModeratorID
+			m.d.reports[i].UpdatedAt = m.Now()
+			return m.d.reports[i], nil
+		}
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (m *Memory) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationLog, error) {
+	defer m.lock()()
+
+	entry := database.ModerationLog{
+		ID:          uuid.New(),
+		ModeratorID: arg.ModeratorID,
+		Action:      arg.Action,
+		ReportID:    arg.ReportID,
+		UserID:      arg.UserID,
+		ChirpID:     arg.ChirpID,
+		Note:        arg.Note,
+		CreatedAt:   m.Now(),
+	}
+	m.d.modLog = append(m.d.modLog, entry)
+	return entry, nil
+}
+
+func (m *Memory) ListModerationLog(ctx context.Context, arg database.ListModerationLogParams) ([]database.ModerationLog, error) {
+	defer m.lock()()
+
+	var entries []database.ModerationLog
+	for _, e := range m.d.modLog {
+		if e.CreatedAt.Before(arg.Before) || (e.CreatedAt.Equal(arg.Before) && bytes.Compare(e.ID[:], arg.BeforeID[:]) < 0) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return bytes.Compare(entries[i].ID[:], entries[j].ID[:]) > 0
+	})
+	if len(entries) > int(arg.MaxRows) {
+		entries = entries[:arg.MaxRows]
+	}
+	return entries, nil
+}
+
+func (m *Memory) IsModerator(ctx context.Context, userID uuid.UUID) (bool, error) {
+	defer m.lock()()
+
+	return slices.ContainsFunc(m.d.mods, func(mod database.Moderator) bool { return mod.UserID == userID }), nil
+}
+
+func (m *Memory) AddModerator(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+
+	if !m.userExists(userID) {
+		return ErrForeignKey
+	}
+	if slices.ContainsFunc(m.d.mods, func(mod database.Moderator) bool { return mod.UserID == userID }) {
+		return nil
+	}
+	m.d.mods = append(m.d.mods, database.Moderator{UserID: userID, CreatedAt: m.Now()})
+	return nil
+}
+
+func (m *Memory) RemoveModerator(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+
+	m.d.mods = slices.DeleteFunc(m.d.mods, func(mod database.Moderator) bool { return mod.UserID == userID })
+	return nil
+}
+
+/*
+	SUSPENSIONS
+*/
+
+func (m *Memory) CreateSuspension(ctx context.Context, arg database.CreateSuspensionParams) (database.Suspension, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) || (arg.CreatedBy.Valid && !m.userExists(arg.CreatedBy.UUID)) {
+		return database.Suspension{}, ErrForeignKey
+	}
+	s := database.Suspension{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Reason:    arg.Reason,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedBy: arg.CreatedBy,
+		CreatedAt: m.Now(),
+	}
+	m.d.suspends = append(m.d.suspends, s)
+	return s, nil
+}
+
+// suspended reports if s is in effect.
+func (m *Memory) suspended(s database.Suspension) bool {
+	return !s.LiftedAt.Valid && (!s.ExpiresAt.Valid || s.ExpiresAt.Time.After(m.Now()))
+}
+
+func (m *Memory) GetActiveSuspension(ctx context.Context, userID uuid.UUID) (database.Suspension, error) {
+	defer m.lock()()
+
+	var active *database.Suspension
+	for i, s := range m.d.suspends {
+		if s.UserID != userID || !m.suspended(s) {
+			continue
+		}
+		if active == nil || !s.ExpiresAt.Valid || (active.ExpiresAt.Valid && s.ExpiresAt.Time.After(active.ExpiresAt.Time)) {
+			active = &m.d.suspends[i]
+		}
+	}
+	if active == nil {
+		return database.Suspension{}, sql.ErrNoRows
+	}
+	return *active, nil
+}
+
+func (m *Memory) ListSuspensionsByUser(ctx context.Context, userID uuid.UUID) ([]database.Suspension, error) {
+	defer m.lock()()
+
+	var suspensions []database.Suspension
+	for i := len(m.d.suspends) - 1; i >= 0; i-- {
+		if s := m.d.suspends[i]; s.UserID == userID {
+			suspensions = append(suspensions, s)
+		}
+	}
+	return suspensions, nil
+}
+
+func (m *Memory) LiftSuspensions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	var n int64
+	for i, s := range m.d.suspends {
+		if s.UserID == userID && m.suspended(s) {
+			m.d.suspends[i].LiftedAt = sql.NullTime{Time: m.Now(), Valid: true}
+			n++
+		}
+	}
+	return n, nil
+}
+
+/*
+	FILTER RULES
+*/
+
+func (m *Memory) CreateFilterRule(ctx context.Context, arg database.CreateFilterRuleParams) (database.FilterRule, error) {
+	defer m.lock()()
+
+	if !validRule(arg.Kind, arg.Action) {
+		return database.FilterRule{}, ErrCheck
+	}
+	now := m.Now()
+	r := database.FilterRule{
+		ID:        uuid.New(),
+		Kind:      arg.Kind,
+		Pattern:   arg.Pattern,
+		Action:    arg.Action,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.d.rules = append(m.d.rules, r)
+	return r, nil
+}
+
+func validRule(kind, action string) bool {
+	return (kind == "word" || kind == "regex") && (action == "mask" || action == "hold" || action == "reject")
+}
+
+func (m *Memory) GetFilterRule(ctx context.Context, id uuid.UUID) (database.FilterRule, error) {
+	defer m.lock()()
+
+	for _, r := range m.d.rules {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return database.FilterRule{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListFilterRules(ctx context.Context) ([]database.FilterRule, error) {
+	defer m.lock()()
+
+	rules := slices.Clone(m.d.rules)
+	sort.SliceStable(rules, func(i, j int) bool {
+		if !rules[i].CreatedAt.Equal(rules[j].CreatedAt) {
+			return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+		}
+		return bytes.Compare(rules[i].ID[:], rules[j].ID[:]) < 0
+	})
+	return rules, nil
+}
+
+func (m *Memory) UpdateFilterRule(ctx context.Context, arg database.UpdateFilterRuleParams) (database.FilterRule, error) {
+	defer m.lock()()
+
+	if !validRule(arg.Kind, arg.Action) {
+		return database.FilterRule{}, ErrCheck
+	}
+	for i, r := range m.d.rules {
+		if r.ID == arg.ID {
+			r.Kind = arg.Kind
+			r.Pattern = arg.Pattern
+			r.Action = arg.Action
+			r.UpdatedAt = m.Now()
+			m.d.rules[i] = r
+			return r, nil
+		}
+	}
+	return database.FilterRule{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteFilterRule(ctx context.Context, id uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	n := len(m.d.rules)
+	m.d.rules = slices.DeleteFunc(m.d.rules, func(r database.FilterRule) bool { return r.ID == id })
+	return int64(n - len(m.d.rules)), nil
+}
+
+/*
+	MEDIA
+*/
+
+func (m *Memory) CreateMedia(ctx context.Context, arg database.CreateMediaParams) (database.Media, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) {
+		return database.Media{}, ErrForeignKey
+	}
+	if slices.ContainsFunc(m.d.media, func(md database.Media) bool { return md.ID == arg.ID }) {
+		return database.Media{}, ErrUnique
+	}
+	md := database.Media{
+		ID:          arg.ID,
+		UserID:      arg.UserID,
+		ContentType: arg.ContentType,
+		Size:        arg.Size,
+		CreatedAt:   m.Now(),
+	}
+	m.d.media = append(m.d.media, md)
+	return md, nil
+}
+
+func (m *Memory) GetMedia(ctx context.Context, id uuid.UUID) (database.Media, error) {
+	defer m.lock()()
+
+	for _, md := range m.d.media {
+		if md.ID == id {
+			return md, nil
+		}
+	}
+	return database.Media{}, sql.ErrNoRows
+}
+
+func (m *Memory) AttachMedia(ctx context.Context, arg database.AttachMediaParams) (int64, error) {
+	defer m.lock()()
+
+	if arg.ChirpID.Valid && !slices.ContainsFunc(m.d.chirps, func(c database.Chirp) bool { return c.ID == arg.ChirpID.UUID }) {
+		return 0, ErrForeignKey
+	}
+	for i, md := range m.d.media {
+		if md.ID == arg.ID && md.UserID == arg.UserID && !md.ChirpID.Valid {
+			m.d.media[i].ChirpID = arg.ChirpID
+			m.d.media[i].Position = arg.Position
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) ListMediaByChirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.Media, error) {
+	defer m.lock()()
+
+	var media []database.Media
+	for _, md := range m.d.media {
+		if md.ChirpID.Valid && slices.Contains(chirpIds, md.ChirpID.UUID) {
+			media = append(media, md)
+		}
+	}
+	sort.SliceStable(media, func(i, j int) bool {
+		if c := bytes.Compare(media[i].ChirpID.UUID[:], media[j].ChirpID.UUID[:]); c != 0 {
+			return c < 0
+		}
+		return media[i].Position < media[j].Position
+	})
+	return media, nil
+}
+
+func (m *Memory) ListAllMedia(ctx context.Context) ([]database.Media, error) {
+	defer m.lock()()
+
+	return slices.Clone(m.d.media), nil
+}
+
+func (m *Memory) ListUnattachedMedia(ctx context.Context, createdAt time.Time) ([]database.Media, error) {
+	defer m.lock()()
+
+	var media []database.Media
+	for _, md := range m.d.media {
+		if !md.ChirpID.Valid && md.CreatedAt.Before(createdAt) {
+			media = append(media, md)
+		}
+	}
+	sort.SliceStable(media, func(i, j int) bool { return media[i].CreatedAt.Before(media[j].CreatedAt) })
+	return media, nil
+}
+
+func (m *Memory) DeleteUnattachedMedia(ctx context.Context, id uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	n := len(m.d.media)
+	m.d.media = slices.DeleteFunc(m.d.media, func(md database.Media) bool {
+		return md.ID == id && !md.ChirpID.Valid
+	})
+	return int64(n - len(m.d.media)), nil
+}
+
+/*
+	NOTIFICATIONS
+*/
+
+func (m *Memory) CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) || (arg.ActorID.Valid && !m.userExists(arg.ActorID.UUID)) {
+		return database.Notification{}, ErrForeignKey
+	}
+	if arg.ChirpID.Valid && !slices.ContainsFunc(m.d.chirps, func(c database.Chirp) bool { return c.ID == arg.ChirpID.UUID }) {
+		return database.Notification{}, ErrForeignKey
+	}
+	n := database.Notification{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Type:      arg.Type,
+		ActorID:   arg.ActorID,
+		ChirpID:   arg.ChirpID,
+		CreatedAt: m.Now(),
+	}
+	m.d.notes = append(m.d.notes, n)
+	return n, nil
+}
+
+// ListNotifications orders by created_at and id descending like the query,
+// comparing ids byte-wise as Postgres does.
+func (m *Memory) ListNotifications(ctx context.Context, arg database.ListNotificationsParams) ([]database.Notification, error) {
+	defer m.lock()()
+
+	var notes []database.Notification
+	for _, n := range m.d.notes {
+		if n.UserID != arg.UserID {
+			continue
+		}
+		if n.CreatedAt.Before(arg.Before) || (n.CreatedAt.Equal(arg.Before) && bytes.Compare(n.ID[:], arg.BeforeID[:]) < 0) {
+			notes = append(notes, n)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].CreatedAt.Equal(notes[j].CreatedAt) {
+			return notes[i].CreatedAt.After(notes[j].CreatedAt)
+		}
+		return bytes.Compare(notes[i].ID[:], notes[j].ID[:]) > 0
+	})
+	if len(notes) > int(arg.MaxRows) {
+		notes = notes[:arg.MaxRows]
+	}
+	return notes, nil
+}
+
+func (m *Memory) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	var n int64
+	for _, note := range m.d.notes {
+		if note.UserID == userID && !note.ReadAt.Valid {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) MarkNotificationRead(ctx context.Context, arg database.MarkNotificationReadParams) (int64, error) {
+	defer m.lock()()
+
+	for i, n := range m.d.notes {
+		if n.ID == arg.ID && n.UserID == arg.UserID {
+			if !n.ReadAt.Valid {
+				m.d.notes[i].ReadAt = sql.NullTime{Time: m.Now(), Valid: true}
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	var marked int64
+	for i, n := range m.d.notes {
+		if n.UserID == userID && !n.ReadAt.Valid {
+			m.d.notes[i].ReadAt = sql.NullTime{Time: m.Now(), Valid: true}
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (m *Memory) GetNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error) {
+	defer m.lock()()
+
+	var prefs []database.NotificationPreference
+	for _, p := range m.d.prefs {
+		if p.UserID == userID {
+			prefs = append(prefs, p)
+		}
+	}
+	return prefs, nil
+}
+
+func (m *Memory) SetNotificationPreference(ctx context.Context, arg database.SetNotificationPreferenceParams) error {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) {
+		return ErrForeignKey
+	}
+	for i, p := range m.d.prefs {
+		if p.UserID == arg.UserID && p.Type == arg.Type {
+			m.d.prefs[i].Enabled = arg.Enabled
+			return nil
+		}
+	}
+	m.d.prefs = append(m.d.prefs, database.NotificationPreference(arg))
+	return nil
+}
+
+/*
+	TOKENS
+*/
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) {
+		return database.RefreshToken{}, ErrForeignKey
+	}
+	now := m.Now()
+	t := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	m.d.tokens = append(m.d.tokens, t)
+	return t, nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	defer m.lock()()
+
+	for _, t := range m.d.tokens {
+		if t.Token == token {
+			return t, nil
+		}
+	}
+	return database.RefreshToken{}, sql.ErrNoRows
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, token string) error {
+	defer m.lock()()
+
+	for i, t := range m.d.tokens {
+		if t.Token == token {
+			now := m.Now()
+			t.RevokedAt = sql.NullTime{Time: now, Valid: true}
+			t.UpdatedAt = now
+			m.d.tokens[i] = t
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+
+	now := m.Now()
+	for i, t := range m.d.tokens {
+		if t.UserID == userID && !t.RevokedAt.Valid {
+			m.d.tokens[i].RevokedAt = sql.NullTime{Time: now, Valid: true}
+			m.d.tokens[i].UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+/*
+	SUBSCRIPTIONS
+*/
+
+func (m *Memory) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	defer m.lock()()
+
+	for _, s := range m.d.subs {
+		if s.UserID == userID {
+			return s, nil
+		}
+	}
+	return database.Subscription{}, sql.ErrNoRows
+}
+
+func (m *Memory) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) {
+		return database.Subscription{}, ErrForeignKey
+	}
+	now := m.Now()
+	for i, s := range m.d.subs {
+		if s.UserID == arg.UserID {
+			s.Plan = arg.Plan
+			s.Status = arg.Status
+			s.CurrentPeriodStart = arg.CurrentPeriodStart
+			s.CurrentPeriodEnd = arg.CurrentPeriodEnd
+			s.GraceUntil = arg.GraceUntil
+			s.UpdatedAt = now
+			m.d.subs[i] = s
+			return s, nil
+		}
+	}
+
+	s := database.Subscription{
+		ID:                 uuid.New(),
+		UserID:             arg.UserID,
+		Plan:               arg.Plan,
+		Status:             arg.Status,
+		CurrentPeriodStart: arg.CurrentPeriodStart,
+		CurrentPeriodEnd:   arg.CurrentPeriodEnd,
+		GraceUntil:         arg.GraceUntil,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	m.d.subs = append(m.d.subs, s)
+	return s, nil
+}
+
+func (m *Memory) ExpireLapsedSubscriptions(ctx context.Context) (int64, error) {
+	defer m.lock()()
+
+	now := m.Now()
+	var n int64
+	for i, s := range m.d.subs {
+		if s.Status != "active" && s.Status != "past_due" {
+			continue
+		}
+		until := s.CurrentPeriodEnd
+		if s.GraceUntil.Valid {
+			until = s.GraceUntil.Time
+		}
+		if !now.Before(until) {
+			s.Status = "expired"
+			s.UpdatedAt = now
+			m.d.subs[i] = s
+			n++
+		}
+	}
+	return n, nil
+}
+
+/*
+	WEBHOOK EVENTS
+*/
+
+func (m *Memory) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (database.WebhookEvent, error) {
+	defer m.lock()()
+
+	for _, e := range m.d.events {
+		if e.ID == arg.ID {
+			return database.WebhookEvent{}, sql.ErrNoRows
+		}
+	}
+	e := database.WebhookEvent{
+		ID:         arg.ID,
+		Source:     arg.Source,
+		Event:      arg.Event,
+		Payload:    arg.Payload,
+		Status:     "received",
+		ReceivedAt: m.Now(),
+	}
+	m.d.events = append(m.d.events, e)
+	return e, nil
+}
+
+func (m *Memory) GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	defer m.lock()()
+
+	for _, e := range m.d.events {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return database.WebhookEvent{}, sql.ErrNoRows
+}
+
+func (m *Memory) MarkWebhookEvent(ctx context.Context, arg database.MarkWebhookEventParams) error {
+	defer m.lock()()
+
+	for i, e := range m.d.events {
+		if e.ID == arg.ID {
+			e.Status = arg.Status
+			e.ProcessedAt = sql.NullTime{Time: m.Now(), Valid: true}
+			m.d.events[i] = e
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ListWebhookEvents(ctx context.Context, arg database.ListWebhookEventsParams) ([]database.WebhookEvent, error) {
+	defer m.lock()()
+
+	var events []database.WebhookEvent
+	for i := len(m.d.events) - 1; i >= 0 && len(events) < int(arg.Limit); i-- {
+		if m.d.events[i].Source == arg.Source {
+			events = append(events, m.d.events[i])
+		}
+	}
+	return events, nil
+}
+
+/*
+	WEBHOOKS
+*/
+
+func (m *Memory) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	defer m.lock()()
+
+	if !m.userExists(arg.UserID) {
+		return database.WebhookEndpoint{}, ErrForeignKey
+	}
+	now := m.Now()
+	e := database.WebhookEndpoint{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Url:       arg.Url,
+		Secret:    arg.Secret,
+		Events:    slices.Clone(arg.Events),
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.d.endpoints = append(m.d.endpoints, e)
+	return e, nil
+}
+
+func (m *Memory) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	defer m.lock()()
+
+	for _, e := range m.d.endpoints {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return database.WebhookEndpoint{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error) {
+	defer m.lock()()
+
+	var endpoints []database.WebhookEndpoint
+	for _, e := range m.d.endpoints {
+		if e.UserID == userID {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints, nil
+}
+
+func (m *Memory) DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error) {
+	defer m.lock()()
+
+	before := len(m.d.endpoints)
+	m.d.endpoints = slices.DeleteFunc(m.d.endpoints, func(e database.WebhookEndpoint) bool {
+		return e.ID == arg.ID && e.UserID == arg.UserID
+	})
+	if len(m.d.endpoints) == before {
+		return 0, nil
+	}
+	m.d.deliveries = slices.DeleteFunc(m.d.deliveries, func(d database.WebhookDelivery) bool {
+		return d.EndpointID == arg.ID
+	})
+	return 1, nil
+}
+
+func (m *Memory) EnqueueWebhookDeliveries(ctx context.Context, arg database.EnqueueWebhookDeliveriesParams) (int64, error) {
+	defer m.lock()()
+
+	now := m.Now()
+	var n int64
+	for _, e := range m.d.endpoints {
+		if !e.Active || !slices.Contains(e.Events, arg.Event) {
+			continue
+		}
+		m.d.deliveries = append(m.d.deliveries, database.WebhookDelivery{
+			ID:            uuid.New(),
+			EndpointID:    e.ID,
+			Event:         arg.Event,
+			Payload:       arg.Payload,
+			Status:        "pending",
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+		n++
+	}
+	return n, nil
+}
+
+func (m *Memory) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	defer m.lock()()
+
+	now := m.Now()
+	var due []int
+	for i, d := range m.d.deliveries {
+		if d.Status == "pending" && !d.NextAttemptAt.After(now) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(a, b int) bool {
+		return m.d.deliveries[due[a]].NextAttemptAt.Before(m.d.deliveries[due[b]].NextAttemptAt)
+	})
+	if len(due) > int(arg.Batch) {
+		due = due[:arg.Batch]
+	}
+
+	claimed := make([]database.WebhookDelivery, 0, len(due))
+	for _, i := range due {
+		m.d.deliveries[i].NextAttemptAt = arg.LeaseUntil
+		m.d.deliveries[i].UpdatedAt = now
+		claimed = append(claimed, m.d.deliveries[i])
+	}
+	return claimed, nil
+}
+
+func (m *Memory) MarkWebhookDelivery(ctx context.Context, arg database.MarkWebhookDeliveryParams) error {
+	defer m.lock()()
+
+	for i, d := range m.d.deliveries {
+		if d.ID == arg.ID {
+			d.Status = arg.Status
+			d.Attempts = arg.Attempts
+			d.NextAttemptAt = arg.NextAttemptAt
+			d.LastStatusCode = arg.LastStatusCode
+			d.LastError = arg.LastError
+			d.UpdatedAt = m.Now()
+			m.d.deliveries[i] = d
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	defer m.lock()()
+
+	for _, d := range m.d.deliveries {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return database.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListWebhookDeliveriesByEndpoint(ctx context.Context, arg database.ListWebhookDeliveriesByEndpointParams) ([]database.WebhookDelivery, error) {
+	defer m.lock()()
+
+	var deliveries []database.WebhookDelivery
+	for i := len(m.d.deliveries) - 1; i >= 0 && len(deliveries) < int(arg.Limit); i-- {
+		if m.d.deliveries[i].EndpointID == arg.EndpointID {
+			deliveries = append(deliveries, m.d.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *Memory) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	defer m.lock()()
+
+	for i, d := range m.d.deliveries {
+		if d.ID == id && d.Status != "pending" {
+			now := m.Now()
+			d.Status = "pending"
+			d.Attempts = 0
+			d.NextAttemptAt = now
+			d.UpdatedAt = now
+			m.d.deliveries[i] = d
+			return d, nil
+		}
+	}
+	return database.WebhookDelivery{}, sql.ErrNoRows
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+func TestMemoryUsers(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	user, err := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a", HashedPassword: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.IsChirpyRed {
+		t.Error("expect a new user not to be red")
+	}
+
+	_, err = m.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           user.ID,
+		Plan:             "chirpy_red",
+		Status:           "active",
+		CurrentPeriodEnd: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.GetUserByEmailWithPassword(ctx, "a@example.com")
+	if err != nil || !got.IsChirpyRed {
+		t.Errorf("expect red user, got %v %v", got, err)
+	}
+
+	_, err = m.CreateChirp(ctx, database.CreateChirpParams{UserID: user.ID, Body: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteAllUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	chirps, _ := m.GetAllChirps(ctx, uuid.Nil)
+	if len(chirps) != 0 {
+		t.Errorf("expect chirps deleted with their users, got %d", len(chirps))
+	}
+	if _, err := m.GetUserByID(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expect sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestMemoryInTx(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+
+	failed := errors.New("failed")
+	err := m.InTx(ctx, func(q Queries) error {
+		if _, err := q.CreateChirp(ctx, database.CreateChirpParams{UserID: user.ID, Body: "rolled back"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expect the error of fn, got %v", err)
+	}
+	if chirps, _ := m.GetAllChirps(ctx, uuid.Nil); len(chirps) != 0 {
+		t.Errorf("expect rollback, got %d chirps", len(chirps))
+	}
+
+	err = m.InTx(ctx, func(q Queries) error {
+		_, err := q.CreateChirp(ctx, database.CreateChirpParams{UserID: user.ID, Body: "committed"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirps, _ := m.GetAllChirps(ctx, uuid.Nil); len(chirps) != 1 {
+		t.Errorf("expect 1 chirp, got %d", len(chirps))
+	}
+}
+
+func TestMemoryConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = m.InTx(ctx, func(q Queries) error {
+				_, err := q.CreateChirp(ctx, database.CreateChirpParams{UserID: user.ID, Body: "hi"})
+				return err
+			})
+			_, _ = m.GetAllChirps(ctx, uuid.Nil)
+		}()
+	}
+	wg.Wait()
+
+	n, _ := m.CountChirpsByUserSince(ctx, database.CountChirpsByUserSinceParams{UserID: user.ID})
+	if n != 50 {
+		t.Errorf("expect 50 chirps, got %d", n)
+	}
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Driver returns the database/sql driver and data source name of a DB_URL.
+// postgres:// and postgresql:// urls are Postgres, sqlite: urls are a SQLite
+// file: sqlite:chirpy.db and sqlite:///var/lib/chirpy/chirpy.db.
+func Driver(dbURL string) (driver, dsn string, err error) {
+	scheme, rest, ok := strings.Cut(dbURL, ":")
+	if !ok {
+		return "", "", fmt.Errorf("store: database url %q has no scheme", dbURL)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return "postgres", dbURL, nil
+
+	case "sqlite", "sqlite3":
+		path, query, _ := strings.Cut(strings.TrimPrefix(rest, "//"), "?")
+		if path == "" {
+			return "", "", fmt.Errorf("store: database url %q has no file", dbURL)
+		}
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			return "", "", fmt.Errorf("store: database url %q: %w", dbURL, err)
+		}
+		// the schema relies on foreign keys for its cascades, and the
+		// queries on times being written in a format that sorts as text
+		params.Add("_pragma", "foreign_keys(1)")
+		params.Add("_pragma", "busy_timeout(5000)")
+		params.Add("_pragma", "journal_mode(WAL)")
+		params.Set("_time_format", "sqlite")
+		params.Set("_txlock", "immediate")
+		return "sqlite", "file:" + path + "?" + params.Encode(), nil
+	}
+	return "", "", fmt.Errorf("store: unsupported database url scheme %q", scheme)
+}
+
+// Open opens the database of a DB_URL and returns it with its driver.
+func Open(dbURL string) (*sql.DB, string, error) {
+	driver, dsn, err := Driver(dbURL)
+	if err != nil {
+		return nil, "", err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	return db, driver, nil
+}
+
+// New returns the Store of a database opened with driver.
+func New(driver string, db *sql.DB) (Store, error) {
+	switch driver {
+	case "postgres":
+		return NewPostgres(db), nil
+	case "sqlite":
+		return NewSQLite(db), nil
+	}
+	return nil, fmt.Errorf("store: unsupported driver %q", driver)
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	_ "github.com/lib/pq"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+// the sqlc queries are the Postgres implementation of every query
+var _ Queries = (*database.Queries)(nil)
+
+// Postgres is the Store of a Postgres database.
+type Postgres struct {
+	*database.Queries
+	DB *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{Queries: database.New(db), DB: db}
+}
+
+func (p *Postgres) InTx(ctx context.Context, fn func(q Queries) error) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(p.Queries.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.DB.PingContext(ctx)
+}
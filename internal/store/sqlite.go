@@ -0,0 +1,773 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/sqlitedb"
+)
+
+// sqliteTimeFormat is how times are written with _time_format=sqlite. In UTC
+// the text of two times sorts like the times, which the queries rely on.
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// The SQLite queries keep the Postgres gen_random_uuid() and now().
+func init() {
+	err := sqlite.RegisterScalarFunction("gen_random_uuid", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = sqlite.RegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeFormat), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// SQLite is the Store of a SQLite database, opened with the data source name
+// of Driver.
+type SQLite struct {
+	sqliteQueries
+	DB *sql.DB
+}
+
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{sqliteQueries: sqliteQueries{q: sqlitedb.New(db)}, DB: db}
+}
+
+func (s *SQLite) InTx(ctx context.Context, fn func(q Queries) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(sqliteQueries{q: s.q.WithTx(tx)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+// sqliteQueries adapts the sqlc SQLite queries to the Postgres types.
+type sqliteQueries struct {
+	q *sqlitedb.Queries
+}
+
+var _ Queries = sqliteQueries{}
+
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func utcNull(t sql.NullTime) sql.NullTime {
+	t.Time = t.Time.UTC()
+	return t
+}
+
+func convertAll[T, U any](rows []T, err error, convert func(T) U) ([]U, error) {
+	if err != nil {
+		return nil, err
+	}
+	out := make([]U, len(rows))
+	for i, row := range rows {
+		out[i] = convert(row)
+	}
+	return out, nil
+}
+
+// users
+
+// sqlc drops the is_chirpy_red alias of a SQLite RETURNING, so the column is
+// Column7 of CreateUser and UpdateUserEmailAndPassword.
+func (s sqliteQueries) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	row, err := s.q.CreateUser(ctx, sqlitedb.CreateUserParams(arg))
+	return database.CreateUserRow{
+		ID:             row.ID,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+		Email:          row.Email,
+		HashedPassword: row.HashedPassword,
+		Handle:         row.Handle,
+		IsChirpyRed:    row.Column7,
+	}, err
+}
+
+func (s sqliteQueries) GetUserByID(ctx context.Context, id uuid.UUID) (database.GetUserByIDRow, error) {
+	row, err := s.q.GetUserByID(ctx, id)
+	return database.GetUserByIDRow(row), err
+}
+
+func (s sqliteQueries) LockUser(ctx context.Context, id uuid.UUID) error {
+	return s.q.LockUser(ctx, id)
+}
+
+func (s sqliteQueries) GetUserByEmailWithPassword(ctx context.Context, email string) (database.GetUserByEmailWithPasswordRow, error) {
+	row, err := s.q.GetUserByEmailWithPassword(ctx, email)
+	return database.GetUserByEmailWithPasswordRow(row), err
+}
+
+func (s sqliteQueries) UpdateUserEmailAndPassword(ctx context.Context, arg database.UpdateUserEmailAndPasswordParams) (database.UpdateUserEmailAndPasswordRow, error) {
+	row, err := s.q.UpdateUserEmailAndPassword(ctx, sqlitedb.UpdateUserEmailAndPasswordParams{
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		ID:             arg.ID,
+	})
+	return database.UpdateUserEmailAndPasswordRow{
+		ID:             row.ID,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+		Email:          row.Email,
+		HashedPassword: row.HashedPassword,
+		Handle:         row.Handle,
+		IsChirpyRed:    row.Column7,
+	}, err
+}
+
+func (s sqliteQueries) UpdateUserHandle(ctx context.Context, arg database.UpdateUserHandleParams) error {
+	return s.q.UpdateUserHandle(ctx, sqlitedb.UpdateUserHandleParams{Handle: arg.Handle, ID: arg.ID})
+}
+
+func (s sqliteQueries) DeleteAllUsers(ctx context.Context) error {
+	return s.q.DeleteAllUsers(ctx)
+}
+
+// The handles go in as one string, sqlc can't expand a slice compared to an
+// expression. Handles have no commas.
+func (s sqliteQueries) GetUserIDsByHandles(ctx context.Context, handles []string) ([]uuid.UUID, error) {
+	return s.q.GetUserIDsByHandles(ctx, ","+strings.Join(handles, ",")+",")
+}
+
+// chirps
+
+func chirpFromSQLite(c sqlitedb.Chirp) database.Chirp {
+	return database.Chirp(c)
+}
+
+func (s sqliteQueries) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	chirp, err := s.q.CreateChirp(ctx, sqlitedb.CreateChirpParams(arg))
+	return database.Chirp(chirp), err
+}
+
+func (s sqliteQueries) GetAChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := s.q.GetAChirp(ctx, id)
+	return database.Chirp(chirp), err
+}
+
+func (s sqliteQueries) GetVisibleChirp(ctx context.Context, arg database.GetVisibleChirpParams) (database.Chirp, error) {
+	chirp, err := s.q.GetVisibleChirp(ctx, sqlitedb.GetVisibleChirpParams(arg))
+	return database.Chirp(chirp), err
+}
+
+func (s sqliteQueries) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	chirps, err := s.q.GetAllChirps(ctx, viewerID)
+	return convertAll(chirps, err, chirpFromSQLite)
+}
+
+func (s sqliteQueries) GetAllChirpsByUser(ctx context.Context, arg database.GetAllChirpsByUserParams) ([]database.Chirp, error) {
+	chirps, err := s.q.GetAllChirpsByUser(ctx, sqlitedb.GetAllChirpsByUserParams(arg))
+	return convertAll(chirps, err, chirpFromSQLite)
+}
+
+func (s sqliteQueries) UpdateChirpBody(ctx context.Context, arg database.UpdateChirpBodyParams) (database.Chirp, error) {
+	chirp, err := s.q.UpdateChirpBody(ctx, sqlitedb.UpdateChirpBodyParams{Body: arg.Body, Held: arg.Held, ID: arg.ID})
+	return database.Chirp(chirp), err
+}
+
+func (s sqliteQueries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteChirp(ctx, id)
+}
+
+func (s sqliteQueries) CountChirpsByUserSince(ctx context.Context, arg database.CountChirpsByUserSinceParams) (int64, error) {
+	return s.q.CountChirpsByUserSince(ctx, sqlitedb.CountChirpsByUserSinceParams{
+		UserID:    arg.UserID,
+		CreatedAt: utc(arg.CreatedAt),
+	})
+}
+
+func (s sqliteQueries) PinChirp(ctx context.Context, arg database.PinChirpParams) error {
+	return s.q.PinChirp(ctx, sqlitedb.PinChirpParams(arg))
+}
+
+func (s sqliteQueries) UnpinChirp(ctx context.Context, arg database.UnpinChirpParams) error {
+	return s.q.UnpinChirp(ctx, sqlitedb.UnpinChirpParams(arg))
+}
+
+func (s sqliteQueries) IsChirpPinned(ctx context.Context, arg database.IsChirpPinnedParams) (bool, error) {
+	pinned, err := s.q.IsChirpPinned(ctx, sqlitedb.IsChirpPinnedParams(arg))
+	return pinned != 0, err
+}
+
+func (s sqliteQueries) CountPinnedChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.CountPinnedChirps(ctx, userID)
+}
+
+func (s sqliteQueries) GetPinnedChirpsByUser(ctx context.Context, arg database.GetPinnedChirpsByUserParams) ([]database.Chirp, error) {
+	chirps, err := s.q.GetPinnedChirpsByUser(ctx, sqlitedb.GetPinnedChirpsByUserParams(arg))
+	return convertAll(chirps, err, chirpFromSQLite)
+}
+
+func (s sqliteQueries) ListHeldChirps(ctx context.Context, arg database.ListHeldChirpsParams) ([]database.Chirp, error) {
+	chirps, err := s.q.ListHeldChirps(ctx, sqlitedb.ListHeldChirpsParams{
+		After:   utc(arg.After),
+		AfterID: arg.AfterID,
+		MaxRows: int64(arg.MaxRows),
+	})
+	return convertAll(chirps, err, chirpFromSQLite)
+}
+
+func (s sqliteQueries) ReleaseChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := s.q.ReleaseChirp(ctx, id)
+	return database.Chirp(chirp), err
+}
+
+// follows
+
+func (s sqliteQueries) FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error) {
+	return s.q.FollowUser(ctx, sqlitedb.FollowUserParams(arg))
+}
+
+func (s sqliteQueries) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	return s.q.UnfollowUser(ctx, sqlitedb.UnfollowUserParams(arg))
+}
+
+func (s sqliteQueries) GetFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error) {
+	return s.q.GetFolloweeIDs(ctx, followerID)
+}
+
+func (s sqliteQueries) IsFollowing(ctx context.Context, arg database.IsFollowingParams) (bool, error) {
+	following, err := s.q.IsFollowing(ctx, sqlitedb.IsFollowingParams(arg))
+	return following != 0, err
+}
+
+// blocks
+
+func (s sqliteQueries) BlockUser(ctx context.Context, arg database.BlockUserParams) (int64, error) {
+	return s.q.BlockUser(ctx, sqlitedb.BlockUserParams(arg))
+}
+
+func (s sqliteQueries) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	return s.q.UnblockUser(ctx, sqlitedb.UnblockUserParams(arg))
+}
+
+func blockFromSQLite(b sqlitedb.Block) database.Block {
+	return database.Block(b)
+}
+
+func (s sqliteQueries) ListBlocks(ctx context.Context, blockerID uuid.UUID) ([]database.Block, error) {
+	blocks, err := s.q.ListBlocks(ctx, blockerID)
+	return convertAll(blocks, err, blockFromSQLite)
+}
+
+func (s sqliteQueries) IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error) {
+	blocked, err := s.q.IsBlockedBetween(ctx, sqlitedb.IsBlockedBetweenParams(arg))
+	return blocked != 0, err
+}
+
+func (s sqliteQueries) MuteUser(ctx context.Context, arg database.MuteUserParams) (int64, error) {
+	return s.q.MuteUser(ctx, sqlitedb.MuteUserParams(arg))
+}
+
+func (s sqliteQueries) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	return s.q.UnmuteUser(ctx, sqlitedb.UnmuteUserParams(arg))
+}
+
+func muteFromSQLite(m sqlitedb.Mute) database.Mute {
+	return database.Mute(m)
+}
+
+func (s sqliteQueries) ListMutes(ctx context.Context, muterID uuid.UUID) ([]database.Mute, error) {
+	mutes, err := s.q.ListMutes(ctx, muterID)
+	return convertAll(mutes, err, muteFromSQLite)
+}
+
+func (s sqliteQueries) GetHiddenUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return s.q.GetHiddenUserIDs(ctx, userID)
+}
+
+// messages
+
+func (s sqliteQueries) CreateConversation(ctx context.Context, arg database.CreateConversationParams) (database.Conversation, error) {
+	c, err := s.q.CreateConversation(ctx, sqlitedb.CreateConversationParams(arg))
+	return database.Conversation(c), err
+}
+
+func (s sqliteQueries) GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error) {
+	c, err := s.q.GetConversation(ctx, id)
+	return database.Conversation(c), err
+}
+
+func (s sqliteQueries) GetConversationByDirectKey(ctx context.Context, directKey sql.NullString) (database.Conversation, error) {
+	c, err := s.q.GetConversationByDirectKey(ctx, directKey)
+	return database.Conversation(c), err
+}
+
+func (s sqliteQueries) AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error {
+	return s.q.AddConversationMember(ctx, sqlitedb.AddConversationMemberParams(arg))
+}
+
+func (s sqliteQueries) GetConversationMember(ctx context.Context, arg database.GetConversationMemberParams) (database.ConversationMember, error) {
+	member, err := s.q.GetConversationMember(ctx, sqlitedb.GetConversationMemberParams(arg))
+	return database.ConversationMember(member), err
+}
+
+func conversationRowFromSQLite(row sqlitedb.ListConversationsByUserRow) database.ListConversationsByUserRow {
+	return database.ListConversationsByUserRow(row)
+}
+
+func (s sqliteQueries) ListConversationsByUser(ctx context.Context, arg database.ListConversationsByUserParams) ([]database.ListConversationsByUserRow, error) {
+	rows, err := s.q.ListConversationsByUser(ctx, sqlitedb.ListConversationsByUserParams{
+		UserID:   arg.UserID,
+		Before:   utc(arg.Before),
+		BeforeID: arg.BeforeID,
+		MaxRows:  int64(arg.MaxRows),
+	})
+	return convertAll(rows, err, conversationRowFromSQLite)
+}
+
+func (s sqliteQueries) ListConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]uuid.UUID, error) {
+	return s.q.ListConversationMembers(ctx, conversationID)
+}
+
+func memberRowFromSQLite(row sqlitedb.ListConversationMembersByUserRow) database.ListConversationMembersByUserRow {
+	return database.ListConversationMembersByUserRow(row)
+}
+
+func (s sqliteQueries) ListConversationMembersByUser(ctx context.Context, userID uuid.UUID) ([]database.ListConversationMembersByUserRow, error) {
+	rows, err := s.q.ListConversationMembersByUser(ctx, userID)
+	return convertAll(rows, err, memberRowFromSQLite)
+}
+
+func messageFromSQLite(m sqlitedb.Message) database.Message {
+	return database.Message(m)
+}
+
+func (s sqliteQueries) CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error) {
+	m, err := s.q.CreateMessage(ctx, sqlitedb.CreateMessageParams(arg))
+	return database.Message(m), err
+}
+
+func (s sqliteQueries) TouchConversation(ctx context.Context, id uuid.UUID) error {
+	return s.q.TouchConversation(ctx, id)
+}
+
+func (s sqliteQueries) ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error) {
+	messages, err := s.q.ListMessages(ctx, sqlitedb.ListMessagesParams{
+		ConversationID: arg.ConversationID,
+		Before:         utc(arg.Before),
+		BeforeID:       arg.BeforeID,
+		MaxRows:        int64(arg.MaxRows),
+	})
+	return convertAll(messages, err, messageFromSQLite)
+}
+
+func (s sqliteQueries) MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error {
+	return s.q.MarkConversationRead(ctx, sqlitedb.MarkConversationReadParams(arg))
+}
+
+func (s sqliteQueries) GetMessageSettings(ctx context.Context, userID uuid.UUID) (database.MessageSetting, error) {
+	settings, err := s.q.GetMessageSettings(ctx, userID)
+	return database.MessageSetting(settings), err
+}
+
+func (s sqliteQueries) SetMessageSettings(ctx context.Context, arg database.SetMessageSettingsParams) (database.MessageSetting, error) {
+	settings, err := s.q.SetMessageSettings(ctx, sqlitedb.SetMessageSettingsParams(arg))
+	return database.MessageSetting(settings), err
+}
+
+// moderation
+
+func reportFromSQLite(r sqlitedb.Report) database.Report {
+	return database.Report(r)
+}
+
+func (s sqliteQueries) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error) {
+	r, err := s.q.CreateReport(ctx, sqlitedb.CreateReportParams(arg))
+	return database.Report(r), err
+}
+
+func (s sqliteQueries) GetReport(ctx context.Context, id uuid.UUID) (database.Report, error) {
+	r, err := s.q.GetReport(ctx, id)
+	return database.Report(r), err
+}
+
+func (s sqliteQueries) ListReports(ctx context.Context, arg database.ListReportsParams) ([]database.Report, error) {
+	reports, err := s.q.ListReports(ctx, sqlitedb.ListReportsParams{
+		Status:  arg.Status,
+		After:   utc(arg.After),
+		AfterID: arg.AfterID,
+		MaxRows: int64(arg.MaxRows),
+	})
+	return convertAll(reports, err, reportFromSQLite)
+}
+
+func (s sqliteQueries) ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error) {
+	r, err := s.q.ClaimReport(ctx, sqlitedb.ClaimReportParams(arg))
+	return database.Report(r), err
+}
+
+func (s sqliteQueries) CloseReport(ctx context.Context, arg database.CloseReportParams) (database.Report, error) {
+	r, err := s.q.CloseReport(ctx, sqlitedb.CloseReportParams(arg))
+	return database.Report(r), err
+}
+
+func (s sqliteQueries) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationLog, error) {
+	e, err := s.q.CreateModerationAction(ctx, sqlitedb.CreateModerationActionParams(arg))
+	return database.ModerationLog(e), err
+}
+
+func moderationLogFromSQLite(e sqlitedb.ModerationLog) database.ModerationLog {
+	return database.ModerationLog(e)
+}
+
+func (s sqliteQueries) ListModerationLog(ctx context.Context, arg database.ListModerationLogParams) ([]database.ModerationLog, error) {
+	entries, err := s.q.ListModerationLog(ctx, sqlitedb.ListModerationLogParams{
+		Before:   utc(arg.Before),
+		BeforeID: arg.BeforeID,
+		MaxRows:  int64(arg.MaxRows),
+	})
+	return convertAll(entries, err, moderationLogFromSQLite)
+}
+
+func (s sqliteQueries) IsModerator(ctx context.Context, userID uuid.UUID) (bool, error) {
+	mod, err := s.q.IsModerator(ctx, userID)
+	return mod != 0, err
+}
+
+func (s sqliteQueries) AddModerator(ctx context.Context, userID uuid.UUID) error {
+	return s.q.AddModerator(ctx, userID)
+}
+
+func (s sqliteQueries) RemoveModerator(ctx context.Context, userID uuid.UUID) error {
+	return s.q.RemoveModerator(ctx, userID)
+}
+
+// suspensions
+
+func (s sqliteQueries) CreateSuspension(ctx context.Context, arg database.CreateSuspensionParams) (database.Suspension, error) {
+	arg.ExpiresAt = utcNull(arg.ExpiresAt)
+	susp, err := s.q.CreateSuspension(ctx, sqlitedb.CreateSuspensionParams(arg))
+	return database.Suspension(susp), err
+}
+
+func suspensionFromSQLite(susp sqlitedb.Suspension) database.Suspension {
+	return database.Suspension(susp)
+}
+
+func (s sqliteQueries) GetActiveSuspension(ctx context.Context, userID uuid.UUID) (database.Suspension, error) {
+	susp, err := s.q.GetActiveSuspension(ctx, userID)
+	return database.Suspension(susp), err
+}
+
+func (s sqliteQueries) ListSuspensionsByUser(ctx context.Context, userID uuid.UUID) ([]database.Suspension, error) {
+	suspensions, err := s.q.ListSuspensionsByUser(ctx, userID)
+	return convertAll(suspensions, err, suspensionFromSQLite)
+}
+
+func (s sqliteQueries) LiftSuspensions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.LiftSuspensions(ctx, userID)
+}
+
+// filter rules
+
+func (s sqliteQueries) CreateFilterRule(ctx context.Context, arg database.CreateFilterRuleParams) (database.FilterRule, error) {
+	r, err := s.q.CreateFilterRule(ctx, sqlitedb.CreateFilterRuleParams(arg))
+	return database.FilterRule(r), err
+}
+
+func (s sqliteQueries) GetFilterRule(ctx context.Context, id uuid.UUID) (database.FilterRule, error) {
+	r, err := s.q.GetFilterRule(ctx, id)
+	return database.FilterRule(r), err
+}
+
+func filterRuleFromSQLite(r sqlitedb.FilterRule) database.FilterRule {
+	return database.FilterRule(r)
+}
+
+func (s sqliteQueries) ListFilterRules(ctx context.Context) ([]database.FilterRule, error) {
+	rules, err := s.q.ListFilterRules(ctx)
+	return convertAll(rules, err, filterRuleFromSQLite)
+}
+
+func (s sqliteQueries) UpdateFilterRule(ctx context.Context, arg database.UpdateFilterRuleParams) (database.FilterRule, error) {
+	r, err := s.q.UpdateFilterRule(ctx, sqlitedb.UpdateFilterRuleParams{
+		Kind:    arg.Kind,
+		Pattern: arg.Pattern,
+		Action:  arg.Action,
+		ID:      arg.ID,
+	})
+	return database.FilterRule(r), err
+}
+
+func (s sqliteQueries) DeleteFilterRule(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.DeleteFilterRule(ctx, id)
+}
+
+// media
+
+func (s sqliteQueries) CreateMedia(ctx context.Context, arg database.CreateMediaParams) (database.Media, error) {
+	md, err := s.q.CreateMedia(ctx, sqlitedb.CreateMediaParams(arg))
+	return database.Media(md), err
+}
+
+func (s sqliteQueries) GetMedia(ctx context.Context, id uuid.UUID) (database.Media, error) {
+	md, err := s.q.GetMedia(ctx, id)
+	return database.Media(md), err
+}
+
+func (s sqliteQueries) AttachMedia(ctx context.Context, arg database.AttachMediaParams) (int64, error) {
+	return s.q.AttachMedia(ctx, sqlitedb.AttachMediaParams(arg))
+}
+
+func mediaFromSQLite(md sqlitedb.Media) database.Media {
+	return database.Media(md)
+}
+
+func (s sqliteQueries) ListMediaByChirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.Media, error) {
+	ids := make([]uuid.NullUUID, len(chirpIds))
+	for i, id := range chirpIds {
+		ids[i] = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	media, err := s.q.ListMediaByChirps(ctx, ids)
+	return convertAll(media, err, mediaFromSQLite)
+}
+
+func (s sqliteQueries) ListAllMedia(ctx context.Context) ([]database.Media, error) {
+	media, err := s.q.ListAllMedia(ctx)
+	return convertAll(media, err, mediaFromSQLite)
+}
+
+func (s sqliteQueries) ListUnattachedMedia(ctx context.Context, createdAt time.Time) ([]database.Media, error) {
+	media, err := s.q.ListUnattachedMedia(ctx, utc(createdAt))
+	return convertAll(media, err, mediaFromSQLite)
+}
+
+func (s sqliteQueries) DeleteUnattachedMedia(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.DeleteUnattachedMedia(ctx, id)
+}
+
+// notifications
+
+func notificationFromSQLite(n sqlitedb.Notification) database.Notification {
+	return database.Notification(n)
+}
+
+func (s sqliteQueries) CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error) {
+	n, err := s.q.CreateNotification(ctx, sqlitedb.CreateNotificationParams(arg))
+	return database.Notification(n), err
+}
+
+func (s sqliteQueries) ListNotifications(ctx context.Context, arg database.ListNotificationsParams) ([]database.Notification, error) {
+	notifications, err := s.q.ListNotifications(ctx, sqlitedb.ListNotificationsParams{
+		UserID:   arg.UserID,
+		Before:   utc(arg.Before),
+		BeforeID: arg.BeforeID,
+		MaxRows:  int64(arg.MaxRows),
+	})
+	return convertAll(notifications, err, notificationFromSQLite)
+}
+
+func (s sqliteQueries) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.CountUnreadNotifications(ctx, userID)
+}
+
+func (s sqliteQueries) MarkNotificationRead(ctx context.Context, arg database.MarkNotificationReadParams) (int64, error) {
+	return s.q.MarkNotificationRead(ctx, sqlitedb.MarkNotificationReadParams(arg))
+}
+
+func (s sqliteQueries) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.MarkAllNotificationsRead(ctx, userID)
+}
+
+func preferenceFromSQLite(p sqlitedb.NotificationPreference) database.NotificationPreference {
+	return database.NotificationPreference(p)
+}
+
+func (s sqliteQueries) GetNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error) {
+	prefs, err := s.q.GetNotificationPreferences(ctx, userID)
+	return convertAll(prefs, err, preferenceFromSQLite)
+}
+
+func (s sqliteQueries) SetNotificationPreference(ctx context.Context, arg database.SetNotificationPreferenceParams) error {
+	return s.q.SetNotificationPreference(ctx, sqlitedb.SetNotificationPreferenceParams(arg))
+}
+
+// tokens
+
+func (s sqliteQueries) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	token, err := s.q.CreateRefreshToken(ctx, sqlitedb.CreateRefreshTokenParams{
+		Token:     arg.Token,
+		ExpiresAt: utc(arg.ExpiresAt),
+		UserID:    arg.UserID,
+	})
+	return database.RefreshToken(token), err
+}
+
+func (s sqliteQueries) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	row, err := s.q.GetRefreshToken(ctx, token)
+	return database.RefreshToken(row), err
+}
+
+func (s sqliteQueries) RevokeToken(ctx context.Context, token string) error {
+	return s.q.RevokeToken(ctx, token)
+}
+
+func (s sqliteQueries) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.q.RevokeUserTokens(ctx, userID)
+}
+
+// subscriptions
+
+func (s sqliteQueries) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.q.GetSubscriptionByUser(ctx, userID)
+	return database.Subscription(sub), err
+}
+
+func (s sqliteQueries) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	sub, err := s.q.UpsertSubscription(ctx, sqlitedb.UpsertSubscriptionParams{
+		UserID:             arg.UserID,
+		Plan:               arg.Plan,
+		Status:             arg.Status,
+		CurrentPeriodStart: utc(arg.CurrentPeriodStart),
+		CurrentPeriodEnd:   utc(arg.CurrentPeriodEnd),
+		GraceUntil:         utcNull(arg.GraceUntil),
+	})
+	return database.Subscription(sub), err
+}
+
+func (s sqliteQueries) ExpireLapsedSubscriptions(ctx context.Context) (int64, error) {
+	return s.q.ExpireLapsedSubscriptions(ctx)
+}
+
+// webhook events
+
+func webhookEventFromSQLite(e sqlitedb.WebhookEvent) database.WebhookEvent {
+	return database.WebhookEvent(e)
+}
+
+func (s sqliteQueries) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (database.WebhookEvent, error) {
+	event, err := s.q.CreateWebhookEvent(ctx, sqlitedb.CreateWebhookEventParams(arg))
+	return database.WebhookEvent(event), err
+}
+
+func (s sqliteQueries) GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	event, err := s.q.GetWebhookEvent(ctx, id)
+	return database.WebhookEvent(event), err
+}
+
+func (s sqliteQueries) MarkWebhookEvent(ctx context.Context, arg database.MarkWebhookEventParams) error {
+	return s.q.MarkWebhookEvent(ctx, sqlitedb.MarkWebhookEventParams{Status: arg.Status, ID: arg.ID})
+}
+
+func (s sqliteQueries) ListWebhookEvents(ctx context.Context, arg database.ListWebhookEventsParams) ([]database.WebhookEvent, error) {
+	events, err := s.q.ListWebhookEvents(ctx, sqlitedb.ListWebhookEventsParams{
+		Source: arg.Source,
+		Limit:  int64(arg.Limit),
+	})
+	return convertAll(events, err, webhookEventFromSQLite)
+}
+
+// webhooks
+
+// endpointFromSQLite decodes the events, stored as a JSON array.
+func endpointFromSQLite(e sqlitedb.WebhookEndpoint) database.WebhookEndpoint {
+	var events []string
+	_ = json.Unmarshal([]byte(e.Events), &events)
+	return database.WebhookEndpoint{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		Url:       e.Url,
+		Secret:    e.Secret,
+		Events:    events,
+		Active:    e.Active,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+func deliveryFromSQLite(d sqlitedb.WebhookDelivery) database.WebhookDelivery {
+	return database.WebhookDelivery(d)
+}
+
+func (s sqliteQueries) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	events, err := json.Marshal(arg.Events)
+	if err != nil {
+		return database.WebhookEndpoint{}, err
+	}
+	endpoint, err := s.q.CreateWebhookEndpoint(ctx, sqlitedb.CreateWebhookEndpointParams{
+		UserID: arg.UserID,
+		Url:    arg.Url,
+		Secret: arg.Secret,
+		Events: string(events),
+	})
+	return endpointFromSQLite(endpoint), err
+}
+
+func (s sqliteQueries) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	endpoint, err := s.q.GetWebhookEndpoint(ctx, id)
+	return endpointFromSQLite(endpoint), err
+}
+
+func (s sqliteQueries) ListWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error) {
+	endpoints, err := s.q.ListWebhookEndpointsByUser(ctx, userID)
+	return convertAll(endpoints, err, endpointFromSQLite)
+}
+
+func (s sqliteQueries) DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error) {
+	return s.q.DeleteWebhookEndpoint(ctx, sqlitedb.DeleteWebhookEndpointParams(arg))
+}
+
+func (s sqliteQueries) EnqueueWebhookDeliveries(ctx context.Context, arg database.EnqueueWebhookDeliveriesParams) (int64, error) {
+	return s.q.EnqueueWebhookDeliveries(ctx, sqlitedb.EnqueueWebhookDeliveriesParams(arg))
+}
+
+func (s sqliteQueries) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	deliveries, err := s.q.ClaimWebhookDeliveries(ctx, sqlitedb.ClaimWebhookDeliveriesParams{
+		LeaseUntil: utc(arg.LeaseUntil),
+		Batch:      int64(arg.Batch),
+	})
+	return convertAll(deliveries, err, deliveryFromSQLite)
+}
+
+func (s sqliteQueries) MarkWebhookDelivery(ctx context.Context, arg database.MarkWebhookDeliveryParams) error {
+	return s.q.MarkWebhookDelivery(ctx, sqlitedb.MarkWebhookDeliveryParams{
+		Status:         arg.Status,
+		Attempts:       arg.Attempts,
+		NextAttemptAt:  utc(arg.NextAttemptAt),
+		LastStatusCode: arg.LastStatusCode,
+		LastError:      arg.LastError,
+		ID:             arg.ID,
+	})
+}
+
+func (s sqliteQueries) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	delivery, err := s.q.GetWebhookDelivery(ctx, id)
+	return database.WebhookDelivery(delivery), err
+}
+
+func (s sqliteQueries) ListWebhookDeliveriesByEndpoint(ctx context.Context, arg database.ListWebhookDeliveriesByEndpointParams) ([]database.WebhookDelivery, error) {
+	deliveries, err := s.q.ListWebhookDeliveriesByEndpoint(ctx, sqlitedb.ListWebhookDeliveriesByEndpointParams{
+		EndpointID: arg.EndpointID,
+		Limit:      int64(arg.Limit),
+	})
+	return convertAll(deliveries, err, deliveryFromSQLite)
+}
+
+func (s sqliteQueries) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	delivery, err := s.q.RedeliverWebhookDelivery(ctx, id)
+	return database.WebhookDelivery(delivery), err
+}
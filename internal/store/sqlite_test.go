@@ -0,0 +1,746 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+	"github.com/dubbersthehoser/httpserver/internal/migrate"
+)
+
+func newSQLite(t *testing.T) *SQLite {
+	t.Helper()
+
+	db, driver, err := Open("sqlite:" + filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrate.New(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLite(db)
+}
+
+func TestDriver(t *testing.T) {
+	tests := []struct {
+		url    string
+		driver string
+		file   string
+	}{
+		{"postgres://chirpy@localhost/chirpy", "postgres", ""},
+		{"postgresql://chirpy@localhost/chirpy", "postgres", ""},
+		{"sqlite:chirpy.db", "sqlite", "file:chirpy.db?"},
+		{"sqlite:///var/lib/chirpy/chirpy.db", "sqlite", "file:/var/lib/chirpy/chirpy.db?"},
+		{"mysql://localhost/chirpy", "", ""},
+		{"sqlite:", "", ""},
+		{"chirpy.db", "", ""},
+	}
+	for _, test := range tests {
+		driver, dsn, err := Driver(test.url)
+		if test.driver == "" {
+			if err == nil {
+				t.Errorf("%s: expect an error", test.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.url, err)
+			continue
+		}
+		if driver != test.driver {
+			t.Errorf("%s: expect driver %s, got %s", test.url, test.driver, driver)
+		}
+		if test.file != "" && dsn[:len(test.file)] != test.file {
+			t.Errorf("%s: expect dsn of %s, got %s", test.url, test.file, dsn)
+		}
+	}
+}
+
+func TestSQLiteUsers(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+
+	user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a", HashedPassword: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.IsChirpyRed || user.CreatedAt.IsZero() {
+		t.Errorf("unexpected new user %#v", user)
+	}
+
+	_, err = s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           user.ID,
+		Plan:             "chirpy_red",
+		Status:           "active",
+		CurrentPeriodEnd: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetUserByEmailWithPassword(ctx, "a@example.com")
+	if err != nil || !got.IsChirpyRed || got.ID != user.ID {
+		t.Errorf("expect red user, got %v %v", got, err)
+	}
+
+	// a lapsed subscription isn't red, whatever the local time zone
+	_, err = s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           user.ID,
+		Plan:             "chirpy_red",
+		Status:           "active",
+		CurrentPeriodEnd: time.Now().In(time.FixedZone("ahead", 14*60*60)).Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetUserByID(ctx, user.ID); got.IsChirpyRed {
+		t.Error("expect a lapsed subscription not to be red")
+	}
+
+	_, err = s.CreateChirp(ctx, database.CreateChirpParams{UserID: user.ID, Body: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAllUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	chirps, _ := s.GetAllChirps(ctx, uuid.Nil)
+	if len(chirps) != 0 {
+		t.Errorf("expect chirps deleted with their users, got %d", len(chirps))
+	}
+	if _, err := s.GetUserByID(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expect sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestSQLiteHandles(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+
+	// the users from before the handles get theirs from their email
+	m, err := migrate.New(s.DB, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, email := range []string{"Walt@example.com", "walt@example.org", "@example.com"} {
+		_, err := s.DB.ExecContext(ctx, "INSERT INTO users (id, created_at, updated_at, email) VALUES (?, ?, ?, ?)",
+			uuid.New(), time.Now().Add(time.Duration(i)*time.Second).UTC().Format(sqliteTimeFormat), time.Now().UTC().Format(sqliteTimeFormat), email)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.GetUserByEmailWithPassword(ctx, "Walt@example.com")
+	second, _ := s.GetUserByEmailWithPassword(ctx, "walt@example.org")
+	empty, _ := s.GetUserByEmailWithPassword(ctx, "@example.com")
+	if first.Handle != "walt" || !strings.HasPrefix(second.Handle, "walt_") || empty.Handle != "user" {
+		t.Errorf("expect walt, walt_<id> and user, got %q %q %q", first.Handle, second.Handle, empty.Handle)
+	}
+
+	if _, err := s.CreateUser(ctx, database.CreateUserParams{Email: "w@example.net", Handle: "walt"}); err == nil {
+		t.Error("expect a taken handle refused")
+	}
+	err = s.UpdateUserHandle(ctx, database.UpdateUserHandleParams{ID: second.ID, Handle: "walter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := s.GetUserIDsByHandles(ctx, []string{"walter", "walt"}); len(ids) != 2 {
+		t.Errorf("expect walter and walt, got %v", ids)
+	}
+}
+
+func TestSQLiteChirps(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+
+	since := time.Now().Add(-time.Second)
+	for _, body := range []string{"one", "two"} {
+		if _, err := s.CreateChirp(ctx, database.CreateChirpParams{UserID: user.ID, Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chirps, err := s.GetAllChirpsByUser(ctx, database.GetAllChirpsByUserParams{UserID: user.ID})
+	if err != nil || len(chirps) != 2 || chirps[0].Body != "one" {
+		t.Fatalf("expect 2 chirps oldest first, got %v %v", chirps, err)
+	}
+
+	n, err := s.CountChirpsByUserSince(ctx, database.CountChirpsByUserSinceParams{UserID: user.ID, CreatedAt: since})
+	if err != nil || n != 2 {
+		t.Errorf("expect 2 chirps since, got %d %v", n, err)
+	}
+	n, _ = s.CountChirpsByUserSince(ctx, database.CountChirpsByUserSinceParams{UserID: user.ID, CreatedAt: time.Now().Add(time.Second)})
+	if n != 0 {
+		t.Errorf("expect no chirps since later, got %d", n)
+	}
+
+	if err := s.PinChirp(ctx, database.PinChirpParams{UserID: user.ID, ChirpID: chirps[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+	pinned, _ := s.GetPinnedChirpsByUser(ctx, database.GetPinnedChirpsByUserParams{UserID: user.ID})
+	if len(pinned) != 1 || pinned[0].ID != chirps[1].ID {
+		t.Errorf("expect chirp two pinned, got %v", pinned)
+	}
+
+	_, err = s.CreateChirp(ctx, database.CreateChirpParams{UserID: chirps[0].ID, Body: "no user"})
+	if err == nil {
+		t.Error("expect a foreign key error")
+	}
+}
+
+func TestSQLiteFollows(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+	b, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", Handle: "b"})
+
+	for i, want := range []int64{1, 0} {
+		n, err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: a.ID, FolloweeID: b.ID})
+		if err != nil || n != want {
+			t.Errorf("follow %d: expect %d rows, got %d %v", i, want, n, err)
+		}
+	}
+	ids, err := s.GetFolloweeIDs(ctx, a.ID)
+	if err != nil || len(ids) != 1 || ids[0] != b.ID {
+		t.Errorf("expect a to follow b once, got %v %v", ids, err)
+	}
+	if following, err := s.IsFollowing(ctx, database.IsFollowingParams{FollowerID: a.ID, FolloweeID: b.ID}); !following || err != nil {
+		t.Errorf("expect a following b, got %v %v", following, err)
+	}
+	if following, _ := s.IsFollowing(ctx, database.IsFollowingParams{FollowerID: b.ID, FolloweeID: a.ID}); following {
+		t.Error("expect b not following a")
+	}
+	if _, err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: a.ID, FolloweeID: a.ID}); err == nil {
+		t.Error("expect a check error following yourself")
+	}
+
+	s.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: a.ID, FolloweeID: b.ID})
+	if ids, _ := s.GetFolloweeIDs(ctx, a.ID); len(ids) != 0 {
+		t.Errorf("expect no follows, got %v", ids)
+	}
+}
+
+func TestSQLiteBlocks(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+	b, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", Handle: "b"})
+	c, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "c@example.com", Handle: "c"})
+	var chirps []database.Chirp
+	for _, u := range []uuid.UUID{a.ID, b.ID, c.ID} {
+		chirp, _ := s.CreateChirp(ctx, database.CreateChirpParams{UserID: u, Body: "hi"})
+		s.PinChirp(ctx, database.PinChirpParams{UserID: u, ChirpID: chirp.ID})
+		chirps = append(chirps, chirp)
+	}
+
+	for i, want := range []int64{1, 0} {
+		n, err := s.BlockUser(ctx, database.BlockUserParams{BlockerID: a.ID, BlockedID: b.ID})
+		if err != nil || n != want {
+			t.Errorf("block %d: expect %d rows, got %d %v", i, want, n, err)
+		}
+	}
+	s.MuteUser(ctx, database.MuteUserParams{MuterID: a.ID, MutedID: c.ID})
+	if blocked, err := s.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{UserID: b.ID, OtherID: a.ID}); !blocked || err != nil {
+		t.Errorf("expect a block either way, got %v %v", blocked, err)
+	}
+	if blocked, _ := s.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{UserID: a.ID, OtherID: c.ID}); blocked {
+		t.Error("expect a mute isn't a block")
+	}
+	if ids, _ := s.GetHiddenUserIDs(ctx, a.ID); len(ids) != 2 {
+		t.Errorf("expect b and c hidden from a, got %v", ids)
+	}
+
+	if chirps, _ := s.GetAllChirps(ctx, a.ID); len(chirps) != 1 || chirps[0].UserID != a.ID {
+		t.Errorf("expect only a's chirp for a, got %v", chirps)
+	}
+	if chirps, _ := s.GetAllChirps(ctx, b.ID); len(chirps) != 3 {
+		t.Errorf("expect every chirp for b, got %v", chirps)
+	}
+	if chirps, _ := s.GetAllChirpsByUser(ctx, database.GetAllChirpsByUserParams{UserID: b.ID, ViewerID: a.ID}); len(chirps) != 0 {
+		t.Errorf("expect none of b's chirps for a, got %v", chirps)
+	}
+	if chirps, _ := s.GetPinnedChirpsByUser(ctx, database.GetPinnedChirpsByUserParams{UserID: c.ID, ViewerID: a.ID}); len(chirps) != 0 {
+		t.Errorf("expect none of c's pins for a, got %v", chirps)
+	}
+	if _, err := s.GetVisibleChirp(ctx, database.GetVisibleChirpParams{ViewerID: a.ID, ID: chirps[1].ID}); err != sql.ErrNoRows {
+		t.Errorf("expect b's chirp not found for a, got %v", err)
+	}
+	if _, err := s.GetVisibleChirp(ctx, database.GetVisibleChirpParams{ViewerID: a.ID, ID: chirps[2].ID}); err != nil {
+		t.Errorf("expect c's muted chirp found for a, got %v", err)
+	}
+
+	s.UnblockUser(ctx, database.UnblockUserParams{BlockerID: a.ID, BlockedID: b.ID})
+	s.UnmuteUser(ctx, database.UnmuteUserParams{MuterID: a.ID, MutedID: c.ID})
+	blocks, _ := s.ListBlocks(ctx, a.ID)
+	mutes, _ := s.ListMutes(ctx, a.ID)
+	if len(blocks) != 0 || len(mutes) != 0 {
+		t.Errorf("expect nothing left, got %v %v", blocks, mutes)
+	}
+}
+
+func TestSQLiteMessages(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+	b, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", Handle: "b"})
+
+	key := sql.NullString{String: a.ID.String() + ":" + b.ID.String(), Valid: true}
+	c, err := s.CreateConversation(ctx, database.CreateConversationParams{DirectKey: key, CreatedBy: a.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateConversation(ctx, database.CreateConversationParams{DirectKey: key, CreatedBy: b.ID}); err == nil {
+		t.Error("expect a unique error for a second direct conversation")
+	}
+	if got, err := s.GetConversationByDirectKey(ctx, key); err != nil || got.ID != c.ID {
+		t.Errorf("expect the conversation by its key, got %v %v", got, err)
+	}
+	for _, u := range []uuid.UUID{a.ID, b.ID} {
+		if err := s.AddConversationMember(ctx, database.AddConversationMemberParams{ConversationID: c.ID, UserID: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, body := range []string{"hi", "hello", "bye"} {
+		if _, err := s.CreateMessage(ctx, database.CreateMessageParams{ConversationID: c.ID, SenderID: a.ID, Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := s.ListMessages(ctx, database.ListMessagesParams{
+		ConversationID: c.ID,
+		Before:         time.Now().Add(time.Hour),
+		BeforeID:       uuid.Max,
+		MaxRows:        2,
+	})
+	if err != nil || len(messages) != 2 || messages[0].Body != "bye" {
+		t.Fatalf("expect the last 2 messages, got %v %v", messages, err)
+	}
+
+	convs, err := s.ListConversationsByUser(ctx, database.ListConversationsByUserParams{UserID: b.ID, Before: time.Now().Add(time.Hour), BeforeID: uuid.Max, MaxRows: 10})
+	if err != nil || len(convs) != 1 || convs[0].UnreadCount != 3 {
+		t.Fatalf("expect 3 unread for b, got %v %v", convs, err)
+	}
+	if convs, _ := s.ListConversationsByUser(ctx, database.ListConversationsByUserParams{UserID: a.ID, Before: time.Now().Add(time.Hour), BeforeID: uuid.Max, MaxRows: 10}); convs[0].UnreadCount != 0 {
+		t.Errorf("expect no unread of your own messages, got %d", convs[0].UnreadCount)
+	}
+	s.MarkConversationRead(ctx, database.MarkConversationReadParams{ConversationID: c.ID, UserID: b.ID})
+	if convs, _ := s.ListConversationsByUser(ctx, database.ListConversationsByUserParams{UserID: b.ID, Before: time.Now().Add(time.Hour), BeforeID: uuid.Max, MaxRows: 10}); convs[0].UnreadCount != 0 || !convs[0].LastReadAt.Valid {
+		t.Errorf("expect b read everything, got %v", convs[0])
+	}
+	members, _ := s.ListConversationMembersByUser(ctx, b.ID)
+	if len(members) != 2 {
+		t.Errorf("expect both members, got %v", members)
+	}
+	if ids, _ := s.ListConversationMembers(ctx, c.ID); len(ids) != 2 || ids[0] != a.ID {
+		t.Errorf("expect a then b, got %v", ids)
+	}
+
+	if _, err := s.GetMessageSettings(ctx, a.ID); err != sql.ErrNoRows {
+		t.Errorf("expect no settings, got %v", err)
+	}
+	for _, from := range []string{"following", "everyone"} {
+		s.SetMessageSettings(ctx, database.SetMessageSettingsParams{UserID: a.ID, AcceptFrom: from})
+	}
+	if settings, _ := s.GetMessageSettings(ctx, a.ID); settings.AcceptFrom != "everyone" {
+		t.Errorf("expect everyone, got %s", settings.AcceptFrom)
+	}
+}
+
+func TestSQLiteModeration(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+	b, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", Handle: "b"})
+	mod, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "mod@example.com", Handle: "mod"})
+	chirp, _ := s.CreateChirp(ctx, database.CreateChirpParams{UserID: b.ID, Body: "hi"})
+
+	s.AddModerator(ctx, mod.ID)
+	if ok, err := s.IsModerator(ctx, mod.ID); !ok || err != nil {
+		t.Errorf("expect a moderator, got %v %v", ok, err)
+	}
+	if ok, _ := s.IsModerator(ctx, a.ID); ok {
+		t.Error("expect a isn't a moderator")
+	}
+
+	first, err := s.CreateReport(ctx, database.CreateReportParams{
+		ReporterID: a.ID,
+		UserID:     b.ID,
+		ChirpID:    uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Reason:     "spam",
+	})
+	if err != nil || first.Status != "open" {
+		t.Fatalf("expect an open report, got %v %v", first, err)
+	}
+	second, _ := s.CreateReport(ctx, database.CreateReportParams{ReporterID: a.ID, UserID: b.ID, Reason: "harassment"})
+
+	reports, _ := s.ListReports(ctx, database.ListReportsParams{Status: "open", MaxRows: 1})
+	if len(reports) != 1 || reports[0].ID != first.ID {
+		t.Fatalf("expect the first report first, got %v", reports)
+	}
+	reports, _ = s.ListReports(ctx, database.ListReportsParams{Status: "open", After: first.CreatedAt, AfterID: first.ID, MaxRows: 10})
+	if len(reports) != 1 || reports[0].ID != second.ID {
+		t.Errorf("expect the second report after the first, got %v", reports)
+	}
+
+	modID := uuid.NullUUID{UUID: mod.ID, Valid: true}
+	if _, err := s.ClaimReport(ctx, database.ClaimReportParams{ID: first.ID, ModeratorID: modID}); err != nil {
+		t.Fatal(err)
+	}
+	other := uuid.NullUUID{UUID: a.ID, Valid: true}
+	if _, err := s.ClaimReport(ctx, database.ClaimReportParams{ID: first.ID, ModeratorID: other}); err != sql.ErrNoRows {
+		t.Errorf("expect the claim held, got %v", err)
+	}
+	closed, err := s.CloseReport(ctx, database.CloseReportParams{
+		ID:          first.ID,
+		Status:      "resolved",
+		Resolution:  sql.NullString{String: "delete_chirp", Valid: true},
+		ModeratorID: modID,
+	})
+	if err != nil || closed.Status != "resolved" {
+		t.Errorf("expect resolved, got %v %v", closed, err)
+	}
+	if _, err := s.CloseReport(ctx, database.CloseReportParams{ID: first.ID, Status: "dismissed", ModeratorID: modID}); err != sql.ErrNoRows {
+		t.Errorf("expect a closed report stays closed, got %v", err)
+	}
+
+	s.DeleteChirp(ctx, chirp.ID)
+	if rep, _ := s.GetReport(ctx, first.ID); rep.ChirpID.Valid {
+		t.Errorf("expect the deleted chirp unset, got %v", rep.ChirpID)
+	}
+
+	until := sql.NullTime{Time: time.Now().Add(24 * time.Hour), Valid: true}
+	if _, err := s.CreateSuspension(ctx, database.CreateSuspensionParams{UserID: b.ID, Reason: "spam", ExpiresAt: until, CreatedBy: modID}); err != nil {
+		t.Error(err)
+	}
+
+	entry, err := s.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		ModeratorID: mod.ID,
+		Action:      "delete_chirp",
+		ReportID:    uuid.NullUUID{UUID: first.ID, Valid: true},
+		UserID:      uuid.NullUUID{UUID: b.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.ExecContext(ctx, "UPDATE moderation_log SET note = 'changed'"); err == nil {
+		t.Error("expect the log can't be changed")
+	}
+	if _, err := s.DB.ExecContext(ctx, "DELETE FROM moderation_log"); err == nil {
+		t.Error("expect the log can't be deleted from")
+	}
+	s.DeleteAllUsers(ctx)
+	entries, _ := s.ListModerationLog(ctx, database.ListModerationLogParams{Before: time.Now().Add(time.Hour), BeforeID: uuid.Max, MaxRows: 10})
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Errorf("expect the log to outlive the users, got %v", entries)
+	}
+}
+
+func TestSQLiteSuspensions(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+	b, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", Handle: "b"})
+	s.CreateChirp(ctx, database.CreateChirpParams{UserID: a.ID, Body: "hi"})
+	chirp, _ := s.CreateChirp(ctx, database.CreateChirpParams{UserID: b.ID, Body: "hi"})
+	s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "tok", UserID: b.ID, ExpiresAt: time.Now().Add(time.Hour)})
+
+	if _, err := s.GetActiveSuspension(ctx, b.ID); err != sql.ErrNoRows {
+		t.Errorf("expect no suspension, got %v", err)
+	}
+	past := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+	s.CreateSuspension(ctx, database.CreateSuspensionParams{UserID: b.ID, Reason: "over", ExpiresAt: past})
+	if _, err := s.GetActiveSuspension(ctx, b.ID); err != sql.ErrNoRows {
+		t.Errorf("expect an expired suspension over, got %v", err)
+	}
+
+	soon := sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+	s.CreateSuspension(ctx, database.CreateSuspensionParams{UserID: b.ID, Reason: "spam", ExpiresAt: soon})
+	s.CreateSuspension(ctx, database.CreateSuspensionParams{UserID: b.ID, Reason: "ban"})
+	s.RevokeUserTokens(ctx, b.ID)
+	if active, err := s.GetActiveSuspension(ctx, b.ID); err != nil || active.Reason != "ban" {
+		t.Errorf("expect the ban first, got %v %v", active, err)
+	}
+	if tok, _ := s.GetRefreshToken(ctx, "tok"); !tok.RevokedAt.Valid {
+		t.Error("expect the token revoked")
+	}
+
+	if chirps, _ := s.GetAllChirps(ctx, uuid.Nil); len(chirps) != 1 || chirps[0].UserID != a.ID {
+		t.Errorf("expect only a's chirp, got %v", chirps)
+	}
+	if chirps, _ := s.GetAllChirpsByUser(ctx, database.GetAllChirpsByUserParams{UserID: b.ID}); len(chirps) != 0 {
+		t.Errorf("expect b's chirps hidden, got %v", chirps)
+	}
+	if _, err := s.GetVisibleChirp(ctx, database.GetVisibleChirpParams{ID: chirp.ID}); err != sql.ErrNoRows {
+		t.Errorf("expect b's chirp not found, got %v", err)
+	}
+
+	if n, err := s.LiftSuspensions(ctx, b.ID); n != 2 || err != nil {
+		t.Errorf("expect 2 lifted, got %d %v", n, err)
+	}
+	if chirps, _ := s.GetAllChirps(ctx, uuid.Nil); len(chirps) != 2 {
+		t.Errorf("expect both chirps again, got %v", chirps)
+	}
+	if suspensions, _ := s.ListSuspensionsByUser(ctx, b.ID); len(suspensions) != 3 || !suspensions[0].LiftedAt.Valid {
+		t.Errorf("expect every suspension kept, got %v", suspensions)
+	}
+}
+
+func TestSQLiteFilterRules(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+
+	r, err := s.CreateFilterRule(ctx, database.CreateFilterRuleParams{Kind: "word", Pattern: "spam", Action: "reject"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateFilterRule(ctx, database.CreateFilterRuleParams{Kind: "glob", Pattern: "x", Action: "mask"}); err == nil {
+		t.Error("expect the kind checked")
+	}
+	r, err = s.UpdateFilterRule(ctx, database.UpdateFilterRuleParams{ID: r.ID, Kind: "regex", Pattern: "sp+am", Action: "hold"})
+	if err != nil || r.Pattern != "sp+am" || r.Action != "hold" {
+		t.Errorf("expect the rule updated, got %v %v", r, err)
+	}
+	if rules, _ := s.ListFilterRules(ctx); len(rules) != 1 || rules[0].ID != r.ID {
+		t.Errorf("expect the rule listed, got %v", rules)
+	}
+	if n, _ := s.DeleteFilterRule(ctx, r.ID); n != 1 {
+		t.Errorf("expect 1 deleted, got %d", n)
+	}
+	if _, err := s.GetFilterRule(ctx, r.ID); err != sql.ErrNoRows {
+		t.Errorf("expect the rule gone, got %v", err)
+	}
+
+	s.CreateChirp(ctx, database.CreateChirpParams{UserID: a.ID, Body: "hi"})
+	held, _ := s.CreateChirp(ctx, database.CreateChirpParams{UserID: a.ID, Body: "buy now", Held: true})
+	if chirps, _ := s.GetAllChirps(ctx, uuid.Nil); len(chirps) != 1 {
+		t.Errorf("expect the held chirp hidden, got %v", chirps)
+	}
+	if chirps, _ := s.ListHeldChirps(ctx, database.ListHeldChirpsParams{MaxRows: 10}); len(chirps) != 1 || chirps[0].ID != held.ID {
+		t.Errorf("expect the held chirp queued, got %v", chirps)
+	}
+	if c, err := s.ReleaseChirp(ctx, held.ID); err != nil || c.Held {
+		t.Errorf("expect the chirp released, got %v %v", c, err)
+	}
+	if _, err := s.ReleaseChirp(ctx, held.ID); err != sql.ErrNoRows {
+		t.Errorf("expect a released chirp not held, got %v", err)
+	}
+	if chirps, _ := s.GetAllChirps(ctx, uuid.Nil); len(chirps) != 2 {
+		t.Errorf("expect both chirps, got %v", chirps)
+	}
+}
+
+func TestSQLiteMedia(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+	b, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", Handle: "b"})
+
+	var ids []uuid.UUID
+	for range 2 {
+		md, err := s.CreateMedia(ctx, database.CreateMediaParams{ID: uuid.New(), UserID: a.ID, ContentType: "image/png", Size: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, md.ID)
+	}
+	chirp, _ := s.CreateChirp(ctx, database.CreateChirpParams{UserID: a.ID, Body: "look"})
+
+	attach := func(userID, id uuid.UUID, position int32) int64 {
+		n, err := s.AttachMedia(ctx, database.AttachMediaParams{
+			ChirpID:  uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			Position: position,
+			ID:       id,
+			UserID:   userID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := attach(b.ID, ids[0], 0); n != 0 {
+		t.Errorf("expect the media of another user left alone, got %d", n)
+	}
+	if n := attach(a.ID, ids[1], 0) + attach(a.ID, ids[0], 1); n != 2 {
+		t.Errorf("expect both media attached, got %d", n)
+	}
+	if n := attach(a.ID, ids[0], 2); n != 0 {
+		t.Errorf("expect attached media not attached again, got %d", n)
+	}
+
+	media, err := s.ListMediaByChirps(ctx, []uuid.UUID{chirp.ID, uuid.New()})
+	if err != nil || len(media) != 2 || media[0].ID != ids[1] || media[1].ID != ids[0] {
+		t.Errorf("expect the media by position, got %v %v", media, err)
+	}
+	if media, _ := s.ListMediaByChirps(ctx, nil); len(media) != 0 {
+		t.Errorf("expect no media, got %v", media)
+	}
+
+	loose, _ := s.CreateMedia(ctx, database.CreateMediaParams{ID: uuid.New(), UserID: b.ID, ContentType: "image/gif", Size: 5})
+	if media, err := s.ListUnattachedMedia(ctx, time.Now().Add(-time.Hour)); err != nil || len(media) != 0 {
+		t.Errorf("expect no upload an hour old, got %v %v", media, err)
+	}
+	media, err = s.ListUnattachedMedia(ctx, time.Now().Add(time.Minute))
+	if err != nil || len(media) != 1 || media[0].ID != loose.ID {
+		t.Errorf("expect the unattached upload, got %v %v", media, err)
+	}
+	if n, err := s.DeleteUnattachedMedia(ctx, ids[0]); n != 0 || err != nil {
+		t.Errorf("expect attached media kept, got %d %v", n, err)
+	}
+	if n, err := s.DeleteUnattachedMedia(ctx, loose.ID); n != 1 || err != nil {
+		t.Errorf("expect the upload deleted, got %d %v", n, err)
+	}
+	if media, _ := s.ListAllMedia(ctx); len(media) != 2 {
+		t.Errorf("expect 2 media left, got %v", media)
+	}
+
+	s.DeleteChirp(ctx, chirp.ID)
+	if _, err := s.GetMedia(ctx, ids[0]); err != sql.ErrNoRows {
+		t.Errorf("expect the media deleted with the chirp, got %v", err)
+	}
+}
+
+func TestSQLiteNotifications(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	a, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "Walt.White@example.com", Handle: "walt.white"})
+	b, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "jesse@example.com", Handle: "jesse"})
+
+	ids, err := s.GetUserIDsByHandles(ctx, []string{"walt.white", "walt", "skyler"})
+	if err != nil || len(ids) != 1 || ids[0] != a.ID {
+		t.Errorf("expect walt.white, got %v %v", ids, err)
+	}
+
+	for range 3 {
+		_, err := s.CreateNotification(ctx, database.CreateNotificationParams{
+			UserID:  a.ID,
+			Type:    "followed",
+			ActorID: uuid.NullUUID{UUID: b.ID, Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := s.ListNotifications(ctx, database.ListNotificationsParams{
+		UserID:   a.ID,
+		Before:   time.Now().Add(time.Hour),
+		BeforeID: uuid.Max,
+		MaxRows:  2,
+	})
+	if err != nil || len(first) != 2 || first[0].ActorID.UUID != b.ID {
+		t.Fatalf("expect a page of 2, got %v %v", first, err)
+	}
+	rest, _ := s.ListNotifications(ctx, database.ListNotificationsParams{
+		UserID:   a.ID,
+		Before:   first[1].CreatedAt,
+		BeforeID: first[1].ID,
+		MaxRows:  2,
+	})
+	if len(rest) != 1 || rest[0].ID == first[0].ID || rest[0].ID == first[1].ID {
+		t.Errorf("expect the third notification, got %v", rest)
+	}
+
+	if n, _ := s.MarkNotificationRead(ctx, database.MarkNotificationReadParams{ID: rest[0].ID, UserID: b.ID}); n != 0 {
+		t.Error("expect another user's notification not marked")
+	}
+	s.MarkNotificationRead(ctx, database.MarkNotificationReadParams{ID: rest[0].ID, UserID: a.ID})
+	if n, _ := s.CountUnreadNotifications(ctx, a.ID); n != 2 {
+		t.Errorf("expect 2 unread, got %d", n)
+	}
+	if n, _ := s.MarkAllNotificationsRead(ctx, a.ID); n != 2 {
+		t.Errorf("expect 2 marked, got %d", n)
+	}
+
+	for _, enabled := range []bool{false, true} {
+		s.SetNotificationPreference(ctx, database.SetNotificationPreferenceParams{UserID: a.ID, Type: "liked", Enabled: enabled})
+	}
+	prefs, _ := s.GetNotificationPreferences(ctx, a.ID)
+	if len(prefs) != 1 || !prefs[0].Enabled {
+		t.Errorf("expect liked back on, got %v", prefs)
+	}
+}
+
+func TestSQLiteInTx(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+
+	failed := errors.New("failed")
+	err := s.InTx(ctx, func(q Queries) error {
+		if _, err := q.CreateChirp(ctx, database.CreateChirpParams{UserID: user.ID, Body: "rolled back"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expect the error of fn, got %v", err)
+	}
+	if chirps, _ := s.GetAllChirps(ctx, uuid.Nil); len(chirps) != 0 {
+		t.Errorf("expect rollback, got %d chirps", len(chirps))
+	}
+}
+
+func TestSQLiteWebhooks(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Handle: "a"})
+
+	endpoint, err := s.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+		UserID: user.ID,
+		Url:    "https://example.com/hook",
+		Secret: "secret",
+		Events: []string{"chirp.created"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !endpoint.Active || len(endpoint.Events) != 1 || endpoint.Events[0] != "chirp.created" {
+		t.Errorf("unexpected endpoint %#v", endpoint)
+	}
+
+	payload := json.RawMessage(`{"id":"1"}`)
+	for _, event := range []string{"chirp.created", "chirp.deleted"} {
+		if _, err := s.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{Event: event, Payload: payload}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claimed, err := s.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseUntil: time.Now().Add(time.Minute), Batch: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].Event != "chirp.created" || string(claimed[0].Payload) != string(payload) {
+		t.Fatalf("expect the chirp.created delivery, got %#v", claimed)
+	}
+	// leased until later
+	if again, _ := s.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseUntil: time.Now().Add(time.Minute), Batch: 10}); len(again) != 0 {
+		t.Errorf("expect the delivery leased, got %d", len(again))
+	}
+
+	_, err = s.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{ID: "evt_1", Source: "polka", Event: "user.upgraded", Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{ID: "evt_1", Source: "polka", Event: "user.upgraded", Payload: payload})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expect sql.ErrNoRows for a duplicate event, got %v", err)
+	}
+}
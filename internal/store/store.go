@@ -0,0 +1,240 @@
+// Package store is the storage of Chirpy behind interfaces, with a Postgres
+// implementation over the sqlc queries and an in-memory one for tests.
+//
+// The interfaces use the sqlc types of the database package and keep its
+// behavior: lookups of missing rows return sql.ErrNoRows.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+type Users interface {
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.GetUserByIDRow, error)
+	GetUserByEmailWithPassword(ctx context.Context, email string) (database.GetUserByEmailWithPasswordRow, error)
+	UpdateUserEmailAndPassword(ctx context.Context, arg database.UpdateUserEmailAndPasswordParams) (database.UpdateUserEmailAndPasswordRow, error)
+	// GetUserIDsByHandles finds users by their handles, which are unique and
+	// lower cased.
+	GetUserIDsByHandles(ctx context.Context, handles []string) ([]uuid.UUID, error)
+	UpdateUserHandle(ctx context.Context, arg database.UpdateUserHandleParams) error
+	// LockUser keeps other transactions from locking the user until the end
+	// of the transaction it's called in.
+	LockUser(ctx context.Context, id uuid.UUID) error
+	// DeleteAllUsers deletes every user along with everything they own.
+	DeleteAllUsers(ctx context.Context) error
+}
+
+type Chirps interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetAChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	// GetVisibleChirp returns sql.ErrNoRows for a chirp the viewer doesn't see:
+	// a held chirp of someone else, or a chirp of a user the viewer blocked
+	// or of a suspended user.
+	GetVisibleChirp(ctx context.Context, arg database.GetVisibleChirpParams) (database.Chirp, error)
+	// The chirp listings leave out the held chirps and the chirps of the users
+	// the viewer blocked or muted. uuid.Nil views every chirp.
+	GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error)
+	GetAllChirpsByUser(ctx context.Context, arg database.GetAllChirpsByUserParams) ([]database.Chirp, error)
+	UpdateChirpBody(ctx context.Context, arg database.UpdateChirpBodyParams) (database.Chirp, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	CountChirpsByUserSince(ctx context.Context, arg database.CountChirpsByUserSinceParams) (int64, error)
+	PinChirp(ctx context.Context, arg database.PinChirpParams) error
+	UnpinChirp(ctx context.Context, arg database.UnpinChirpParams) error
+	IsChirpPinned(ctx context.Context, arg database.IsChirpPinnedParams) (bool, error)
+	CountPinnedChirps(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetPinnedChirpsByUser(ctx context.Context, arg database.GetPinnedChirpsByUserParams) ([]database.Chirp, error)
+	ListHeldChirps(ctx context.Context, arg database.ListHeldChirpsParams) ([]database.Chirp, error)
+	// ReleaseChirp returns sql.ErrNoRows unless the chirp is held.
+	ReleaseChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+}
+
+type Follows interface {
+	// FollowUser does nothing and returns 0 if the follow exists.
+	FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error)
+	UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error
+	GetFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error)
+	IsFollowing(ctx context.Context, arg database.IsFollowingParams) (bool, error)
+}
+
+// Blocks are the users a user blocked, stopping every interaction between
+// them, and the users they muted.
+type Blocks interface {
+	// BlockUser does nothing and returns 0 if the block exists.
+	BlockUser(ctx context.Context, arg database.BlockUserParams) (int64, error)
+	UnblockUser(ctx context.Context, arg database.UnblockUserParams) error
+	ListBlocks(ctx context.Context, blockerID uuid.UUID) ([]database.Block, error)
+	// IsBlockedBetween reports if either user blocked the other.
+	IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error)
+	// MuteUser does nothing and returns 0 if the mute exists.
+	MuteUser(ctx context.Context, arg database.MuteUserParams) (int64, error)
+	UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error
+	ListMutes(ctx context.Context, muterID uuid.UUID) ([]database.Mute, error)
+	// GetHiddenUserIDs lists the users whose chirps a user doesn't see, the
+	// ones they blocked or muted.
+	GetHiddenUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// Messages are the direct message conversations between users and who each
+// user accepts them from.
+type Messages interface {
+	CreateConversation(ctx context.Context, arg database.CreateConversationParams) (database.Conversation, error)
+	GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error)
+	GetConversationByDirectKey(ctx context.Context, directKey sql.NullString) (database.Conversation, error)
+	AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error
+	GetConversationMember(ctx context.Context, arg database.GetConversationMemberParams) (database.ConversationMember, error)
+	// ListConversationsByUser lists a user's conversations, latest message
+	// first, with how many messages the user hasn't read.
+	ListConversationsByUser(ctx context.Context, arg database.ListConversationsByUserParams) ([]database.ListConversationsByUserRow, error)
+	ListConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]uuid.UUID, error)
+	// ListConversationMembersByUser lists the members of every conversation
+	// of a user, the user included.
+	ListConversationMembersByUser(ctx context.Context, userID uuid.UUID) ([]database.ListConversationMembersByUserRow, error)
+	CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error)
+	TouchConversation(ctx context.Context, id uuid.UUID) error
+	ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error)
+	MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error
+	GetMessageSettings(ctx context.Context, userID uuid.UUID) (database.MessageSetting, error)
+	SetMessageSettings(ctx context.Context, arg database.SetMessageSettingsParams) (database.MessageSetting, error)
+}
+
+// Moderation is the reports users make of chirps and users, the moderators
+// working through them and the log of every action they take.
+type Moderation interface {
+	CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error)
+	GetReport(ctx context.Context, id uuid.UUID) (database.Report, error)
+	ListReports(ctx context.Context, arg database.ListReportsParams) ([]database.Report, error)
+	// ClaimReport and CloseReport return sql.ErrNoRows unless the report is
+	// open or claimed by the moderator.
+	ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error)
+	CloseReport(ctx context.Context, arg database.CloseReportParams) (database.Report, error)
+	CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationLog, error)
+	ListModerationLog(ctx context.Context, arg database.ListModerationLogParams) ([]database.ModerationLog, error)
+	IsModerator(ctx context.Context, userID uuid.UUID) (bool, error)
+	AddModerator(ctx context.Context, userID uuid.UUID) error
+	RemoveModerator(ctx context.Context, userID uuid.UUID) error
+}
+
+// Suspensions keep users out of their accounts for a time, or for good as a
+// ban, and hide their chirps meanwhile.
+type Suspensions interface {
+	CreateSuspension(ctx context.Context, arg database.CreateSuspensionParams) (database.Suspension, error)
+	// GetActiveSuspension returns sql.ErrNoRows unless the user is suspended,
+	// a ban before a suspension.
+	GetActiveSuspension(ctx context.Context, userID uuid.UUID) (database.Suspension, error)
+	ListSuspensionsByUser(ctx context.Context, userID uuid.UUID) ([]database.Suspension, error)
+	// LiftSuspensions ends the user's active suspensions, returning how many.
+	LiftSuspensions(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
+// FilterRules are the content filter rules added by the admins.
+type FilterRules interface {
+	CreateFilterRule(ctx context.Context, arg database.CreateFilterRuleParams) (database.FilterRule, error)
+	GetFilterRule(ctx context.Context, id uuid.UUID) (database.FilterRule, error)
+	ListFilterRules(ctx context.Context) ([]database.FilterRule, error)
+	UpdateFilterRule(ctx context.Context, arg database.UpdateFilterRuleParams) (database.FilterRule, error)
+	DeleteFilterRule(ctx context.Context, id uuid.UUID) (int64, error)
+}
+
+// Media are the images users upload, attached to at most one chirp each.
+type Media interface {
+	CreateMedia(ctx context.Context, arg database.CreateMediaParams) (database.Media, error)
+	GetMedia(ctx context.Context, id uuid.UUID) (database.Media, error)
+	// AttachMedia returns 0 unless the media belongs to the user and is in no
+	// chirp yet.
+	AttachMedia(ctx context.Context, arg database.AttachMediaParams) (int64, error)
+	// ListMediaByChirps lists the media of the chirps, by chirp and position.
+	ListMediaByChirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.Media, error)
+	ListAllMedia(ctx context.Context) ([]database.Media, error)
+	// ListUnattachedMedia lists the uploads in no chirp created before
+	// createdAt, oldest first.
+	ListUnattachedMedia(ctx context.Context, createdAt time.Time) ([]database.Media, error)
+	// DeleteUnattachedMedia returns 0 if the media is gone or was attached
+	// to a chirp in the meantime.
+	DeleteUnattachedMedia(ctx context.Context, id uuid.UUID) (int64, error)
+}
+
+// Notifications are what happened to a user, newest first, and the types of
+// notification they turned on or off.
+type Notifications interface {
+	CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error)
+	ListNotifications(ctx context.Context, arg database.ListNotificationsParams) ([]database.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkNotificationRead(ctx context.Context, arg database.MarkNotificationReadParams) (int64, error)
+	MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error)
+	SetNotificationPreference(ctx context.Context, arg database.SetNotificationPreferenceParams) error
+}
+
+type Tokens interface {
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeToken(ctx context.Context, token string) error
+	// RevokeUserTokens revokes every refresh token of a user.
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID) error
+}
+
+type Subscriptions interface {
+	GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error)
+	UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error)
+	ExpireLapsedSubscriptions(ctx context.Context) (int64, error)
+}
+
+// WebhookEvents are the webhooks Chirpy receives.
+type WebhookEvents interface {
+	// CreateWebhookEvent returns sql.ErrNoRows if the event id exists.
+	CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (database.WebhookEvent, error)
+	GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error)
+	MarkWebhookEvent(ctx context.Context, arg database.MarkWebhookEventParams) error
+	ListWebhookEvents(ctx context.Context, arg database.ListWebhookEventsParams) ([]database.WebhookEvent, error)
+}
+
+// Webhooks are the endpoints developers register and their deliveries.
+type Webhooks interface {
+	CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error)
+	ListWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error)
+	EnqueueWebhookDeliveries(ctx context.Context, arg database.EnqueueWebhookDeliveriesParams) (int64, error)
+	ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	MarkWebhookDelivery(ctx context.Context, arg database.MarkWebhookDeliveryParams) error
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error)
+	ListWebhookDeliveriesByEndpoint(ctx context.Context, arg database.ListWebhookDeliveriesByEndpointParams) ([]database.WebhookDelivery, error)
+	// RedeliverWebhookDelivery returns sql.ErrNoRows unless the delivery is
+	// delivered or dead.
+	RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error)
+}
+
+// Queries is every query of the storage.
+type Queries interface {
+	Users
+	Chirps
+	Follows
+	Blocks
+	Messages
+	Moderation
+	Suspensions
+	FilterRules
+	Media
+	Notifications
+	Tokens
+	Subscriptions
+	WebhookEvents
+	Webhooks
+}
+
+// Store is a storage backend.
+type Store interface {
+	Queries
+	// InTx runs fn in a transaction, committed if fn returns nil and rolled
+	// back otherwise.
+	InTx(ctx context.Context, fn func(q Queries) error) error
+	// Ping checks the storage is reachable.
+	Ping(ctx context.Context) error
+}
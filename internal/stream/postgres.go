@@ -0,0 +1,79 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+// channel is the Postgres notification channel of chirp events.
+const channel = "chirp_events"
+
+// Postgres publishes events with NOTIFY and delivers every instance's events
+// to the Broker from LISTEN.
+type Postgres struct {
+	Q      *database.Queries
+	URL    string
+	Broker *Broker
+}
+
+func NewPostgres(db *sql.DB, url string, broker *Broker) *Postgres {
+	return &Postgres{Q: database.New(db), URL: url, Broker: broker}
+}
+
+// Publish notifies every instance, this one included, of an event.
+func (p *Postgres) Publish(ctx context.Context, typ string, userID uuid.UUID, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return p.Q.NotifyChirpEvent(ctx, database.NotifyChirpEventParams{
+		Type:   typ,
+		UserID: userID,
+		Data:   raw,
+	})
+}
+
+// Run listens for events until ctx is done. Events notified while the
+// connection is down are missed.
+func (p *Postgres) Run(ctx context.Context) error {
+	listener := pq.NewListener(p.URL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.WarnContext(ctx, "chirp events listener", "event", ev, "err", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(channel); err != nil {
+		return err
+	}
+
+	// a ping now and then notices a dead connection
+	ticker := time.NewTicker(90 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			go listener.Ping()
+		case n := <-listener.Notify:
+			if n == nil {
+				// reconnected
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				slog.WarnContext(ctx, "chirp events listener: bad event", "err", err)
+				continue
+			}
+			p.Broker.Deliver(e)
+		}
+	}
+}
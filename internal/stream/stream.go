@@ -0,0 +1,164 @@
+// Package stream fans chirp events out to Server-Sent Events clients.
+//
+// A Broker keeps the latest events so a reconnecting client can resume from
+// the last one it saw, and hands new events to every subscriber. With one
+// instance the Broker publishes itself; with several, events go through
+// Postgres LISTEN/NOTIFY so every instance's Broker sees all of them.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is a change to the chirps, Data is its JSON.
+type Event struct {
+	ID     int64           `json:"id"`
+	Type   string          `json:"type"`
+	UserID uuid.UUID       `json:"user_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Publisher sends an event to every subscriber.
+type Publisher interface {
+	Publish(ctx context.Context, typ string, userID uuid.UUID, data any) error
+}
+
+// subscriberBuffer is how far a subscriber may fall behind before it's
+// dropped, a dropped client reconnects and resumes from the replay buffer.
+const subscriberBuffer = 64
+
+// Subscription receives events on C until it's closed, when the subscriber
+// fell behind or the Broker closed.
+type Subscription struct {
+	C <-chan Event
+	c chan Event
+}
+
+type Broker struct {
+	mu     sync.Mutex
+	size   int
+	events []Event
+	lastID int64
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroker returns a Broker replaying at most size events. The ids it gives
+// start from the time so they keep growing across restarts.
+func NewBroker(size int) *Broker {
+	return &Broker{
+		size:   size,
+		lastID: time.Now().UnixMicro(),
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+// Publish gives an event the next id and delivers it, the Publisher of a
+// single instance.
+func (b *Broker) Publish(ctx context.Context, typ string, userID uuid.UUID, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver(Event{ID: b.lastID + 1, Type: typ, UserID: userID, Data: raw})
+	return nil
+}
+
+// Deliver records e for replay and sends it to the subscribers.
+func (b *Broker) Deliver(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver(e)
+}
+
+func (b *Broker) deliver(e Event) {
+	if b.closed {
+		return
+	}
+
+	b.lastID = max(b.lastID, e.ID)
+	b.events = append(b.events, e)
+	if len(b.events) > b.size {
+		b.events = b.events[len(b.events)-b.size:]
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.c <- e:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// Subscribe returns a subscription to new events and the buffered events
+// after lastID, 0 for none. complete is false when events after lastID have
+// already left the buffer, the client missed some.
+func (b *Broker) Subscribe(lastID int64) (sub *Subscription, replay []Event, complete bool) {
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub, nil, true
+	}
+	b.subs[sub] = struct{}{}
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	// events are in delivery order, which across instances isn't strictly
+	// id order, so resume after the position of lastID
+	for i, e := range b.events {
+		if e.ID == lastID {
+			return sub, append([]Event(nil), b.events[i+1:]...), true
+		}
+	}
+	for i, e := range b.events {
+		if e.ID > lastID {
+			return sub, append([]Event(nil), b.events[i:]...), i > 0 || e.ID == lastID+1
+		}
+	}
+	return sub, nil, lastID == b.lastID
+}
+
+// Unsubscribe stops and closes sub.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		b.drop(sub)
+	}
+}
+
+func (b *Broker) drop(sub *Subscription) {
+	delete(b.subs, sub)
+	close(sub.c)
+}
+
+// Closed reports if the Broker closed, telling a shutdown from a subscriber
+// that was dropped.
+func (b *Broker) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Close ends every subscription, so streams don't hold up a shutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
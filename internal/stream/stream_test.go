@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBrokerReplay(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(3)
+	user := uuid.New()
+
+	for i := range 5 {
+		if err := b.Publish(ctx, "chirp.created", user, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the buffer holds the last 3
+	first := b.events[0].ID
+
+	sub, replay, complete := b.Subscribe(first)
+	if !complete || len(replay) != 2 || replay[0].ID != first+1 {
+		t.Errorf("expect 2 events after %d, got %v %v", first, replay, complete)
+	}
+	b.Unsubscribe(sub)
+
+	_, replay, complete = b.Subscribe(first - 2)
+	if complete || len(replay) != 3 {
+		t.Errorf("expect 3 events and a gap, got %d %v", len(replay), complete)
+	}
+
+	_, replay, complete = b.Subscribe(b.lastID)
+	if !complete || len(replay) != 0 {
+		t.Errorf("expect an up to date client, got %d %v", len(replay), complete)
+	}
+}
+
+func TestBrokerSubscribers(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(10)
+
+	sub, _, _ := b.Subscribe(0)
+	b.Publish(ctx, "chirp.deleted", uuid.New(), map[string]string{})
+	e := <-sub.C
+	if e.Type != "chirp.deleted" || string(e.Data) != "{}" {
+		t.Errorf("unexpected event %#v", e)
+	}
+
+	// a subscriber that falls behind is dropped
+	for range subscriberBuffer + 1 {
+		b.Publish(ctx, "chirp.created", uuid.New(), nil)
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("expect %d buffered events before the drop, got %d", subscriberBuffer, n)
+	}
+
+	other, _, _ := b.Subscribe(0)
+	b.Close()
+	if _, ok := <-other.C; ok || !b.Closed() {
+		t.Error("expect Close to end subscriptions")
+	}
+	late, _, _ := b.Subscribe(0)
+	if _, ok := <-late.C; ok {
+		t.Error("expect subscriptions after Close to be closed")
+	}
+}
@@ -0,0 +1,138 @@
+package subscription
+
+import (
+	"errors"
+	"time"
+)
+
+// Subscription statuses.
+const (
+	StatusActive   = "active"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+	StatusExpired  = "expired"
+)
+
+// Polka events that move a subscription through its lifecycle.
+const (
+	EventUpgraded      = "user.upgraded"
+	EventRenewed       = "user.renewed"
+	EventPaymentFailed = "user.payment_failed"
+	EventDowngraded    = "user.downgraded"
+)
+
+const DefaultPlan string = "chirpy_red"
+
+var (
+	ErrUnknownEvent   = errors.New("unknown subscription event")
+	ErrNoSubscription = errors.New("no subscription to apply event to")
+)
+
+// Config holds the billing period and how long a subscription stays
+// active after a failed payment.
+type Config struct {
+	Period time.Duration
+	Grace  time.Duration
+}
+
+var DefaultConfig = Config{
+	Period: 30 * 24 * time.Hour,
+	Grace:  7 * 24 * time.Hour,
+}
+
+// State is the part of a subscription the lifecycle works on.
+type State struct {
+	Plan        string
+	Status      string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	GraceUntil  *time.Time
+}
+
+// ActiveAt reports if the subscription grants Chirpy Red at t.
+func (s State) ActiveAt(t time.Time) bool {
+	if s.Status != StatusActive && s.Status != StatusPastDue {
+		return false
+	}
+	end := s.PeriodEnd
+	if s.GraceUntil != nil {
+		end = *s.GraceUntil
+	}
+	return t.Before(end)
+}
+
+// Known reports if event is a subscription lifecycle event.
+func Known(event string) bool {
+	switch event {
+	case EventUpgraded, EventRenewed, EventPaymentFailed, EventDowngraded:
+		return true
+	}
+	return false
+}
+
+// Apply returns the state after event happens at now. current is nil when
+// the user has no subscription yet. An empty plan is DefaultPlan on an
+// upgrade and the current plan on a renewal.
+func (c Config) Apply(current *State, event, plan string, now time.Time) (State, error) {
+	switch event {
+	case EventUpgraded:
+		if plan == "" {
+			plan = DefaultPlan
+		}
+		return State{
+			Plan:        plan,
+			Status:      StatusActive,
+			PeriodStart: now,
+			PeriodEnd:   now.Add(c.Period),
+		}, nil
+
+	case EventRenewed:
+		if current == nil {
+			return c.Apply(nil, EventUpgraded, plan, now)
+		}
+		if plan == "" {
+			plan = current.Plan
+		}
+		// a renewal continues from the end of the paid period unless it already lapsed
+		start := current.PeriodEnd
+		if !current.ActiveAt(now) {
+			start = now
+		}
+		return State{
+			Plan:        plan,
+			Status:      StatusActive,
+			PeriodStart: start,
+			PeriodEnd:   start.Add(c.Period),
+		}, nil
+
+	case EventPaymentFailed:
+		if current == nil {
+			return State{}, ErrNoSubscription
+		}
+		// a late failure doesn't bring back a canceled or expired
+		// subscription, nor extend the grace of a past due one
+		next := *current
+		if next.Status != StatusActive {
+			return next, nil
+		}
+		base := current.PeriodEnd
+		if base.Before(now) {
+			base = now
+		}
+		grace := base.Add(c.Grace)
+		next.Status = StatusPastDue
+		next.GraceUntil = &grace
+		return next, nil
+
+	case EventDowngraded:
+		if current == nil {
+			return State{}, ErrNoSubscription
+		}
+		next := *current
+		next.Status = StatusCanceled
+		next.PeriodEnd = now
+		next.GraceUntil = nil
+		return next, nil
+	}
+	return State{}, ErrUnknownEvent
+}
@@ -0,0 +1,129 @@
+package subscription
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	conf := Config{Period: 30 * 24 * time.Hour, Grace: 3 * 24 * time.Hour}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sub, err := conf.Apply(nil, EventUpgraded, "", now)
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+	if sub.Plan != DefaultPlan || sub.Status != StatusActive {
+		t.Errorf("upgrade, got %#v", sub)
+	}
+	if !sub.ActiveAt(now) {
+		t.Errorf("upgraded subscription not active")
+	}
+
+	// payment fails at the end of the period
+	end := sub.PeriodEnd
+	sub, err = conf.Apply(&sub, EventPaymentFailed, "", end.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+	if sub.Status != StatusPastDue {
+		t.Errorf("expect %s, got %s", StatusPastDue, sub.Status)
+	}
+	if !sub.ActiveAt(end.Add(conf.Grace - time.Hour)) {
+		t.Errorf("past due subscription not active within grace")
+	}
+	if sub.ActiveAt(end.Add(conf.Grace)) {
+		t.Errorf("past due subscription active after grace")
+	}
+
+	// renewal continues the paid period and clears grace
+	sub, err = conf.Apply(&sub, EventRenewed, "", end.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+	if sub.Status != StatusActive || sub.GraceUntil != nil {
+		t.Errorf("renew, got %#v", sub)
+	}
+	if !sub.PeriodEnd.Equal(end.Add(conf.Period)) {
+		t.Errorf("expect period end %s, got %s", end.Add(conf.Period), sub.PeriodEnd)
+	}
+
+	downAt := end.Add(2 * time.Hour)
+	sub, err = conf.Apply(&sub, EventDowngraded, "", downAt)
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+	if sub.ActiveAt(downAt) {
+		t.Errorf("downgraded subscription is active")
+	}
+}
+
+func TestApplyWithoutSubscription(t *testing.T) {
+	now := time.Now()
+
+	_, err := DefaultConfig.Apply(nil, EventDowngraded, "", now)
+	if !errors.Is(err, ErrNoSubscription) {
+		t.Errorf("expect %s, got %v", ErrNoSubscription, err)
+	}
+
+	_, err = DefaultConfig.Apply(nil, EventPaymentFailed, "", now)
+	if !errors.Is(err, ErrNoSubscription) {
+		t.Errorf("expect %s, got %v", ErrNoSubscription, err)
+	}
+
+	_, err = DefaultConfig.Apply(nil, "user.unknown", "", now)
+	if !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("expect %s, got %v", ErrUnknownEvent, err)
+	}
+
+	sub, err := DefaultConfig.Apply(nil, EventRenewed, "gold", now)
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+	if sub.Plan != "gold" || !sub.ActiveAt(now) {
+		t.Errorf("renew without subscription, got %#v", sub)
+	}
+}
+
+func TestLatePaymentFailed(t *testing.T) {
+	conf := Config{Period: 30 * 24 * time.Hour, Grace: 3 * 24 * time.Hour}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, status := range []string{StatusCanceled, StatusExpired} {
+		sub := State{Plan: DefaultPlan, Status: status, PeriodStart: now.Add(-conf.Period), PeriodEnd: now}
+		next, err := conf.Apply(&sub, EventPaymentFailed, "", now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Unexpected Error: %s", err)
+		}
+		if next.Status != status || next.GraceUntil != nil || next.ActiveAt(now.Add(time.Hour)) {
+			t.Errorf("expect the %s subscription unchanged, got %#v", status, next)
+		}
+	}
+
+	// a second failure keeps the grace of the first
+	sub, _ := conf.Apply(nil, EventUpgraded, "", now)
+	sub, _ = conf.Apply(&sub, EventPaymentFailed, "", now)
+	grace := *sub.GraceUntil
+	sub, _ = conf.Apply(&sub, EventPaymentFailed, "", now.Add(24*time.Hour))
+	if !sub.GraceUntil.Equal(grace) {
+		t.Errorf("expect grace until %s, got %s", grace, sub.GraceUntil)
+	}
+}
+
+func TestRenewKeepsPlan(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sub, _ := DefaultConfig.Apply(nil, EventUpgraded, "gold", now)
+	sub, err := DefaultConfig.Apply(&sub, EventRenewed, "", now.Add(DefaultConfig.Period))
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+	if sub.Plan != "gold" {
+		t.Errorf("expect plan gold kept, got %s", sub.Plan)
+	}
+	sub, _ = DefaultConfig.Apply(&sub, EventRenewed, "platinum", now.Add(2*DefaultConfig.Period))
+	if sub.Plan != "platinum" {
+		t.Errorf("expect plan platinum, got %s", sub.Plan)
+	}
+}
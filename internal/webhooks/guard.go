@@ -0,0 +1,123 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for an endpoint at an address of the
+// server's own network.
+var ErrForbiddenAddress = errors.New("webhooks: address not allowed")
+
+// Guard keeps webhooks from reaching into the server's network: the loopback,
+// private, carrier-grade NAT, link-local, unspecified and multicast addresses
+// are refused unless they are in Allow.
+type Guard struct {
+	// Allow are the networks allowed anyway, like a receiver on localhost
+	// in development.
+	Allow []netip.Prefix
+}
+
+// ParseNetworks parses a comma separated list of IPs and CIDRs.
+func ParseNetworks(s string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("webhooks: allowed network %q: %w", field, err)
+			}
+			networks = append(networks, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks: allowed network %q: %w", field, err)
+		}
+		networks = append(networks, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return networks, nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private to a provider's
+// network but not to netip's IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func internal(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		sharedAddressSpace.Contains(addr)
+}
+
+// Check returns ErrForbiddenAddress if webhooks may not be sent to addr.
+func (g Guard) Check(addr netip.Addr) error {
+	// an IPv4 address mapped to IPv6 is the IPv4 address
+	addr = addr.Unmap()
+	if !internal(addr) {
+		return nil
+	}
+	for _, prefix := range g.Allow {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+}
+
+// CheckHost checks every address host resolves to. It only catches the
+// endpoints that are obviously internal, as the name can resolve elsewhere
+// by the time of a delivery: the Dispatcher checks again on connecting.
+func (g Guard) CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.Check(addr)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+	for _, addr := range addrs {
+		if err := g.Check(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// control checks the address a connection is about to be made to, after
+// the name was resolved.
+func (g Guard) control(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	return g.Check(addrPort.Addr())
+}
+
+// Client returns an HTTP client whose connections are checked by g. It
+// doesn't follow redirects, which could lead anywhere, nor use a proxy,
+// which would connect for it.
+func (g Guard) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: g.control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
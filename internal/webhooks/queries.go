@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/database"
+)
+
+// Queries are the database queries of the delivery queue.
+type Queries interface {
+	ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error)
+	MarkWebhookDelivery(ctx context.Context, arg database.MarkWebhookDeliveryParams) error
+}
+
+// Enqueuer adds deliveries to the queue.
+type Enqueuer interface {
+	EnqueueWebhookDeliveries(ctx context.Context, arg database.EnqueueWebhookDeliveriesParams) (int64, error)
+}
+
+// QueryStore keeps deliveries in the webhook_deliveries table.
+type QueryStore struct {
+	Q Queries
+}
+
+func (s QueryStore) Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]Delivery, error) {
+	rows, err := s.Q.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LeaseUntil: leaseUntil,
+		Batch:      int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := map[uuid.UUID]database.WebhookEndpoint{}
+	deliveries := make([]Delivery, 0, len(rows))
+	for _, row := range rows {
+		endpoint, ok := endpoints[row.EndpointID]
+		if !ok {
+			endpoint, err = s.Q.GetWebhookEndpoint(ctx, row.EndpointID)
+			if err != nil {
+				return nil, err
+			}
+			endpoints[row.EndpointID] = endpoint
+		}
+
+		deliveries = append(deliveries, Delivery{
+			ID:       row.ID,
+			Event:    row.Event,
+			Payload:  row.Payload,
+			Attempts: int(row.Attempts),
+			URL:      endpoint.Url,
+			Secret:   endpoint.Secret,
+		})
+	}
+	return deliveries, nil
+}
+
+func (s QueryStore) Finish(ctx context.Context, id uuid.UUID, res Result) error {
+	return s.Q.MarkWebhookDelivery(ctx, database.MarkWebhookDeliveryParams{
+		ID:             id,
+		Status:         res.Status,
+		Attempts:       int32(res.Attempts),
+		NextAttemptAt:  res.NextAttemptAt,
+		LastStatusCode: int32(res.StatusCode),
+		LastError:      res.Error,
+	})
+}
+
+// Enqueue queues event for every active endpoint subscribed to it. Pass
+// queries bound to a transaction to enqueue along with the change.
+func Enqueue(ctx context.Context, q Enqueuer, event string, data any) error {
+	payload, err := NewPayload(event, data)
+	if err != nil {
+		return err
+	}
+	_, err = q.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		Event:   event,
+		Payload: payload,
+	})
+	return err
+}
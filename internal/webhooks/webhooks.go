@@ -0,0 +1,228 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+)
+
+// Events developers can subscribe to.
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpDeleted = "chirp.deleted"
+	EventUserFollowed = "user.followed"
+	EventUserUpgraded = "user.upgraded"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+const (
+	EventHeader    = "X-Webhook-Event"
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// Known reports if event can be subscribed to.
+func Known(event string) bool {
+	switch event {
+	case EventChirpCreated, EventChirpDeleted, EventUserFollowed, EventUserUpgraded:
+		return true
+	}
+	return false
+}
+
+// Envelope is the JSON body of every delivery.
+type Envelope struct {
+	ID        uuid.UUID       `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewPayload wraps data in an Envelope for event.
+func NewPayload(event string, data any) ([]byte, error) {
+	jData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		ID:        uuid.New(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      jData,
+	})
+}
+
+// Delivery is one attempt of sending an event to an endpoint.
+type Delivery struct {
+	ID       uuid.UUID
+	Event    string
+	Payload  []byte
+	Attempts int
+	URL      string
+	Secret   string
+}
+
+// Result is the outcome of a delivery attempt.
+type Result struct {
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	StatusCode    int
+	Error         string
+}
+
+// Store is the durable queue of deliveries.
+type Store interface {
+	// Claim leases up to limit due deliveries until leaseUntil.
+	Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]Delivery, error)
+	// Finish records the result of an attempt.
+	Finish(ctx context.Context, id uuid.UUID, res Result) error
+}
+
+// Dispatcher sends queued deliveries, retrying failures with exponential
+// backoff until MaxAttempts is reached and the delivery is dead. The Client of
+// NewDispatcher only connects to the addresses its Guard allows.
+type Dispatcher struct {
+	Store       Store
+	Client      *http.Client
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Batch       int
+	Interval    time.Duration
+	// Lease is how long a batch is claimed for, after which the deliveries
+	// not yet sent are due again, for any instance.
+	Lease time.Duration
+}
+
+func NewDispatcher(store Store, guard Guard) *Dispatcher {
+	const batch, timeout = 20, 10 * time.Second
+	return &Dispatcher{
+		Store:       store,
+		Client:      guard.Client(timeout),
+		MaxAttempts: 8,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  6 * time.Hour,
+		Batch:       batch,
+		Interval:    2 * time.Second,
+		// room to send the whole batch, each delivery timing out
+		Lease: batch*timeout + time.Minute,
+	}
+}
+
+// Run processes due deliveries every Interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		_, err := d.RunOnce(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "webhook dispatch", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends one batch of due deliveries and returns how many were attempted.
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	leaseUntil := time.Now().Add(d.Lease)
+	deliveries, err := d.Store.Claim(ctx, d.Batch, leaseUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, delivery := range deliveries {
+		// a delivery that could still be in flight once the lease ends
+		// would be claimed and sent again, it waits for the next claim
+		if time.Now().Add(d.Client.Timeout).After(leaseUntil) {
+			return i, nil
+		}
+		res := d.Attempt(ctx, delivery)
+		if err := d.Store.Finish(ctx, delivery.ID, res); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// Attempt sends a delivery once and returns its result.
+func (d *Dispatcher) Attempt(ctx context.Context, delivery Delivery) Result {
+	res := Result{Attempts: delivery.Attempts + 1}
+
+	code, err := d.send(ctx, delivery)
+	res.StatusCode = code
+	if err == nil {
+		res.Status = StatusDelivered
+		res.NextAttemptAt = time.Now()
+		return res
+	}
+
+	res.Error = err.Error()
+	if res.Attempts >= d.MaxAttempts {
+		res.Status = StatusDead
+		res.NextAttemptAt = time.Now()
+		return res
+	}
+	res.Status = StatusPending
+	res.NextAttemptAt = time.Now().Add(d.Backoff(res.Attempts))
+	return res
+}
+
+// Backoff returns how long to wait after the given number of failed attempts.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	wait := d.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= d.MaxBackoff {
+			return d.MaxBackoff
+		}
+	}
+	return wait
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(auth.WebhookTimestampHeader, strconv.FormatInt(now, 10))
+	req.Header.Set(auth.WebhookSignatureHeader, "v1="+auth.SignWebhook(delivery.Secret, now, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,252 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dubbersthehoser/httpserver/internal/auth"
+)
+
+type memoryStore struct {
+	mu         sync.Mutex
+	deliveries map[uuid.UUID]*Delivery
+	due        map[uuid.UUID]time.Time
+	results    map[uuid.UUID]Result
+}
+
+func newMemoryStore(deliveries ...Delivery) *memoryStore {
+	s := &memoryStore{
+		deliveries: map[uuid.UUID]*Delivery{},
+		due:        map[uuid.UUID]time.Time{},
+		results:    map[uuid.UUID]Result{},
+	}
+	for i := range deliveries {
+		s.deliveries[deliveries[i].ID] = &deliveries[i]
+		s.due[deliveries[i].ID] = time.Now()
+	}
+	return s
+}
+
+func (s *memoryStore) Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed []Delivery
+	for id, d := range s.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if s.results[id].Status != "" && s.results[id].Status != StatusPending {
+			continue
+		}
+		if time.Now().Before(s.due[id]) {
+			continue
+		}
+		s.due[id] = leaseUntil
+		claimed = append(claimed, *d)
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) Finish(ctx context.Context, id uuid.UUID, res Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[id] = res
+	s.deliveries[id].Attempts = res.Attempts
+	s.due[id] = res.NextAttemptAt
+	return nil
+}
+
+// local lets the dispatchers reach the httptest receivers.
+var local = Guard{Allow: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}
+
+func TestDeliverSigned(t *testing.T) {
+	secret := "endpoint secret"
+	payload, err := NewPayload(EventChirpCreated, map[string]string{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *http.Request, 1)
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		err := auth.ValidateWebhookSignature(r.Header, body, secret, time.Minute)
+		if err != nil {
+			t.Errorf("invalid signature: %s", err)
+		}
+		received <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	delivery := Delivery{ID: uuid.New(), Event: EventChirpCreated, Payload: payload, URL: receiver.URL, Secret: secret}
+	store := newMemoryStore(delivery)
+	d := NewDispatcher(store, local)
+
+	n, err := d.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected Error: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("expect 1 delivery, got %d", n)
+	}
+
+	r := <-received
+	if r.Header.Get(EventHeader) != EventChirpCreated {
+		t.Errorf("expect event header %s, got %s", EventChirpCreated, r.Header.Get(EventHeader))
+	}
+	if r.Header.Get(DeliveryHeader) != delivery.ID.String() {
+		t.Errorf("expect delivery header %s, got %s", delivery.ID, r.Header.Get(DeliveryHeader))
+	}
+	if string(body) != string(payload) {
+		t.Errorf("expect body %s, got %s", payload, body)
+	}
+
+	res := store.results[delivery.ID]
+	if res.Status != StatusDelivered || res.StatusCode != http.StatusNoContent || res.Attempts != 1 {
+		t.Errorf("unexpected result %#v", res)
+	}
+}
+
+func TestRetryUntilDead(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	delivery := Delivery{ID: uuid.New(), Event: EventChirpDeleted, Payload: []byte(`{}`), URL: receiver.URL}
+	store := newMemoryStore(delivery)
+	d := NewDispatcher(store, local)
+	d.MaxAttempts = 3
+	d.BaseBackoff = 0
+
+	for i := 1; i <= 3; i++ {
+		_, err := d.RunOnce(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected Error: %s", err)
+		}
+		res := store.results[delivery.ID]
+		if res.Attempts != i {
+			t.Errorf("expect %d attempts, got %d", i, res.Attempts)
+		}
+		if res.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expect status code 503, got %d", res.StatusCode)
+		}
+	}
+
+	if s := store.results[delivery.ID].Status; s != StatusDead {
+		t.Errorf("expect %s, got %s", StatusDead, s)
+	}
+
+	n, _ := d.RunOnce(context.Background())
+	if n != 0 {
+		t.Errorf("dead delivery was attempted again")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, Guard{})
+	d.BaseBackoff = time.Second
+	d.MaxBackoff = 10 * time.Second
+
+	expect := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, e := range expect {
+		if got := d.Backoff(i + 1); got != e {
+			t.Errorf("Backoff(%d): expect %s, got %s", i+1, e, got)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	var g Guard
+	for _, addr := range []string{"93.184.215.14", "100.128.0.1", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"} {
+		if err := g.Check(netip.MustParseAddr(addr)); err != nil {
+			t.Errorf("expect %s allowed, got %s", addr, err)
+		}
+	}
+	for _, addr := range []string{
+		"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "fd00::1",
+		"169.254.169.254", "fe80::1", "0.0.0.0", "::", "224.0.0.1", "ff02::1",
+		"::ffff:127.0.0.1", "100.64.0.1", "100.127.255.254",
+	} {
+		if err := g.Check(netip.MustParseAddr(addr)); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("expect %s refused, got %v", addr, err)
+		}
+	}
+
+	if err := local.Check(netip.MustParseAddr("127.0.0.2")); err != nil {
+		t.Errorf("expect an allowed network to pass, got %s", err)
+	}
+	if err := g.CheckHost(context.Background(), "localhost"); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("expect localhost refused, got %v", err)
+	}
+
+	allow, err := ParseNetworks(" 127.0.0.1, 10.0.0.0/8 ,")
+	if err != nil || len(allow) != 2 || allow[0].String() != "127.0.0.1/32" {
+		t.Errorf("unexpected networks %v %v", allow, err)
+	}
+	if _, err := ParseNetworks("10.0.0.0/33"); err == nil {
+		t.Error("expect an invalid network error")
+	}
+}
+
+func TestDeliverGuarded(t *testing.T) {
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(receiver.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	// the receiver is on loopback, refused on connecting
+	d := NewDispatcher(nil, Guard{})
+	res := d.Attempt(context.Background(), Delivery{ID: uuid.New(), Payload: []byte(`{}`), URL: receiver.URL})
+	if res.Status != StatusPending || !strings.Contains(res.Error, ErrForbiddenAddress.Error()) {
+		t.Errorf("expect the delivery refused, got %#v", res)
+	}
+
+	// redirects aren't followed
+	d = NewDispatcher(nil, local)
+	res = d.Attempt(context.Background(), Delivery{ID: uuid.New(), Payload: []byte(`{}`), URL: redirect.URL})
+	if res.Status != StatusPending || res.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expect the redirect to fail the delivery, got %#v", res)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("expect the receiver never reached, got %d requests", n)
+	}
+}
+
+func TestLease(t *testing.T) {
+	d := NewDispatcher(nil, Guard{})
+	if send := time.Duration(d.Batch) * d.Client.Timeout; d.Lease <= send {
+		t.Errorf("expect a lease over the %s a batch can take, got %s", send, d.Lease)
+	}
+
+	// deliveries that could outlive the lease are left for the next claim
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer receiver.Close()
+	store := newMemoryStore(Delivery{ID: uuid.New(), Payload: []byte(`{}`), URL: receiver.URL})
+	d = NewDispatcher(store, local)
+	d.Lease = d.Client.Timeout / 2
+
+	n, err := d.RunOnce(context.Background())
+	if err != nil || n != 0 || hits.Load() != 0 {
+		t.Errorf("expect nothing sent, got %d %v, %d requests", n, err, hits.Load())
+	}
+}
@@ -0,0 +1,7 @@
+// Package servfiles embeds the web site so the binary serves it from anywhere.
+package servfiles
+
+import "embed"
+
+//go:embed app
+var FS embed.FS
@@ -0,0 +1,7 @@
+-- name: NotifyChirpEvent :exec
+SELECT pg_notify('chirp_events', json_build_object(
+	'id', nextval('chirp_event_ids'),
+	'type', sqlc.arg(type)::text,
+	'user_id', sqlc.arg(user_id)::uuid,
+	'data', sqlc.arg(data)::json
+)::text);
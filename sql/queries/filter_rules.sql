@@ -0,0 +1,27 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, kind, pattern, action, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	now(),
+	now()
+)
+RETURNING *;
+
+-- name: GetFilterRule :one
+SELECT * FROM filter_rules WHERE id = $1;
+
+-- name: ListFilterRules :many
+SELECT * FROM filter_rules
+ORDER BY created_at, id;
+
+-- name: UpdateFilterRule :one
+UPDATE filter_rules
+SET kind = $2, pattern = $3, action = $4, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE id = $1;
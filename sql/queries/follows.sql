@@ -0,0 +1,21 @@
+-- name: FollowUser :execrows
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+	$1,
+	$2,
+	now()
+)
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFolloweeIDs :many
+SELECT followee_id FROM follows
+WHERE follower_id = $1
+ORDER BY created_at DESC;
+
+-- name: IsFollowing :one
+SELECT EXISTS (
+	SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2
+) AS is_following;
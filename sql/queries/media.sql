@@ -0,0 +1,34 @@
+-- name: CreateMedia :one
+INSERT INTO media (id, user_id, content_type, size, created_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	now()
+)
+RETURNING *;
+
+-- name: GetMedia :one
+SELECT * FROM media WHERE id = $1;
+
+-- name: AttachMedia :execrows
+UPDATE media
+SET chirp_id = $1, position = $2
+WHERE id = $3 AND user_id = $4 AND chirp_id IS NULL;
+
+-- name: ListMediaByChirps :many
+SELECT * FROM media
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: ListAllMedia :many
+SELECT * FROM media;
+
+-- name: ListUnattachedMedia :many
+SELECT * FROM media
+WHERE chirp_id IS NULL AND created_at < $1
+ORDER BY created_at;
+
+-- name: DeleteUnattachedMedia :execrows
+DELETE FROM media WHERE id = $1 AND chirp_id IS NULL;
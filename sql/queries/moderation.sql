@@ -0,0 +1,73 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, reporter_id, user_id, chirp_id, reason, details, status, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	'open',
+	now(),
+	now()
+)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports WHERE id = $1;
+
+-- name: ListReports :many
+-- oldest first, the queue is worked from the front
+SELECT * FROM reports
+WHERE status = sqlc.arg(status)
+AND (created_at > sqlc.arg(after) OR (created_at = sqlc.arg(after) AND id > sqlc.arg(after_id)))
+ORDER BY created_at, id
+LIMIT sqlc.arg(max_rows);
+
+-- name: ClaimReport :one
+-- an open report, or one the moderator already claimed
+UPDATE reports SET status = 'claimed', moderator_id = sqlc.arg(moderator_id), updated_at = now()
+WHERE id = sqlc.arg(id)
+AND (status = 'open' OR (status = 'claimed' AND moderator_id = sqlc.arg(moderator_id)))
+RETURNING *;
+
+-- name: CloseReport :one
+-- resolves or dismisses a report open or claimed by the moderator
+UPDATE reports SET status = sqlc.arg(status), resolution = sqlc.arg(resolution), moderator_id = sqlc.arg(moderator_id), updated_at = now()
+WHERE id = sqlc.arg(id)
+AND (status = 'open' OR (status = 'claimed' AND moderator_id = sqlc.arg(moderator_id)))
+RETURNING *;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_log (id, moderator_id, action, report_id, user_id, chirp_id, note, created_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	now()
+)
+RETURNING *;
+
+-- name: ListModerationLog :many
+SELECT * FROM moderation_log
+WHERE created_at < sqlc.arg(before) OR (created_at = sqlc.arg(before) AND id < sqlc.arg(before_id))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: IsModerator :one
+SELECT EXISTS (SELECT 1 FROM moderators WHERE user_id = $1) AS is_moderator;
+
+-- name: AddModerator :exec
+INSERT INTO moderators (user_id, created_at)
+VALUES (
+	$1,
+	now()
+)
+ON CONFLICT (user_id) DO NOTHING;
+
+-- name: RemoveModerator :exec
+DELETE FROM moderators WHERE user_id = $1;
@@ -0,0 +1,22 @@
+-- name: TakeRateLimitToken :one
+-- Refills the token bucket of key for the time since it was last used, then
+-- takes a token if there's one. allowed is if a token was taken.
+INSERT INTO rate_limits AS rl (key, tokens, allowed, updated_at)
+VALUES (
+	sqlc.arg(key),
+	sqlc.arg(burst)::float8 - 1,
+	true,
+	now()
+)
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+		WHEN LEAST(sqlc.arg(burst)::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * sqlc.arg(rate)::float8) >= 1
+		THEN LEAST(sqlc.arg(burst)::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * sqlc.arg(rate)::float8) - 1
+		ELSE LEAST(sqlc.arg(burst)::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * sqlc.arg(rate)::float8)
+	END,
+	allowed = LEAST(sqlc.arg(burst)::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * sqlc.arg(rate)::float8) >= 1,
+	updated_at = now()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimits :execrows
+DELETE FROM rate_limits WHERE updated_at < $1;
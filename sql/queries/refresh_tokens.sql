@@ -13,6 +13,10 @@ RETURNING *;
 UPDATE refresh_tokens
 SET revoked_at = now(), updated_at = now() WHERE token = $1;
 
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now() WHERE user_id = $1 AND revoked_at IS NULL;
+
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens WHERE token = $1;
 
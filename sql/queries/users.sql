@@ -1,28 +1,55 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     now(),
     now(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING *;
+RETURNING *, false AS is_chirpy_red;
+
+-- name: LockUser :exec
+-- holds the user's row until the end of the transaction, so that what's
+-- counted for the user's limits doesn't change before it's written.
+SELECT id FROM users WHERE id = $1 FOR UPDATE;
 
 -- name: DeleteAllUsers :exec
 DELETE FROM users;
 
+-- name: GetUserByID :one
+SELECT users.*, EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS is_chirpy_red
+FROM users WHERE users.id = $1;
+
 -- name: GetUserByEmailWithPassword :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1;
+SELECT users.*, EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS is_chirpy_red
+FROM users WHERE users.email = $1;
 
 -- name: UpdateUserEmailAndPassword :one
 UPDATE users
 SET updated_at = now(), email = $2, hashed_password = $3
-WHERE id = $1
-RETURNING *;
+WHERE users.id = $1
+RETURNING *, EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS is_chirpy_red;
 
+-- name: GetUserIDsByHandles :many
+SELECT id FROM users
+WHERE handle = ANY(sqlc.arg(handles)::text[]);
 
--- name: SetUserToRed :exec
-UPDATE users
-SET updated_at = now(), is_chirpy_red = true
-WHERE id = $1;
+-- name: UpdateUserHandle :exec
+UPDATE users SET updated_at = now(), handle = $2 WHERE id = $1;
@@ -0,0 +1,25 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, source, event, payload, received_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	now()
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING *;
+
+-- name: MarkWebhookEvent :exec
+UPDATE webhook_events
+SET status = $2, processed_at = now()
+WHERE id = $1;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE source = $1
+ORDER BY received_at DESC
+LIMIT $2;
@@ -0,0 +1,65 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, user_id, url, secret, events, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	now(),
+	now()
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints WHERE id = $1;
+
+-- name: ListWebhookEndpointsByUser :many
+SELECT * FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at ASC;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2;
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, endpoint_id, event, payload, next_attempt_at, created_at, updated_at)
+SELECT gen_random_uuid(), webhook_endpoints.id, sqlc.arg(event)::text, sqlc.arg(payload)::jsonb, now(), now(), now()
+FROM webhook_endpoints
+WHERE webhook_endpoints.active AND sqlc.arg(event)::text = ANY(webhook_endpoints.events);
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until), updated_at = now()
+WHERE webhook_deliveries.id IN (
+	SELECT due.id FROM webhook_deliveries AS due
+	WHERE due.status = 'pending' AND due.next_attempt_at <= now()
+	ORDER BY due.next_attempt_at
+	LIMIT sqlc.arg(batch)
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = $2,
+	attempts = $3,
+	next_attempt_at = $4,
+	last_status_code = $5,
+	last_error = $6,
+	updated_at = now()
+WHERE id = $1;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries WHERE id = $1;
+
+-- name: ListWebhookDeliveriesByEndpoint :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- A pending delivery is due, backing off or being sent, and is left alone.
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = now(), updated_at = now()
+WHERE id = $1 AND status <> 'pending'
+RETURNING *;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+	id TEXT PRIMARY KEY,
+	source TEXT NOT NULL,
+	event TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'received',
+	received_at TIMESTAMP NOT NULL,
+	processed_at TIMESTAMP);
+
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
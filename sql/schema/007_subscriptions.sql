@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL UNIQUE,
+	plan TEXT NOT NULL,
+	status TEXT NOT NULL,
+	current_period_start TIMESTAMP NOT NULL,
+	current_period_end TIMESTAMP NOT NULL,
+	grace_until TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+INSERT INTO subscriptions (id, user_id, plan, status, current_period_start, current_period_end, created_at, updated_at)
+SELECT gen_random_uuid(), id, 'chirpy_red', 'active', now(), now() + interval '30 days', now(), now()
+FROM users WHERE is_chirpy_red;
+
+ALTER TABLE users DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET is_chirpy_red = true
+WHERE id IN (SELECT user_id FROM subscriptions WHERE status IN ('active', 'past_due'));
+
+DROP TABLE subscriptions;
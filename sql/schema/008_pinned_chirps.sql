@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE pinned_chirps (
+	user_id UUID NOT NULL,
+	chirp_id UUID NOT NULL,
+	pinned_at TIMESTAMP NOT NULL,
+
+	PRIMARY KEY (user_id, chirp_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE);
+
+-- +goose Down
+DROP TABLE pinned_chirps;
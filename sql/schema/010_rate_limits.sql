@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE rate_limits (
+	key TEXT PRIMARY KEY,
+	tokens DOUBLE PRECISION NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	updated_at TIMESTAMP NOT NULL);
+
+CREATE INDEX rate_limits_updated_at_idx ON rate_limits (updated_at);
+
+-- +goose Down
+DROP TABLE rate_limits;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- ids of the chirp events streamed to clients, shared by every instance
+CREATE SEQUENCE chirp_event_ids;
+
+-- +goose Down
+DROP SEQUENCE chirp_event_ids;
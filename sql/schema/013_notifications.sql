@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE notifications (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL,
+	type TEXT NOT NULL,
+	actor_id UUID,
+	chirp_id UUID,
+	created_at TIMESTAMP NOT NULL,
+	read_at TIMESTAMP,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE);
+
+CREATE INDEX notifications_user_id_created_at_idx ON notifications (user_id, created_at DESC, id DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+-- Only the types a user turned off or back on are stored, every type is on
+-- by default.
+CREATE TABLE notification_preferences (
+	user_id UUID NOT NULL,
+	type TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL,
+
+	PRIMARY KEY (user_id, type),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notifications;
@@ -0,0 +1,74 @@
+-- +goose Up
+CREATE TABLE moderators (
+	user_id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+-- A report is of a user, and of one of their chirps when chirp_id is set. It's
+-- open until a moderator claims it, then resolved or dismissed.
+CREATE TABLE reports (
+	id UUID PRIMARY KEY,
+	reporter_id UUID NOT NULL,
+	user_id UUID NOT NULL,
+	chirp_id UUID,
+	reason TEXT NOT NULL,
+	details TEXT NOT NULL,
+	status TEXT NOT NULL,
+	moderator_id UUID,
+	resolution TEXT,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+
+	CHECK (status IN ('open', 'claimed', 'resolved', 'dismissed')),
+	FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE SET NULL,
+	FOREIGN KEY (moderator_id) REFERENCES users(id) ON DELETE SET NULL);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at, id);
+
+-- A suspension without expires_at is a ban.
+CREATE TABLE suspensions (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL,
+	reason TEXT NOT NULL,
+	expires_at TIMESTAMP,
+	created_by UUID,
+	created_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL);
+
+CREATE INDEX suspensions_user_id_idx ON suspensions (user_id);
+
+-- The moderation log is every action of the moderators. It has no foreign keys
+-- so it outlives the users and chirps it's about, and its rows can't be
+-- changed or deleted.
+CREATE TABLE moderation_log (
+	id UUID PRIMARY KEY,
+	moderator_id UUID NOT NULL,
+	action TEXT NOT NULL,
+	report_id UUID,
+	user_id UUID,
+	chirp_id UUID,
+	note TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL);
+
+-- +goose StatementBegin
+CREATE FUNCTION moderation_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'moderation_log is append only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER moderation_log_append_only BEFORE UPDATE OR DELETE ON moderation_log
+FOR EACH ROW EXECUTE FUNCTION moderation_log_append_only();
+
+-- +goose Down
+DROP TABLE moderation_log;
+DROP FUNCTION moderation_log_append_only;
+DROP TABLE suspensions;
+DROP TABLE reports;
+DROP TABLE moderators;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- A lifted suspension is over early, kept for the user's history.
+ALTER TABLE suspensions ADD COLUMN lifted_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE suspensions DROP COLUMN lifted_at;
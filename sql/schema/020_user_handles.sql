@@ -0,0 +1,24 @@
+-- +goose Up
+-- A user is mentioned by their handle, unique among the users. The handles of
+-- the users from before start as the part of their email before the @, with
+-- the start of their id after it when an older user has it already.
+ALTER TABLE users ADD COLUMN handle TEXT;
+
+UPDATE users
+SET handle = CASE WHEN h.n = 1 THEN h.base ELSE h.base || '_' || substr(replace(users.id::text, '-', ''), 1, 8) END
+FROM (
+	SELECT id, base, row_number() OVER (PARTITION BY base ORDER BY created_at, id) AS n
+	FROM (
+		SELECT id, created_at, COALESCE(NULLIF(lower(split_part(email, '@', 1)), ''), 'user') AS base
+		FROM users
+	) AS b
+) AS h
+WHERE users.id = h.id;
+
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX users_handle_idx ON users (handle);
+
+-- +goose Down
+DROP INDEX users_handle_idx;
+ALTER TABLE users DROP COLUMN handle;
@@ -0,0 +1,45 @@
+-- name: BlockUser :execrows
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES (
+	?,
+	?,
+	now()
+)
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ?;
+
+-- name: ListBlocks :many
+SELECT * FROM blocks
+WHERE blocker_id = ?
+ORDER BY created_at DESC;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+	SELECT 1 FROM blocks
+	WHERE (blocker_id = sqlc.arg(user_id) AND blocked_id = sqlc.arg(other_id))
+	OR (blocker_id = sqlc.arg(other_id) AND blocked_id = sqlc.arg(user_id))
+) AS is_blocked;
+
+-- name: MuteUser :execrows
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES (
+	?,
+	?,
+	now()
+)
+ON CONFLICT (muter_id, muted_id) DO NOTHING;
+
+-- name: UnmuteUser :exec
+DELETE FROM mutes WHERE muter_id = ? AND muted_id = ?;
+
+-- name: ListMutes :many
+SELECT * FROM mutes
+WHERE muter_id = ?
+ORDER BY created_at DESC;
+
+-- name: GetHiddenUserIDs :many
+SELECT blocked_id AS user_id FROM blocks WHERE blocker_id = sqlc.arg(user_id)
+UNION
+SELECT muted_id AS user_id FROM mutes WHERE muter_id = sqlc.arg(user_id);
@@ -0,0 +1,103 @@
+-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, user_id, body, held)
+VALUES (
+	gen_random_uuid(),
+	now(),
+	now(),
+	?,
+	?,
+	?
+)
+RETURNING *;
+
+-- name: GetAllChirps :many
+-- The chirp listings leave out the chirps of the users the viewer blocked or
+-- muted, of the suspended users and the held chirps. The nil UUID is an
+-- anonymous viewer, who blocked and muted nobody.
+SELECT chirps.* FROM chirps
+LEFT JOIN blocks ON blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id
+LEFT JOIN mutes ON mutes.muter_id = sqlc.arg(viewer_id) AND mutes.muted_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE NOT chirps.held AND blocks.blocker_id IS NULL AND mutes.muter_id IS NULL AND suspensions.id IS NULL
+ORDER BY chirps.created_at ASC;
+
+-- name: GetAllChirpsByUser :many
+SELECT chirps.* FROM chirps
+LEFT JOIN blocks ON blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id
+LEFT JOIN mutes ON mutes.muter_id = sqlc.arg(viewer_id) AND mutes.muted_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE chirps.user_id = sqlc.arg(user_id)
+AND NOT chirps.held AND blocks.blocker_id IS NULL AND mutes.muter_id IS NULL AND suspensions.id IS NULL
+ORDER BY chirps.created_at ASC;
+
+-- name: GetAChirp :one
+SELECT * FROM chirps WHERE id = ?;
+
+-- name: GetVisibleChirp :one
+-- GetAChirp as the viewer sees it: like the listings, without the chirps of the
+-- users the viewer blocked or of the suspended users, and with a held chirp
+-- only seen by its author. A muted user's chirp is still there to be opened.
+SELECT chirps.* FROM chirps
+LEFT JOIN blocks ON blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE chirps.id = sqlc.arg(id)
+AND (chirps.user_id = sqlc.arg(viewer_id) OR (NOT chirps.held AND blocks.blocker_id IS NULL AND suspensions.id IS NULL));
+
+-- name: DeleteChirp :exec
+DELETE FROM chirps WHERE id = ?;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = sqlc.arg(body), held = sqlc.arg(held), updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: CountChirpsByUserSince :one
+SELECT count(*) FROM chirps WHERE user_id = ? AND created_at >= ?;
+
+-- name: PinChirp :exec
+INSERT INTO pinned_chirps (user_id, chirp_id, pinned_at)
+VALUES (
+	?,
+	?,
+	now()
+)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnpinChirp :exec
+DELETE FROM pinned_chirps WHERE user_id = ? AND chirp_id = ?;
+
+-- name: IsChirpPinned :one
+SELECT EXISTS (
+	SELECT 1 FROM pinned_chirps WHERE user_id = ? AND chirp_id = ?
+) AS is_pinned;
+
+-- name: CountPinnedChirps :one
+SELECT count(*) FROM pinned_chirps WHERE user_id = ?;
+
+-- name: GetPinnedChirpsByUser :many
+SELECT chirps.* FROM chirps
+JOIN pinned_chirps ON pinned_chirps.chirp_id = chirps.id
+LEFT JOIN blocks ON blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id
+LEFT JOIN mutes ON mutes.muter_id = sqlc.arg(viewer_id) AND mutes.muted_id = chirps.user_id
+LEFT JOIN suspensions ON suspensions.user_id = chirps.user_id AND suspensions.lifted_at IS NULL
+	AND (suspensions.expires_at IS NULL OR suspensions.expires_at > now())
+WHERE pinned_chirps.user_id = sqlc.arg(user_id)
+AND NOT chirps.held AND blocks.blocker_id IS NULL AND mutes.muter_id IS NULL AND suspensions.id IS NULL
+ORDER BY pinned_chirps.pinned_at DESC;
+
+-- name: ListHeldChirps :many
+-- oldest first, like the reports
+SELECT * FROM chirps
+WHERE held
+AND (created_at > sqlc.arg(after) OR (created_at = sqlc.arg(after) AND id > sqlc.arg(after_id)))
+ORDER BY created_at, id
+LIMIT sqlc.arg(max_rows);
+
+-- name: ReleaseChirp :one
+UPDATE chirps SET held = false
+WHERE id = ? AND held
+RETURNING *;
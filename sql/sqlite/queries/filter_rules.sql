@@ -0,0 +1,27 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, kind, pattern, action, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	now(),
+	now()
+)
+RETURNING *;
+
+-- name: GetFilterRule :one
+SELECT * FROM filter_rules WHERE id = ?;
+
+-- name: ListFilterRules :many
+SELECT * FROM filter_rules
+ORDER BY created_at, id;
+
+-- name: UpdateFilterRule :one
+UPDATE filter_rules
+SET kind = sqlc.arg(kind), pattern = sqlc.arg(pattern), action = sqlc.arg(action), updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE id = ?;
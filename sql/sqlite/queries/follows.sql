@@ -0,0 +1,21 @@
+-- name: FollowUser :execrows
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+	?,
+	?,
+	now()
+)
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows WHERE follower_id = ? AND followee_id = ?;
+
+-- name: GetFolloweeIDs :many
+SELECT followee_id FROM follows
+WHERE follower_id = ?
+ORDER BY created_at DESC;
+
+-- name: IsFollowing :one
+SELECT EXISTS (
+	SELECT 1 FROM follows WHERE follower_id = ? AND followee_id = ?
+) AS is_following;
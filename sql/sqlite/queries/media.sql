@@ -0,0 +1,34 @@
+-- name: CreateMedia :one
+INSERT INTO media (id, user_id, content_type, size, created_at)
+VALUES (
+	?,
+	?,
+	?,
+	?,
+	now()
+)
+RETURNING *;
+
+-- name: GetMedia :one
+SELECT * FROM media WHERE id = ?;
+
+-- name: AttachMedia :execrows
+UPDATE media
+SET chirp_id = sqlc.arg(chirp_id), position = sqlc.arg(position)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id) AND chirp_id IS NULL;
+
+-- name: ListMediaByChirps :many
+SELECT * FROM media
+WHERE chirp_id IN (sqlc.slice(chirp_ids))
+ORDER BY chirp_id, position;
+
+-- name: ListAllMedia :many
+SELECT * FROM media;
+
+-- name: ListUnattachedMedia :many
+SELECT * FROM media
+WHERE chirp_id IS NULL AND created_at < ?
+ORDER BY created_at;
+
+-- name: DeleteUnattachedMedia :execrows
+DELETE FROM media WHERE id = ? AND chirp_id IS NULL;
@@ -0,0 +1,88 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, direct_key, created_by, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	now(),
+	now()
+)
+RETURNING *;
+
+-- name: GetConversation :one
+SELECT * FROM conversations WHERE id = ?;
+
+-- name: GetConversationByDirectKey :one
+SELECT * FROM conversations WHERE direct_key = ?;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at)
+VALUES (
+	?,
+	?,
+	now()
+);
+
+-- name: GetConversationMember :one
+SELECT * FROM conversation_members WHERE conversation_id = ? AND user_id = ?;
+
+-- name: ListConversationsByUser :many
+SELECT conversations.*, conversation_members.last_read_at, (
+	SELECT count(*) FROM messages
+	WHERE messages.conversation_id = conversations.id
+	AND messages.sender_id <> conversation_members.user_id
+	AND (conversation_members.last_read_at IS NULL OR messages.created_at > conversation_members.last_read_at)
+) AS unread_count
+FROM conversations
+JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversation_members.user_id = sqlc.arg(user_id)
+AND (conversations.updated_at < sqlc.arg(before) OR (conversations.updated_at = sqlc.arg(before) AND conversations.id < sqlc.arg(before_id)))
+ORDER BY conversations.updated_at DESC, conversations.id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: ListConversationMembers :many
+SELECT user_id FROM conversation_members WHERE conversation_id = ? ORDER BY joined_at;
+
+-- name: ListConversationMembersByUser :many
+SELECT conversation_id, user_id FROM conversation_members
+WHERE conversation_id IN (
+	SELECT mine.conversation_id FROM conversation_members AS mine WHERE mine.user_id = ?
+)
+ORDER BY joined_at;
+
+-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	now()
+)
+RETURNING *;
+
+-- name: TouchConversation :exec
+UPDATE conversations SET updated_at = now() WHERE id = ?;
+
+-- name: ListMessages :many
+SELECT * FROM messages
+WHERE conversation_id = sqlc.arg(conversation_id)
+AND (created_at < sqlc.arg(before) OR (created_at = sqlc.arg(before) AND id < sqlc.arg(before_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_members SET last_read_at = now()
+WHERE conversation_id = ? AND user_id = ?;
+
+-- name: GetMessageSettings :one
+SELECT * FROM message_settings WHERE user_id = ?;
+
+-- name: SetMessageSettings :one
+INSERT INTO message_settings (user_id, accept_from)
+VALUES (
+	?,
+	?
+)
+ON CONFLICT (user_id) DO UPDATE SET accept_from = excluded.accept_from
+RETURNING *;
@@ -0,0 +1,21 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token, expires_at, user_id, updated_at, created_at)
+VALUES (
+	?,
+	?,
+	?,
+	now(),
+	now()
+)
+RETURNING *;
+
+-- name: RevokeToken :exec
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now() WHERE token = ?;
+
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now() WHERE user_id = ? AND revoked_at IS NULL;
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens WHERE token = ?;
@@ -0,0 +1,30 @@
+-- name: GetSubscriptionByUser :one
+SELECT * FROM subscriptions WHERE user_id = ?;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (id, user_id, plan, status, current_period_start, current_period_end, grace_until, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	?,
+	?,
+	?,
+	now(),
+	now()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET plan = excluded.plan,
+	status = excluded.status,
+	current_period_start = excluded.current_period_start,
+	current_period_end = excluded.current_period_end,
+	grace_until = excluded.grace_until,
+	updated_at = now()
+RETURNING *;
+
+-- name: ExpireLapsedSubscriptions :execrows
+UPDATE subscriptions
+SET status = 'expired', updated_at = now()
+WHERE status IN ('active', 'past_due')
+AND now() >= COALESCE(grace_until, current_period_end);
@@ -0,0 +1,27 @@
+-- name: CreateSuspension :one
+INSERT INTO suspensions (id, user_id, reason, expires_at, created_by, created_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	?,
+	now()
+)
+RETURNING *;
+
+-- name: GetActiveSuspension :one
+-- a ban first, then the suspension ending last
+SELECT * FROM suspensions
+WHERE user_id = ? AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+ORDER BY expires_at IS NULL DESC, expires_at DESC
+LIMIT 1;
+
+-- name: ListSuspensionsByUser :many
+SELECT * FROM suspensions
+WHERE user_id = ?
+ORDER BY created_at DESC;
+
+-- name: LiftSuspensions :execrows
+UPDATE suspensions SET lifted_at = now()
+WHERE user_id = ? AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > now());
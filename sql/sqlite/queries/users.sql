@@ -0,0 +1,56 @@
+-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
+VALUES (
+	gen_random_uuid(),
+	now(),
+	now(),
+	?,
+	?,
+	?
+)
+RETURNING id, created_at, updated_at, email, hashed_password, handle, CAST(false AS BOOLEAN) AS is_chirpy_red;
+
+-- name: LockUser :exec
+-- SQLite has no row locks, but the transactions are begun immediate and so
+-- run one at a time already.
+SELECT id FROM users WHERE id = ?;
+
+-- name: DeleteAllUsers :exec
+DELETE FROM users;
+
+-- name: GetUserByID :one
+SELECT users.*, CAST(EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS BOOLEAN) AS is_chirpy_red
+FROM users WHERE users.id = ?;
+
+-- name: GetUserByEmailWithPassword :one
+SELECT users.*, CAST(EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS BOOLEAN) AS is_chirpy_red
+FROM users WHERE users.email = ?;
+
+-- name: UpdateUserEmailAndPassword :one
+UPDATE users
+SET updated_at = now(), email = sqlc.arg(email), hashed_password = sqlc.arg(hashed_password)
+WHERE users.id = sqlc.arg(id)
+RETURNING id, created_at, updated_at, email, hashed_password, handle, CAST(EXISTS (
+	SELECT 1 FROM subscriptions
+	WHERE subscriptions.user_id = users.id
+	AND subscriptions.status IN ('active', 'past_due')
+	AND now() < COALESCE(subscriptions.grace_until, subscriptions.current_period_end)
+) AS BOOLEAN) AS is_chirpy_red;
+
+-- name: GetUserIDsByHandles :many
+-- handles is the handles comma separated and wrapped in commas, ",walt,jesse,".
+SELECT id FROM users
+WHERE instr(CAST(sqlc.arg(handles) AS TEXT), ',' || handle || ',') > 0;
+
+-- name: UpdateUserHandle :exec
+UPDATE users SET updated_at = now(), handle = ? WHERE id = ?;
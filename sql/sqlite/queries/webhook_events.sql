@@ -0,0 +1,25 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, source, event, payload, received_at)
+VALUES (
+	?,
+	?,
+	?,
+	?,
+	now()
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING *;
+
+-- name: MarkWebhookEvent :exec
+UPDATE webhook_events
+SET status = sqlc.arg(status), processed_at = now()
+WHERE id = sqlc.arg(id);
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events WHERE id = ?;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE source = ?
+ORDER BY received_at DESC
+LIMIT ?;
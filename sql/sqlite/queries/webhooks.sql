@@ -0,0 +1,67 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, user_id, url, secret, events, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	?,
+	?,
+	?,
+	?,
+	now(),
+	now()
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints WHERE id = ?;
+
+-- name: ListWebhookEndpointsByUser :many
+SELECT * FROM webhook_endpoints WHERE user_id = ? ORDER BY created_at ASC;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints WHERE id = ? AND user_id = ?;
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, endpoint_id, event, payload, next_attempt_at, created_at, updated_at)
+SELECT gen_random_uuid(), webhook_endpoints.id, sqlc.arg(event), sqlc.arg(payload), now(), now(), now()
+FROM webhook_endpoints
+WHERE webhook_endpoints.active AND EXISTS (
+	SELECT 1 FROM json_each(webhook_endpoints.events) WHERE json_each.value = sqlc.arg(event)
+);
+
+-- name: ClaimWebhookDeliveries :many
+-- SQLite has a single writer, so no rows need skipping
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until), updated_at = now()
+WHERE webhook_deliveries.id IN (
+	SELECT due.id FROM webhook_deliveries AS due
+	WHERE due.status = 'pending' AND due.next_attempt_at <= now()
+	ORDER BY due.next_attempt_at
+	LIMIT sqlc.arg(batch)
+)
+RETURNING *;
+
+-- name: MarkWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = sqlc.arg(status),
+	attempts = sqlc.arg(attempts),
+	next_attempt_at = sqlc.arg(next_attempt_at),
+	last_status_code = sqlc.arg(last_status_code),
+	last_error = sqlc.arg(last_error),
+	updated_at = now()
+WHERE id = sqlc.arg(id);
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries WHERE id = ?;
+
+-- name: ListWebhookDeliveriesByEndpoint :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = ?
+ORDER BY created_at DESC
+LIMIT ?;
+
+-- A pending delivery is due, backing off or being sent, and is left alone.
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = now(), updated_at = now()
+WHERE id = ? AND status <> 'pending'
+RETURNING *;
@@ -0,0 +1,102 @@
+-- +goose Up
+-- The SQLite schema starts at the Postgres schema of 009_webhooks.sql.
+-- UUIDs are stored as text, timestamps as UTC text and booleans as 0 or 1.
+-- gen_random_uuid() and now() are registered by the store package.
+CREATE TABLE users (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	email TEXT NOT NULL,
+	hashed_password TEXT NOT NULL DEFAULT 'unset');
+
+CREATE TABLE chirps (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	body TEXT NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+CREATE TABLE webhook_events (
+	id TEXT PRIMARY KEY,
+	source TEXT NOT NULL,
+	event TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'received',
+	received_at TIMESTAMP NOT NULL,
+	processed_at TIMESTAMP);
+
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at);
+
+CREATE TABLE subscriptions (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL UNIQUE,
+	plan TEXT NOT NULL,
+	status TEXT NOT NULL,
+	current_period_start TIMESTAMP NOT NULL,
+	current_period_end TIMESTAMP NOT NULL,
+	grace_until TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+CREATE TABLE pinned_chirps (
+	user_id UUID NOT NULL,
+	chirp_id UUID NOT NULL,
+	pinned_at TIMESTAMP NOT NULL,
+
+	PRIMARY KEY (user_id, chirp_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE);
+
+-- events is a JSON array of event names
+CREATE TABLE webhook_endpoints (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	events TEXT NOT NULL,
+	active BOOLEAN NOT NULL DEFAULT true,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+CREATE TABLE webhook_deliveries (
+	id UUID PRIMARY KEY,
+	endpoint_id UUID NOT NULL,
+	event TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_status_code INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id) ON DELETE CASCADE);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
+DROP TABLE pinned_chirps;
+DROP TABLE subscriptions;
+DROP TABLE webhook_events;
+DROP TABLE refresh_tokens;
+DROP TABLE chirps;
+DROP TABLE users;
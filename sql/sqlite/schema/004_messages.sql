@@ -0,0 +1,49 @@
+-- +goose Up
+-- direct_key is the two members of a one-to-one conversation, so there's only
+-- one between them. Group conversations have none.
+CREATE TABLE conversations (
+	id UUID PRIMARY KEY,
+	direct_key TEXT UNIQUE,
+	created_by UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE);
+
+CREATE TABLE conversation_members (
+	conversation_id UUID NOT NULL,
+	user_id UUID NOT NULL,
+	joined_at TIMESTAMP NOT NULL,
+	last_read_at TIMESTAMP,
+
+	PRIMARY KEY (conversation_id, user_id),
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+CREATE INDEX conversation_members_user_id_idx ON conversation_members (user_id);
+
+CREATE TABLE messages (
+	id UUID PRIMARY KEY,
+	conversation_id UUID NOT NULL,
+	sender_id UUID NOT NULL,
+	body TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+	FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE);
+
+CREATE INDEX messages_conversation_id_created_at_idx ON messages (conversation_id, created_at DESC, id DESC);
+
+-- accept_from is who can start a conversation with the user, everyone or
+-- only the users they follow. Users without a row accept everyone.
+CREATE TABLE message_settings (
+	user_id UUID PRIMARY KEY,
+	accept_from TEXT NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+
+-- +goose Down
+DROP TABLE message_settings;
+DROP TABLE messages;
+DROP TABLE conversation_members;
+DROP TABLE conversations;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Filter rules added by the admins, checked along with the configured ones.
+CREATE TABLE filter_rules (
+	id UUID PRIMARY KEY,
+	kind TEXT NOT NULL,
+	pattern TEXT NOT NULL,
+	action TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+
+	CHECK (kind IN ('word', 'regex')),
+	CHECK (action IN ('mask', 'hold', 'reject')));
+
+-- A held chirp is waiting for a moderator and only its author can see it.
+ALTER TABLE chirps ADD COLUMN held BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN held;
+DROP TABLE filter_rules;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Images uploaded by users, kept in the blob store under media/<id>. An upload
+-- belongs to no chirp until it is attached to one.
+CREATE TABLE media (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL,
+	chirp_id UUID,
+	position INTEGER NOT NULL DEFAULT 0,
+	content_type TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE);
+
+CREATE INDEX media_chirp_id_idx ON media (chirp_id, position);
+
+-- +goose Down
+DROP TABLE media;
@@ -0,0 +1,7 @@
+// Package schema embeds the goose migrations of the SQLite backend.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS